@@ -31,7 +31,7 @@ package stompngo
 */
 func (c *Connection) Abort(h Headers) error {
 	c.log(ABORT, "start", h)
-	if !c.connected {
+	if !c.Connected() {
 		return ECONBAD
 	}
 	// We must have a transaction header here
@@ -42,7 +42,16 @@ func (c *Connection) Abort(h Headers) error {
 	if h.Value(HK_TRANSACTION) == "" {
 		return ETIDABTEMT
 	}
+	// Lost with a previous connection, already aborted, see OnTxAborted
+	if c.txAborted(h.Value(HK_TRANSACTION)) {
+		c.txEnded(h.Value(HK_TRANSACTION))
+		c.log(ABORT, "end aborted by reconnect", h)
+		return nil
+	}
 	e := c.transmitCommon(ABORT, h) // transmitCommon Clones() the headers
+	if e == nil {
+		c.txEnded(h.Value(HK_TRANSACTION))
+	}
 	c.log(ABORT, "end", h)
 	return e
 }
@@ -28,6 +28,15 @@ package stompngo
 
 	For Stomp 1.2 Headers must contain a unique "id" header key.
 
+	The required headers are checked for the negotiated protocol level, and
+	must not be empty.  EREQMIDACK, EREQSUBACK, or EREQIDACK is returned,
+	and nothing is sent, if one is missing.
+
+	On a subscription in "client" ack mode an ACK is cumulative: it also
+	acknowledges every earlier MESSAGE delivered on that subscription.  In
+	"client-individual" mode it acknowledges only the one MESSAGE.
+	OutstandingAcks follows the same rules.
+
 	See the specifications at http://stomp.github.com/ for details.
 
 	Example:
@@ -40,33 +49,105 @@ package stompngo
 
 */
 func (c *Connection) Ack(h Headers) error {
-	c.log(ACK, "start", h, c.Protocol())
-	if !c.connected {
+	s := c.ackSubscription(h) // For logging
+	c.subLog(s, ACK, "start", h, c.Protocol())
+	if !c.Connected() {
 		return ECONBAD
 	}
-	e := checkHeaders(h, c.Protocol())
+	e := c.validateHeaders(h)
 	if e != nil {
 		return e
 	}
+	if e = checkAckHeaders(c.Protocol(), h, false); e != nil {
+		return e
+	}
+	ah, rid := c.ackReceiptHeaders(h)
+
+	e = c.transmitCommon(ACK, ah) // transmitCommon Clones() the headers
+	if e == nil {
+		c.clearAck(h)
+	} else if rid != "" {
+		c.removeReceipt(rid)
+	}
+	c.subLog(s, ACK, "end", h, c.Protocol())
+	return e
+}
+
+/*
+	Headers required by ACK and NACK at each protocol level, with the errors
+	returned when one is missing or empty.  NACK is not valid at 1.0.
+*/
+var ackRequired = map[string][]struct {
+	k      string // Header key
+	ea, en Error  // ACK, NACK error
+}{
+	SPL_10: {{HK_MESSAGE_ID, EREQMIDACK, ""}},
+	SPL_11: {{HK_SUBSCRIPTION, EREQSUBACK, EREQSUBNAK},
+		{HK_MESSAGE_ID, EREQMIDACK, EREQMIDNAK}},
+	SPL_12: {{HK_ID, EREQIDACK, EREQIDNAK}},
+}
+
+/*
+	Check the headers required by ACK, or NACK, at protocol level p, before
+	anything is sent.  Headers for a different level, e.g. a 1.1 style
+	"message-id" and "subscription" on a 1.2 connection, fail here rather
+	than being silently ignored by the broker.
+*/
+func checkAckHeaders(p string, h Headers, nack bool) error {
+	for _, r := range ackRequired[p] {
+		if v, ok := h.Contains(r.k); !ok || v == "" {
+			if nack {
+				return r.en
+			}
+			return r.ea
+		}
+	}
+	return nil
+}
+
+/*
+	AckMessage ACKs a received MESSAGE, building the required headers from
+	the MESSAGE for the current protocol level.
+
+	For Stomp 1.2 the MESSAGE "ack" header value is used as the ACK "id", and
+	EREQIDACK is returned if the MESSAGE has no, or an empty, "ack" header.
+
+	For Stomp 1.1 the "message-id" and "subscription" headers are used.
+
+	For Stomp 1.0 the "message-id" header is used.
+
+	Example:
+		md := <-sc
+		e := c.AckMessage(md.Message)
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func (c *Connection) AckMessage(m Message) error {
+	h, e := c.ackHeaders(m, EREQIDACK)
+	if e != nil {
+		return e
+	}
+	return c.Ack(h)
+}
+
+/*
+	Build ACK / NACK headers from a received MESSAGE.  At 1.2 a missing or
+	empty "ack" header returns eid.
+*/
+func (c *Connection) ackHeaders(m Message, eid error) (Headers, error) {
 	switch c.Protocol() {
 	case SPL_12:
-		if _, ok := h.Contains(HK_ID); !ok {
-			return EREQIDACK
+		id, ok := m.Headers.Contains(HK_ACK)
+		if !ok || id == "" {
+			return nil, eid
 		}
+		return Headers{HK_ID, c.decodedValue(id)}, nil
 	case SPL_11:
-		if _, ok := h.Contains(HK_SUBSCRIPTION); !ok {
-			return EREQSUBACK
-		}
-		if _, ok := h.Contains(HK_MESSAGE_ID); !ok {
-			return EREQMIDACK
-		}
+		return Headers{HK_MESSAGE_ID, c.decodedValue(m.Headers.Value(HK_MESSAGE_ID)),
+			HK_SUBSCRIPTION, c.decodedValue(m.Headers.Value(HK_SUBSCRIPTION))}, nil
 	default: // SPL_10
-		if _, ok := h.Contains(HK_MESSAGE_ID); !ok {
-			return EREQMIDACK
-		}
+		return Headers{HK_MESSAGE_ID,
+			c.decodedValue(m.Headers.Value(HK_MESSAGE_ID))}, nil
 	}
-
-	e = c.transmitCommon(ACK, h) // transmitCommon Clones() the headers
-	c.log(ACK, "end", h, c.Protocol())
-	return e
 }
@@ -255,3 +255,88 @@ func TestAckDiffConn(t *testing.T) {
 		_ = closeConn(t, n)
 	}
 }
+
+/*
+	Test AckMessage headers by protocol level.
+*/
+func TestAckMessage(t *testing.T) {
+	for ti, tv := range ackMsgList {
+		nc, fb := openFakeConn(t, tv.resp)
+		c, e := Connect(nc, tv.ch)
+		if e != nil {
+			t.Fatalf("TestAckMessage[%d] CONNECT expected nil, got %v\n", ti, e)
+		}
+		_ = fb.nextFrame(t) // CONNECT
+		e = c.AckMessage(Message{MESSAGE, tv.mh, []byte{}})
+		if e != tv.exe {
+			t.Fatalf("TestAckMessage[%d] proto:%s expected:%v got:%v\n",
+				ti, tv.proto, tv.exe, e)
+		}
+		if e == nil {
+			f := fb.nextFrame(t)
+			if f.Command != ACK {
+				t.Fatalf("TestAckMessage[%d] proto:%s expected:%v got:%v\n",
+					ti, tv.proto, ACK, f.Command)
+			}
+			for i := 0; i < len(tv.want); i += 2 {
+				if !f.Headers.ContainsKV(tv.want[i], tv.want[i+1]) {
+					t.Fatalf("TestAckMessage[%d] proto:%s expected:%v got:%v\n",
+						ti, tv.proto, tv.want, f.Headers)
+				}
+			}
+			for _, k := range []string{HK_ID, HK_MESSAGE_ID, HK_SUBSCRIPTION} {
+				if _, ok := f.Headers.Contains(k); ok && tv.want.Index(k) < 0 {
+					t.Fatalf("TestAckMessage[%d] proto:%s unexpected header:%s\n",
+						ti, tv.proto, k)
+				}
+			}
+		}
+		e = c.Disconnect(empty_headers)
+		checkDisconnectError(t, e)
+		fb.close()
+	}
+}
+
+/*
+	Test Ack and Nack: headers required for the negotiated protocol level
+	are checked before anything is sent.
+*/
+func TestAckVersionHeaders(t *testing.T) {
+	for ti, tv := range ackVersionList {
+		nc, fb := openFakeConn(t, tv.resp)
+		c, e := Connect(nc, tv.ch)
+		if e != nil {
+			t.Fatalf("TestAckVersionHeaders[%d] CONNECT expected nil, got %v\n", ti, e)
+		}
+		_ = fb.nextFrame(t) // CONNECT
+		if tv.nack {
+			e = c.Nack(tv.h)
+		} else {
+			e = c.Ack(tv.h)
+		}
+		if e != tv.want {
+			t.Fatalf("TestAckVersionHeaders[%d] proto:%s nack:%v expected:%v got:%v\n",
+				ti, tv.proto, tv.nack, tv.want, e)
+		}
+		// Nothing was sent, the next frame is a valid ACK
+		if e = c.Ack(ackVersionGood[tv.proto]); e != nil {
+			t.Fatalf("TestAckVersionHeaders[%d] proto:%s expected nil, got:%v\n",
+				ti, tv.proto, e)
+		}
+		f := fb.nextFrame(t)
+		if f.Command != ACK {
+			t.Fatalf("TestAckVersionHeaders[%d] proto:%s expected:%v got:%v\n",
+				ti, tv.proto, ACK, f.Command)
+		}
+		w := ackVersionGood[tv.proto]
+		for i := 0; i < len(w); i += 2 {
+			if !f.Headers.ContainsKV(w[i], w[i+1]) {
+				t.Fatalf("TestAckVersionHeaders[%d] proto:%s expected:%v got:%v\n",
+					ti, tv.proto, w, f.Headers)
+			}
+		}
+		e = c.Disconnect(empty_headers)
+		checkDisconnectError(t, e)
+		fb.close()
+	}
+}
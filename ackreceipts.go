@@ -0,0 +1,127 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+/*
+	SubscribeWithAckReceipts subscribes as Subscribe does, and requests a
+	broker RECEIPT for every ACK sent for the subscription, e.g. by Ack,
+	AckMessage, or DeadLetter.  Each RECEIPT confirms the broker processed
+	the ACK, and invokes any OnAckConfirmed callback with the message-id of
+	the MESSAGE acknowledged.  The "sng_ackreceipts" header is set to "true".
+
+	Only ACKs for deliveries on "client" and "client-individual"
+	subscriptions are tracked, an "auto" subscription sends no ACKs.  An ACK
+	that already has a "receipt" header, e.g. one sent by AckReceipt, keeps
+	it, and is confirmed when that RECEIPT arrives.
+
+	Every ACK costs a full broker round trip, and a pending receipt entry
+	until the RECEIPT arrives (see PendingReceipts, these entries are not
+	subject to SetMaxPendingReceipts).  Brokers typically process a receipt
+	request synchronously, so expect noticeably lower ACK throughput than
+	for a plain subscription.  Use this for auditing, not for bulk
+	consumption.
+
+	Example:
+		c.OnAckConfirmed(func(mid string) {
+			audit.Printf("ACK confirmed: %s\n", mid)
+		})
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/orders",
+			stompngo.HK_ACK, stompngo.AckModeClientIndividual}
+		s, e := c.SubscribeWithAckReceipts(h)
+		if e != nil {
+			// Do something sane ...
+		}
+		md := <-s
+		e = c.AckMessage(md.Message)
+*/
+func (c *Connection) SubscribeWithAckReceipts(h Headers) (<-chan MessageData, error) {
+	if h == nil {
+		return nil, EHDRNIL
+	}
+	ch := h.Clone()
+	for ch.Index(StompPlusAckReceipts) >= 0 {
+		ch = ch.Delete(StompPlusAckReceipts)
+	}
+	return subChan(c.subscribe(ch.Add(StompPlusAckReceipts, "true"), 0))
+}
+
+/*
+	OnAckConfirmed sets a callback function invoked by the connection reader
+	each time the broker RECEIPT for an ACK on a subscription from
+	SubscribeWithAckReceipts arrives.  The messageId parameter is the
+	message-id of the MESSAGE acknowledged.  The callback must not block.
+
+	Set to "nil" to disable.
+*/
+func (c *Connection) OnAckConfirmed(f func(messageId string)) {
+	c.cbLock.Lock()
+	c.ackch = f
+	c.cbLock.Unlock()
+}
+
+/*
+	Get the ACK confirmed callback.
+*/
+func (c *Connection) ackConfirmedHandler() func(messageId string) {
+	c.cbLock.RLock()
+	defer c.cbLock.RUnlock()
+	return c.ackch
+}
+
+/*
+	Headers for an ACK, with a receipt request when the ACK is for a
+	delivery on an ack receipt subscription.  Returns the headers to send
+	and the receipt id registered, "" if none.
+*/
+func (c *Connection) ackReceiptHeaders(h Headers) (Headers, string) {
+	c.atLock.Lock()
+	ap, ok := c.atmp[c.ackKey(h)]
+	c.atLock.Unlock()
+	if !ok {
+		return h, ""
+	}
+	c.subsLock.RLock()
+	ar := ap.s.ackr
+	c.subsLock.RUnlock()
+	if !ar {
+		return h, ""
+	}
+	mid := ap.mid
+	cf := func() {
+		if f := c.ackConfirmedHandler(); f != nil {
+			f(mid)
+		}
+	}
+	if id, ok := h.Contains(HK_RECEIPT); ok {
+		// Already waited for by the caller
+		c.rcptLock.Lock()
+		if rw, ok := c.rcpts[id]; ok {
+			rw.cf = cf
+		}
+		c.rcptLock.Unlock()
+		return h, ""
+	}
+	id := c.newId(IdReceipt)
+	if _, e := c.registerReceipt(id, false, false); e != nil {
+		return h, "" // Duplicate id, sent without a receipt request
+	}
+	c.rcptLock.Lock()
+	c.rcpts[id].cf = cf
+	c.rcpts[id].drp = true
+	c.rcptLock.Unlock()
+	return h.Clone().Add(HK_RECEIPT, id), id
+}
@@ -0,0 +1,119 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+/*
+	AckReceipts Test: every ACK on the subscription requests a receipt, and
+	each RECEIPT is reported with the message-id.
+*/
+func TestAckReceiptsConfirmed(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestAckReceiptsConfirmed Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	cc := make(chan string, len(ackReceiptIds))
+	c.OnAckConfirmed(func(mid string) { cc <- mid })
+	sc, e := c.SubscribeWithAckReceipts(Headers{HK_DESTINATION, "/queue/audit",
+		HK_ID, "ar1", HK_ACK, AckModeClientIndividual})
+	if e != nil {
+		t.Fatalf("TestAckReceiptsConfirmed Expected nil, got <%v>\n", e)
+	}
+	if f := fb.nextFrame(t); !f.Headers.ContainsKV(StompPlusAckReceipts, "true") {
+		t.Fatalf("TestAckReceiptsConfirmed Expected <%s:true>, got <%v>\n",
+			StompPlusAckReceipts, f.Headers)
+	}
+	go func() {
+		for i, mid := range ackReceiptIds {
+			_ = fb.write(fmt.Sprintf("MESSAGE\ndestination:/queue/audit\n"+
+				"subscription:ar1\nmessage-id:%s\nack:a%d\n\naudit\x00", mid, i))
+		}
+	}()
+	for i, mid := range ackReceiptIds {
+		md := <-sc
+		if i == 0 {
+			e = c.AckMessage(md.Message)
+		} else { // A caller receipt is confirmed also
+			_, e = c.AckReceipt(Headers{HK_ID, md.Message.Headers.Value(HK_ACK)},
+				5*time.Second)
+		}
+		if e != nil {
+			t.Fatalf("TestAckReceiptsConfirmed Expected nil, got <%v>\n", e)
+		}
+		if f := fb.nextFrame(t); f.Command != ACK || f.Headers.Value(HK_RECEIPT) == "" {
+			t.Fatalf("TestAckReceiptsConfirmed Expected ACK with receipt, got <%v>\n", f)
+		}
+		select {
+		case cm := <-cc:
+			if cm != mid {
+				t.Fatalf("TestAckReceiptsConfirmed Expected <%s>, got <%s>\n", mid, cm)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestAckReceiptsConfirmed <%s> not confirmed\n", mid)
+		}
+	}
+	if n := c.PendingReceipts(); n != 0 {
+		t.Fatalf("TestAckReceiptsConfirmed Expected 0 pending, got <%d>\n", n)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	AckReceipts Test: ACKs on a plain subscription request no receipt.
+*/
+func TestAckReceiptsPlain(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestAckReceiptsPlain Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	c.OnAckConfirmed(func(mid string) {
+		t.Errorf("TestAckReceiptsPlain Unexpected confirmation <%s>\n", mid)
+	})
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/audit",
+		HK_ID, "ar2", HK_ACK, AckModeClientIndividual})
+	if e != nil {
+		t.Fatalf("TestAckReceiptsPlain Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // SUBSCRIBE
+	go func() {
+		_ = fb.write("MESSAGE\ndestination:/queue/audit\nsubscription:ar2\n" +
+			"message-id:p1\nack:p1\n\nplain\x00")
+	}()
+	md := <-sc
+	if e = c.AckMessage(md.Message); e != nil {
+		t.Fatalf("TestAckReceiptsPlain Expected nil, got <%v>\n", e)
+	}
+	if f := fb.nextFrame(t); f.Headers.Index(HK_RECEIPT) >= 0 {
+		t.Fatalf("TestAckReceiptsPlain Expected no receipt, got <%v>\n", f.Headers)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
@@ -0,0 +1,257 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+/*
+	Outstanding ack data.
+*/
+type ackPending struct {
+	s   *subscription // Subscription
+	nh  Headers       // NACK headers
+	mid string        // MESSAGE message-id
+	dt  int64         // Delivery time, monotonic ns
+	seq uint64        // Delivery sequence
+	cum bool          // Cumulative (client) ack mode
+}
+
+/*
+	SubscribeWithAckTimeout subscribes as Subscribe does, and additionally
+	NACKs any delivered MESSAGE that has not been ACKed or NACKed by the
+	application within the duration d.  This causes the broker to redeliver
+	stuck or poison messages.
+
+	Headers MUST specify an "ack" mode of "client" or "client-individual",
+	otherwise EATMOAM is returned.  The duration d MUST be positive,
+	otherwise EATMODUR is returned.  Disallowed for an established STOMP 1.0
+	connection, and EBADVERNAK is returned.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/myqueue",
+			stompngo.HK_ACK, stompngo.AckModeClientIndividual}
+		s, e := c.SubscribeWithAckTimeout(h, 30*time.Second)
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func (c *Connection) SubscribeWithAckTimeout(h Headers,
+	d time.Duration) (<-chan MessageData, error) {
+	if !c.Connected() {
+		return nil, ECONBAD
+	}
+	if c.Protocol() == SPL_10 {
+		return nil, EBADVERNAK
+	}
+	if h == nil {
+		return nil, EHDRNIL
+	}
+	if d <= 0 {
+		return nil, EATMODUR
+	}
+	switch h.Value(HK_ACK) {
+	case AckModeClient, AckModeClientIndividual:
+	default:
+		return nil, EATMOAM
+	}
+	return subChan(c.subscribe(h, d))
+}
+
+/*
+	Ack tracking key for ACK / NACK headers.
+*/
+func (c *Connection) ackKey(h Headers) string {
+	switch c.Protocol() {
+	case SPL_12:
+		return h.Value(HK_ID)
+	case SPL_11:
+		return h.Value(HK_SUBSCRIPTION) + "\n" + h.Value(HK_MESSAGE_ID)
+	default: // SPL_10, ACK has no subscription header
+		return h.Value(HK_MESSAGE_ID)
+	}
+}
+
+/*
+	The subscription an ACK or NACK is for, nil if not known.  Outstanding
+	acks are checked first, and then any "subscription" header.
+*/
+func (c *Connection) ackSubscription(h Headers) *subscription {
+	c.atLock.Lock()
+	ap, ok := c.atmp[c.ackKey(h)]
+	c.atLock.Unlock()
+	if ok {
+		return ap.s
+	}
+	sid, ok := h.Contains(HK_SUBSCRIPTION)
+	if !ok {
+		return nil
+	}
+	c.subsLock.RLock()
+	defer c.subsLock.RUnlock()
+	return c.subs[sid]
+}
+
+/*
+	Start ack timeout processing for a new subscription.
+*/
+func (c *Connection) startAckTimeout(s *subscription, d time.Duration) {
+	c.subsLock.Lock()
+	s.atmo = d
+	c.subsLock.Unlock()
+	go c.ackTimer(s, d)
+}
+
+/*
+	Track a delivered MESSAGE on a client or client-individual subscription,
+	reader only.  The caller holds the subscription delivery lock.
+*/
+func (c *Connection) trackAck(s *subscription, m Message) {
+	if s.am != AckModeClient && s.am != AckModeClientIndividual {
+		return
+	}
+	ap := &ackPending{s: s, dt: c.monoNanos(),
+		cum: s.am == AckModeClient,
+		mid: c.decodedValue(m.Headers.Value(HK_MESSAGE_ID))}
+	var k string
+	if c.Protocol() == SPL_12 {
+		k = c.decodedValue(m.Headers.Value(HK_ACK))
+		ap.nh = Headers{HK_ID, k}
+	} else {
+		ap.nh = Headers{HK_MESSAGE_ID, c.decodedValue(m.Headers.Value(HK_MESSAGE_ID)),
+			HK_SUBSCRIPTION, s.id}
+		k = c.ackKey(ap.nh)
+	}
+	c.atLock.Lock()
+	if c.atmp == nil {
+		c.atmp = make(map[string]*ackPending)
+	}
+	c.atsq++
+	ap.seq = c.atsq
+	if _, ok := c.atmp[k]; !ok { // A redelivery replaces, and is not counted
+		atomic.AddInt64(&s.oac, 1)
+		atomic.AddInt64(&c.oact, 1)
+	}
+	c.atmp[k] = ap
+	c.atLock.Unlock()
+}
+
+/*
+	Stop tracking one delivery.  The caller holds the ack timeout lock.
+*/
+func (c *Connection) dropAck(k string, ap *ackPending) {
+	delete(c.atmp, k)
+	atomic.AddInt64(&ap.s.oac, -1)
+	atomic.AddInt64(&c.oact, -1)
+}
+
+/*
+	OutstandingAcks returns the number of MESSAGE frames delivered to the
+	subscription with id subId and not yet ACKed or NACKed.  In client ack
+	mode an ACK or NACK also covers earlier deliveries.  Subscriptions in
+	auto ack mode, and unknown ids, report 0.
+
+	Example:
+		if c.OutstandingAcks("sub1") > 1000 {
+			// Consumer is lagging ...
+		}
+*/
+func (c *Connection) OutstandingAcks(subId string) int {
+	c.subsLock.RLock()
+	ps, ok := c.subs[subId]
+	c.subsLock.RUnlock()
+	if !ok {
+		return 0
+	}
+	return int(atomic.LoadInt64(&ps.oac))
+}
+
+/*
+	OutstandingAcksTotal returns OutstandingAcks summed across all
+	subscriptions.
+*/
+func (c *Connection) OutstandingAcksTotal() int {
+	return int(atomic.LoadInt64(&c.oact))
+}
+
+/*
+	Stop tracking after a successful ACK or NACK.  In client ack mode all
+	earlier deliveries on the same subscription are also covered.
+*/
+func (c *Connection) clearAck(h Headers) {
+	k := c.ackKey(h)
+	c.atLock.Lock()
+	defer c.atLock.Unlock()
+	ap, ok := c.atmp[k]
+	if !ok {
+		return
+	}
+	c.dropAck(k, ap)
+	if !ap.cum {
+		return
+	}
+	for ok, op := range c.atmp {
+		if op.s == ap.s && op.seq < ap.seq {
+			c.dropAck(ok, op)
+		}
+	}
+}
+
+/*
+	The ack timer for a single subscription.
+*/
+func (c *Connection) ackTimer(s *subscription, d time.Duration) {
+	c.checkLoop(d, nil, func(ct int64) bool {
+		c.subsLock.RLock()
+		cs, ok := c.subs[s.id]
+		live := ok && cs == s && !s.cs
+		c.subsLock.RUnlock()
+		if !live {
+			c.expireAcks(s, ct, -1)
+			return true
+		}
+		for _, nh := range c.expireAcks(s, ct, d) {
+			c.subLog(s, "Ack Timeout, NACK", s.id, nh)
+			_ = c.Nack(nh)
+		}
+		return false
+	})
+	c.subLog(s, "Ack Timer Ends", s.id, time.Now())
+}
+
+/*
+	Remove and return the NACK headers for tracked deliveries older than d.
+	A negative d removes all deliveries for the subscription.
+*/
+func (c *Connection) expireAcks(s *subscription, ct int64,
+	d time.Duration) []Headers {
+	var r []Headers
+	c.atLock.Lock()
+	defer c.atLock.Unlock()
+	for k, ap := range c.atmp {
+		if ap.s != s {
+			continue
+		}
+		if d < 0 || ct-ap.dt > int64(d) {
+			r = append(r, ap.nh)
+			c.dropAck(k, ap)
+		}
+	}
+	return r
+}
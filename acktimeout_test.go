@@ -0,0 +1,215 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"testing"
+	"time"
+)
+
+/*
+	Ack Timeout Test: unacked messages are NACKed, acked messages are not.
+*/
+func TestAckTimeoutNack(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestAckTimeoutNack Expected nil, got <%v>\n", e)
+	}
+	c.SetSubChanCap(4)
+	sh := Headers{HK_DESTINATION, "/queue/atmo", HK_ID, "atmo1",
+		HK_ACK, AckModeClientIndividual}
+	sc, e := c.SubscribeWithAckTimeout(sh, 100*time.Millisecond)
+	if e != nil {
+		t.Fatalf("TestAckTimeoutNack Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	_ = fb.nextFrame(t) // SUBSCRIBE
+	_ = fb.write(fakeAckTmoMsg1)
+	_ = fb.write(fakeAckTmoMsg2)
+	_ = <-sc
+	md := <-sc
+	if e = c.Ack(Headers{HK_ID, md.Message.Headers.Value(HK_ACK)}); e != nil {
+		t.Fatalf("TestAckTimeoutNack Expected nil, got <%v>\n", e)
+	}
+	if f := fb.nextFrame(t); f.Command != ACK || f.Headers.Value(HK_ID) != "a2" {
+		t.Fatalf("TestAckTimeoutNack Expected <%v a2>, got <%v %v>\n", ACK,
+			f.Command, f.Headers)
+	}
+	if f := fb.nextFrame(t); f.Command != NACK || f.Headers.Value(HK_ID) != "a1" {
+		t.Fatalf("TestAckTimeoutNack Expected <%v a1>, got <%v %v>\n", NACK,
+			f.Command, f.Headers)
+	}
+	time.Sleep(250 * time.Millisecond) // No further NACK for a2
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	if f := fb.nextFrame(t); f.Command != DISCONNECT {
+		t.Fatalf("TestAckTimeoutNack Expected <%v>, got <%v %v>\n", DISCONNECT,
+			f.Command, f.Headers)
+	}
+	fb.close()
+}
+
+/*
+	Ack Timeout Test: argument checks.
+*/
+func TestAckTimeoutChecks(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestAckTimeoutChecks Expected nil, got <%v>\n", e)
+	}
+	sh := Headers{HK_DESTINATION, "/queue/atmo", HK_ACK, AckModeAuto}
+	if _, e = c.SubscribeWithAckTimeout(sh, time.Second); e != EATMOAM {
+		t.Fatalf("TestAckTimeoutChecks Expected <%v>, got <%v>\n", EATMOAM, e)
+	}
+	sh = Headers{HK_DESTINATION, "/queue/atmo", HK_ACK, AckModeClient}
+	if _, e = c.SubscribeWithAckTimeout(sh, -time.Second); e != EATMODUR {
+		t.Fatalf("TestAckTimeoutChecks Expected <%v>, got <%v>\n", EATMODUR, e)
+	}
+	if _, e = c.SubscribeWithAckTimeout(sh, time.Nanosecond); e != nil {
+		t.Fatalf("TestAckTimeoutChecks Expected nil, got <%v>\n", e)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+	//
+	nc, fb = openFakeConn(t, fakeConnected10)
+	c, e = Connect(nc, Headers{HK_HOST, "localhost"})
+	if e != nil {
+		t.Fatalf("TestAckTimeoutChecks Expected nil, got <%v>\n", e)
+	}
+	sh = Headers{HK_DESTINATION, "/queue/atmo", HK_ACK, AckModeClient}
+	if _, e = c.SubscribeWithAckTimeout(sh, time.Second); e != EBADVERNAK {
+		t.Fatalf("TestAckTimeoutChecks Expected <%v>, got <%v>\n", EBADVERNAK, e)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
+
+/*
+	Ack Timeout Test: outstanding ack counts, per subscription and in total.
+*/
+func TestAckTimeoutOutstanding(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestAckTimeoutOutstanding Expected nil, got <%v>\n", e)
+	}
+	c.SetSubChanCap(4)
+	si, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/atmo", HK_ID, "atmo1",
+		HK_ACK, AckModeClientIndividual})
+	if e != nil {
+		t.Fatalf("TestAckTimeoutOutstanding Expected nil, got <%v>\n", e)
+	}
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/cum", HK_ID, "cum1",
+		HK_ACK, AckModeClient})
+	if e != nil {
+		t.Fatalf("TestAckTimeoutOutstanding Expected nil, got <%v>\n", e)
+	}
+	checkOutstanding := func(w1, wc int) {
+		if n := c.OutstandingAcks("atmo1"); n != w1 {
+			t.Fatalf("TestAckTimeoutOutstanding atmo1 Expected <%d>, got <%d>\n", w1, n)
+		}
+		if n := c.OutstandingAcks("cum1"); n != wc {
+			t.Fatalf("TestAckTimeoutOutstanding cum1 Expected <%d>, got <%d>\n", wc, n)
+		}
+		if n := c.OutstandingAcksTotal(); n != w1+wc {
+			t.Fatalf("TestAckTimeoutOutstanding total Expected <%d>, got <%d>\n", w1+wc, n)
+		}
+	}
+	_ = fb.write(fakeAckTmoMsg1)
+	_ = fb.write(fakeAckTmoMsg2)
+	var mds []MessageData
+	for _, m := range ackOutstandingMsgs {
+		_ = fb.write(m)
+		mds = append(mds, <-sc)
+	}
+	_, _ = <-si, <-si
+	checkOutstanding(2, 3)
+	if e = c.Ack(Headers{HK_ID, "a2"}); e != nil {
+		t.Fatalf("TestAckTimeoutOutstanding Expected nil, got <%v>\n", e)
+	}
+	checkOutstanding(1, 3)
+	if e = c.Nack(Headers{HK_ID, "a1"}); e != nil {
+		t.Fatalf("TestAckTimeoutOutstanding Expected nil, got <%v>\n", e)
+	}
+	checkOutstanding(0, 3)
+	if e = c.AckMessage(mds[1].Message); e != nil { // Cumulative
+		t.Fatalf("TestAckTimeoutOutstanding Expected nil, got <%v>\n", e)
+	}
+	checkOutstanding(0, 1)
+	e = c.Unsubscribe(Headers{HK_DESTINATION, "/queue/cum", HK_ID, "cum1"})
+	if e != nil {
+		t.Fatalf("TestAckTimeoutOutstanding Expected nil, got <%v>\n", e)
+	}
+	checkOutstanding(0, 0)
+	if n := c.OutstandingAcks("unknown"); n != 0 {
+		t.Fatalf("TestAckTimeoutOutstanding Expected <0>, got <%d>\n", n)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Ack Timeout Test: outstanding acks at STOMP 1.1, where the ack key is the
+	subscription and message-id.  An ACK is cumulative in client mode only.
+*/
+func TestAckTimeoutOutstanding11(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected11)
+	c, e := Connect(nc, Headers{HK_ACCEPT_VERSION, SPL_11, HK_HOST, "localhost"})
+	if e != nil {
+		t.Fatalf("TestAckTimeoutOutstanding11 Expected nil, got <%v>\n", e)
+	}
+	c.SetSubChanCap(4)
+	for id, am := range ackOutstandingModes {
+		sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/" + id, HK_ID, id,
+			HK_ACK, am})
+		if e != nil {
+			t.Fatalf("TestAckTimeoutOutstanding11 Expected nil, got <%v>\n", e)
+		}
+		var mds []MessageData
+		for _, mid := range []string{"m1", "m2", "m3"} {
+			_ = fb.write(MESSAGE + "\ndestination:/queue/" + id + "\nsubscription:" +
+				id + "\nmessage-id:" + mid + "\n\n" + mid + "\x00")
+			mds = append(mds, <-sc)
+		}
+		if n := c.OutstandingAcks(id); n != 3 {
+			t.Fatalf("TestAckTimeoutOutstanding11 %s Expected <3>, got <%d>\n", id, n)
+		}
+		if e = c.AckMessage(mds[1].Message); e != nil {
+			t.Fatalf("TestAckTimeoutOutstanding11 Expected nil, got <%v>\n", e)
+		}
+		w := 2
+		if am == AckModeClient {
+			w = 1
+		}
+		if n := c.OutstandingAcks(id); n != w {
+			t.Fatalf("TestAckTimeoutOutstanding11 %s Expected <%d>, got <%d>\n", id, w, n)
+		}
+	}
+	if n := c.OutstandingAcksTotal(); n != 3 {
+		t.Fatalf("TestAckTimeoutOutstanding11 total Expected <3>, got <%d>\n", n)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
@@ -31,7 +31,7 @@ package stompngo
 */
 func (c *Connection) Begin(h Headers) error {
 	c.log(BEGIN, "start", h)
-	if !c.connected {
+	if !c.Connected() {
 		return ECONBAD
 	}
 	// We must have a transaction header here
@@ -43,6 +43,36 @@ func (c *Connection) Begin(h Headers) error {
 		return ETIDBEGEMT
 	}
 	e := c.transmitCommon(BEGIN, h) // transmitCommon Clones() the headers
+	if e == nil {
+		c.txBegun(h)
+	}
 	c.log(BEGIN, "end", h)
 	return e
 }
+
+/*
+	BeginTx begins a STOMP transaction as Begin does, with a generated
+	transaction id (see SetIdGenerator), which is returned for use with
+	SendBytesTx, Commit, and Abort.  Any "transaction" header in h is
+	replaced.
+
+	Example:
+		tx, e := c.BeginTx(stompngo.Headers{})
+		if e != nil {
+			// Do something sane ...
+		}
+		e = c.SendBytesTx(h, []byte("My message"), tx)
+		// ...
+		e = c.Commit(stompngo.Headers{stompngo.HK_TRANSACTION, tx})
+*/
+func (c *Connection) BeginTx(h Headers) (string, error) {
+	ch := h.Clone()
+	for ch.Index(HK_TRANSACTION) >= 0 {
+		ch = ch.Delete(HK_TRANSACTION)
+	}
+	tx := c.newId(IdTransaction)
+	if e := c.Begin(ch.Add(HK_TRANSACTION, tx)); e != nil {
+		return "", e
+	}
+	return tx, nil
+}
@@ -0,0 +1,162 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strconv"
+)
+
+/*
+	BodyCodec compresses and decompresses message bodies.  Encoding is the
+	"content-encoding" header value that marks a body encoded by the codec,
+	e.g. "gzip".
+*/
+type BodyCodec interface {
+	Encoding() string
+	Encode(b []byte) ([]byte, error)
+	Decode(b []byte) ([]byte, error)
+}
+
+/*
+	GzipBodyCodec is a BodyCodec using gzip, with the "gzip" encoding.
+*/
+var GzipBodyCodec BodyCodec = gzipBodyCodec{}
+
+type gzipBodyCodec struct{}
+
+func (gzipBodyCodec) Encoding() string {
+	return "gzip"
+}
+
+func (gzipBodyCodec) Encode(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, e := w.Write(b); e != nil {
+		return nil, e
+	}
+	if e := w.Close(); e != nil {
+		return nil, e
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipBodyCodec) Decode(b []byte) ([]byte, error) {
+	r, e := gzip.NewReader(bytes.NewReader(b))
+	if e != nil {
+		return nil, e
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+/*
+	WithBodyCodec sets a BodyCodec for the connection.  SEND bodies of at
+	least min bytes are encoded, and a "content-encoding" header is added.
+	A negative min means bodies are only encoded on request.  Received
+	MESSAGE bodies with a "content-encoding" header matching the codec are
+	always decoded, whatever min is.
+
+	The choice can be made per send with the "content-encoding" header.  A
+	value matching the codec encoding, e.g. "gzip", encodes the body
+	whatever its size.  A value of "identity" sends the body as is, e.g. for
+	a payload that is already compressed, and the header is removed.  Any
+	other value is sent unchanged, and the body is not encoded.
+
+	The "content-length" header, if sent, is the encoded length.  A body that
+	can not be decoded is delivered as received, with the "content-encoding"
+	header still present.
+
+	Example:
+		c, e := stompngo.Connect(n, h,
+			stompngo.WithBodyCodec(stompngo.GzipBodyCodec, 16*1024))
+		if e != nil {
+			// Do something sane ...
+		}
+		// Always compress this one
+		e = c.SendBytes(stompngo.Headers{stompngo.HK_DESTINATION, "/queue/a",
+			stompngo.HK_CONTENT_ENCODING, "gzip"}, small)
+*/
+func WithBodyCodec(bc BodyCodec, min int) ConnectOption {
+	return func(o *connectOptions) {
+		o.bcod = bc
+		o.bcmn = min
+	}
+}
+
+/*
+	Encode a SEND body if required.  The headers are a private copy.
+*/
+func (c *Connection) encodeBody(f *Frame) error {
+	if c.copts == nil || c.copts.bcod == nil {
+		return nil
+	}
+	bc := c.copts.bcod
+	ce, ok := f.Headers.Contains(HK_CONTENT_ENCODING)
+	switch {
+	case !ok: // Connection default
+		if c.copts.bcmn < 0 || len(f.Body) < c.copts.bcmn {
+			return nil
+		}
+	case ce == ContentEncodingIdentity:
+		f.Headers = f.Headers.Delete(HK_CONTENT_ENCODING)
+		return nil
+	case ce != bc.Encoding():
+		return nil
+	}
+	b, e := bc.Encode(f.Body)
+	if e != nil {
+		return e
+	}
+	f.Body = b
+	if !ok {
+		f.Headers = f.Headers.Add(HK_CONTENT_ENCODING, bc.Encoding())
+	}
+	if f.Headers.Index(HK_CONTENT_LENGTH) >= 0 {
+		f.Headers = f.Headers.Delete(HK_CONTENT_LENGTH).Add(HK_CONTENT_LENGTH,
+			strconv.Itoa(len(b)))
+	}
+	return nil
+}
+
+/*
+	Decode a received MESSAGE body if it was encoded by the connection codec.
+	The "content-encoding" header is removed, and any "content-length" is
+	updated to the decoded length.
+*/
+func (c *Connection) decodeBody(f *Frame) {
+	if c.copts == nil || c.copts.bcod == nil {
+		return
+	}
+	bc := c.copts.bcod
+	if ce, ok := f.Headers.Contains(HK_CONTENT_ENCODING); !ok || ce != bc.Encoding() {
+		return
+	}
+	b, e := bc.Decode(f.Body)
+	if e != nil {
+		c.log("RDR_BODY_DECODE", f.Headers, e)
+		return
+	}
+	f.Body = b
+	f.Headers = f.Headers.Delete(HK_CONTENT_ENCODING)
+	if f.Headers.Index(HK_CONTENT_LENGTH) >= 0 {
+		f.Headers = f.Headers.Delete(HK_CONTENT_LENGTH).Add(HK_CONTENT_LENGTH,
+			strconv.Itoa(len(b)))
+	}
+}
@@ -0,0 +1,115 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+)
+
+/*
+	Body Codec Test: SEND bodies are encoded by size or on request, and
+	"content-length" is the encoded length, for both Send and SendBytes.
+*/
+func TestBodyCodecSend(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers, WithBodyCodec(GzipBodyCodec, bodyCodecMin))
+	if e != nil {
+		t.Fatalf("TestBodyCodecSend Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	senders := map[string]func(h Headers, b []byte) error{
+		"SendBytes": c.SendBytes,
+		"Send":      func(h Headers, b []byte) error { return c.Send(h, string(b)) },
+	}
+	for sn, send := range senders {
+		for _, bv := range bodyCodecList {
+			h := Headers{HK_DESTINATION, "/queue/bodycodec"}
+			if bv.ce != "" {
+				h = h.Add(HK_CONTENT_ENCODING, bv.ce)
+			}
+			b := bytes.Repeat([]byte("z"), bv.bl)
+			if e = send(h, b); e != nil {
+				t.Fatalf("TestBodyCodecSend %s Expected nil, got <%v>\n", sn, e)
+			}
+			f := fb.nextFrame(t)
+			ce, ok := f.Headers.Contains(HK_CONTENT_ENCODING)
+			if ce != bv.wce || ok != (bv.wce != "") {
+				t.Fatalf("TestBodyCodecSend %s <%+v> Expected encoding <%s>, got <%v>\n", sn, bv, bv.wce, f.Headers)
+			}
+			if v := f.Headers.Value(HK_CONTENT_LENGTH); v != strconv.Itoa(len(f.Body)) {
+				t.Fatalf("TestBodyCodecSend %s <%+v> Expected length <%d>, got <%s>\n", sn, bv, len(f.Body), v)
+			}
+			wb := f.Body
+			if bv.enc {
+				if wb, e = GzipBodyCodec.Decode(f.Body); e != nil {
+					t.Fatalf("TestBodyCodecSend %s <%+v> Expected nil, got <%v>\n", sn, bv, e)
+				}
+			}
+			if !bytes.Equal(wb, b) {
+				t.Fatalf("TestBodyCodecSend %s <%+v> Expected body, got <%q>\n", sn, bv, f.Body)
+			}
+		}
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Body Codec Test: an encoded MESSAGE body is decoded, whatever its size.
+*/
+func TestBodyCodecReceive(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers, WithBodyCodec(GzipBodyCodec, -1))
+	if e != nil {
+		t.Fatalf("TestBodyCodecReceive Expected nil, got <%v>\n", e)
+	}
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/bodycodec", HK_ID, "bc1"})
+	if e != nil {
+		t.Fatalf("TestBodyCodecReceive Expected nil, got <%v>\n", e)
+	}
+	zb, e := GzipBodyCodec.Encode([]byte(tm))
+	if e != nil {
+		t.Fatalf("TestBodyCodecReceive Expected nil, got <%v>\n", e)
+	}
+	_ = fb.write(MESSAGE + "\ndestination:/queue/bodycodec\nsubscription:bc1\n" +
+		"message-id:bc-m1\ncontent-encoding:gzip\ncontent-length:" +
+		strconv.Itoa(len(zb)) + "\n\n" + string(zb) + "\x00")
+	select {
+	case md := <-sc:
+		if md.Error != nil || md.Message.BodyString() != tm {
+			t.Fatalf("TestBodyCodecReceive Expected <%s>, got <%q> <%v>\n", tm,
+				md.Message.Body, md.Error)
+		}
+		if _, ok := md.Message.Headers.Contains(HK_CONTENT_ENCODING); ok {
+			t.Fatalf("TestBodyCodecReceive Expected no encoding, got <%v>\n", md.Message.Headers)
+		}
+		if v := md.Message.Headers.Value(HK_CONTENT_LENGTH); v != strconv.Itoa(len(tm)) {
+			t.Fatalf("TestBodyCodecReceive Expected length <%d>, got <%s>\n", len(tm), v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestBodyCodecReceive nothing delivered\n")
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
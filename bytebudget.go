@@ -0,0 +1,115 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const byteBudgetPoll = 5 * time.Millisecond // Budget recheck interval
+
+/*
+	SetReadByteBudget limits the total size of MESSAGE bodies delivered to
+	subscription channels and not yet received by the application.  Once the
+	total exceeds n bytes the reader stops reading from the network, resuming
+	as consumers drain their channels.  A n <= 0 removes the limit, which is
+	the default.
+
+	The budget is checked after each delivery, so a single MESSAGE larger than
+	n is still delivered.  Body sizes are after any registered body decoder.
+
+	Note: while reading is stopped broker heart beats are not read either.
+	Consumers should keep up within the negotiated heart beat interval.
+
+	Example:
+		c.SetReadByteBudget(64 * 1024 * 1024) // At most about 64MiB buffered
+*/
+func (c *Connection) SetReadByteBudget(n int64) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt64(&c.rbb, n)
+	c.log("SET_READ_BYTE_BUDGET", n)
+}
+
+/*
+	BufferedBytes returns the total size of MESSAGE bodies currently buffered
+	in subscription channels, i.e. delivered by the reader and not yet received
+	by the application.
+*/
+func (c *Connection) BufferedBytes() int64 {
+	var t int64
+	c.subsLock.RLock()
+	c.bbLock.Lock()
+	for _, ps := range c.subs {
+		t += ps.bufferedBytes()
+	}
+	c.bbLock.Unlock()
+	c.subsLock.RUnlock()
+	return t
+}
+
+/*
+	Record the body size of a MESSAGE just delivered to a subscription.
+*/
+func (c *Connection) noteBuffered(ps *subscription, n int64) {
+	c.bbLock.Lock()
+	ps.bbq = append(ps.bbq, n)
+	ps.bbt += n
+	ps.bufferedBytes()
+	c.bbLock.Unlock()
+}
+
+/*
+	Return the bytes still buffered in a subscription channel.  Sizes of
+	MESSAGEs already received are dropped, oldest first.  Caller holds bbLock.
+*/
+func (ps *subscription) bufferedBytes() int64 {
+	for len(ps.bbq) > len(ps.md) {
+		ps.bbt -= ps.bbq[0]
+		ps.bbq = ps.bbq[1:]
+	}
+	if len(ps.bbq) == 0 {
+		ps.bbq = nil
+	}
+	return ps.bbt
+}
+
+/*
+	Wait while buffered bytes exceed the read byte budget.  Returns false on
+	shutdown.  The budget no longer applies once DISCONNECT is being sent, so
+	the DISCONNECT receipt can be read.
+*/
+func (c *Connection) waitByteBudget() bool {
+	lg := false
+	for {
+		mx := atomic.LoadInt64(&c.rbb)
+		if mx == 0 || atomic.LoadInt32(&c.dsnt) == 1 || c.BufferedBytes() <= mx {
+			return true
+		}
+		if !lg {
+			c.log("RDR_BYTE_BUDGET", mx)
+			lg = true
+		}
+		select {
+		case _ = <-time.After(byteBudgetPoll):
+		case _ = <-c.ssdc:
+			return false
+		}
+	}
+}
@@ -0,0 +1,118 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*
+   Test helper.  Wait until BufferedBytes reaches an expected value.
+*/
+func waitBufferedBytes(t *testing.T, c *Connection, w int64) {
+	for i := 0; i < 200 && c.BufferedBytes() != w; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if b := c.BufferedBytes(); b != w {
+		t.Fatalf("TestByteBudget Expected <%d>, got <%d>\n", w, b)
+	}
+}
+
+/*
+	Byte Budget Test: reading stops while buffered bodies exceed the budget,
+	and resumes as the consumer drains.
+*/
+func TestByteBudgetMixedSizes(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestByteBudgetMixedSizes Expected nil, got <%v>\n", e)
+	}
+	c.SetSubChanCap(len(byteBudgetSizes))
+	c.SetReadByteBudget(byteBudget)
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/bb", HK_ID, "bb1"})
+	if e != nil {
+		t.Fatalf("TestByteBudgetMixedSizes Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	_ = fb.nextFrame(t) // SUBSCRIBE
+	go func() {
+		for i, n := range byteBudgetSizes {
+			_ = fb.write(fmt.Sprintf("MESSAGE\ndestination:/queue/bb\nsubscription:bb1\nmessage-id:m%d\n\n%s\x00",
+				i, strings.Repeat("b", n)))
+		}
+	}()
+	// 600+50+50+900 exceeds the budget, the last MESSAGE is held back
+	waitBufferedBytes(t, c, 1600)
+	time.Sleep(50 * time.Millisecond)
+	if len(sc) != 4 {
+		t.Fatalf("TestByteBudgetMixedSizes Expected <4>, got <%d>\n", len(sc))
+	}
+	// Draining 600 brings the total to the budget, reading resumes
+	if md := <-sc; len(md.Message.Body) != byteBudgetSizes[0] {
+		t.Fatalf("TestByteBudgetMixedSizes Expected <%d>, got <%d>\n",
+			byteBudgetSizes[0], len(md.Message.Body))
+	}
+	waitBufferedBytes(t, c, 1010)
+	for _, n := range byteBudgetSizes[1:] {
+		if md := <-sc; len(md.Message.Body) != n {
+			t.Fatalf("TestByteBudgetMixedSizes Expected <%d>, got <%d>\n",
+				n, len(md.Message.Body))
+		}
+	}
+	waitBufferedBytes(t, c, 0)
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
+
+/*
+	Byte Budget Test: no budget means reading never stops.
+*/
+func TestByteBudgetNone(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestByteBudgetNone Expected nil, got <%v>\n", e)
+	}
+	c.SetSubChanCap(len(byteBudgetSizes))
+	c.SetReadByteBudget(byteBudget)
+	c.SetReadByteBudget(0)
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/bb", HK_ID, "bb2"})
+	if e != nil {
+		t.Fatalf("TestByteBudgetNone Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	_ = fb.nextFrame(t) // SUBSCRIBE
+	go func() {
+		for i, n := range byteBudgetSizes {
+			_ = fb.write(fmt.Sprintf("MESSAGE\ndestination:/queue/bb\nsubscription:bb2\nmessage-id:m%d\n\n%s\x00",
+				i, strings.Repeat("b", n)))
+		}
+	}()
+	waitBufferedBytes(t, c, 1610)
+	for range byteBudgetSizes {
+		_ = <-sc
+	}
+	waitBufferedBytes(t, c, 0)
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
@@ -0,0 +1,222 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"time"
+)
+
+/*
+	OnError sets a callback function invoked by the connection reader each
+	time an ERROR frame is received from the broker.
+
+	The callback runs before the reader processes any further data, so the
+	ERROR frame is seen even if the broker closes the connection immediately
+	afterwards.  When a callback is set, ERROR frames are no longer queued to
+	the Connection.MessageData channel.  An ERROR frame answering a receipt
+	waited for, e.g. by SubscribeConfirmed, is passed to the callback and is
+	also returned to the waiter as a BrokerError.
+
+	Set to "nil" to restore the default behavior.
+
+	Example:
+		c.OnError(func(m stompngo.Message) {
+			log.Printf("broker ERROR: %s %s\n", m.Headers.Value(stompngo.HK_MESSAGE),
+				m.BodyString())
+		})
+*/
+func (c *Connection) OnError(f func(m Message)) {
+	c.cbLock.Lock()
+	c.errh = f
+	c.cbLock.Unlock()
+}
+
+/*
+	Get the ERROR frame callback.
+*/
+func (c *Connection) errorHandler() func(m Message) {
+	c.cbLock.RLock()
+	defer c.cbLock.RUnlock()
+	return c.errh
+}
+
+/*
+	OnShortWrite sets a callback function invoked each time short write
+	recovery (see ShortWriteRecovery) resumes a partially written message
+	body.  The written parameter is the number of body bytes written so far,
+	and total is the full body length.
+
+	Set to "nil" to disable.
+*/
+func (c *Connection) OnShortWrite(f func(written, total int)) {
+	c.cbLock.Lock()
+	c.swh = f
+	c.cbLock.Unlock()
+}
+
+/*
+	Get the short write callback.
+*/
+func (c *Connection) shortWriteHandler() func(written, total int) {
+	c.cbLock.RLock()
+	defer c.cbLock.RUnlock()
+	return c.swh
+}
+
+/*
+	SetStrictCommands sets how frames with unknown broker commands are
+	handled.  In strict mode (the default) an unknown command ends the
+	session with EINVBCMD.  In lenient mode unknown frames are passed to
+	any OnUnknownFrame callback, or dropped if there is none.
+*/
+func (c *Connection) SetStrictCommands(s bool) {
+	c.cbLock.Lock()
+	c.lncm = !s
+	c.cbLock.Unlock()
+}
+
+/*
+	Get the strict command setting.
+*/
+func (c *Connection) strictCommands() bool {
+	c.cbLock.RLock()
+	defer c.cbLock.RUnlock()
+	return !c.lncm
+}
+
+/*
+	OnUnknownFrame sets a callback function invoked by the connection reader
+	for each frame with an unknown broker command, e.g. broker specific
+	extension frames.  It is only used in lenient mode, see
+	SetStrictCommands.
+
+	Set to "nil" to disable.
+
+	Example:
+		c.SetStrictCommands(false)
+		c.OnUnknownFrame(func(f stompngo.Frame) {
+			log.Printf("broker extension frame: %s %v\n", f.Command, f.Headers)
+		})
+*/
+func (c *Connection) OnUnknownFrame(f func(f Frame)) {
+	c.cbLock.Lock()
+	c.ufh = f
+	c.cbLock.Unlock()
+}
+
+/*
+	Get the unknown frame callback.
+*/
+func (c *Connection) unknownFrameHandler() func(f Frame) {
+	c.cbLock.RLock()
+	defer c.cbLock.RUnlock()
+	return c.ufh
+}
+
+/*
+	OnHeartBeatSent sets a callback function invoked by the heart beat
+	sender each time a heart beat is successfully sent.
+
+	Set to "nil" to disable.
+*/
+func (c *Connection) OnHeartBeatSent(f func()) {
+	c.cbLock.Lock()
+	c.hbsh = f
+	c.cbLock.Unlock()
+}
+
+/*
+	Get the heart beat sent callback.
+*/
+func (c *Connection) heartBeatSentHandler() func() {
+	c.cbLock.RLock()
+	defer c.cbLock.RUnlock()
+	return c.hbsh
+}
+
+/*
+	OnHeartBeatReceived sets a callback function invoked by the connection
+	reader each time a heart beat is received from the broker.
+
+	Set to "nil" to disable.
+
+	Example:
+		c.OnHeartBeatReceived(func() {
+			hbCounter.Inc() // Feed a metrics pipeline
+		})
+*/
+func (c *Connection) OnHeartBeatReceived(f func()) {
+	c.cbLock.Lock()
+	c.hbrh = f
+	c.cbLock.Unlock()
+}
+
+/*
+	Get the heart beat received callback.
+*/
+func (c *Connection) heartBeatReceivedHandler() func() {
+	c.cbLock.RLock()
+	defer c.cbLock.RUnlock()
+	return c.hbrh
+}
+
+/*
+	OnSlowConsumer sets a callback function invoked by the connection reader
+	when delivery of a MESSAGE to a full subscription channel has been
+	blocked for the slow consumer threshold (see SetSlowConsumerThreshold).
+	The reader, and so the whole connection, remains blocked until the
+	subscriber reads, or the subscription channel is closed.
+
+	Subscription.Close may be called from the callback, or any other
+	goroutine, to abandon the blocked delivery.  A plain Unsubscribe does not
+	close the channel, and so does not release the reader.
+
+	Set to "nil" to disable.
+
+	Example:
+		c.OnSlowConsumer(func(subId string, blockedFor time.Duration) {
+			log.Printf("slow consumer: %s blocked %v\n", subId, blockedFor)
+		})
+*/
+func (c *Connection) OnSlowConsumer(f func(subId string, blockedFor time.Duration)) {
+	c.cbLock.Lock()
+	c.slch = f
+	c.cbLock.Unlock()
+}
+
+/*
+	SetSlowConsumerThreshold sets how long a subscription channel delivery may
+	block before any slow consumer callback is invoked.  A value <= 0
+	restores the default of DefaultSlowConsumerThreshold.
+*/
+func (c *Connection) SetSlowConsumerThreshold(d time.Duration) {
+	c.cbLock.Lock()
+	c.slct = d
+	c.cbLock.Unlock()
+}
+
+/*
+	Get the slow consumer callback and threshold.
+*/
+func (c *Connection) slowConsumerHandler() (func(string, time.Duration), time.Duration) {
+	c.cbLock.RLock()
+	defer c.cbLock.RUnlock()
+	if c.slct <= 0 {
+		return c.slch, DefaultSlowConsumerThreshold
+	}
+	return c.slch, c.slct
+}
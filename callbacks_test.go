@@ -0,0 +1,231 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+/*
+	Callbacks Test: ERROR frame callback runs before connection teardown.
+*/
+func TestCallbacksOnError(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestCallbacksOnError Expected nil, got <%v>\n", e)
+	}
+	em := make(chan Message, 1)
+	c.OnError(func(m Message) {
+		em <- m
+	})
+	_ = fb.write(fakeErrorFrame)
+	fb.close() // Broker closes right after ERROR
+	select {
+	case m := <-em:
+		if v := m.Headers.Value(HK_MESSAGE); v != "bad frame" {
+			t.Fatalf("TestCallbacksOnError Expected <%v>, got <%v>\n", "bad frame", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestCallbacksOnError ERROR callback not invoked\n")
+	}
+	// The read error from teardown, not the ERROR frame
+	md := <-c.MessageData
+	if md.Error == nil {
+		t.Fatalf("TestCallbacksOnError Expected read error, got <%v>\n", md)
+	}
+	_ = nc.Close()
+}
+
+/*
+	Callbacks Test: unknown broker commands in lenient mode.
+*/
+func TestCallbacksUnknownLenient(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestCallbacksUnknownLenient Expected nil, got <%v>\n", e)
+	}
+	c.SetStrictCommands(false)
+	uf := make(chan Frame, 1)
+	c.OnUnknownFrame(func(f Frame) {
+		uf <- f
+	})
+	_ = fb.write(fakeUnknownFrame)
+	select {
+	case f := <-uf:
+		if f.Command != "PING" || string(f.Body) != "ping" {
+			t.Fatalf("TestCallbacksUnknownLenient Expected <%v>, got <%v>\n", "PING", f)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestCallbacksUnknownLenient unknown frame callback not invoked\n")
+	}
+	// The session continues
+	_ = fb.write(fakeReceiptFrame)
+	md := <-c.MessageData
+	if md.Error != nil || md.Message.Command != RECEIPT {
+		t.Fatalf("TestCallbacksUnknownLenient Expected <%v>, got <%v>\n", RECEIPT, md)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
+
+/*
+	Callbacks Test: unknown broker commands in strict mode, the default.
+*/
+func TestCallbacksUnknownStrict(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestCallbacksUnknownStrict Expected nil, got <%v>\n", e)
+	}
+	c.OnUnknownFrame(func(f Frame) {
+		t.Errorf("TestCallbacksUnknownStrict unexpected callback <%v>\n", f)
+	})
+	go func() {
+		_ = fb.write(fakeUnknownFrame) // Client stops reading part way through
+	}()
+	md := <-c.MessageData
+	if md.Error == nil || !strings.HasPrefix(md.Error.Error(), EINVBCMD.Error()) {
+		t.Fatalf("TestCallbacksUnknownStrict Expected <%v>, got <%v>\n",
+			EINVBCMD, md.Error)
+	}
+	fb.close()
+	_ = nc.Close()
+}
+
+/*
+	Callbacks Test: heart beat sent and received.
+*/
+func TestCallbacksHeartBeats(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnectedHB)
+	c, e := Connect(nc, fake12Headers.Add(HK_HEART_BEAT, "50,0"))
+	if e != nil {
+		t.Fatalf("TestCallbacksHeartBeats Expected nil, got <%v>\n", e)
+	}
+	hs := make(chan struct{}, 1)
+	hr := make(chan struct{}, 1)
+	c.OnHeartBeatSent(func() {
+		select {
+		case hs <- struct{}{}:
+		default:
+		}
+	})
+	c.OnHeartBeatReceived(func() {
+		select {
+		case hr <- struct{}{}:
+		default:
+		}
+	})
+	_ = fb.write("\n")
+	for _, ch := range []chan struct{}{hs, hr} {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestCallbacksHeartBeats heart beat callback not invoked\n")
+		}
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
+
+/*
+	Callbacks Test: slow consumer detection with an idle consumer.
+*/
+func TestCallbacksSlowConsumer(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestCallbacksSlowConsumer Expected nil, got <%v>\n", e)
+	}
+	type slow struct {
+		id string
+		d  time.Duration
+	}
+	sl := make(chan slow, 1)
+	c.SetSlowConsumerThreshold(50 * time.Millisecond)
+	c.OnSlowConsumer(func(subId string, blockedFor time.Duration) {
+		sl <- slow{subId, blockedFor}
+	})
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/drain", HK_ID, "drain1"})
+	if e != nil {
+		t.Fatalf("TestCallbacksSlowConsumer Expected nil, got <%v>\n", e)
+	}
+	// Capacity 1: the second MESSAGE blocks, the consumer is idle
+	_ = fb.write(fakeDrainMessage)
+	_ = fb.write(fakeDrainMessage)
+	select {
+	case s := <-sl:
+		if s.id != "drain1" || s.d < 50*time.Millisecond {
+			t.Fatalf("TestCallbacksSlowConsumer Expected <drain1 >=50ms>, got <%v>\n", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestCallbacksSlowConsumer slow consumer callback not invoked\n")
+	}
+	_ = <-sc
+	_ = <-sc
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
+
+/*
+	Callbacks Test: Close from the slow consumer callback releases the
+	blocked reader.
+*/
+func TestCallbacksSlowConsumerClose(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestCallbacksSlowConsumerClose Expected nil, got <%v>\n", e)
+	}
+	s, e := c.SubscribeHandle(Headers{HK_DESTINATION, "/queue/drain",
+		HK_ID, "drain1"})
+	if e != nil {
+		t.Fatalf("TestCallbacksSlowConsumerClose Expected nil, got <%v>\n", e)
+	}
+	cd := make(chan error, 1)
+	c.SetSlowConsumerThreshold(50 * time.Millisecond)
+	c.OnSlowConsumer(func(subId string, blockedFor time.Duration) {
+		cd <- s.Close()
+	})
+	// Capacity 1: the second MESSAGE blocks, the consumer is idle
+	_ = fb.write(fakeDrainMessage)
+	_ = fb.write(fakeDrainMessage)
+	select {
+	case ce := <-cd:
+		if ce != nil {
+			t.Fatalf("TestCallbacksSlowConsumerClose Expected nil, got <%v>\n", ce)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestCallbacksSlowConsumerClose Close did not complete\n")
+	}
+	n := 0
+	for _ = range s.MessageData {
+		n++
+	}
+	if n != 1 {
+		t.Fatalf("TestCallbacksSlowConsumerClose Expected 1, got <%v>\n", n)
+	}
+	e = c.Disconnect(empty_headers) // Reader is running again
+	checkDisconnectError(t, e)
+	fb.close()
+}
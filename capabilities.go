@@ -0,0 +1,125 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"strings"
+)
+
+/*
+	BrokerType identifies the broker product, from the "server" header of
+	the CONNECTED frame.
+*/
+type BrokerType int
+
+const (
+	BrokerUnknown  BrokerType = iota // No or unrecognized "server" header
+	BrokerActiveMQ                   // Apache ActiveMQ (classic)
+	BrokerArtemis                    // Apache ActiveMQ Artemis
+	BrokerApollo                     // Apache Apollo
+	BrokerRabbitMQ                   // RabbitMQ
+)
+
+/*
+	Capabilities reports optional features available on a connection, based
+	on the broker type and the negotiated protocol level.
+*/
+type Capabilities struct {
+	SupportsNack           bool // NACK frames, STOMP 1.1+
+	SupportsDurable        bool // Durable (persistent) subscriptions
+	SupportsCumulativeAck  bool // ACK in "client" mode also acknowledges earlier messages
+	SupportsStreamPosition bool // SubscribeFrom, a starting stream position
+}
+
+/*
+	Broker quirks table entry.
+*/
+type brokerQuirks struct {
+	bt   BrokerType // Broker type
+	name string     // Broker type name
+	sp   string     // "server" header prefix, lower case, "" matches nothing
+	dur  bool       // Durable subscriptions
+	cum  bool       // Cumulative client acks
+	sph  string     // Stream position SUBSCRIBE header, "" means none
+}
+
+/*
+	Known broker quirks.  Server prefixes are checked in table order, so a
+	prefix must follow any longer prefix it also matches.  To support a new
+	broker, add a BrokerType and a table entry.
+*/
+var brokerTable = []brokerQuirks{
+	{BrokerUnknown, "unknown", "", false, true, ""},
+	{BrokerArtemis, "artemis", "activemq-artemis", true, true, ""},
+	{BrokerActiveMQ, "activemq", "activemq", true, true, ""},
+	{BrokerApollo, "apollo", "apache-apollo", true, true, ""},
+	{BrokerRabbitMQ, "rabbitmq", "rabbitmq", true, true, "x-stream-offset"},
+}
+
+/*
+	String returns the broker type name.
+*/
+func (b BrokerType) String() string {
+	return b.quirks().name
+}
+
+/*
+	Broker quirks for a broker type, unknown quirks if not in the table.
+*/
+func (b BrokerType) quirks() brokerQuirks {
+	for _, q := range brokerTable {
+		if q.bt == b {
+			return q
+		}
+	}
+	return brokerTable[0]
+}
+
+/*
+	BrokerType returns the broker type, recognized from the "server" header
+	of the CONNECTED frame.  BrokerUnknown is returned if the header is
+	missing or not recognized.
+*/
+func (c *Connection) BrokerType() BrokerType {
+	if c.ConnectResponse == nil {
+		return BrokerUnknown
+	}
+	s := strings.ToLower(c.ConnectResponse.Headers.Value(HK_SERVER))
+	for _, q := range brokerTable {
+		if q.sp != "" && strings.HasPrefix(s, q.sp) {
+			return q.bt
+		}
+	}
+	return BrokerUnknown
+}
+
+/*
+	Capabilities returns the optional features available on this
+	connection.
+
+	Example:
+		if !c.Capabilities().SupportsNack {
+			// Reject some other way ...
+		}
+*/
+func (c *Connection) Capabilities() Capabilities {
+	q := c.BrokerType().quirks()
+	return Capabilities{SupportsNack: c.Protocol() >= SPL_11,
+		SupportsDurable:        q.dur,
+		SupportsCumulativeAck:  q.cum,
+		SupportsStreamPosition: q.sph != ""}
+}
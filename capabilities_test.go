@@ -0,0 +1,48 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"testing"
+)
+
+/*
+	Capabilities Test: broker type recognition from the "server" header, and
+	the resulting capabilities at each protocol level.
+*/
+func TestCapabilitiesTable(t *testing.T) {
+	for _, cd := range capsList {
+		nc, fb := openFakeConn(t, cd.resp)
+		c, e := Connect(nc, Headers{HK_ACCEPT_VERSION, "1.0,1.1,1.2", HK_HOST, "localhost"})
+		if e != nil {
+			t.Fatalf("TestCapabilitiesTable %s Expected nil, got <%v>\n", cd.name, e)
+		}
+		if bt := c.BrokerType(); bt != cd.bt {
+			t.Fatalf("TestCapabilitiesTable %s Expected <%v>, got <%v>\n", cd.name, cd.bt, bt)
+		}
+		if cp := c.Capabilities(); cp != cd.caps {
+			t.Fatalf("TestCapabilitiesTable %s Expected <%+v>, got <%+v>\n", cd.name, cd.caps, cp)
+		}
+		e = c.Disconnect(empty_headers)
+		checkDisconnectError(t, e)
+		_ = nc.Close()
+		fb.close()
+	}
+	if s := BrokerType(99).String(); s != "unknown" {
+		t.Fatalf("TestCapabilitiesTable Expected <unknown>, got <%s>\n", s)
+	}
+}
@@ -0,0 +1,248 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"mime"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+/*
+	Charset converts message bodies between Go strings and the bytes of a
+	character set.  Name is the IANA charset name used in the content-type
+	"charset" parameter.
+
+	Charsets are defined here rather than taken from golang.org/x/text, so
+	the package has no dependencies.  An x/text encoding.Encoding is easily
+	adapted with its NewEncoder().String and NewDecoder().Bytes methods.
+*/
+type Charset interface {
+	Name() string
+	Encode(s string) ([]byte, error)
+	Decode(b []byte) (string, error)
+}
+
+var (
+	CharsetUTF8    Charset = utf8Charset{}                          // UTF-8
+	CharsetLatin1  Charset = latin1Charset{}                        // ISO-8859-1
+	CharsetUTF16   Charset = utf16Charset{"UTF-16", true, true}     // UTF-16, big endian with a BOM, any BOM honored on decode
+	CharsetUTF16BE Charset = utf16Charset{"UTF-16BE", true, false}  // UTF-16 big endian
+	CharsetUTF16LE Charset = utf16Charset{"UTF-16LE", false, false} // UTF-16 little endian
+)
+
+/*
+	Known charsets, by lower case name.
+*/
+var charsets = struct {
+	lk sync.RWMutex
+	m  map[string]Charset
+}{m: map[string]Charset{}}
+
+func init() {
+	for _, cs := range []Charset{CharsetUTF8, CharsetLatin1, CharsetUTF16,
+		CharsetUTF16BE, CharsetUTF16LE} {
+		RegisterCharset(cs)
+	}
+}
+
+/*
+	RegisterCharset makes cs known to Message.BodyString for decoding
+	received bodies, by its Name, case insensitive.  A later registration
+	with the same name replaces an earlier one, including the built in
+	charsets.
+*/
+func RegisterCharset(cs Charset) {
+	charsets.lk.Lock()
+	charsets.m[strings.ToLower(cs.Name())] = cs
+	charsets.lk.Unlock()
+}
+
+/*
+	Registered charset by name, or nil.
+*/
+func lookupCharset(n string) Charset {
+	charsets.lk.RLock()
+	defer charsets.lk.RUnlock()
+	return charsets.m[strings.ToLower(n)]
+}
+
+/*
+	SendEncoded sends the string s encoded in the charset enc.  The
+	content-type header "charset" parameter is set to the enc Name, any
+	media type supplied by the caller is kept, and "text/plain" is used
+	otherwise.  ECHARENC is returned if s can not be represented in enc.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/utf16"}
+		e := c.SendEncoded(h, "Grüße", stompngo.CharsetUTF16LE)
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func (c *Connection) SendEncoded(h Headers, s string, enc Charset) error {
+	if h == nil {
+		return EHDRNIL
+	}
+	b, e := enc.Encode(s)
+	if e != nil {
+		return e
+	}
+	return c.SendBytes(charsetHeaders(h, enc.Name()), b)
+}
+
+/*
+	Headers with the content-type charset parameter set to cs.
+*/
+func charsetHeaders(h Headers, cs string) Headers {
+	mt, ps := "text/plain", map[string]string{}
+	if ct, ok := h.Contains(HK_CONTENT_TYPE); ok {
+		if t, p, e := mime.ParseMediaType(ct); e == nil {
+			mt, ps = t, p
+		}
+	}
+	ps["charset"] = cs
+	ch := h.Clone()
+	for ch.Index(HK_CONTENT_TYPE) >= 0 {
+		ch = ch.Delete(HK_CONTENT_TYPE)
+	}
+	return ch.Add(HK_CONTENT_TYPE, mime.FormatMediaType(mt, ps))
+}
+
+/*
+	Body as a string, decoded per any content-type charset parameter.  ok is
+	false if the charset is unknown, or the body is not valid in it.
+*/
+func (m *Message) charsetBody() (string, bool) {
+	ct, ok := m.Headers.Contains(HK_CONTENT_TYPE)
+	if !ok {
+		return "", false
+	}
+	_, ps, e := mime.ParseMediaType(ct)
+	if e != nil || ps["charset"] == "" || strings.EqualFold(ps["charset"], "UTF-8") {
+		return "", false // The body bytes are the string
+	}
+	cs := lookupCharset(ps["charset"])
+	if cs == nil {
+		return "", false
+	}
+	s, e := cs.Decode(m.Body)
+	return s, e == nil
+}
+
+/*
+	UTF-8, the STOMP default.
+*/
+type utf8Charset struct{}
+
+func (utf8Charset) Name() string { return "UTF-8" }
+
+func (utf8Charset) Encode(s string) ([]byte, error) {
+	if !utf8.ValidString(s) {
+		return nil, ECHARENC
+	}
+	return []byte(s), nil
+}
+
+func (utf8Charset) Decode(b []byte) (string, error) {
+	if !utf8.Valid(b) {
+		return "", ECHARDEC
+	}
+	return string(b), nil
+}
+
+/*
+	ISO-8859-1, each byte is the code point.
+*/
+type latin1Charset struct{}
+
+func (latin1Charset) Name() string { return "ISO-8859-1" }
+
+func (latin1Charset) Encode(s string) ([]byte, error) {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return nil, ECHARENC
+		}
+		b = append(b, byte(r))
+	}
+	return b, nil
+}
+
+func (latin1Charset) Decode(b []byte) (string, error) {
+	rs := make([]rune, len(b))
+	for i, c := range b {
+		rs[i] = rune(c)
+	}
+	return string(rs), nil
+}
+
+/*
+	UTF-16, either byte order, optionally with a byte order mark.
+*/
+type utf16Charset struct {
+	n   string // Name
+	be  bool   // Big endian
+	bom bool   // Write a BOM, and honor one when decoding
+}
+
+func (u utf16Charset) Name() string { return u.n }
+
+func (u utf16Charset) Encode(s string) ([]byte, error) {
+	if !utf8.ValidString(s) {
+		return nil, ECHARENC
+	}
+	us := utf16.Encode([]rune(s))
+	if u.bom {
+		us = append([]uint16{0xfeff}, us...)
+	}
+	b := make([]byte, 0, 2*len(us))
+	for _, v := range us {
+		if u.be {
+			b = append(b, byte(v>>8), byte(v))
+		} else {
+			b = append(b, byte(v), byte(v>>8))
+		}
+	}
+	return b, nil
+}
+
+func (u utf16Charset) Decode(b []byte) (string, error) {
+	if len(b)%2 != 0 {
+		return "", ECHARDEC
+	}
+	be := u.be
+	if u.bom && len(b) >= 2 {
+		switch {
+		case b[0] == 0xfe && b[1] == 0xff:
+			b = b[2:]
+		case b[0] == 0xff && b[1] == 0xfe:
+			be, b = false, b[2:]
+		}
+	}
+	us := make([]uint16, len(b)/2)
+	for i := range us {
+		if be {
+			us[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		} else {
+			us[i] = uint16(b[2*i+1])<<8 | uint16(b[2*i])
+		}
+	}
+	return string(utf16.Decode(us)), nil
+}
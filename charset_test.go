@@ -0,0 +1,104 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+/*
+	Charset Test: SendEncoded sets the charset and encodes the body, and
+	BodyString decodes a received body in a non UTF-8 charset.
+*/
+func TestCharsetRoundTrip(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestCharsetRoundTrip Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/charset", HK_ID, "cs1"})
+	if e != nil {
+		t.Fatalf("TestCharsetRoundTrip Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // SUBSCRIBE
+	for i, cd := range charsetList {
+		h := Headers{HK_DESTINATION, "/queue/charset"}
+		if cd.ct != "" {
+			h = h.Add(HK_CONTENT_TYPE, cd.ct)
+		}
+		if e = c.SendEncoded(h, cd.s, cd.cs); e != nil {
+			t.Fatalf("TestCharsetRoundTrip %d Expected nil, got <%v>\n", i, e)
+		}
+		f := fb.nextFrame(t)
+		if v := f.Headers.Value(HK_CONTENT_TYPE); v != cd.want {
+			t.Fatalf("TestCharsetRoundTrip %d Expected <%v>, got <%v>\n", i, cd.want, v)
+		}
+		if ch := f.Headers.Delete(HK_CONTENT_TYPE); ch.Index(HK_CONTENT_TYPE) >= 0 {
+			t.Fatalf("TestCharsetRoundTrip %d Expected one content-type, got <%v>\n", i, f.Headers)
+		}
+		if string(f.Body) == cd.s && cd.cs != CharsetUTF8 {
+			t.Fatalf("TestCharsetRoundTrip %d Expected an encoded body\n", i)
+		}
+		// Echo it back
+		go func(ct string, b []byte) {
+			_ = fb.write(MESSAGE + "\ndestination:/queue/charset\nsubscription:cs1\n" +
+				"message-id:m1\ncontent-type:" + ct +
+				fmt.Sprintf("\ncontent-length:%d\n\n", len(b)) + string(b) + "\x00")
+		}(cd.want, f.Body)
+		select {
+		case md := <-sc:
+			if s := md.Message.BodyString(); s != cd.s {
+				t.Fatalf("TestCharsetRoundTrip %d Expected <%v>, got <%v>\n", i, cd.s, s)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestCharsetRoundTrip %d nothing delivered\n", i)
+		}
+	}
+	if e = c.SendEncoded(Headers{HK_DESTINATION, "/queue/charset"}, "€", CharsetLatin1); e != ECHARENC {
+		t.Fatalf("TestCharsetRoundTrip Expected <%v>, got <%v>\n", ECHARENC, e)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Charset Test: bodies that are not valid in, or have an unknown,
+	charset are returned as is by BodyString.
+*/
+func TestCharsetBodyString(t *testing.T) {
+	for _, ct := range []string{"text/plain; charset=UTF-16", "text/plain; charset=x-unknown"} {
+		m := Message{MESSAGE, Headers{HK_CONTENT_TYPE, ct}, []byte("odd")}
+		if s := m.BodyString(); s != "odd" {
+			t.Fatalf("TestCharsetBodyString <%v> Expected <odd>, got <%v>\n", ct, s)
+		}
+	}
+	b, _ := CharsetUTF16.Encode("x")
+	if s, _ := CharsetUTF16LE.Decode(append([]byte{0xff, 0xfe}, 'x', 0)); s != "\ufeffx" {
+		t.Fatalf("TestCharsetBodyString Expected a kept BOM, got <%q>\n", s)
+	}
+	if s, e := CharsetUTF16.Decode(b); e != nil || s != "x" {
+		t.Fatalf("TestCharsetBodyString Expected <x>, got <%q> <%v>\n", s, e)
+	}
+	if s, e := CharsetUTF16.Decode([]byte{0xff, 0xfe, 'x', 0}); e != nil || s != "x" {
+		t.Fatalf("TestCharsetBodyString Expected <x>, got <%q> <%v>\n", s, e)
+	}
+}
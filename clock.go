@@ -0,0 +1,80 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"time"
+)
+
+/*
+	Monotonic clock source.  Readings are the elapsed time since connection
+	start, and are not affected by wall clock steps (e.g. NTP adjustments).
+*/
+type monoClock func() time.Duration
+
+/*
+	The default clock, monotonic readings via time.Since.
+*/
+func sinceClock(st time.Time) monoClock {
+	return func() time.Duration {
+		return time.Since(st)
+	}
+}
+
+/*
+	Current monotonic reading, ns.  All interval bookkeeping (heart beats,
+	watchdog, idle timeout, ack timeout) uses this rather than wall clock
+	values.
+*/
+func (c *Connection) monoNanos() int64 {
+	return int64(c.mclk())
+}
+
+/*
+	Shortest interval between periodic checks.
+*/
+const minCheckInterval = time.Millisecond
+
+/*
+	Run a periodic check for a timeout of duration d, every d/4 but no more
+	often than minCheckInterval.  The loop ends when check returns true, sd
+	is closed, or the connection shuts down.  check is passed the current
+	monotonic reading.
+*/
+func (c *Connection) checkLoop(d time.Duration, sd chan struct{},
+	check func(now int64) bool) {
+	ti := d / 4
+	if ti < minCheckInterval {
+		ti = minCheckInterval
+	}
+	ticker := time.NewTicker(ti)
+	defer ticker.Stop()
+	for {
+		select {
+		case _ = <-ticker.C:
+			if check(c.monoNanos()) {
+				return
+			}
+		case _ = <-sd:
+			return
+		case _ = <-c.ssdc:
+			return
+		case _ = <-c.wtrsdc:
+			return
+		}
+	}
+}
@@ -0,0 +1,116 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/*
+	Clock Test: Running and interval checks use only the monotonic clock.
+	Real (wall) time passing, or stepping, has no effect.
+*/
+func TestClockMonotonic(t *testing.T) {
+	fc := &fakeClock{}
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers, func(o *connectOptions) {
+		o.mclk = fc.now
+	})
+	if e != nil {
+		t.Fatalf("TestClockMonotonic Expected nil, got <%v>\n", e)
+	}
+	fc.advance(5 * time.Second)
+	if r := c.Running(); r != 5*time.Second {
+		t.Fatalf("TestClockMonotonic Expected <%v>, got <%v>\n", 5*time.Second, r)
+	}
+	sc := make(chan error, 1)
+	c.OnStateChange(func(connected bool, reason error) {
+		if !connected {
+			sc <- reason
+		}
+	})
+	c.SetIdleTimeout(40 * time.Millisecond)
+	// Real time passes, the monotonic clock does not: no idle timeout
+	select {
+	case r := <-sc:
+		t.Fatalf("TestClockMonotonic Unexpected disconnect <%v>\n", r)
+	case <-time.After(150 * time.Millisecond):
+	}
+	// The monotonic clock moves: idle timeout
+	fc.advance(time.Second)
+	select {
+	case r := <-sc:
+		if r != EIDLETMO {
+			t.Fatalf("TestClockMonotonic Expected <%v>, got <%v>\n", EIDLETMO, r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestClockMonotonic Expected idle timeout\n")
+	}
+	fb.close()
+}
+
+/*
+	Clock Test: ack timeouts use only the monotonic clock.
+*/
+func TestClockAckTimeout(t *testing.T) {
+	fc := &fakeClock{}
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers, func(o *connectOptions) {
+		o.mclk = fc.now
+	})
+	if e != nil {
+		t.Fatalf("TestClockAckTimeout Expected nil, got <%v>\n", e)
+	}
+	sh := Headers{HK_DESTINATION, "/queue/atmo", HK_ID, "atmo1",
+		HK_ACK, AckModeClientIndividual}
+	sc, e := c.SubscribeWithAckTimeout(sh, 40*time.Millisecond)
+	if e != nil {
+		t.Fatalf("TestClockAckTimeout Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	_ = fb.nextFrame(t) // SUBSCRIBE
+	_ = fb.write(fakeAckTmoMsg1)
+	_ = <-sc
+	// Real time passes, the monotonic clock does not: no NACK
+	select {
+	case f := <-fb.frames:
+		t.Fatalf("TestClockAckTimeout Unexpected frame <%v>\n", f)
+	case <-time.After(150 * time.Millisecond):
+	}
+	// The monotonic clock moves: NACK
+	fc.advance(time.Second)
+	if f := fb.nextFrame(t); f.Command != NACK || f.Headers.Value(HK_ID) != "a1" {
+		t.Fatalf("TestClockAckTimeout Expected <%v a1>, got <%v %v>\n", NACK,
+			f.Command, f.Headers)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
+
+/*
+   Test helper.  A manually advanced monotonic clock.
+*/
+func (fc *fakeClock) now() time.Duration {
+	return time.Duration(atomic.LoadInt64(&fc.ns))
+}
+
+func (fc *fakeClock) advance(d time.Duration) {
+	atomic.AddInt64(&fc.ns, int64(d))
+}
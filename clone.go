@@ -0,0 +1,248 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	Connection settings copied by CloneSettings.
+*/
+type connSettings struct {
+	logger *log.Logger                                  // Logger
+	lbl    map[string]string                            // Labels
+	scc    int                                          // Subscribe channel capacity
+	dld    deadlineData                                 // Deadline data
+	fit    int64                                        // Frame idle timeout ns
+	mhb    int64                                        // Maximum received header section bytes
+	rbb    int64                                        // Read byte budget
+	sthd   int32                                        // Strict headers
+	aehv   int32                                        // Empty header values allowed at 1.0
+	sct    int32                                        // Suppress default content-type
+	dct    interface{}                                  // Default content-type, nil means unset
+	errh   func(m Message)                              // ERROR frame callback
+	swh    func(written, total int)                     // Short write callback
+	ufh    func(f Frame)                                // Unknown broker command callback
+	lncm   bool                                         // Lenient broker commands
+	hbsh   func()                                       // Heart beat sent callback
+	hbrh   func()                                       // Heart beat received callback
+	slch   func(subId string, blockedFor time.Duration) // Slow consumer callback
+	slct   time.Duration                                // Slow consumer threshold
+	ackch  func(messageId string)                       // ACK confirmed callback
+	dfsk   chan<- MessageData                           // Default message sink
+	idgn   func(kind IdKind) string                     // Id generator
+	dv     DestinationValidator                         // Destination validator
+	dreg   map[string]Decoder                           // Decoder registry copy
+	rlps   int                                          // Send rate limit per second, 0 means none
+	rlbu   int                                          // Send rate limit burst
+	rlnw   bool                                         // Send rate limiter, fail rather than wait
+	rchd   time.Duration                                // Receipt hold time
+	rcmx   int                                          // Maximum pending receipts
+	sch    StateChange                                  // State change callback
+	itd    time.Duration                                // Idle timeout
+	wdd    time.Duration                                // Read watchdog duration
+	txah   TxAborted                                    // Transaction aborted by reconnect callback
+	txlo   []TxSnapshot                                 // Transactions lost, open when no longer connected
+}
+
+/*
+	CloneSettings returns connect options which give a new connection the
+	same configuration as c.  They are the options originally passed to
+	Connect (or a dial helper), followed by one which copies the settings
+	made on c since, as they are now: logger, labels, subscribe channel
+	capacity, deadlines, header and content-type settings, callbacks,
+	decoders, destination validator, id generator, rate limit, receipt
+	settings, idle timeout, read watchdog, and byte budget.
+
+	Subscriptions, transactions, and any other session state are not copied.
+	If c is no longer connected, transactions still open on c are aborted on
+	the new connection, see OnTxAborted.
+	The idle timeout and read watchdog start once the new connection is
+	connected, and everything else applies from the CONNECT on.  Callbacks
+	and the default message sink are shared, not copied, as is any
+	connection event log from WithConnEventLog and any lifetime context from
+	WithContext.
+
+	The options do not take ownership of the network connection passed to
+	Connect.  Redial uses them with the dial helper that created c.
+
+	Example:
+		n2, e := net.Dial("tcp", "broker2.example.com:61613")
+		if e != nil {
+			// Do something sane ...
+		}
+		c2, e := stompngo.Connect(n2, h, c.CloneSettings()...)
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func (c *Connection) CloneSettings() []ConnectOption {
+	s := c.settings()
+	opts := append([]ConnectOption{}, c.conop...)
+	return append(opts, func(o *connectOptions) {
+		o.ownc = false
+		o.dlnw, o.dlad = "", ""
+		o.cset = s
+	})
+}
+
+/*
+	Redial creates a new connection with the same configuration as c, see
+	CloneSettings, over a fresh network connection obtained the same way as
+	for c, i.e. with Dial or DialUnix and the same address.  The same
+	CONNECT headers are sent, including any credentials.  Any connect retry
+	policy applies.
+
+	ENOREDIAL is returned if c was not created by a dial helper.  c itself
+	is not changed, and is normally disconnected by the caller, before or
+	after Redial.
+
+	Example:
+		c2, e := c.Redial()
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func (c *Connection) Redial() (*Connection, error) {
+	if c.copts.dlnw == "" {
+		return nil, ENOREDIAL
+	}
+	c.log("REDIAL", c.copts.dlnw, c.copts.dlad)
+	return dialConnect(c.copts.dlnw, c.copts.dlad, c.conh, c.CloneSettings())
+}
+
+/*
+	Capture the current settings.
+*/
+func (c *Connection) settings() *connSettings {
+	s := &connSettings{scc: c.scc,
+		fit:  atomic.LoadInt64(&c.fit),
+		mhb:  atomic.LoadInt64(&c.mhb),
+		rbb:  atomic.LoadInt64(&c.rbb),
+		sthd: atomic.LoadInt32(&c.sthd),
+		aehv: atomic.LoadInt32(&c.aehv),
+		sct:  atomic.LoadInt32(&c.sct),
+		dct:  c.dct.Load()}
+	s.dld = copyDeadlines(c.dld)
+	//
+	logLock.Lock()
+	s.logger = c.logger
+	s.lbl, _ = copyLabels(c.lbl)
+	logLock.Unlock()
+	//
+	c.cbLock.RLock()
+	s.errh, s.swh, s.ufh, s.lncm = c.errh, c.swh, c.ufh, c.lncm
+	s.hbsh, s.hbrh, s.slch, s.slct = c.hbsh, c.hbrh, c.slch, c.slct
+	s.ackch, s.dfsk, s.idgn = c.ackch, c.dfsk, c.idgn
+	s.txah = c.txah
+	c.cbLock.RUnlock()
+	if !c.Connected() {
+		s.txlo = c.TxSnapshot()
+	}
+	//
+	c.dvLock.RLock()
+	s.dv = c.dv
+	c.dvLock.RUnlock()
+	c.drLock.RLock()
+	if len(c.dreg) > 0 {
+		s.dreg = make(map[string]Decoder, len(c.dreg))
+		for k, d := range c.dreg {
+			s.dreg[k] = d
+		}
+	}
+	c.drLock.RUnlock()
+	//
+	c.rlLock.Lock()
+	if c.rl != nil {
+		s.rlps, s.rlbu = int(c.rl.rate), int(c.rl.burst)
+	}
+	s.rlnw = c.rlnw
+	c.rlLock.Unlock()
+	c.rcptLock.Lock()
+	s.rchd, s.rcmx = c.rchd, c.rcmx
+	c.rcptLock.Unlock()
+	c.stLock.Lock()
+	s.sch = c.sch
+	c.stLock.Unlock()
+	//
+	c.itLock.Lock()
+	s.itd = c.itd
+	c.itLock.Unlock()
+	c.wdLock.Lock()
+	s.wdd = c.wdd
+	c.wdLock.Unlock()
+	return s
+}
+
+/*
+	Apply captured settings to a new connection, before the CONNECT is sent.
+*/
+func (s *connSettings) apply(c *Connection) {
+	c.logger = s.logger
+	c.lbl, c.lbs = copyLabels(s.lbl)
+	c.scc = s.scc
+	*c.dld = copyDeadlines(&s.dld)
+	c.fit, c.mhb, c.rbb = s.fit, s.mhb, s.rbb
+	c.sthd, c.aehv, c.sct = s.sthd, s.aehv, s.sct
+	if s.dct != nil {
+		c.dct.Store(s.dct)
+	}
+	c.errh, c.swh, c.ufh, c.lncm = s.errh, s.swh, s.ufh, s.lncm
+	c.hbsh, c.hbrh, c.slch, c.slct = s.hbsh, s.hbrh, s.slch, s.slct
+	c.ackch, c.dfsk, c.idgn = s.ackch, s.dfsk, s.idgn
+	c.txah = s.txah
+	c.dv = s.dv
+	for k, d := range s.dreg {
+		if c.dreg == nil {
+			c.dreg = make(map[string]Decoder, len(s.dreg))
+		}
+		c.dreg[k] = d
+	}
+	if s.rlps > 0 {
+		c.SetSendRateLimit(s.rlps, s.rlbu)
+	}
+	c.rlnw = s.rlnw
+	c.rchd, c.rcmx = s.rchd, s.rcmx
+	c.sch = s.sch
+}
+
+/*
+	Copy deadline settings.  The per frame values, reader and writer use, are
+	not copied.
+*/
+func copyDeadlines(d *deadlineData) deadlineData {
+	return deadlineData{wde: d.wde, wdld: d.wdld, wds: d.wds,
+		dlnotify: d.dlnotify, dns: d.dns,
+		rde: d.rde, rdld: d.rdld, rds: d.rds,
+		rfsw: d.rfsw}
+}
+
+/*
+	Start any captured timers, and abort lost transactions, once connected.
+*/
+func (s *connSettings) start(c *Connection) {
+	c.txLost(s.txlo)
+	if s.itd > 0 {
+		c.SetIdleTimeout(s.itd)
+	}
+	if s.wdd > 0 {
+		c.SetReadWatchdog(s.wdd)
+	}
+}
@@ -0,0 +1,195 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+)
+
+/*
+   Test helper.  Compare captured settings.  Callbacks compare equal when
+   both are set, the decoder registries by media type.
+*/
+func checkSettings(t *testing.T, s1, s2 *connSettings) {
+	fs := func(s *connSettings) []bool {
+		return []bool{s.errh != nil, s.swh != nil, s.ufh != nil, s.hbsh != nil,
+			s.hbrh != nil, s.slch != nil, s.ackch != nil, s.idgn != nil,
+			s.dv != nil, s.sch != nil, s.dld.dlnotify != nil, s.txah != nil}
+	}
+	if f1, f2 := fs(s1), fs(s2); !reflect.DeepEqual(f1, f2) {
+		t.Fatalf("checkSettings callbacks Expected <%v>, got <%v>\n", f1, f2)
+	}
+	for k := range s1.dreg {
+		if s2.dreg[k] == nil {
+			t.Fatalf("checkSettings Expected decoder <%s>, got <%v>\n", k, s2.dreg)
+		}
+	}
+	if len(s1.dreg) != len(s2.dreg) {
+		t.Fatalf("checkSettings Expected <%v>, got <%v>\n", s1.dreg, s2.dreg)
+	}
+	z := func(s *connSettings) connSettings {
+		v := *s
+		v.errh, v.swh, v.ufh, v.hbsh, v.hbrh, v.slch = nil, nil, nil, nil, nil, nil
+		v.ackch, v.idgn, v.dv, v.sch, v.dld.dlnotify, v.dreg = nil, nil, nil, nil, nil, nil
+		v.txah = nil
+		return v
+	}
+	if v1, v2 := z(s1), z(s2); !reflect.DeepEqual(v1, v2) {
+		t.Fatalf("checkSettings Expected <%+v>, got <%+v>\n", v1, v2)
+	}
+}
+
+/*
+   Test helper.  Apply a setting of every kind CloneSettings copies.
+*/
+func cloneConfigure(c *Connection) {
+	c.SetLogger(log.New(ioutil.Discard, "clone ", log.Lmicroseconds))
+	c.SetLabels(cloneLabels)
+	c.SetSubChanCap(cloneSubChanCap)
+	c.WriteDeadline(cloneDeadline)
+	c.EnableWriteDeadline(true)
+	c.ReadDeadline(cloneDeadline)
+	c.EnableReadDeadline(true)
+	c.ExpiredNotification(func(err error, rw bool) {})
+	c.ShortWriteRecovery(true)
+	c.SetFrameIdleTimeout(cloneTimers)
+	c.SetMaxHeaderBytes(cloneBudget)
+	c.SetReadByteBudget(cloneBudget)
+	c.SetStrictHeaders(true)
+	c.SetAllowEmptyHeaderValues(true)
+	c.SuppressContentType(true)
+	c.SetDefaultContentType("application/json")
+	c.OnError(func(m Message) {})
+	c.OnShortWrite(func(written, total int) {})
+	c.OnUnknownFrame(func(f Frame) {})
+	c.SetStrictCommands(false)
+	c.OnHeartBeatSent(func() {})
+	c.OnHeartBeatReceived(func() {})
+	c.OnSlowConsumer(func(subId string, blockedFor time.Duration) {})
+	c.SetSlowConsumerThreshold(cloneDeadline)
+	c.OnAckConfirmed(func(messageId string) {})
+	c.SetDefaultMessageSink(make(chan MessageData, 1))
+	c.SetIdGenerator(func(kind IdKind) string { return kind.String() })
+	c.SetDestinationValidator(func(d string) error { return nil })
+	c.RegisterDecoder("application/json", func(b []byte) (interface{}, error) {
+		return nil, nil
+	})
+	c.SetSendRateLimit(cloneRateLimit, cloneRateBurst)
+	c.SetSendRateLimitNoWait(true)
+	c.SetReceiptHold(cloneDeadline)
+	c.SetMaxPendingReceipts(cloneSubChanCap)
+	c.OnStateChange(func(connected bool, reason error) {})
+	c.OnTxAborted(func(c *Connection, s TxSnapshot) {})
+	c.SetIdleTimeout(cloneTimers)
+	c.SetReadWatchdog(cloneTimers)
+}
+
+/*
+	Clone Test: every setting is carried over to a new connection, along
+	with the original connect options.
+*/
+func TestCloneSettings(t *testing.T) {
+	nc1, fb1 := openFakeConn(t, fakeConnected12)
+	c1, e := Connect(nc1, fake12Headers, WithOrderedSends())
+	if e != nil {
+		t.Fatalf("TestCloneSettings Expected nil, got <%v>\n", e)
+	}
+	cloneConfigure(c1)
+	nc2, fb2 := openFakeConn(t, fakeConnected12)
+	c2, e := Connect(nc2, fake12Headers, c1.CloneSettings()...)
+	if e != nil {
+		t.Fatalf("TestCloneSettings Expected nil, got <%v>\n", e)
+	}
+	checkSettings(t, c1.settings(), c2.settings())
+	if !c2.copts.ords || c2.copts.ownc {
+		t.Fatalf("TestCloneSettings Expected <true false>, got <%v %v>\n",
+			c2.copts.ords, c2.copts.ownc)
+	}
+	c2.itLock.Lock()
+	ir := c2.itsd != nil
+	c2.itLock.Unlock()
+	c2.wdLock.Lock()
+	wr := c2.wdsd != nil
+	c2.wdLock.Unlock()
+	if !ir || !wr {
+		t.Fatalf("TestCloneSettings Expected timers running, got <%v %v>\n", ir, wr)
+	}
+	if _, e = c2.Redial(); e != ENOREDIAL {
+		t.Fatalf("TestCloneSettings Expected <%v>, got <%v>\n", ENOREDIAL, e)
+	}
+	for _, c := range []*Connection{c1, c2} {
+		e = c.Disconnect(NoDiscReceipt)
+		checkDisconnectError(t, e)
+	}
+	fb1.close()
+	fb2.close()
+}
+
+/*
+	Clone Test: Redial connects again to the same address, with the same
+	CONNECT headers and settings.
+*/
+func TestCloneRedial(t *testing.T) {
+	l, fbc := listenFakeBroker(t, NetProtoTCP4, "127.0.0.1:0")
+	defer l.Close()
+	c1, e := Dial(l.Addr().String(), cloneRedialHeaders, WithNetwork(NetProtoTCP4))
+	if e != nil {
+		t.Fatalf("TestCloneRedial Expected nil, got <%v>\n", e)
+	}
+	fb1 := <-fbc
+	cloneConfigure(c1)
+	fbc2 := make(chan *fakeBroker, 1)
+	go func() {
+		sn, e := l.Accept()
+		if e != nil {
+			close(fbc2)
+			return
+		}
+		fbc2 <- newFakeBroker(sn, fakeConnected12)
+	}()
+	c2, e := c1.Redial()
+	if e != nil {
+		t.Fatalf("TestCloneRedial Expected nil, got <%v>\n", e)
+	}
+	fb2 := <-fbc2
+	checkSettings(t, c1.settings(), c2.settings())
+	if !c2.copts.ownc || c2.copts.dlad != l.Addr().String() {
+		t.Fatalf("TestCloneRedial Expected <true %s>, got <%v %s>\n",
+			l.Addr().String(), c2.copts.ownc, c2.copts.dlad)
+	}
+	_ = fb1.nextFrame(t) // CONNECT
+	f := fb2.nextFrame(t)
+	if f.Command != CONNECT {
+		t.Fatalf("TestCloneRedial Expected <%v>, got <%v>\n", CONNECT, f.Command)
+	}
+	for i := 0; i < len(cloneRedialHeaders); i += 2 {
+		if !f.Headers.ContainsKV(cloneRedialHeaders[i], cloneRedialHeaders[i+1]) {
+			t.Fatalf("TestCloneRedial Expected <%v>, got <%v>\n",
+				cloneRedialHeaders, f.Headers)
+		}
+	}
+	for _, c := range []*Connection{c1, c2} {
+		e = c.Disconnect(NoDiscReceipt)
+		checkDisconnectError(t, e)
+	}
+	fb1.close()
+	fb2.close()
+}
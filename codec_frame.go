@@ -0,0 +1,143 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"bufio"
+)
+
+/*
+	FrameCodec reads and writes frames on the wire.  The default, used when
+	no codec is set, is the built in STOMP codec.  A custom codec can be set
+	with WithFrameCodec, in order to speak a non-standard dialect or to
+	decorate the standard framing.
+
+	A custom codec is used for every frame, including CONNECT and the
+	CONNECTED or ERROR response.  Heart beats are always written by the
+	connection as a single LF, and are never passed to WriteFrame.
+
+	The contract is:
+
+	WriteFrame writes exactly one complete frame to w, including any frame
+	terminator (a NUL for STOMP).  The connection flushes w after WriteFrame
+	returns.  The connection does not add content-length or content-type
+	headers, and does not encode header values, for a custom codec: that is
+	the codec's job.  WriteFrame must not retain f.Body after it returns.
+
+	ReadFrame reads exactly one complete frame from r, consuming any frame
+	terminator.  The terminator is not part of the returned Body.  A Frame
+	with an empty Command reports a heart beat.  Header values are used as
+	returned, no decoding is done.  It is up to the codec to honor
+	content-length, including bodies that contain NUL bytes.
+
+	Any error returned by either method is treated as a network error.  Read
+	and write deadlines set for the connection are applied around each call.
+*/
+type FrameCodec interface {
+	WriteFrame(w *bufio.Writer, f Frame) error
+	ReadFrame(r *bufio.Reader) (Frame, error)
+}
+
+/*
+	WithFrameCodec sets a custom FrameCodec for the connection.  A nil
+	codec selects the built in STOMP codec.
+
+	Example:
+		c, e := stompngo.Connect(n, h, stompngo.WithFrameCodec(myCodec))
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func WithFrameCodec(fc FrameCodec) ConnectOption {
+	return func(o *connectOptions) {
+		o.fcod = fc
+	}
+}
+
+/*
+	The custom codec, or nil for the built in STOMP codec.
+*/
+func (c *Connection) frameCodec() FrameCodec {
+	if c.copts == nil {
+		return nil
+	}
+	return c.copts.fcod
+}
+
+/*
+	Write one frame, using any custom codec.
+*/
+func (c *Connection) writeWireFrame(f *Frame) error {
+	fc := c.frameCodec()
+	if fc == nil {
+		return f.writeFrame(c.wtr, c)
+	}
+	c.setWriteDeadline()
+	e := fc.WriteFrame(c.wtr, *f)
+	if c.checkWriteError(e) != nil {
+		return e
+	}
+	if c.writeDeadlineActive() {
+		_ = c.netconn.SetWriteDeadline(c.dld.t0)
+	}
+	return nil
+}
+
+/*
+	Read one frame with a custom codec.
+*/
+func (c *Connection) readCodecFrame() (Frame, error) {
+	c.setReadDeadline()
+	f, e := c.frameCodec().ReadFrame(c.rdr)
+	if c.checkReadError(e) != nil {
+		return f, e
+	}
+	c.updateReads()
+	if c.dld.rde {
+		_ = c.netconn.SetReadDeadline(c.dld.t0)
+	}
+	if f.Command == "" {
+		if hh := c.heartBeatReceivedHandler(); hh != nil {
+			hh()
+		}
+		return f, nil
+	}
+	if f.Headers == nil {
+		f.Headers = Headers{}
+	}
+	return f, nil
+}
+
+/*
+	Read the CONNECT response with a custom codec.
+*/
+func (c *Connection) codecConnectResponse() (*Frame, error) {
+	f, e := c.frameCodec().ReadFrame(c.rdr)
+	if e != nil {
+		return nil, e
+	}
+	if f.Command != CONNECTED && f.Command != ERROR {
+		return &f, EUNKFRM
+	}
+	if f.Command == CONNECTED && len(f.Body) > 0 {
+		return &f, EBDYDATA
+	}
+	if f.Headers == nil {
+		f.Headers = Headers{}
+	}
+	return &f, nil
+}
@@ -0,0 +1,84 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"testing"
+	"time"
+)
+
+/*
+	Frame Codec Test: a custom codec is used for the handshake and for all
+	frames in both directions, and the connection adds no headers of its own.
+*/
+func TestFrameCodec(t *testing.T) {
+	tc := &testCodec{}
+	nc, fb := openFakeConn(t, fakeConnected12)
+	defer fb.close()
+	defer nc.Close()
+	c, e := Connect(nc, fake12Headers, WithFrameCodec(tc))
+	if e != nil {
+		t.Fatalf("TestFrameCodec Expected nil, got <%v>\n", e)
+	}
+	f := fb.nextFrame(t)
+	if f.Command != CONNECT || f.Headers.Value(frameCodecHeader) != "w" {
+		t.Fatalf("TestFrameCodec Expected codec CONNECT, got <%v>\n", f)
+	}
+	if c.ConnectResponse.Headers.Value(frameCodecHeader) != "r" {
+		t.Fatalf("TestFrameCodec Expected codec CONNECTED, got <%v>\n",
+			c.ConnectResponse.Headers)
+	}
+	//
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/fc", HK_ID, "fc1"})
+	if e != nil {
+		t.Fatalf("TestFrameCodec Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // SUBSCRIBE
+	if e = fb.write("\n" + frameCodecMsg); e != nil {
+		t.Fatalf("TestFrameCodec Expected nil, got <%v>\n", e)
+	}
+	select {
+	case md := <-sc:
+		if md.Error != nil || md.Message.BodyString() != "fc body" ||
+			md.Message.Headers.Value(frameCodecHeader) != "r" {
+			t.Fatalf("TestFrameCodec Expected codec MESSAGE, got <%v> <%v>\n",
+				md.Message, md.Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestFrameCodec nothing delivered\n")
+	}
+	//
+	e = c.Send(Headers{HK_DESTINATION, "/queue/fc"}, "fc send")
+	if e != nil {
+		t.Fatalf("TestFrameCodec Expected nil, got <%v>\n", e)
+	}
+	f = fb.nextFrame(t)
+	if f.Command != SEND || string(f.Body) != "fc send" {
+		t.Fatalf("TestFrameCodec Expected SEND, got <%v>\n", f)
+	}
+	for _, k := range []string{HK_CONTENT_LENGTH, HK_CONTENT_TYPE} {
+		if _, ok := f.Headers.Contains(k); ok {
+			t.Fatalf("TestFrameCodec Expected no <%s>, got <%v>\n", k, f.Headers)
+		}
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	if nr, nw := tc.counts(); nr != 3 || nw != 4 {
+		t.Fatalf("TestFrameCodec Expected 3 read 4 written, got <%d> <%d>\n",
+			nr, nw)
+	}
+}
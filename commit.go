@@ -32,7 +32,7 @@ package stompngo
 */
 func (c *Connection) Commit(h Headers) error {
 	c.log(COMMIT, "start", h)
-	if !c.connected {
+	if !c.Connected() {
 		return ECONBAD
 	}
 	// We must have a transaction header here
@@ -43,7 +43,14 @@ func (c *Connection) Commit(h Headers) error {
 	if h.Value(HK_TRANSACTION) == "" {
 		return ETIDCOMEMT
 	}
+	// Lost with a previous connection, see OnTxAborted
+	if c.txAborted(h.Value(HK_TRANSACTION)) {
+		return ETXABRT
+	}
 	e := c.transmitCommon(COMMIT, h) // transmitCommon Clones() the headers
+	if e == nil {
+		c.txEnded(h.Value(HK_TRANSACTION))
+	}
 	c.log(COMMIT, "end", h)
 	return e
 }
@@ -17,7 +17,9 @@
 package stompngo
 
 import (
+	"errors"
 	"testing"
+	"time"
 )
 
 /*
@@ -47,7 +49,7 @@ func TestConnCDDisc(t *testing.T) {
 			t.Fatalf("TestConnCDDisc Expected command [%v], got [%v]\n", CONNECTED,
 				conn.ConnectResponse.Command)
 		}
-		if !conn.connected {
+		if !conn.Connected() {
 			t.Fatalf("TestConnCDDisc Expected connected [true], got [false]\n")
 		}
 		if !conn.Connected() {
@@ -235,6 +237,22 @@ func TestConnCDReceipt(t *testing.T) {
 	}
 }
 
+/*
+	ConnReceipt Test: a receipt on connect fails before any frame is sent.
+*/
+func TestConnCDReceiptNoFrame(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	if _, e := Connect(nc, dialReceiptHeaders); e != ENORECPT {
+		t.Fatalf("TestConnCDReceiptNoFrame Expected [%v], got [%v]\n", ENORECPT, e)
+	}
+	_ = nc.Close()
+	<-fb.done
+	if len(fb.frames) != 0 {
+		t.Fatalf("TestConnCDReceiptNoFrame Expected no frames, got [%v]\n",
+			<-fb.frames)
+	}
+}
+
 /*
 	ConnDisc Test: ECONBAD
 */
@@ -365,3 +383,144 @@ func TestConnCDRespData(t *testing.T) {
 		_ = closeConn(t, n)
 	}
 }
+
+/*
+	ConnDisc Test: a broker ERROR in answer to CONNECT is returned as a
+	ConnectError, carrying the ERROR frame and the broker's reason.
+*/
+func TestConnCDErrorFrame(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnectRejected)
+	_, e := Connect(nc, fake12Headers)
+	if !errors.Is(e, ECONERR) {
+		t.Fatalf("TestConnCDErrorFrame Expected <%v>, got <%v>\n", ECONERR, e)
+	}
+	ce, ok := e.(ConnectError)
+	if !ok {
+		t.Fatalf("TestConnCDErrorFrame Expected ConnectError, got <%T>\n", e)
+	}
+	f := ce.Frame()
+	if f.Command != ERROR || f.Headers.Value(HK_MESSAGE) != "login failed" ||
+		f.BodyString() != "bad credentials" {
+		t.Fatalf("TestConnCDErrorFrame Expected ERROR frame, got <%v>\n", f)
+	}
+	if want := string(ECONERR) + "\nmessage:login failed"; e.Error() != want {
+		t.Fatalf("TestConnCDErrorFrame Expected <%s>, got <%s>\n", want, e.Error())
+	}
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	ConnDisc Test: a broker that closes the connection on DISCONNECT.  This
+	is not an error without a receipt request, and EDISCEOF with one.
+*/
+func TestConnCDDiscBrokerEOF(t *testing.T) {
+	for _, dh := range []Headers{NoDiscReceipt, empty_headers} {
+		nc, fb := openFakeConn(t, fakeConnected12)
+		fb.setAutoReceipt(false)
+		c, e := Connect(nc, fake12Headers)
+		if e != nil {
+			t.Fatalf("TestConnCDDiscBrokerEOF Expected nil, got <%v>\n", e)
+		}
+		_ = fb.nextFrame(t) // CONNECT
+		r := make(chan error, 1)
+		go func() {
+			r <- c.Disconnect(dh)
+		}()
+		if f := fb.nextFrame(t); f.Command != DISCONNECT {
+			t.Fatalf("TestConnCDDiscBrokerEOF Expected <%s>, got <%v>\n", DISCONNECT, f)
+		}
+		fb.close() // Broker closes at once
+		var want error
+		if _, ok := dh.Contains("noreceipt"); !ok {
+			want = EDISCEOF
+		}
+		select {
+		case e = <-r:
+			if e != want {
+				t.Fatalf("TestConnCDDiscBrokerEOF Expected <%v>, got <%v>\n", want, e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestConnCDDiscBrokerEOF Disconnect did not return\n")
+		}
+		// No spurious read error for MessageData consumers
+		for md := range c.MessageData {
+			if md.Error != nil {
+				t.Fatalf("TestConnCDDiscBrokerEOF Expected no error, got <%v>\n", md.Error)
+			}
+		}
+		_ = nc.Close()
+	}
+}
+
+/*
+	ConnDisc Test: an anonymous CONNECT carries no credential headers, and
+	empty credential values are not sent.
+*/
+func TestConnCDAnonymous(t *testing.T) {
+	for _, ch := range anonConnectHeaders {
+		nc, fb := openFakeConn(t, fakeConnected12)
+		c, e := Connect(nc, ch)
+		if e != nil {
+			t.Fatalf("TestConnCDAnonymous Expected nil, got <%v>\n", e)
+		}
+		f := fb.nextFrame(t)
+		for _, k := range []string{HK_LOGIN, HK_PASSCODE} {
+			if _, ok := f.Headers.Contains(k); ok {
+				t.Fatalf("TestConnCDAnonymous Expected no <%s>, got <%v>\n", k, f.Headers)
+			}
+		}
+		e = c.Disconnect(empty_headers)
+		checkDisconnectError(t, e)
+		_ = nc.Close()
+		fb.close()
+	}
+	// Real credentials are sent as is
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, Headers{HK_ACCEPT_VERSION, SPL_12, HK_HOST, "localhost",
+		HK_LOGIN, "guest", HK_PASSCODE, "guest"})
+	if e != nil {
+		t.Fatalf("TestConnCDAnonymous Expected nil, got <%v>\n", e)
+	}
+	if f := fb.nextFrame(t); f.Headers.Value(HK_LOGIN) != "guest" ||
+		f.Headers.Value(HK_PASSCODE) != "guest" {
+		t.Fatalf("TestConnCDAnonymous Expected credentials, got <%v>\n", f.Headers)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	ConnDisc Test: DisconnectConfirmed waits for the receipt, and times out
+	against a broker that never sends one.
+*/
+func TestConnCDDiscConfirmed(t *testing.T) {
+	for _, ar := range []bool{true, false} {
+		nc, fb := openFakeConn(t, fakeConnected12)
+		fb.setAutoReceipt(ar)
+		c, e := Connect(nc, fake12Headers)
+		if e != nil {
+			t.Fatalf("TestConnCDDiscConfirmed Expected nil, got <%v>\n", e)
+		}
+		e = c.DisconnectConfirmed(discConfTmo)
+		if ar {
+			checkDisconnectError(t, e)
+			if c.DisconnectReceipt.Message.Command != RECEIPT {
+				t.Fatalf("TestConnCDDiscConfirmed Expected RECEIPT, got <%v>\n",
+					c.DisconnectReceipt)
+			}
+		} else if e != EDRCPTTMO {
+			t.Fatalf("TestConnCDDiscConfirmed Expected <%v>, got <%v>\n", EDRCPTTMO, e)
+		}
+		if c.Connected() {
+			t.Fatalf("TestConnCDDiscConfirmed Expected disconnected\n")
+		}
+		if _, we := c.WaitDisconnectReceipt(time.Second); we != e {
+			t.Fatalf("TestConnCDDiscConfirmed Expected <%v>, got <%v>\n", e, we)
+		}
+		_ = nc.Close()
+		fb.close()
+	}
+}
@@ -26,8 +26,8 @@ import (
 /*
 	Wrapper for primary STOMP Connect function that returns an interface.
 */
-func NewConnector(n net.Conn, h Headers) (STOMPConnector, error) {
-	return Connect(n, h)
+func NewConnector(n net.Conn, h Headers, opts ...ConnectOption) (STOMPConnector, error) {
+	return Connect(n, h, opts...)
 }
 
 /*
@@ -36,6 +36,19 @@ func NewConnector(n net.Conn, h Headers) (STOMPConnector, error) {
 	For STOMP 1.1+ the Headers parameter MUST contain the headers required
 	by the specification.  Those headers are not magically inferred.
 
+	Optional ConnectOption values may be supplied to further control
+	connection establishment.
+
+	Credentials are never added by the client.  For an anonymous connect
+	omit the "login" and "passcode" headers.  A "login" or "passcode" header
+	with an empty value is removed from the CONNECT frame rather than sent,
+	since some brokers reject empty credentials.
+
+	A "receipt" header is not allowed on CONNECT, since the broker answers
+	with CONNECTED (or ERROR) rather than a RECEIPT.  ENORECPT is returned,
+	and nothing is sent, if h contains one.  The dial helpers check this
+	before dialing.
+
 	Example:
 		// Obtain a network connection
 		n, e := net.Dial(NetProtoTCP, "localhost:61613")
@@ -63,7 +76,7 @@ func NewConnector(n net.Conn, h Headers) (STOMPConnector, error) {
 		}
 		// Use c
 */
-func Connect(n net.Conn, h Headers) (*Connection, error) {
+func Connect(n net.Conn, h Headers, opts ...ConnectOption) (*Connection, error) {
 	if h == nil {
 		return nil, EHDRNIL
 	}
@@ -73,29 +86,66 @@ func Connect(n net.Conn, h Headers) (*Connection, error) {
 	if _, ok := h.Contains(HK_RECEIPT); ok {
 		return nil, ENORECPT
 	}
-	ch := h.Clone()
+	ch := omitEmptyCredentials(h.Clone())
 	//fmt.Printf("CONDB01\n")
 	c := &Connection{netconn: n,
 		input:             make(chan MessageData, 1),
-		output:            make(chan wiredata),
-		connected:         false,
 		session:           "",
 		protocol:          SPL_10,
 		subs:              make(map[string]*subscription),
+		rcpts:             make(map[string]*receiptWaiter),
 		DisconnectReceipt: MessageData{},
 		ssdc:              make(chan struct{}),
 		wtrsdc:            make(chan struct{}),
+		wtrdc:             make(chan struct{}),
+		drc:               make(chan struct{}),
 		scc:               1,
-		dld:               &deadlineData{}}
+		dld:               &deadlineData{},
+		copts:             newConnectOptions(opts),
+		conh:              h.Clone(),
+		conop:             append([]ConnectOption{}, opts...)}
+
+	// Output channel, unbuffered unless requested
+	c.output = make(chan wiredata, c.copts.ocap)
+	if c.copts.ords {
+		c.sseq = newSendSequencer()
+	}
+	c.lbl, c.lbs = copyLabels(c.copts.lbl)
+	c.celg = c.copts.celg
+	if c.celg == nil {
+		c.celg = NewConnEventLog(DefaultConnEvents)
+	}
 
 	// Basic metric data
 	c.mets = &metrics{st: time.Now()}
+	c.mclk = c.copts.mclk
+	if c.mclk == nil {
+		c.mclk = sinceClock(c.mets.st)
+	}
+	// Settings cloned from another connection
+	if c.copts.cset != nil {
+		c.copts.cset.apply(c)
+	}
 
 	// Assumed for now
 	c.MessageData = c.input
 
+	// A lifetime context may already be done
+	if e := c.contextErr(); e != nil {
+		return c, e
+	}
+	// Add any extra CONNECT headers
+	ch, e := c.applyConnectHeaders(ch)
+	if e != nil {
+		return c, e
+	}
+	// Honor any minimum protocol level
+	ch, e = c.applyMinProtocol(ch)
+	if e != nil {
+		return c, e
+	}
 	// Check that the client wants a version we support
-	if e := c.checkClientVersions(h); e != nil {
+	if e := c.checkClientVersions(ch); e != nil {
 		return c, e
 	}
 	//fmt.Printf("CONDB02\n")
@@ -103,24 +153,44 @@ func Connect(n net.Conn, h Headers) (*Connection, error) {
 	c.wtr = bufio.NewWriter(n)        // Create the writer
 	go c.writer()                     // Start it
 	f := Frame{CONNECT, ch, NULLBUFF} // Create actual CONNECT frame
-	r := make(chan error)             // Make the error channel for a write
-	c.output <- wiredata{f, r}        // Send the CONNECT frame
-	e := <-r                          // Retrieve any error
+	e = c.wireSend(f, c.copts.hswt)   // Send the CONNECT frame
 	//
 	if e != nil {
 		close(c.ssdc) // Shutdown,  we are done with errors
-		return c, e
+		return c, c.handshakeError(e, HandshakeWrite)
 	}
 	//fmt.Printf("CONDB03\n")
 	//
+	if c.copts.hswt > 0 {
+		_ = c.netconn.SetReadDeadline(time.Now().Add(c.copts.hswt))
+	}
 	e = c.connectHandler(ch)
+	if c.copts.hswt > 0 {
+		_ = c.netconn.SetReadDeadline(c.dld.t0)
+	}
 	if e != nil {
 		close(c.ssdc) // Shutdown ,  we are done with errors
-		return c, e
+		return c, c.handshakeError(e, HandshakeRead)
 	}
 	//fmt.Printf("CONDB04\n")
 	// We are connected
 	go c.reader()
+	// Lifetime context watcher
+	if c.copts.ctx != nil {
+		go c.contextWatcher(c.copts.ctx)
+	}
+	// Cloned timers start, and lost transactions abort, once connected
+	if c.copts.cset != nil {
+		c.copts.cset.start(c)
+	}
+	// Client post connect processing
+	if c.copts.ocf != nil {
+		if e = c.copts.ocf(c); e != nil {
+			c.log("ONCONNECT error", e)
+			_ = c.Disconnect(NoDiscReceipt)
+			return c, e
+		}
+	}
 	//
 	return c, e
 }
@@ -19,9 +19,25 @@ package stompngo
 import (
 	"bufio"
 	// "fmt"
+	"net"
 	"strings"
+	"sync/atomic"
 )
 
+/*
+	Map a network timeout during the handshake to a HandshakeTimeoutError,
+	when a handshake timeout is set.  Other errors are returned unchanged.
+*/
+func (c *Connection) handshakeError(e error, phase string) error {
+	if c.copts.hswt <= 0 {
+		return e
+	}
+	if ne, ok := e.(net.Error); ok && ne.Timeout() {
+		return HandshakeTimeoutError{Phase: phase, Timeout: c.copts.hswt}
+	}
+	return e
+}
+
 /*
 	Connection handler, one time use during initial connect.
 
@@ -31,12 +47,18 @@ import (
 func (c *Connection) connectHandler(h Headers) (e error) {
 	//fmt.Printf("CHDB01\n")
 	c.rdr = bufio.NewReader(c.netconn)
-	b, e := c.rdr.ReadBytes(0)
-	if e != nil {
-		return e
+	var f *Frame
+	if c.frameCodec() != nil {
+		f, e = c.codecConnectResponse()
+	} else {
+		var b []byte
+		b, e = c.rdr.ReadBytes(0)
+		if e != nil {
+			return e
+		}
+		//fmt.Printf("CHDB02\n")
+		f, e = connectResponse(string(b))
 	}
-	//fmt.Printf("CHDB02\n")
-	f, e := connectResponse(string(b))
 	if e != nil {
 		return e
 	}
@@ -44,10 +66,14 @@ func (c *Connection) connectHandler(h Headers) (e error) {
 	//
 	c.ConnectResponse = &Message{f.Command, f.Headers, f.Body}
 	if c.ConnectResponse.Command == ERROR {
-		return ECONERR
+		return ConnectError{*c.ConnectResponse}
 	}
 	//fmt.Printf("CHDB04\n")
 	//
+	e = c.checkMinProtocol(c.ConnectResponse.Headers)
+	if e != nil {
+		return e
+	}
 	e = c.setProtocolLevel(h, c.ConnectResponse.Headers)
 	if e != nil {
 		return e
@@ -58,6 +84,7 @@ func (c *Connection) connectHandler(h Headers) (e error) {
 		c.session = s
 	}
 
+	c.noteHeartBeats(h)
 	if c.Protocol() >= SPL_11 {
 		e = c.initializeHeartBeats(h)
 		if e != nil {
@@ -66,9 +93,12 @@ func (c *Connection) connectHandler(h Headers) (e error) {
 	}
 	//fmt.Printf("CHDB06\n")
 
-	c.connected = true
-	c.mets.tfr += 1
-	c.mets.tbr += c.ConnectResponse.Size(false)
+	c.setConnected(true)
+	c.lrt = c.monoNanos()
+	c.lat = c.lrt
+	c.notifyState(true, nil)
+	atomic.AddInt64(&c.mets.tfr, 1)
+	atomic.AddInt64(&c.mets.tbr, c.ConnectResponse.Size(false))
 	return nil
 }
 
@@ -208,3 +238,20 @@ func hasValue(a []string, w string) bool {
 	}
 	return false
 }
+
+/*
+	Remove "login" and "passcode" headers with empty values, so an anonymous
+	CONNECT carries no credential headers at all.
+*/
+func omitEmptyCredentials(h Headers) Headers {
+	for _, k := range []string{HK_LOGIN, HK_PASSCODE} {
+		for {
+			i := h.Index(k)
+			if i < 0 || h[i+1] != "" {
+				break
+			}
+			h = h.Delete(k)
+		}
+	}
+	return h
+}
@@ -0,0 +1,342 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+/*
+	ConnectOption is an optional setting for Connect.  Options are applied
+	before the CONNECT frame is put on the wire.
+*/
+type ConnectOption func(*connectOptions)
+
+/*
+	Connect time option data.
+*/
+type connectOptions struct {
+	minp string                    // Minimum acceptable protocol level, "" means any
+	ocf  func(c *Connection) error // Post connect callback
+	netw string                    // Network for the Dial helper, "" means tcp
+	mclk monoClock                 // Monotonic clock, tests only
+	dlfn dialFunc                  // Dial helper dialer, tests only, nil means net.Dial
+	rawh bool                      // Deliver received headers still encoded
+	xch  Headers                   // Extra CONNECT headers
+	ctx  context.Context           // Connection lifetime context
+	ocap int                       // Output channel capacity
+	ownc bool                      // Network connection owned, closed after DISCONNECT
+	ords bool                      // Ordered sends
+	lbl  map[string]string         // Connection labels
+	fcod FrameCodec                // Custom frame codec, nil means STOMP
+	bcod BodyCodec                 // Body codec, nil means none
+	bcmn int                       // Minimum SEND body length encoded, < 0 means on request only
+	nahs bool                      // No automatic host header from the Dial address
+	celg *ConnEventLog             // Connection event log, nil means a new one
+	hswt time.Duration             // CONNECT write and CONNECTED wait timeout, 0 means none
+	rtry *RetryPolicy              // Dial helper connect retries, nil means none
+	dlnw string                    // Dial helper network, "" if not dialed
+	dlad string                    // Dial helper address
+	cset *connSettings             // Settings copied from another connection, see CloneSettings
+	txfr bool                      // Record transaction SEND frames
+}
+
+/*
+	WithMinProtocol sets the lowest protocol level acceptable to the client.
+
+	CONNECT will only offer accept-version values at or above this level, and
+	Connect returns EBADVERSVR if the broker negotiates a lower level.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_ACCEPT_VERSION, "1.1,1.2",
+			stompngo.HK_HOST, "localhost"}
+		c, e := stompngo.Connect(n, h, stompngo.WithMinProtocol(stompngo.SPL_12))
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func WithMinProtocol(v string) ConnectOption {
+	return func(o *connectOptions) {
+		o.minp = v
+	}
+}
+
+/*
+	WithOnConnect sets a callback that is invoked once the STOMP handshake
+	succeeds, before Connect returns.  It is a natural place for common
+	connection setup, e.g. subscribing to destinations.
+
+	If the callback returns an error, the connection is disconnected and
+	Connect returns that error.
+
+	Example:
+		oc := func(c *stompngo.Connection) error {
+			_, e := c.Subscribe(stompngo.Headers{stompngo.HK_DESTINATION, "/queue/a"})
+			return e
+		}
+		c, e := stompngo.Connect(n, h, stompngo.WithOnConnect(oc))
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func WithOnConnect(f func(c *Connection) error) ConnectOption {
+	return func(o *connectOptions) {
+		o.ocf = f
+	}
+}
+
+/*
+	WithoutAutoHost stops the address based Dial helper from adding a host
+	header derived from the dial address, see Dial.  A host header supplied
+	by the caller is never replaced, so this option is only needed when no
+	host header at all should be sent.
+*/
+func WithoutAutoHost() ConnectOption {
+	return func(o *connectOptions) {
+		o.nahs = true
+	}
+}
+
+/*
+	WithNetwork sets the network used by the address based Dial helper,
+	overriding the default of "tcp".  Use "tcp4" or "tcp6" to force IPv4 or
+	IPv6 in dual stack environments.  Dial returns EBADNET for any other
+	value.
+
+	Example:
+		c, e := stompngo.Dial("broker.example.com:61613", h,
+			stompngo.WithNetwork(stompngo.NetProtoTCP4))
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func WithNetwork(network string) ConnectOption {
+	return func(o *connectOptions) {
+		o.netw = network
+	}
+}
+
+/*
+	WithRawHeaders delivers received frames with header keys and values
+	exactly as on the wire, without the STOMP 1.1+ unescape of '\\', '\n',
+	'\r', and ':' normally applied.  This allows a relay to re-emit frames
+	byte for byte, e.g. with Frame.Bytes.
+
+	Applications using this option are responsible for any decoding they
+	require.  Headers of frames sent are always encoded as usual.
+
+	Example:
+		c, e := stompngo.Connect(n, h, stompngo.WithRawHeaders())
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func WithRawHeaders() ConnectOption {
+	return func(o *connectOptions) {
+		o.rawh = true
+	}
+}
+
+/*
+	WithConnectHeaders adds extra headers to the CONNECT frame, e.g. a
+	"client-id" or other broker specific extensions.  The headers are sent
+	verbatim, after those passed to Connect.
+
+	Connect returns ECONHDR if any extra header is "accept-version",
+	"heart-beat", or "receipt", or duplicates a header passed to Connect.
+
+	Example:
+		c, e := stompngo.Dial("localhost:61613", h,
+			stompngo.WithConnectHeaders(stompngo.Headers{"client-id", "app1"}))
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func WithConnectHeaders(h Headers) ConnectOption {
+	return func(o *connectOptions) {
+		o.xch = h.Clone()
+	}
+}
+
+/*
+	WithContext ties the connection lifetime to ctx.  When ctx is cancelled
+	the connection is shut down (a DISCONNECT without a receipt request),
+	subscription channels are closed, and further sends return ctx.Err().
+	Any state change callback is invoked with a reason of ctx.Err().
+
+	Connect returns ctx.Err() if ctx is already done.
+
+	Example:
+		c, e := stompngo.Connect(n, h, stompngo.WithContext(srv.BaseContext))
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func WithContext(ctx context.Context) ConnectOption {
+	return func(o *connectOptions) {
+		o.ctx = ctx
+	}
+}
+
+/*
+	WithOutputCapacity sets the capacity of the channel used to queue frames
+	for the connection writer.  The default is 0 (unbuffered).  A buffered
+	channel lets concurrent producers queue frames, and OutputQueueDepth
+	reports how full it is.
+*/
+func WithOutputCapacity(n int) ConnectOption {
+	return func(o *connectOptions) {
+		if n > 0 {
+			o.ocap = n
+		}
+	}
+}
+
+/*
+	WithOrderedSends serializes Send and SendBytes calls on the connection,
+	so frames are put on the wire in exactly the order the calls are made,
+	even from multiple goroutines.  Each call waits for all earlier calls to
+	complete, including the network write.
+
+	By default concurrent sends overlap, and their relative order is not
+	defined.  Ordered sends trade throughput for ordering: only one SEND is
+	in progress at any time, and a slow write delays every waiting sender.
+
+	Example:
+		c, e := stompngo.Connect(n, h, stompngo.WithOrderedSends())
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func WithOrderedSends() ConnectOption {
+	return func(o *connectOptions) {
+		o.ords = true
+	}
+}
+
+/*
+	WithHandshakeWriteTimeout bounds the STOMP handshake.  The CONNECT frame
+	write, and then the wait for the broker CONNECTED (or ERROR) frame, must
+	each complete within d.  This guards against a broker that accepts the
+	network connection but never reads or never answers.
+
+	The timeout applies to the handshake only.  Deadlines for later frames
+	are set as usual, see SetWriteDeadline and SetReadDeadline.
+
+	On expiry Connect returns a HandshakeTimeoutError, which unwraps to
+	EHSTMO.  A d that is not positive means no handshake timeout, the
+	default.
+
+	Example:
+		c, e := stompngo.Dial("localhost:61613", h,
+			stompngo.WithHandshakeWriteTimeout(5*time.Second))
+		if errors.Is(e, stompngo.EHSTMO) {
+			// Broker did not complete the handshake in time ...
+		}
+*/
+func WithHandshakeWriteTimeout(d time.Duration) ConnectOption {
+	return func(o *connectOptions) {
+		if d > 0 {
+			o.hswt = d
+		}
+	}
+}
+
+/*
+	Apply connect options.
+*/
+func newConnectOptions(opts []ConnectOption) *connectOptions {
+	o := &connectOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+/*
+	Add any extra CONNECT headers, one time use during initial connect.
+*/
+func (c *Connection) applyConnectHeaders(h Headers) (Headers, error) {
+	if len(c.copts.xch) == 0 {
+		return h, nil
+	}
+	if e := c.copts.xch.Validate(); e != nil {
+		return h, e
+	}
+	for i := 0; i < len(c.copts.xch); i += 2 {
+		k := c.copts.xch[i]
+		switch k {
+		case HK_ACCEPT_VERSION, HK_HEART_BEAT, HK_RECEIPT:
+			return h, ECONHDR
+		}
+		if _, ok := h.Contains(k); ok {
+			return h, ECONHDR
+		}
+	}
+	return h.AddHeaders(c.copts.xch), nil
+}
+
+/*
+	Restrict the client requested accept-version values to those permitted
+	by any minimum protocol setting, one time use during initial connect.
+*/
+func (c *Connection) applyMinProtocol(h Headers) (Headers, error) {
+	if c.copts.minp == "" {
+		return h, nil
+	}
+	if !Supported(c.copts.minp) {
+		return h, EBADVERCLI
+	}
+	i := h.Index(HK_ACCEPT_VERSION)
+	if i < 0 { // Client wants 1.0 only
+		if c.copts.minp > SPL_10 {
+			return h, EBADVERCLI
+		}
+		return h, nil
+	}
+	av := []string{}
+	for _, v := range strings.Split(h[i+1], ",") {
+		if v >= c.copts.minp {
+			av = append(av, v)
+		}
+	}
+	if len(av) == 0 {
+		return h, EBADVERCLI
+	}
+	h[i+1] = strings.Join(av, ",")
+	return h, nil
+}
+
+/*
+	Check the broker's CONNECTED version against any minimum protocol
+	setting, before protocol negotiation.  No version header means 1.0.
+*/
+func (c *Connection) checkMinProtocol(sh Headers) error {
+	if c.copts.minp == "" {
+		return nil
+	}
+	v := sh.Value(HK_VERSION)
+	if v == "" {
+		v = SPL_10
+	}
+	if v < c.copts.minp {
+		return EBADVERSVR
+	}
+	return nil
+}
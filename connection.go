@@ -18,7 +18,9 @@ package stompngo
 
 import (
 	"log"
+	"net"
 	"runtime"
+	"sync/atomic"
 	"time"
 )
 
@@ -28,7 +30,53 @@ import (
 	Connected returns the current connection status.
 */
 func (c *Connection) Connected() bool {
-	return c.connected
+	return atomic.LoadInt32(&c.connected) == 1
+}
+
+/*
+	Healthy returns a liveness verdict for the connection, a better
+	readiness signal than Connected alone.  It is false if the connection is
+	not connected, if heart beat sends have failed (Hbsf), or if heart beats
+	are being received and nothing has been read within the heart beat
+	receive window or a receive failure was flagged (Hbrf).  Without heart
+	beats it is the same as Connected.
+
+	Healthy only reads existing state.  It is passive, while a read watchdog,
+	see SetReadWatchdog, acts on silence by closing the network connection.
+	Both can be used together: Healthy for readiness reporting, and the
+	watchdog to force a half open connection to fail.
+*/
+func (c *Connection) Healthy() bool {
+	if !c.Connected() {
+		return false
+	}
+	if c.hbd == nil {
+		return true
+	}
+	c.hbd.sdl.Lock()
+	sf := c.Hbsf
+	c.hbd.sdl.Unlock()
+	if sf {
+		return false
+	}
+	if !c.hbd.hbr {
+		return true
+	}
+	c.hbd.rdl.Lock()
+	rf, lr := c.Hbrf, c.hbd.lr
+	c.hbd.rdl.Unlock()
+	return !rf && c.monoNanos()-lr <= c.hbd.rti+(c.hbd.rti/5)
+}
+
+/*
+	Set the current connection status.
+*/
+func (c *Connection) setConnected(b bool) {
+	var v int32
+	if b {
+		v = 1
+	}
+	atomic.StoreInt32(&c.connected, v)
 }
 
 /*
@@ -91,6 +139,8 @@ func (c *Connection) SendTickerCount() int64 {
 	if c.hbd == nil {
 		return 0
 	}
+	c.hbd.sdl.Lock()
+	defer c.hbd.sdl.Unlock()
 	return c.hbd.sc
 }
 
@@ -102,6 +152,8 @@ func (c *Connection) ReceiveTickerCount() int64 {
 	if c.hbd == nil {
 		return 0
 	}
+	c.hbd.rdl.Lock()
+	defer c.hbd.rdl.Unlock()
 	return c.hbd.rc
 }
 
@@ -109,35 +161,35 @@ func (c *Connection) ReceiveTickerCount() int64 {
 	FramesRead returns a count of the number of frames read on the connection.
 */
 func (c *Connection) FramesRead() int64 {
-	return c.mets.tfr
+	return atomic.LoadInt64(&c.mets.tfr)
 }
 
 /*
 	BytesRead returns a count of the number of bytes read on the connection.
 */
 func (c *Connection) BytesRead() int64 {
-	return c.mets.tbr
+	return atomic.LoadInt64(&c.mets.tbr)
 }
 
 /*
 	FramesWritten returns a count of the number of frames written on the connection.
 */
 func (c *Connection) FramesWritten() int64 {
-	return c.mets.tfw
+	return atomic.LoadInt64(&c.mets.tfw)
 }
 
 /*
 	BytesWritten returns a count of the number of bytes written on the connection.
 */
 func (c *Connection) BytesWritten() int64 {
-	return c.mets.tbw
+	return atomic.LoadInt64(&c.mets.tbw)
 }
 
 /*
 	Running returns a time duration since connection start.
 */
 func (c *Connection) Running() time.Duration {
-	return time.Since(c.mets.st)
+	return c.mclk()
 }
 
 /*
@@ -156,23 +208,201 @@ func (c *Connection) SetSubChanCap(nc int) {
 	return
 }
 
+/*
+	OutputQueueDepth returns the number of frames currently queued for the
+	connection writer, and the queue capacity (see WithOutputCapacity).
+	Producers can use this to back off before sends block.
+*/
+func (c *Connection) OutputQueueDepth() (int, int) {
+	return len(c.output), cap(c.output)
+}
+
+/*
+	SetDefaultMessageSink sets the channel that receives frames not routed
+	elsewhere, in place of Connection.MessageData.  Received frames are
+	routed exactly once, as follows:
+
+		MESSAGE     The channel of the matching subscription only.  A
+		            MESSAGE for no current subscription, e.g. one in flight
+		            during UNSUBSCRIBE, is dropped.
+		RECEIPT     The waiter for its receipt-id, e.g. from SendBytesR or
+		            SubscribeConfirmed, otherwise the default sink.
+		ERROR       The waiter for its receipt-id, and any OnError callback.
+		            With neither, the default sink.
+		Read error  The default sink, and every subscription channel.
+
+	A held receipt (see SetReceiptHold) that is never waited for goes to the
+	default sink when the hold expires.
+
+	The sink belongs to the caller and is never closed, though
+	Connection.MessageData is still closed when the connection reader ends.
+	The reader waits while the sink is full, so it must be drained.  Set to
+	nil to restore Connection.MessageData.
+
+	Example:
+		other := make(chan stompngo.MessageData, 16)
+		c.SetDefaultMessageSink(other)
+		go func() {
+			for md := range other {
+				log.Printf("%s %v\n", md.Message.Command, md.Error)
+			}
+		}()
+*/
+func (c *Connection) SetDefaultMessageSink(ch chan<- MessageData) {
+	c.cbLock.Lock()
+	c.dfsk = ch
+	c.cbLock.Unlock()
+}
+
+/*
+	Get the default message sink, Connection.MessageData if none is set.
+*/
+func (c *Connection) defaultSink() chan<- MessageData {
+	c.cbLock.RLock()
+	defer c.cbLock.RUnlock()
+	if c.dfsk != nil {
+		return c.dfsk
+	}
+	return c.input
+}
+
+/*
+	SuppressContentType controls the default "content-type" header.  By
+	default a "content-type" of DFLT_CONTENT_TYPE, or the value set with
+	SetDefaultContentType, is added to every frame sent without one.  When
+	suppressed, no "content-type" is added, though a caller supplied header
+	is still sent.
+
+	Suppression for a single frame is also possible by adding an
+	HK_SUPPRESS_CT header to that frame.
+*/
+func (c *Connection) SuppressContentType(s bool) {
+	var v int32
+	if s {
+		v = 1
+	}
+	atomic.StoreInt32(&c.sct, v)
+}
+
+/*
+	Default content-type suppression, writer.
+*/
+func (c *Connection) suppressContentType() bool {
+	return atomic.LoadInt32(&c.sct) != 0
+}
+
+/*
+	SetDefaultContentType sets the "content-type" added to frames sent
+	without one, in place of DFLT_CONTENT_TYPE, e.g. "application/json".
+	An empty string means no default is added.  Suppression, see
+	SuppressContentType, takes precedence.
+
+	Example:
+		c.SetDefaultContentType("application/json")
+*/
+func (c *Connection) SetDefaultContentType(s string) {
+	c.dct.Store(s)
+}
+
+/*
+	Default content-type, writer.
+*/
+func (c *Connection) defaultContentType() string {
+	if s, ok := c.dct.Load().(string); ok {
+		return s
+	}
+	return DFLT_CONTENT_TYPE
+}
+
+/*
+	NetConn returns the underlying network connection, e.g. for TLS
+	connection state inspection.  It is for diagnostics only: reading from,
+	writing to, or setting deadlines on it directly will corrupt the STOMP
+	session.  Returns nil if there is no network connection.
+*/
+func (c *Connection) NetConn() net.Conn {
+	if c == nil {
+		return nil
+	}
+	return c.netconn
+}
+
+/*
+	LocalAddr returns the local network address, or nil if there is no
+	network connection.
+*/
+func (c *Connection) LocalAddr() net.Addr {
+	if n := c.NetConn(); n != nil {
+		return n.LocalAddr()
+	}
+	return nil
+}
+
+/*
+	RemoteAddr returns the remote (broker) network address, or nil if there
+	is no network connection.
+*/
+func (c *Connection) RemoteAddr() net.Addr {
+	if n := c.NetConn(); n != nil {
+		return n.RemoteAddr()
+	}
+	return nil
+}
+
 // Unexported Connection methods
 
 /*
 	Log data if possible.
 */
 func (c *Connection) log(v ...interface{}) {
+	c.logTo(nil, false, v)
+}
+
+/*
+	Log subscription data if possible, to any subscription logger, else to
+	the connection logger.
+*/
+func (c *Connection) subLog(s *subscription, v ...interface{}) {
+	c.logTo(s, false, v)
+}
+
+/*
+	Log subscription data to a subscription logger only, for per MESSAGE
+	events.
+*/
+func (c *Connection) subTrace(s *subscription, v ...interface{}) {
+	c.logTo(s, true, v)
+}
+
+/*
+	Common logging.  A subscription logger line has the subscription id as a
+	"sub" field.
+*/
+func (c *Connection) logTo(s *subscription, only bool, v []interface{}) {
 	logLock.Lock()
 	defer logLock.Unlock()
-	if c.logger == nil {
+	l := c.logger
+	if s != nil && s.lgr != nil {
+		l = s.lgr
+	} else if only {
 		return
 	}
-	_, fn, ld, ok := runtime.Caller(1)
+	if l == nil {
+		return
+	}
+	_, fn, ld, ok := runtime.Caller(2)
 
+	sl := c.session
+	if c.lbs != "" {
+		sl += " " + c.lbs
+	}
+	if l != c.logger {
+		sl += " sub=" + s.id
+	}
 	if ok {
-		c.logger.Printf("%s %s %d %v\n", c.session, fn, ld, v)
+		l.Printf("%s %s %d %v\n", sl, fn, ld, v)
 	} else {
-		c.logger.Print(c.session, v)
+		l.Print(sl, v)
 	}
 	return
 }
@@ -200,39 +430,127 @@ func (c *Connection) shutdownHeartBeats() {
 /*
 	Shutdown logic.
 */
-func (c *Connection) shutdown() {
+func (c *Connection) shutdown(why error) {
 	c.log("SHUTDOWN", "starts")
 	c.shutdownHeartBeats()
 	// Close all individual subscribe channels
 	// This is a write lock
 	c.subsLock.Lock()
-	for key := range c.subs {
-		close(c.subs[key].md)
-		c.subs[key].cs = true
+	for _, ps := range c.subs {
+		c.closeSub(ps, nil)
 	}
-	c.connected = false
+	c.setConnected(false)
 	c.subsLock.Unlock()
+	c.notifyState(false, why)
 	c.log("SHUTDOWN", "ends")
 	return
 }
 
+/*
+	Unsubscribe a subscription if it is still live, then close it and remove
+	it from the subscription map.  The UNSUBSCRIBE error, if any, is
+	returned.
+*/
+func (c *Connection) closeSubscription(sd *subscription) error {
+	var e error
+	uh := Headers{HK_DESTINATION, sd.dest, HK_ID, sd.id}
+	c.subsLock.RLock()
+	_, live := c.subs[sd.id]
+	c.subsLock.RUnlock()
+	if live {
+		e = c.Unsubscribe(uh)
+	}
+	c.subsLock.Lock()
+	c.closeSub(sd, nil)
+	if ps, ok := c.subs[sd.id]; ok && ps == sd {
+		delete(c.subs, sd.id)
+	}
+	c.subsLock.Unlock()
+	return e
+}
+
+/*
+	Close a subscription channel once, optionally queueing a final error
+	first.  Any blocked delivery is abandoned before the channel is closed.
+	Caller holds the subs write lock.
+*/
+func (c *Connection) closeSub(ps *subscription, fe *MessageData) {
+	if ps.cs {
+		return
+	}
+	ps.cs = true
+	c.expireAcks(ps, 0, -1) // Nothing more can be acked
+	if ps.drtm != nil {
+		ps.drtm.Stop()
+	}
+	c.quitSub(ps)
+	ps.dlk.Lock()
+	if fe != nil {
+		c.finalSubError(ps, *fe)
+	}
+	close(ps.md)
+	ps.dlk.Unlock()
+}
+
+/*
+	Signal a subscription closed for delivery, once.  Blocked deliveries
+	and credit waits are abandoned.  Caller holds the subs write lock.
+*/
+func (c *Connection) quitSub(ps *subscription) {
+	if ps.qcd {
+		return
+	}
+	ps.qcd = true
+	close(ps.qc)
+}
+
+/*
+	Queue a final error to a subscription channel without blocking.  The
+	reader is the only sender, so if the channel is full, displacing the
+	oldest buffered message guarantees room.  Displaced messages are kept
+	for DrainBuffered.  Caller holds the subs write lock.
+*/
+func (c *Connection) finalSubError(ps *subscription, md MessageData) {
+	for {
+		select {
+		case ps.md <- md:
+			return
+		default: // Full
+		}
+		select {
+		case om := <-ps.md:
+			c.subLog(ps, "HDRERR", "displaced", ps.id)
+			if om.Error == nil {
+				ps.dspl = append(ps.dspl, om)
+			}
+		default: // Consumer emptied it meanwhile
+		}
+	}
+}
+
 /*
 	Read error handler.
 */
 func (c *Connection) handleReadError(md MessageData) {
 	c.log("HDRERR", "starts", md)
 	c.shutdownHeartBeats() // We are done here
+	// Notify any receipt waiters of error
+	c.failReceipts(md)
 	// Notify any general subscriber of error
-	c.input <- md
-	// Notify all individual subscribers of error
-	// This is a read lock
-	c.subsLock.RLock()
-	if c.connected {
-		for key := range c.subs {
-			c.subs[key].md <- md
+	c.defaultSink() <- md
+	// Notify all individual subscribers of error, then close their channels.
+	// No further client operations are possible.  Nothing is left running
+	// once the lock is released, so DrainBuffered sees the final state.
+	// This is a write lock
+	c.subsLock.Lock()
+	if c.Connected() {
+		for _, ps := range c.subs {
+			c.closeSub(ps, &md)
 		}
 	}
-	c.subsLock.RUnlock()
+	c.setConnected(false)
+	c.subsLock.Unlock()
+	c.notifyState(false, md.Error)
 	// Try to catch the writer
 	close(c.wtrsdc)
 	c.log("HDRERR", "ends")
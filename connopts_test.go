@@ -0,0 +1,296 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+/*
+	ConnOpts Test: minimum protocol level against a 1.0 only broker.
+*/
+func TestConnOptsMinProto10Broker(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected10)
+	ch := Headers{HK_ACCEPT_VERSION, "1.0,1.1,1.2", HK_HOST, "localhost"}
+	_, e := Connect(nc, ch, WithMinProtocol(SPL_12))
+	if e != EBADVERSVR {
+		t.Fatalf("TestConnOptsMinProto10Broker Expected <%v>, got <%v>\n",
+			EBADVERSVR, e)
+	}
+	f := fb.nextFrame(t)
+	if v := f.Headers.Value(HK_ACCEPT_VERSION); v != SPL_12 {
+		t.Fatalf("TestConnOptsMinProto10Broker Expected accept-version <%v>, got <%v>\n",
+			SPL_12, v)
+	}
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	ConnOpts Test: minimum protocol level, broker answers 1.1 to a 1.2 only
+	request.
+*/
+func TestConnOptsMinProto11Broker(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected11)
+	ch := Headers{HK_ACCEPT_VERSION, "1.0,1.1,1.2", HK_HOST, "localhost"}
+	_, e := Connect(nc, ch, WithMinProtocol(SPL_12))
+	if e != EBADVERSVR {
+		t.Fatalf("TestConnOptsMinProto11Broker Expected <%v>, got <%v>\n",
+			EBADVERSVR, e)
+	}
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	ConnOpts Test: minimum protocol level, client version request data.
+*/
+func TestConnOptsMinProtoClient(t *testing.T) {
+	for _, mpd := range minProtoList {
+		c := &Connection{copts: newConnectOptions(
+			[]ConnectOption{WithMinProtocol(mpd.minp)})}
+		h, e := c.applyMinProtocol(mpd.headers.Clone())
+		if e != mpd.errval {
+			t.Fatalf("TestConnOptsMinProtoClient Expected <%v>, got <%v>, data: %v\n",
+				mpd.errval, e, mpd)
+		}
+		if e != nil {
+			continue
+		}
+		if v := h.Value(HK_ACCEPT_VERSION); v != mpd.offer {
+			t.Fatalf("TestConnOptsMinProtoClient Expected offer <%v>, got <%v>, data: %v\n",
+				mpd.offer, v, mpd)
+		}
+	}
+}
+
+/*
+	ConnOpts Test: minimum protocol level satisfied by broker.
+*/
+func TestConnOptsMinProtoOK(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	ch := Headers{HK_ACCEPT_VERSION, "1.1,1.2", HK_HOST, "localhost"}
+	c, e := Connect(nc, ch, WithMinProtocol(SPL_12))
+	if e != nil {
+		t.Fatalf("TestConnOptsMinProtoOK Expected nil, got <%v>\n", e)
+	}
+	if c.Protocol() != SPL_12 {
+		t.Fatalf("TestConnOptsMinProtoOK Expected <%v>, got <%v>\n",
+			SPL_12, c.Protocol())
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	ConnOpts Test: post connect callback.
+*/
+func TestConnOptsOnConnect(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	cc := 0
+	oc := func(c *Connection) error {
+		cc++
+		if !c.Connected() {
+			t.Fatalf("TestConnOptsOnConnect Expected connected in callback\n")
+		}
+		return nil
+	}
+	c, e := Connect(nc, fake12Headers, WithOnConnect(oc))
+	if e != nil {
+		t.Fatalf("TestConnOptsOnConnect Expected nil, got <%v>\n", e)
+	}
+	if cc != 1 {
+		t.Fatalf("TestConnOptsOnConnect Expected 1 callback, got <%v>\n", cc)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	ConnOpts Test: post connect callback error aborts the connection.
+*/
+func TestConnOptsOnConnectError(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	we := Error("setup failed")
+	oc := func(c *Connection) error {
+		return we
+	}
+	c, e := Connect(nc, fake12Headers, WithOnConnect(oc))
+	if e != we {
+		t.Fatalf("TestConnOptsOnConnectError Expected <%v>, got <%v>\n", we, e)
+	}
+	if c.Connected() {
+		t.Fatalf("TestConnOptsOnConnectError Expected not connected\n")
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	if f := fb.nextFrame(t); f.Command != DISCONNECT {
+		t.Fatalf("TestConnOptsOnConnectError Expected <%v>, got <%v>\n",
+			DISCONNECT, f.Command)
+	}
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	ConnOpts Test: raw headers are delivered as on the wire, and round trip.
+*/
+func TestConnOptsRawHeaders(t *testing.T) {
+	for _, raw := range []bool{false, true} {
+		nc, fb := openFakeConn(t, fakeConnected12)
+		opts := []ConnectOption{}
+		if raw {
+			opts = append(opts, WithRawHeaders())
+		}
+		c, e := Connect(nc, fake12Headers, opts...)
+		if e != nil {
+			t.Fatalf("TestConnOptsRawHeaders Expected nil, got <%v>\n", e)
+		}
+		sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/raw", HK_ID, "raw1"})
+		if e != nil {
+			t.Fatalf("TestConnOptsRawHeaders Expected nil, got <%v>\n", e)
+		}
+		_ = fb.write(fakeRawMessage)
+		md := <-sc
+		wv := "a:b\nc"
+		if raw {
+			wv = "a\\cb\\nc"
+		}
+		if v := md.Message.Headers.Value("k"); v != wv {
+			t.Fatalf("TestConnOptsRawHeaders raw:%v Expected <%q>, got <%q>\n",
+				raw, wv, v)
+		}
+		if raw {
+			f := Frame(md.Message)
+			if b := string(f.Bytes(false)); b != fakeRawMessage {
+				t.Fatalf("TestConnOptsRawHeaders Expected <%q>, got <%q>\n",
+					fakeRawMessage, b)
+			}
+		}
+		e = c.Disconnect(empty_headers)
+		checkDisconnectError(t, e)
+		fb.close()
+	}
+}
+
+/*
+	ConnOpts Test: extra CONNECT headers reach the wire.
+*/
+func TestConnOptsConnectHeaders(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	h := fake12Headers.Add("x-vendor", "v1")
+	c, e := Connect(nc, h,
+		WithConnectHeaders(Headers{"client-id", "app1"}))
+	if e != nil {
+		t.Fatalf("TestConnOptsConnectHeaders Expected nil, got <%v>\n", e)
+	}
+	f := fb.nextFrame(t)
+	if f.Command != CONNECT {
+		t.Fatalf("TestConnOptsConnectHeaders Expected <%v>, got <%v>\n",
+			CONNECT, f.Command)
+	}
+	for _, kv := range [][2]string{{"x-vendor", "v1"}, {"client-id", "app1"},
+		{HK_HOST, "localhost"}} {
+		if !f.Headers.ContainsKV(kv[0], kv[1]) {
+			t.Fatalf("TestConnOptsConnectHeaders Expected <%v:%v>, got <%v>\n",
+				kv[0], kv[1], f.Headers)
+		}
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+	// Conflicts
+	for _, xh := range connHdrConflictList {
+		c := &Connection{copts: newConnectOptions(
+			[]ConnectOption{WithConnectHeaders(xh)})}
+		if _, e = c.applyConnectHeaders(fake12Headers.Clone()); e != ECONHDR {
+			t.Fatalf("TestConnOptsConnectHeaders <%v> Expected <%v>, got <%v>\n",
+				xh, ECONHDR, e)
+		}
+	}
+}
+
+/*
+	ConnOpts Test: output channel capacity and depth.
+*/
+func TestConnOptsOutputCapacity(t *testing.T) {
+	for _, oc := range []int{0, 4} {
+		nc, fb := openFakeConn(t, fakeConnected12)
+		c, e := Connect(nc, fake12Headers, WithOutputCapacity(oc))
+		if e != nil {
+			t.Fatalf("TestConnOptsOutputCapacity Expected nil, got <%v>\n", e)
+		}
+		if l, cp := c.OutputQueueDepth(); l != 0 || cp != oc {
+			t.Fatalf("TestConnOptsOutputCapacity Expected <0 %d>, got <%d %d>\n",
+				oc, l, cp)
+		}
+		e = c.Disconnect(empty_headers)
+		checkDisconnectError(t, e)
+		fb.close()
+	}
+}
+
+/*
+	ConnOpts Test: handshake timeout against a broker that never reads, and
+	one that reads CONNECT but never answers.
+*/
+func TestConnOptsHandshakeTimeout(t *testing.T) {
+	for _, ph := range []string{HandshakeWrite, HandshakeRead} {
+		nc, sn := net.Pipe()
+		if ph == HandshakeRead {
+			go func() { _, _ = io.Copy(ioutil.Discard, sn) }()
+		}
+		st := time.Now()
+		_, e := Connect(nc, fake12Headers, WithHandshakeWriteTimeout(handshakeTmo))
+		if !errors.Is(e, EHSTMO) {
+			t.Fatalf("TestConnOptsHandshakeTimeout %s Expected <%v>, got <%v>\n",
+				ph, EHSTMO, e)
+		}
+		var he HandshakeTimeoutError
+		if !errors.As(e, &he) || he.Phase != ph || he.Timeout != handshakeTmo {
+			t.Fatalf("TestConnOptsHandshakeTimeout %s Expected phase <%s>, got <%v>\n",
+				ph, ph, e)
+		}
+		if el := time.Since(st); el > 10*handshakeTmo {
+			t.Fatalf("TestConnOptsHandshakeTimeout %s Expected <%v>, took <%v>\n",
+				ph, handshakeTmo, el)
+		}
+		_ = nc.Close()
+		_ = sn.Close()
+	}
+	// A prompt broker is unaffected, and later reads have no deadline
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers, WithHandshakeWriteTimeout(handshakeTmo))
+	if e != nil {
+		t.Fatalf("TestConnOptsHandshakeTimeout Expected nil, got <%v>\n", e)
+	}
+	time.Sleep(2 * handshakeTmo)
+	if !c.Connected() {
+		t.Fatalf("TestConnOptsHandshakeTimeout Expected connected\n")
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
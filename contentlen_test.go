@@ -0,0 +1,115 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+/*
+	Content Length Test: a body which does not match the declared
+	content-length ends the session with EBADCLEN.
+*/
+func TestContentLenMismatch(t *testing.T) {
+	for _, cl := range contentLenList {
+		nc, fb := openFakeConn(t, fakeConnected12)
+		c, e := Connect(nc, fake12Headers)
+		if e != nil {
+			t.Fatalf("TestContentLenMismatch %s Expected nil, got <%v>\n", cl.name, e)
+		}
+		sc := make(chan error, 1)
+		c.OnStateChange(func(connected bool, reason error) {
+			if !connected {
+				sc <- reason
+			}
+		})
+		go func(f string) {
+			_ = fb.write(f) // Client stops reading part way through
+		}(cl.frame)
+		select {
+		case md := <-c.MessageData:
+			if md.Error != EBADCLEN {
+				t.Fatalf("TestContentLenMismatch %s Expected <%v>, got <%v>\n",
+					cl.name, EBADCLEN, md.Error)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestContentLenMismatch %s read error not delivered\n", cl.name)
+		}
+		select {
+		case r := <-sc:
+			if r != EBADCLEN {
+				t.Fatalf("TestContentLenMismatch %s Expected <%v>, got <%v>\n",
+					cl.name, EBADCLEN, r)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestContentLenMismatch %s Expected disconnected\n", cl.name)
+		}
+		fb.close()
+		_ = nc.Close()
+	}
+}
+
+/*
+	Content Length Test: heartbeats between frames are never read as frames
+	or as frame data, and EOL only bodies are not read as heartbeats.
+*/
+func TestContentLenHeartbeats(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestContentLenHeartbeats Expected nil, got <%v>\n", e)
+	}
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/cl", HK_ID, "cl1"})
+	if e != nil {
+		t.Fatalf("TestContentLenHeartbeats Expected nil, got <%v>\n", e)
+	}
+	go func() {
+		_ = fb.write(contentLenHBStream)
+	}()
+	for i, b := range contentLenHBBodies {
+		select {
+		case md := <-sc:
+			if md.Error != nil {
+				t.Fatalf("TestContentLenHeartbeats Expected nil, got <%v>\n", md.Error)
+			}
+			if md.Message.Command != MESSAGE {
+				t.Fatalf("TestContentLenHeartbeats Expected <%s>, got <%s>\n",
+					MESSAGE, md.Message.Command)
+			}
+			if id := md.Message.Headers.Value(HK_MESSAGE_ID); id != fmt.Sprintf("m%d", i+1) {
+				t.Fatalf("TestContentLenHeartbeats Expected <m%d>, got <%s>\n", i+1, id)
+			}
+			if md.Message.BodyString() != b {
+				t.Fatalf("TestContentLenHeartbeats Expected <%q>, got <%q>\n",
+					b, md.Message.BodyString())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestContentLenHeartbeats message %d not delivered\n", i+1)
+		}
+	}
+	select {
+	case md := <-sc:
+		t.Fatalf("TestContentLenHeartbeats Expected no more data, got <%v>\n", md)
+	case <-time.After(50 * time.Millisecond):
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
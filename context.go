@@ -0,0 +1,46 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"context"
+)
+
+/*
+	Any error from the connection lifetime context.
+*/
+func (c *Connection) contextErr() error {
+	if c.copts == nil || c.copts.ctx == nil {
+		return nil
+	}
+	return c.copts.ctx.Err()
+}
+
+/*
+	Shut down the connection when the lifetime context is done.  Exits when
+	the connection shuts down for any other reason.
+*/
+func (c *Connection) contextWatcher(ctx context.Context) {
+	select {
+	case _ = <-ctx.Done():
+		c.log("Context done", ctx.Err())
+		_ = c.disconnect(NoDiscReceipt, ctx.Err(), 0)
+	case _ = <-c.ssdc:
+	case _ = <-c.wtrsdc:
+	}
+	c.log("Context Watcher Ends")
+}
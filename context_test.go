@@ -0,0 +1,141 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+/*
+	Context Test: cancellation shuts down the connection.
+*/
+func TestContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers, WithContext(ctx))
+	if e != nil {
+		t.Fatalf("TestContextCancel Expected nil, got <%v>\n", e)
+	}
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/ctx", HK_ID, "ctx1"})
+	if e != nil {
+		t.Fatalf("TestContextCancel Expected nil, got <%v>\n", e)
+	}
+	st := make(chan error, 1)
+	c.OnStateChange(func(connected bool, reason error) {
+		if !connected {
+			st <- reason
+		}
+	})
+	cancel()
+	select {
+	case r := <-st:
+		if r != context.Canceled {
+			t.Fatalf("TestContextCancel Expected <%v>, got <%v>\n", context.Canceled, r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestContextCancel Expected disconnect\n")
+	}
+	if _, ok := <-sc; ok {
+		t.Fatalf("TestContextCancel Expected closed subscription channel\n")
+	}
+	if e = c.Send(Headers{HK_DESTINATION, "/queue/ctx"}, tm); e != context.Canceled {
+		t.Fatalf("TestContextCancel Expected <%v>, got <%v>\n", context.Canceled, e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	_ = fb.nextFrame(t) // SUBSCRIBE
+	if f := fb.nextFrame(t); f.Command != DISCONNECT {
+		t.Fatalf("TestContextCancel Expected <%v>, got <%v>\n", DISCONNECT, f.Command)
+	}
+	fb.close()
+	// Already done
+	nc, fb = openFakeConn(t, fakeConnected12)
+	_, e = Connect(nc, fake12Headers, WithContext(ctx))
+	if e != context.Canceled {
+		t.Fatalf("TestContextCancel Expected <%v>, got <%v>\n", context.Canceled, e)
+	}
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Context Test: cancelling a dialed connection closes the network
+	connection.
+*/
+func TestContextDialCancel(t *testing.T) {
+	l, fbc := listenFakeBroker(t, NetProtoTCP4, "127.0.0.1:0")
+	defer l.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	_, e := Dial(l.Addr().String(), fake12Headers, WithContext(ctx))
+	if e != nil {
+		t.Fatalf("TestContextDialCancel Expected nil, got <%v>\n", e)
+	}
+	fb := <-fbc
+	cancel()
+	select {
+	case _ = <-fb.done: // Broker side read fails, the socket is closed
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestContextDialCancel Expected network connection closed\n")
+	}
+	fb.close()
+}
+
+/*
+	Context Test: WaitConnected returns at once when connected, waits for
+	a state change when not, and honors the context.
+*/
+func TestContextWaitConnected(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestContextWaitConnected Expected nil, got <%v>\n", e)
+	}
+	if e = c.WaitConnected(context.Background()); e != nil {
+		t.Fatalf("TestContextWaitConnected Expected nil, got <%v>\n", e)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+	//
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	e = c.WaitConnected(ctx)
+	cancel()
+	if e != context.DeadlineExceeded {
+		t.Fatalf("TestContextWaitConnected Expected <%v>, got <%v>\n", context.DeadlineExceeded, e)
+	}
+	// Several waiters, all released by one change of state.
+	wc := make(chan error, 3)
+	for i := 0; i < cap(wc); i++ {
+		go func() {
+			wc <- c.WaitConnected(context.Background())
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	c.notifyState(true, nil)
+	for i := 0; i < cap(wc); i++ {
+		select {
+		case e = <-wc:
+			if e != nil {
+				t.Fatalf("TestContextWaitConnected Expected nil, got <%v>\n", e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestContextWaitConnected Expected waiter released\n")
+		}
+	}
+}
@@ -0,0 +1,116 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"strconv"
+)
+
+/*
+	SubscribeWithCredits subscribes as SubscribeHandle does, with manual
+	flow control.  At most n MESSAGE frames are delivered to the
+	subscription channel until the consumer asks for more with Request.  An
+	n of zero delivers nothing until the first Request.  The "sng_credits"
+	header is set to n.
+
+	For ActiveMQ the "activemq.prefetchSize" header is also set to n, unless
+	supplied, so the broker limits what it sends.  Otherwise gating is
+	internal: while a subscription has no credits the reader waits, as it
+	does for a full subscription channel, and the other subscriptions on
+	the connection wait as well.  A broker side limit, e.g. a client ack
+	mode with a prefetch or window setting, avoids that.  End the
+	subscription with Close rather than Unsubscribe, so a waiting reader is
+	released at once.
+
+	ECRDNEG is returned if n is negative.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/work"}
+		s, e := c.SubscribeWithCredits(h, 10)
+		if e != nil {
+			// Do something sane ...
+		}
+		for i := 0; i < 10; i++ {
+			md := <-s.MessageData
+			// Process md ...
+		}
+		s.Request(10) // Ready for more
+*/
+func (c *Connection) SubscribeWithCredits(h Headers, n int) (*Subscription, error) {
+	if h == nil {
+		return nil, EHDRNIL
+	}
+	if n < 0 {
+		return nil, ECRDNEG
+	}
+	ch := h.Clone()
+	for ch.Index(StompPlusCredits) >= 0 {
+		ch = ch.Delete(StompPlusCredits)
+	}
+	ch = ch.Add(StompPlusCredits, strconv.Itoa(n))
+	if c.BrokerType() == BrokerActiveMQ && ch.Index(HK_AMQ_PREFETCH) < 0 {
+		pf := n
+		if pf == 0 {
+			pf = 1 // Zero means polling to ActiveMQ
+		}
+		ch = ch.Add(HK_AMQ_PREFETCH, strconv.Itoa(pf))
+	}
+	return c.SubscribeHandle(ch)
+}
+
+/*
+	Request adds n delivery credits to a subscription made with
+	SubscribeWithCredits, allowing n more MESSAGE frames to be delivered.
+	It does nothing for other subscriptions, or if n is not positive.
+*/
+func (s *Subscription) Request(n int) {
+	if s.sd.crc == nil || n <= 0 {
+		return
+	}
+	s.sd.crlk.Lock()
+	s.sd.crn += n
+	s.sd.crlk.Unlock()
+	select {
+	case s.sd.crc <- struct{}{}:
+	default: // A wake up is already pending
+	}
+}
+
+/*
+	Take one delivery credit, waiting for a Request if there are none.
+	Returns false if the subscription or connection closes meanwhile.  Reader only, the
+	caller holds the subscription delivery lock.
+*/
+func (c *Connection) takeCredit(ps *subscription) bool {
+	for {
+		ps.crlk.Lock()
+		if ps.crn > 0 {
+			ps.crn--
+			ps.crlk.Unlock()
+			return true
+		}
+		ps.crlk.Unlock()
+		c.subLog(ps, "RDR_NO_CREDITS", ps.id)
+		select {
+		case _ = <-ps.crc:
+		case _ = <-ps.qc:
+			return false
+		case _ = <-c.ssdc:
+			return false
+		}
+	}
+}
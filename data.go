@@ -21,6 +21,7 @@ import (
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -101,6 +102,7 @@ type MessageData struct {
 type wiredata struct {
 	frame   Frame
 	errchan chan error
+	wdld    time.Duration // One off write deadline, 0 means connection default
 }
 
 /*
@@ -194,10 +196,22 @@ type STOMPConnector interface {
 	Connection is a representation of a STOMP connection.
 */
 type Connection struct {
+	// Atomically accessed values first, for 64 bit alignment.
+	lrt  int64 // Last read activity time, monotonic ns
+	tsc  int64 // Throttled send count
+	swc  int64 // Short write count
+	lat  int64 // Last frame activity time, monotonic ns
+	oact int64 // Outstanding acks, all subscriptions
+	mhb  int64 // Maximum received header section bytes, 0 means no limit
+	fit  int64 // Frame idle timeout ns, 0 means none
+	rbb  int64 // Read byte budget, 0 means none
+	//
 	ConnectResponse   *Message           // Broker response (CONNECTED/ERROR) if physical connection successful.
 	DisconnectReceipt MessageData        // If receipt requested on DISCONNECT.
 	MessageData       <-chan MessageData // Inbound data for the client.
-	connected         bool
+	connected         int32              // 1 when connected, atomic
+	sthd              int32              // 1 when strict headers, reject repeated critical headers, atomic
+	aehv              int32              // 1 when empty header values allowed at 1.0, atomic
 	session           string
 	protocol          string
 	input             chan MessageData
@@ -207,26 +221,104 @@ type Connection struct {
 	subsLock          sync.RWMutex
 	ssdc              chan struct{} // System shutdown channel
 	wtrsdc            chan struct{} // Special writer shutdown channel
+	wtrdc             chan struct{} // Closed when the writer has exited
+	drc               chan struct{} // Closed when DISCONNECT completes
+	drr               bool          // DISCONNECT receipt requested
+	dsnt              int32         // 1 once DISCONNECT is being sent, atomic
 	hbd               *heartBeatData
 	wtr               *bufio.Writer
 	rdr               *bufio.Reader
 	Hbrf              bool // Indicates a heart beat read/receive failure, which is possibly transient.  Valid for 1.1+ only.
 	Hbsf              bool // Indicates a heart beat send failure, which is possibly transient.  Valid for 1.1+ only.
 	logger            *log.Logger
-	mets              *metrics      // Client metrics
-	scc               int           // Subscribe channel capacity
-	discLock          sync.Mutex    // DISCONNECT lock
-	dld               *deadlineData // Deadline data
+	mets              *metrics                                     // Client metrics
+	mclk              monoClock                                    // Monotonic clock source
+	scc               int                                          // Subscribe channel capacity
+	sct               int32                                        // Suppress default content-type, atomic
+	dct               atomic.Value                                 // Default content-type string, unset means DFLT_CONTENT_TYPE
+	sseq              *sendSequencer                               // Ordered sends, nil if not enabled
+	discLock          sync.Mutex                                   // DISCONNECT lock
+	dld               *deadlineData                                // Deadline data
+	copts             *connectOptions                              // Connect time options
+	cbLock            sync.RWMutex                                 // Callback lock
+	errh              func(m Message)                              // ERROR frame callback
+	swh               func(written, total int)                     // Short write callback
+	ufh               func(f Frame)                                // Unknown broker command callback
+	lncm              bool                                         // Lenient broker commands, unknown frames not an error
+	hbsh              func()                                       // Heart beat sent callback
+	hbrh              func()                                       // Heart beat received callback
+	slch              func(subId string, blockedFor time.Duration) // Slow consumer callback
+	slct              time.Duration                                // Slow consumer threshold
+	ackch             func(messageId string)                       // ACK confirmed callback
+	dfsk              chan<- MessageData                           // Default message sink, nil means MessageData
+	idgn              func(kind IdKind) string                     // Id generator, nil means Uuid
+	hbcr              [2]int64                                     // Client requested heart-beat, cx, cy
+	hbsa              [2]int64                                     // Server advertised heart-beat, sx, sy
+	bbLock            sync.Mutex                                   // Buffered bytes lock
+	dvLock            sync.RWMutex                                 // Destination validator lock
+	dv                DestinationValidator                         // Destination validator
+	drLock            sync.RWMutex                                 // Decoder registry lock
+	rpLock            sync.Mutex                                   // Reader pause lock
+	rpc               chan struct{}                                // Reader pause, closed on resume, nil when running
+	dreg              map[string]Decoder                           // Decoder registry, by media type
+	wdLock            sync.Mutex                                   // Read watchdog lock
+	wdsd              chan struct{}                                // Read watchdog shutdown channel
+	wdd               time.Duration                                // Read watchdog duration, under wdLock
+	rcptLock          sync.Mutex                                   // Receipt registry lock
+	rcpts             map[string]*receiptWaiter                    // Receipt registry
+	rchd              time.Duration                                // Receipt hold time, SendBytesR
+	rcpr              bool                                         // Receipt expiry running
+	rcmx              int                                          // Maximum pending receipts, 0 means no limit
+	rlLock            sync.Mutex                                   // Send rate limiter lock
+	rl                *rateLimiter                                 // Send rate limiter
+	stLock            sync.Mutex                                   // State change lock
+	cst               bool                                         // State last notified
+	sch               StateChange                                  // State change callback
+	stcc              chan struct{}                                // State change broadcast, closed per change
+	celg              *ConnEventLog                                // Connection event log
+	lbl               map[string]string                            // Connection labels, under logLock
+	lbs               string                                       // Labels rendered for log lines
+	itLock            sync.Mutex                                   // Idle timer lock
+	itsd              chan struct{}                                // Idle timer shutdown channel
+	itd               time.Duration                                // Idle timeout, under itLock
+	atLock            sync.Mutex                                   // Ack timeout lock
+	atmp              map[string]*ackPending                       // Outstanding acks, by ack id
+	atsq              uint64                                       // Ack timeout delivery sequence
+	rlnw              bool                                         // Send rate limiter, fail rather than wait
+	conh              Headers                                      // Headers passed to Connect
+	conop             []ConnectOption                              // Options passed to Connect
+	txLock            sync.Mutex                                   // Transaction state lock
+	txop              []*TxSnapshot                                // Open transactions, BEGIN order, under txLock
+	txab              map[string]bool                              // Transactions aborted by reconnect, under txLock
+	txah              TxAborted                                    // Transaction aborted by reconnect callback
 }
 
 type subscription struct {
+	mc   int64            // MESSAGE frames delivered, atomic, first for 64 bit alignment
+	oac  int64            // Outstanding acks, atomic
 	md   chan MessageData // Subscription specific MessageData channel
 	id   string           // Subscription id (unique, self reference)
 	am   string           // ACK mode for this subscription
+	dest string           // Destination for this subscription
 	cs   bool             // Closed during shutdown
 	drav bool             // Drain After value validity
 	dra  uint             // Start draining after # messages (MESSAGE frames)
 	drmc uint             // Current drain count if draining
+	drat time.Duration    // Close after this duration, 0 means never
+	drtm *time.Timer      // Close after duration timer, under subsLock
+	atmo time.Duration    // Ack timeout, 0 means none
+	dspl []MessageData    // Messages displaced by a final read error
+	rpl  *replayBuffer    // Replay buffer, nil means none
+	crc  chan struct{}    // Credit wake up, nil means no flow control
+	crlk sync.Mutex       // Credit lock
+	crn  int              // Delivery credits remaining
+	qc   chan struct{}    // Closed when the subscription closes or is unsubscribed
+	qcd  bool             // qc closed, under subsLock
+	ackr bool             // Request a receipt for every ACK
+	bbq  []int64          // Body sizes of MESSAGEs in md, oldest first, under bbLock
+	bbt  int64            // Sum of bbq, under bbLock
+	dlk  sync.Mutex       // Delivery lock, held while sending to md
+	lgr  *log.Logger      // Subscription logger, nil means the connection logger, under logLock
 }
 
 /*
@@ -234,6 +326,78 @@ type subscription struct {
 */
 type Error string
 
+/*
+	AckModeError is returned by Subscribe for an ack mode not valid at the
+	connection protocol level.  It unwraps to ESBADAM, so use
+	errors.Is(e, ESBADAM) to test for it.
+*/
+type AckModeError struct {
+	Mode     string // The offending ack mode
+	Protocol string // The connection protocol level
+}
+
+/*
+	AckModeChangeError is returned by Subscribe when a subscription id is
+	reused with a different ack mode.  STOMP does not allow the ack mode of
+	a live subscription to be changed: unsubscribe, and subscribe again with
+	a new id.  It unwraps to EDUPSID, so use errors.Is(e, EDUPSID) to test
+	for it.
+*/
+type AckModeChangeError struct {
+	Id      string // The subscription id
+	Mode    string // The current ack mode
+	NewMode string // The requested ack mode
+}
+
+/*
+	BrokerError is returned when the broker answers a frame with an ERROR
+	frame rather than the RECEIPT requested.  Frame is the ERROR frame.
+*/
+type BrokerError struct {
+	Frame Message // The broker ERROR frame
+}
+
+/*
+	ConnectError is returned by Connect when the broker answers CONNECT with
+	an ERROR frame.  Frame returns the ERROR frame, with the reason for the
+	rejection.  It unwraps to ECONERR, so use errors.Is(e, ECONERR) to test
+	for it.
+*/
+type ConnectError struct {
+	f Message // The broker ERROR frame
+}
+
+/*
+	DuplicateHeaderError is the read error when a received frame repeats a
+	critical single valued header, with strict headers set, see
+	SetStrictHeaders.  It unwraps to EDUPHDR, so use errors.Is(e, EDUPHDR)
+	to test for it.
+*/
+type DuplicateHeaderError struct {
+	Key     string // The repeated header key
+	Command string // The frame command
+}
+
+/*
+	HandshakeTimeoutError is returned by Connect when the handshake timeout
+	set by WithHandshakeWriteTimeout expires.  Phase is HandshakeWrite or
+	HandshakeRead.  It unwraps to EHSTMO, so use errors.Is(e, EHSTMO) to
+	test for it.
+*/
+type HandshakeTimeoutError struct {
+	Phase   string        // The handshake phase that timed out
+	Timeout time.Duration // The handshake timeout
+}
+
+/*
+	HeaderSizeError is the read error when a received frame header section
+	exceeds the limit set by SetMaxHeaderBytes.  It unwraps to EHDRMAX, so
+	use errors.Is(e, EHDRMAX) to test for it.
+*/
+type HeaderSizeError struct {
+	Limit int // The header section limit, bytes
+}
+
 /*
 	Error constants.
 */
@@ -247,7 +411,7 @@ const (
 	EHDRNIL  = Error("headers can not be nil")
 	EUNKHDR  = Error("corrupt frame headers")
 	EHDRMTK  = Error("header key can not be empty")
-	EHDRMTV  = Error("header value can not be empty")
+	EHDRMTV  = Error("header value can not be empty") // Level 1.0 only, see SetAllowEmptyHeaderValues
 
 	// ERRORs for response to CONNECT.
 	EUNKFRM = Error("unrecognized frame returned, CONNECT")
@@ -289,13 +453,41 @@ const (
 	ETIDBEGEMT = Error("transaction-id empty, BEGIN")
 	ETIDCOMEMT = Error("transaction-id empty, COMMIT")
 	ETIDABTEMT = Error("transaction-id empty, ABORT")
+	ETIDSNDEMT = Error("transaction-id empty, SEND")
 
 	// Host header required, STOMP 1.1+
 	EREQHOST = Error("host header required for STOMP 1.1+")
 
 	// Subscription errors.
-	EDUPSID = Error("duplicate subscription-id")
-	EBADSID = Error("invalid subscription-id")
+	EDUPSID  = Error("duplicate subscription-id")
+	EBADSID  = Error("invalid subscription-id")
+	EDUPDEST = Error("duplicate destination")
+
+	// Drain after duration not positive.
+	EBADDRAT = Error("invalid drain after duration")
+
+	// Selector fails the client side sanity check.
+	ESELSYN = Error("invalid selector syntax")
+
+	// Delivery credits negative.
+	ECRDNEG = Error("negative delivery credits")
+
+	// String not representable, or body not valid, in a charset.
+	ECHARENC = Error("string not encodable in charset")
+	ECHARDEC = Error("body not decodable in charset")
+
+	// Replay buffer size not positive.
+	EBADRPLN = Error("invalid replay buffer size")
+
+	// Received critical header repeated, strict headers.
+	EDUPHDR = Error("duplicate critical header")
+
+	// Received header section too large.
+	EHDRMAX = Error("header section exceeds limit")
+
+	// Stream position errors.
+	ESTRMPOS = Error("invalid stream position")
+	ESTRMBRK = Error("stream position not supported, broker")
 
 	// Subscribe errors.
 	ESBADAM = Error("invalid ackmode, SUBSCRIBE")
@@ -317,6 +509,68 @@ const (
 
 	// Invalid broker command
 	EINVBCMD = Error("invalid broker command")
+
+	// Destination rejected by validator
+	EBADDEST = Error("invalid destination")
+
+	// Receipt not received in time
+	ERCPTTMO = Error("receipt wait timeout")
+
+	// Send rate limit exceeded
+	ERATELIM = Error("send rate limit exceeded")
+
+	// Idle timeout disconnect
+	EIDLETMO = Error("idle timeout, DISCONNECT")
+
+	// Invalid network name
+	EBADNET = Error("invalid network, must be tcp, tcp4, or tcp6")
+
+	// Received content-length does not match the frame body
+	EBADCLEN = Error("content-length does not match frame body")
+
+	// Ack timeout requires a client or client-individual ack mode, and a
+	// positive duration
+	EATMOAM  = Error("ack timeout requires client or client-individual ack mode")
+	EATMODUR = Error("ack timeout duration must be positive")
+
+	// Extra CONNECT header conflicts with a negotiated or supplied header
+	ECONHDR = Error("extra header conflicts, CONNECT")
+
+	// Receipt id not registered for waiting
+	ERCPTUNK = Error("unknown receipt id")
+
+	// Receipt id already registered for waiting
+	ERCPTDUP = Error("duplicate receipt id")
+
+	// Pending receipt limit reached
+	ERCPTMAX = Error("too many pending receipts")
+
+	// DISCONNECT receipt wait errors
+	EDRCPTTMO = Error("disconnect receipt wait timeout")
+	EDRCPTNO  = Error("no receipt requested, DISCONNECT")
+
+	// Broker closed the connection before the DISCONNECT receipt
+	EDISCEOF = Error("broker closed connection before receipt, DISCONNECT")
+
+	// Subscription channel closed
+	ESUBCLSD = Error("subscription closed")
+
+	// Handshake timeout expired, CONNECT
+	EHSTMO = Error("handshake timeout, CONNECT")
+
+	// Connection not created by a dial helper
+	ENOREDIAL = Error("connection not dialed, Redial")
+
+	// Transaction lost with a previous connection
+	ETXABRT = Error("transaction aborted by reconnect")
+)
+
+/*
+	Handshake phases, see HandshakeTimeoutError.
+*/
+const (
+	HandshakeWrite = "CONNECT write"  // Writing the CONNECT frame
+	HandshakeRead  = "CONNECTED wait" // Waiting for the broker response
 )
 
 /*
@@ -383,11 +637,16 @@ type heartBeatData struct {
 	Control structure for basic client metrics.
 */
 type metrics struct {
-	st  time.Time // Start Time
+	// Atomically accessed values first, for 64 bit alignment.
 	tfr int64     // Total frame reads
 	tbr int64     // Total bytes read
 	tfw int64     // Total frame writes
 	tbw int64     // Total bytes written
+	st  time.Time // Start Time
+	//
+	hlk sync.Mutex     // Frame size histogram lock
+	fsh *frameSizeHist // Frame size histogram, nil if not enabled
+	fse int32          // Frame size histogram enabled, atomic
 }
 
 /*
@@ -395,42 +654,64 @@ type metrics struct {
 */
 var validCmds = map[string]bool{MESSAGE: true, ERROR: true, RECEIPT: true}
 
+/*
+  Single valued headers checked for repeats with strict headers.
+*/
+var criticalHeaders = []string{HK_MESSAGE_ID, HK_DESTINATION, HK_CONTENT_LENGTH}
+
 var logLock sync.Mutex
 
 const (
-	NetProtoTCP = "tcp" // Protocol Name
+	NetProtoTCP  = "tcp"  // Protocol Name
+	NetProtoUnix = "unix" // Unix domain socket Protocol Name
+	NetProtoTCP4 = "tcp4" // IPv4 only Protocol Name
+	NetProtoTCP6 = "tcp6" // IPv6 only Protocol Name
 )
 
 /*
 	Common Header keys
 */
 const (
-	HK_ACCEPT_VERSION = "accept-version"
-	HK_ACK            = "ack"
-	HK_CONTENT_TYPE   = "content-type"
-	HK_CONTENT_LENGTH = "content-length"
-	HK_DESTINATION    = "destination"
-	HK_HEART_BEAT     = "heart-beat"
-	HK_HOST           = "host" // HK_VHOST aloas
-	HK_ID             = "id"
-	HK_LOGIN          = "login"
-	HK_MESSAGE        = "message"
-	HK_MESSAGE_ID     = "message-id"
-	HK_SUPPRESS_CL    = "suppress-content-length" // Not in any spec, but used
-	HK_SUPPRESS_CT    = "suppress-content-type"   // Not in any spec, but used
-	HK_PASSCODE       = "passcode"
-	HK_RECEIPT        = "receipt"
-	HK_RECEIPT_ID     = "receipt-id"
-	HK_SESSION        = "session"
-	HK_SERVER         = "server"
-	HK_SUBSCRIPTION   = "subscription"
-	HK_TRANSACTION    = "transaction"
-	HK_VERSION        = "version"
-	HK_VHOST          = "host" // HK_HOST alias
+	HK_ACCEPT_VERSION   = "accept-version"
+	HK_ACK              = "ack"
+	HK_AMQ_PREFETCH     = "activemq.prefetchSize" // ActiveMQ specific
+	HK_CONTENT_ENCODING = "content-encoding"      // Not in any spec, but used
+	HK_CONTENT_TYPE     = "content-type"
+	HK_CONTENT_LENGTH   = "content-length"
+	HK_DESTINATION      = "destination"
+	HK_HEART_BEAT       = "heart-beat"
+	HK_HOST             = "host" // HK_VHOST aloas
+	HK_ID               = "id"
+	HK_LOGIN            = "login"
+	HK_MESSAGE          = "message"
+	HK_MESSAGE_ID       = "message-id"
+	HK_SUPPRESS_CL      = "suppress-content-length" // Not in any spec, but used
+	HK_SUPPRESS_CT      = "suppress-content-type"   // Not in any spec, but used
+	HK_PASSCODE         = "passcode"
+	HK_RECEIPT          = "receipt"
+	HK_RECEIPT_ID       = "receipt-id"
+	HK_REDELIVERED      = "redelivered" // Not in any spec, but used
+	HK_SELECTOR         = "selector"    // Not in any spec, but used
+	HK_SESSION          = "session"
+	HK_SERVER           = "server"
+	HK_SUBSCRIPTION     = "subscription"
+	HK_TIMESTAMP        = "timestamp" // Not in any spec, but used
+	HK_TRANSACTION      = "transaction"
+	HK_VERSION          = "version"
+	HK_VHOST            = "host" // HK_HOST alias
+)
+
+/*
+	Content encoding that sends a body as is, see WithBodyCodec.
+*/
+const (
+	ContentEncodingIdentity = "identity"
 )
 
 /*
-	ACK Modes
+	ACK Modes.  In "client" mode an ACK or NACK is cumulative, covering all
+	earlier messages on the subscription.  In "client-individual" mode it
+	covers a single message.
 */
 const (
 	AckModeAuto             = "auto"
@@ -451,11 +732,32 @@ const (
 	DFLT_CONTENT_TYPE = "text/plain; charset=UTF-8"
 )
 
+/*
+	Default slow consumer threshold.
+*/
+const (
+	DefaultSlowConsumerThreshold = 5 * time.Second
+)
+
+/*
+	Default time a receipt requested by SendBytesR is held for WaitReceipt.
+*/
+const (
+	DefaultReceiptHold = time.Minute
+)
+
 /*
 	Extensions to STOMP protocol.
 */
 const (
-	StompPlusDrainAfter = "sng_drafter" // SUBSCRIBE Header
+	StompPlusDrainAfter     = "sng_drafter"          // SUBSCRIBE Header
+	StompPlusDrainAfterTime = "sng_draftertime"      // SUBSCRIBE Header, a time.Duration string
+	StompPlusReplay         = "sng_replay"           // SUBSCRIBE Header, replay buffer size
+	StompPlusCredits        = "sng_credits"          // SUBSCRIBE Header, initial delivery credits
+	StompPlusDLQDestination = "sng_dlq_destination"  // Dead letter SEND Header, original destination
+	StompPlusDLQRedelivery  = "sng_dlq_redeliveries" // Dead letter SEND Header, redelivery count
+	StompPlusDLQReason      = "sng_dlq_reason"       // Dead letter SEND Header, failure reason
+	StompPlusAckReceipts    = "sng_ackreceipts"      // SUBSCRIBE Header, "true" requests a receipt for every ACK
 )
 
 var (
@@ -18,6 +18,7 @@ package stompngo
 
 import (
 	"testing"
+	"time"
 )
 
 /*
@@ -66,6 +67,81 @@ func TestDataMessageBasic(t *testing.T) {
 	}
 }
 
+/*
+	Data Test: Message metadata accessors.
+*/
+func TestDataMessageMetadata(t *testing.T) {
+	m := metaMessage
+	for _, g := range []struct {
+		f func() (string, bool)
+		v string
+	}{{m.MessageId, "m1"}, {m.Subscription, "meta1"},
+		{m.Destination, "/queue/meta"}, {m.ContentType, "text/plain"}} {
+		if v, ok := g.f(); !ok || v != g.v {
+			t.Fatalf("TestDataMessageMetadata expected: [%v], got [%v]\n", g.v, v)
+		}
+	}
+	ts, ok := m.Timestamp()
+	if !ok || ts.UnixNano() != 1500000000123*int64(time.Millisecond) {
+		t.Fatalf("TestDataMessageMetadata Timestamp, got [%v] [%v]\n", ts, ok)
+	}
+	e := &Message{Command: MESSAGE, Headers: Headers{HK_TIMESTAMP, "x"}}
+	if v, ok := e.MessageId(); ok || v != "" {
+		t.Fatalf("TestDataMessageMetadata MessageId expected: [false], got [%v] [%v]\n", v, ok)
+	}
+	if ts, ok = e.Timestamp(); ok || !ts.IsZero() {
+		t.Fatalf("TestDataMessageMetadata Timestamp expected: [false], got [%v] [%v]\n", ts, ok)
+	}
+	for _, rd := range redelList {
+		rm := &Message{Command: MESSAGE, Headers: rd.h}
+		if r, ok := rm.Redelivered(); r != rd.r || ok != rd.ok {
+			t.Fatalf("TestDataMessageMetadata Redelivered %v expected: [%v %v], got [%v %v]\n",
+				rd.h, rd.r, rd.ok, r, ok)
+		}
+	}
+}
+
+/*
+	Data Test: Message redelivery counts, for each broker's headers.
+*/
+func TestDataRedeliveryCount(t *testing.T) {
+	for _, rd := range redelCountList {
+		m := Message{Command: MESSAGE, Headers: rd.h}
+		if n, ok := m.RedeliveryCount(); n != rd.n || ok != rd.ok {
+			t.Fatalf("TestDataRedeliveryCount %v expected: [%v %v], got [%v %v]\n",
+				rd.h, rd.n, rd.ok, n, ok)
+		}
+		c := &Connection{ConnectResponse: &Message{Command: CONNECTED,
+			Headers: Headers{HK_SERVER, rd.srv}}}
+		if n, ok := c.RedeliveryCount(m); n != rd.cn || ok != rd.cok {
+			t.Fatalf("TestDataRedeliveryCount %v %s expected: [%v %v], got [%v %v]\n",
+				rd.h, rd.srv, rd.cn, rd.cok, n, ok)
+		}
+	}
+}
+
+/*
+	Data Test: supported protocol enumeration returns copies.
+*/
+func TestDataSupportedProtocols(t *testing.T) {
+	sp := SupportedProtocols()
+	if len(sp) != 3 || sp[0] != SPL_10 || sp[2] != SPL_12 {
+		t.Fatalf("TestDataSupportedProtocols expected: [%v], got [%v]\n", supported, sp)
+	}
+	sp[0] = "9.9"
+	if pl := Protocols(); pl[0] != SPL_10 {
+		t.Fatalf("TestDataSupportedProtocols Protocols expected: [%v], got [%v]\n", SPL_10, pl[0])
+	}
+	if SupportedProtocols()[0] != SPL_10 || IsProtocolSupported("9.9") {
+		t.Fatalf("TestDataSupportedProtocols package state modified: [%v]\n", supported)
+	}
+	for _, sd := range suptests {
+		if IsProtocolSupported(sd.v) != sd.s {
+			t.Fatalf("TestDataSupportedProtocols %s expected: [%v], got [%v]\n", sd.v, sd.s, !sd.s)
+		}
+	}
+}
+
 /*
 	Data Test: protocols.
 */
@@ -155,6 +231,39 @@ func TestDataBrokerCmdVal(t *testing.T) {
 	}
 }
 
+/*
+	Data Test: Message Copy and ToSend.
+*/
+func TestDataMessageToSend(t *testing.T) {
+	m := &Message{Command: MESSAGE,
+		Headers: Headers{HK_DESTINATION, "/queue/in", HK_MESSAGE_ID, "m1",
+			HK_SUBSCRIPTION, "s1", HK_ACK, "a1", "keya", "valuea",
+			HK_CONTENT_LENGTH, "4"},
+		Body: []byte("body")}
+	f := m.ToSend("/queue/out")
+	if f.Command != SEND {
+		t.Fatalf("TestDataMessageToSend Command, expected: [%s], got [%s]\n",
+			SEND, f.Command)
+	}
+	wh := Headers{HK_DESTINATION, "/queue/out", "keya", "valuea",
+		HK_CONTENT_LENGTH, "4"}
+	if !wh.Compare(f.Headers) {
+		t.Fatalf("TestDataMessageToSend Headers, expected: [%v], got [%v]\n",
+			wh, f.Headers)
+	}
+	for _, k := range []string{HK_MESSAGE_ID, HK_SUBSCRIPTION, HK_ACK} {
+		if _, ok := f.Headers.Contains(k); ok {
+			t.Fatalf("TestDataMessageToSend Header [%s] not stripped\n", k)
+		}
+	}
+	// The body is a copy
+	f.Body[0] = 'B'
+	if m.BodyString() != "body" {
+		t.Fatalf("TestDataMessageToSend Body, expected: [%s], got [%s]\n",
+			"body", m.BodyString())
+	}
+}
+
 func BenchmarkHeaderAdd(b *testing.B) {
 	h := Headers{"k1", "v1"}
 	for n := 0; n < b.N; n++ {
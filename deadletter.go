@@ -0,0 +1,86 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"strconv"
+)
+
+/*
+	Dead letter diagnostic headers, replaced on each dead lettering.
+*/
+var deadLetterHeaders = []string{StompPlusDLQDestination, StompPlusDLQRedelivery,
+	StompPlusDLQReason}
+
+/*
+	DeadLetter routes a poison message, e.g. one past a redelivery limit,
+	to the dead letter destination dlq, and then acks the original, see
+	DeadLetterReason.
+*/
+func (c *Connection) DeadLetter(m Message, dlq string) error {
+	return c.DeadLetterReason(m, dlq, "")
+}
+
+/*
+	DeadLetterReason forwards m to the dead letter destination dlq, as
+	Message.ToSend does, and then acks the original with AckMessage.  The
+	forwarded message carries diagnostic headers:
+
+		"sng_dlq_destination"   The original destination
+		"sng_dlq_redeliveries"  The redelivery count, see RedeliveryCount,
+		                        when known
+		"sng_dlq_reason"        reason, when not empty
+
+	Nothing is acked if the SEND fails.  If the ACK fails the broker may
+	redeliver the original, which has then been dead lettered twice.  On an
+	auto ack subscription the ACK is still sent, use DeadLetterReason only
+	with client or client-individual subscriptions.  EREQDSTSND is returned
+	if dlq is empty.
+
+	Example:
+		if n, ok := c.RedeliveryCount(md.Message); ok && n >= 5 {
+			e := c.DeadLetterReason(md.Message, "/queue/DLQ.orders",
+				"redelivery limit")
+			if e != nil {
+				// Do something sane ...
+			}
+		}
+*/
+func (c *Connection) DeadLetterReason(m Message, dlq, reason string) error {
+	if dlq == "" {
+		return EREQDSTSND
+	}
+	f := m.ToSend(dlq)
+	for _, k := range deadLetterHeaders {
+		for f.Headers.Index(k) >= 0 {
+			f.Headers = f.Headers.Delete(k)
+		}
+	}
+	f.Headers = f.Headers.Add(StompPlusDLQDestination,
+		c.decodedValue(m.Headers.Value(HK_DESTINATION)))
+	if n, ok := c.RedeliveryCount(m); ok {
+		f.Headers = f.Headers.Add(StompPlusDLQRedelivery, strconv.Itoa(n))
+	}
+	if reason != "" {
+		f.Headers = f.Headers.Add(StompPlusDLQReason, reason)
+	}
+	c.log("DEAD_LETTER", dlq, m.Headers, reason)
+	if e := c.SendBytes(f.Headers, f.Body); e != nil {
+		return e
+	}
+	return c.AckMessage(m)
+}
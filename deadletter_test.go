@@ -0,0 +1,92 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"testing"
+	"time"
+)
+
+/*
+	DeadLetter Test: the message is forwarded to the dead letter destination
+	with diagnostic headers, and then the original is acked.
+*/
+func TestDeadLetter(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestDeadLetter Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/orders", HK_ID, "dlq1",
+		HK_ACK, AckModeClientIndividual})
+	if e != nil {
+		t.Fatalf("TestDeadLetter Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // SUBSCRIBE
+	go func() {
+		_ = fb.write(fakeDeadLetterMessage)
+	}()
+	var md MessageData
+	select {
+	case md = <-sc:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestDeadLetter nothing delivered\n")
+	}
+	if e = c.DeadLetter(md.Message, ""); e != EREQDSTSND {
+		t.Fatalf("TestDeadLetter Expected <%v>, got <%v>\n", EREQDSTSND, e)
+	}
+	if e = c.DeadLetterReason(md.Message, deadLetterQueue, "redelivery limit"); e != nil {
+		t.Fatalf("TestDeadLetter Expected nil, got <%v>\n", e)
+	}
+	f := fb.nextFrame(t)
+	if f.Command != SEND || string(f.Body) != "poison" {
+		t.Fatalf("TestDeadLetter Expected <%v poison>, got <%v %s>\n", SEND,
+			f.Command, f.Body)
+	}
+	for _, w := range []struct{ k, v string }{
+		{HK_DESTINATION, deadLetterQueue},
+		{StompPlusDLQDestination, "/queue/orders"},
+		{StompPlusDLQRedelivery, "5"},
+		{StompPlusDLQReason, "redelivery limit"},
+		{HK_CONTENT_TYPE, "text/plain"},
+	} {
+		if v := f.Headers.Value(w.k); v != w.v {
+			t.Fatalf("TestDeadLetter Expected %s <%v>, got <%v>\n", w.k, w.v, v)
+		}
+	}
+	for _, k := range []string{HK_MESSAGE_ID, HK_SUBSCRIPTION, HK_ACK} {
+		if _, ok := f.Headers.Contains(k); ok {
+			t.Fatalf("TestDeadLetter Expected no %s, got <%v>\n", k, f.Headers)
+		}
+	}
+	if f.Headers.ContainsKV(StompPlusDLQReason, "old") {
+		t.Fatalf("TestDeadLetter Expected the old reason removed, got <%v>\n", f.Headers)
+	}
+	f = fb.nextFrame(t)
+	if f.Command != ACK || f.Headers.Value(HK_ID) != "a7" {
+		t.Fatalf("TestDeadLetter Expected <%v a7>, got <%v %v>\n", ACK,
+			f.Command, f.Headers)
+	}
+	if n := c.OutstandingAcksTotal(); n != 0 {
+		t.Fatalf("TestDeadLetter Expected 0 outstanding, got <%v>\n", n)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
@@ -16,7 +16,10 @@
 
 package stompngo
 
-import "time"
+import (
+	"sync/atomic"
+	"time"
+)
 
 /*
 	ExpiredNotification is a callback function, provided by the client
@@ -33,6 +36,7 @@ type deadlineData struct {
 	wde  bool          // Write deadline data enabled
 	wdld time.Duration // Write deadline duration
 	wds  bool          // True if write duration has been set
+	owd  time.Duration // One off write deadline, current frame only, writer use
 	//
 	dlnotify ExpiredNotification
 	dns      bool // True if dlnotify has been set
@@ -43,6 +47,7 @@ type deadlineData struct {
 	t0   time.Time     // 0 value of Time
 	//
 	rfsw bool // Attempt to recover from short writes
+	fia  bool // Frame idle timeout armed, reader use
 }
 
 /*
@@ -104,6 +109,43 @@ func (c *Connection) IsReadDeadlineEnabled() bool {
 	return c.dld.rde
 }
 
+/*
+	SetFrameIdleTimeout sets a read timeout that is re-armed each time a
+	complete frame or heart beat is received.  A frame, including its body,
+	must be fully received within d of the end of the previous one, so a
+	broker that stalls mid frame trips the timeout after d.  The read error
+	is a net.Error with Timeout() true, and any ExpiredNotification callback
+	is called, as for read deadlines.
+
+	Set d above the broker heart beat interval, or the frequency of frames,
+	since an idle connection also trips it.  When set it is used in place
+	of the per read ReadDeadline.  A d of 0 removes the timeout.
+*/
+func (c *Connection) SetFrameIdleTimeout(d time.Duration) {
+	c.log("Frame Idle Timeout", d)
+	if d < 0 {
+		d = 0
+	}
+	atomic.StoreInt64(&c.fit, int64(d))
+}
+
+/*
+	Arm the frame idle timeout for the next frame, reader only.  A removed
+	timeout is disarmed.
+*/
+func (c *Connection) armFrameIdle() {
+	d := time.Duration(atomic.LoadInt64(&c.fit))
+	if d <= 0 {
+		if c.dld.fia {
+			_ = c.netconn.SetReadDeadline(c.dld.t0)
+			c.dld.fia = false
+		}
+		return
+	}
+	_ = c.netconn.SetReadDeadline(time.Now().Add(d))
+	c.dld.fia = true
+}
+
 /*
 	ShortWriteRecovery enables / disables short write recovery.
 	enablement.
@@ -111,3 +153,11 @@ func (c *Connection) IsReadDeadlineEnabled() bool {
 func (c *Connection) ShortWriteRecovery(ro bool) {
 	c.dld.rfsw = ro // Set recovery option
 }
+
+/*
+	ShortWrites returns a count of the short (partial) message body writes
+	on the connection, whether or not they were recovered.
+*/
+func (c *Connection) ShortWrites() int64 {
+	return atomic.LoadInt64(&c.swc)
+}
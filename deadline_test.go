@@ -18,7 +18,9 @@ package stompngo
 
 import (
 	"fmt"
+	"net"
 	"testing"
+	"time"
 )
 
 var _ = fmt.Println
@@ -43,3 +45,91 @@ func TestDeadlineEnablement(t *testing.T) {
 	checkDisconnectError(t, e)
 	_ = closeConn(t, n)
 }
+
+/*
+	Test a one off write deadline for a single SEND.
+*/
+func TestDeadlineOneOff(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	sc := &slowConn{Conn: nc}
+	c, e := Connect(sc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestDeadlineOneOff CONNECT expected nil, got %v\n", e)
+	}
+	c.WriteDeadline(20 * time.Millisecond)
+	c.EnableWriteDeadline(true)
+	sc.setDelay(80 * time.Millisecond)
+	sh := Headers{HK_DESTINATION, "/queue/deadline.oneoff"}
+	// Slow, but within the one off deadline
+	e = c.SendBytesDeadline(sh, []byte(tm), 5*time.Second)
+	if e != nil {
+		t.Fatalf("TestDeadlineOneOff expected nil, got %v\n", e)
+	}
+	// The connection default applies again
+	e = c.SendBytes(sh, []byte(tm))
+	if !isErrorTimeout(e) {
+		t.Fatalf("TestDeadlineOneOff expected timeout, got %v\n", e)
+	}
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Test Deadline: the frame idle timeout is re-armed per frame, frames with
+	short gaps are read, and a broker that stalls mid body trips it.
+*/
+func TestDeadlineFrameIdle(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestDeadlineFrameIdle Expected nil, got <%v>\n", e)
+	}
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/idle", HK_ID, "idle1"})
+	if e != nil {
+		t.Fatalf("TestDeadlineFrameIdle Expected nil, got <%v>\n", e)
+	}
+	c.SetFrameIdleTimeout(frameIdleTimeout)
+	to := make(chan bool, 1)
+	c.ExpiredNotification(func(err error, rw bool) {
+		to <- rw
+	})
+	go func() {
+		for i := 0; i < frameIdleCount; i++ {
+			time.Sleep(frameIdleGap)
+			_ = fb.write(fmt.Sprintf("MESSAGE\ndestination:/queue/idle\n"+
+				"subscription:idle1\nmessage-id:m%d\n\nbody\x00", i))
+			time.Sleep(frameIdleGap)
+			_ = fb.write("\n") // Heart beat
+		}
+		_ = fb.write(fakeFrameIdleStall)
+	}()
+	for i := 0; i < frameIdleCount; i++ {
+		select {
+		case md := <-sc:
+			if md.Error != nil {
+				t.Fatalf("TestDeadlineFrameIdle %d Expected nil, got <%v>\n", i, md.Error)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestDeadlineFrameIdle %d nothing delivered\n", i)
+		}
+	}
+	select {
+	case md := <-sc:
+		ne, ok := md.Error.(net.Error)
+		if !ok || !ne.Timeout() {
+			t.Fatalf("TestDeadlineFrameIdle Expected timeout, got <%v>\n", md.Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestDeadlineFrameIdle stall not detected\n")
+	}
+	select {
+	case rw := <-to:
+		if rw {
+			t.Fatalf("TestDeadlineFrameIdle Expected a read notification\n")
+		}
+	default:
+		t.Fatalf("TestDeadlineFrameIdle Expected an ExpiredNotification\n")
+	}
+	_ = nc.Close()
+	fb.close()
+}
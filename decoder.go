@@ -0,0 +1,132 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"strings"
+)
+
+/*
+	Decoder is a client supplied function that decodes a received message
+	body, see RegisterDecoder.
+*/
+type Decoder func(b []byte) (interface{}, error)
+
+/*
+	DecodedMessage is what SubscribeDecoded delivers.  Value is the result
+	of the decoder registered for the message content-type, or the raw body
+	bytes when no decoder matches.  Error is set for a subscription error,
+	when Headers and Value are nil, or a decoder error, when Value is nil.
+	Use Headers to Ack or Nack the message.
+*/
+type DecodedMessage struct {
+	Headers Headers
+	Value   interface{}
+	Error   error
+}
+
+/*
+	RegisterDecoder sets the decoder used by SubscribeDecoded for messages
+	with a content-type of contentType.  Media type parameters, e.g.
+	";charset=utf-8", are ignored in the match, and the match is case
+	insensitive.  A nil decoder removes the registration.
+
+	Example:
+		c.RegisterDecoder("application/json", func(b []byte) (interface{}, error) {
+			var v map[string]interface{}
+			e := json.Unmarshal(b, &v)
+			return v, e
+		})
+*/
+func (c *Connection) RegisterDecoder(contentType string, d func([]byte) (interface{}, error)) {
+	k := mediaType(contentType)
+	c.drLock.Lock()
+	if d == nil {
+		delete(c.dreg, k)
+	} else {
+		if c.dreg == nil {
+			c.dreg = make(map[string]Decoder)
+		}
+		c.dreg[k] = d
+	}
+	c.drLock.Unlock()
+}
+
+/*
+	SubscribeDecoded subscribes as Subscribe does, and delivers each message
+	decoded with the decoder registered for its content-type, see
+	RegisterDecoder.  Decoders are looked up as each message arrives.
+
+	The returned channel is closed when the subscription channel is closed,
+	e.g. by UnsubscribeReceipt or Disconnect.  A plain Unsubscribe does not
+	close the subscription channel.
+
+	Example:
+		dc, e := c.SubscribeDecoded(h)
+		if e != nil {
+			// Do something sane ...
+		}
+		for dm := range dc {
+			// Process dm.Value ...
+		}
+*/
+func (c *Connection) SubscribeDecoded(h Headers) (<-chan DecodedMessage, error) {
+	sc, e := c.Subscribe(h)
+	if e != nil {
+		return nil, e
+	}
+	r := make(chan DecodedMessage)
+	go func() {
+		defer close(r)
+		for md := range sc {
+			r <- c.decodeMessage(md)
+		}
+	}()
+	return r, nil
+}
+
+/*
+	Decode one message with any registered decoder.
+*/
+func (c *Connection) decodeMessage(md MessageData) DecodedMessage {
+	if md.Error != nil {
+		return DecodedMessage{Error: md.Error}
+	}
+	dm := DecodedMessage{Headers: md.Message.Headers}
+	c.drLock.RLock()
+	d := c.dreg[mediaType(md.Message.Headers.Value(HK_CONTENT_TYPE))]
+	c.drLock.RUnlock()
+	if d == nil {
+		dm.Value = md.Message.Body
+		return dm
+	}
+	dm.Value, dm.Error = d(md.Message.Body)
+	if dm.Error != nil {
+		dm.Value = nil
+	}
+	return dm
+}
+
+/*
+	Media type of a content-type value, without parameters, lower case.
+*/
+func mediaType(ct string) string {
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
@@ -0,0 +1,110 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+/*
+	Decoder Test: messages decoded by content-type, JSON, a custom type, and
+	raw bytes for unmatched types.
+*/
+func TestDecoderSubscribe(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestDecoderSubscribe Expected nil, got <%v>\n", e)
+	}
+	c.RegisterDecoder("application/json", func(b []byte) (interface{}, error) {
+		var v map[string]interface{}
+		e := json.Unmarshal(b, &v)
+		return v, e
+	})
+	c.RegisterDecoder(decoderPointType, func(b []byte) (interface{}, error) {
+		var p decoderPoint
+		_, e := fmt.Sscanf(string(b), "%d,%d", &p.x, &p.y)
+		return p, e
+	})
+	dc, e := c.SubscribeDecoded(Headers{HK_DESTINATION, "/queue/decode", HK_ID, "dec1"})
+	if e != nil {
+		t.Fatalf("TestDecoderSubscribe Expected nil, got <%v>\n", e)
+	}
+	go func() {
+		for i, dd := range decoderList {
+			fr := MESSAGE + "\ndestination:/queue/decode\nsubscription:dec1\n" +
+				fmt.Sprintf("message-id:m%d\n", i)
+			if dd.ct != "" {
+				fr += "content-type:" + dd.ct + "\n"
+			}
+			_ = fb.write(fr + "\n" + dd.body + "\x00")
+		}
+		// Decoder error
+		_ = fb.write(MESSAGE + "\ndestination:/queue/decode\nsubscription:dec1\n" +
+			"message-id:bad\ncontent-type:application/json\n\n{bad\x00")
+	}()
+	for i, dd := range decoderList {
+		select {
+		case dm := <-dc:
+			if dm.Error != nil {
+				t.Fatalf("TestDecoderSubscribe %d Expected nil, got <%v>\n", i, dm.Error)
+			}
+			if !reflect.DeepEqual(dm.Value, dd.want) {
+				t.Fatalf("TestDecoderSubscribe %d Expected <%#v>, got <%#v>\n", i,
+					dd.want, dm.Value)
+			}
+			if v := dm.Headers.Value(HK_MESSAGE_ID); v != fmt.Sprintf("m%d", i) {
+				t.Fatalf("TestDecoderSubscribe %d Expected headers, got <%v>\n", i, dm.Headers)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestDecoderSubscribe %d nothing delivered\n", i)
+		}
+	}
+	select {
+	case dm := <-dc:
+		if dm.Error == nil || dm.Value != nil || dm.Headers.Value(HK_MESSAGE_ID) != "bad" {
+			t.Fatalf("TestDecoderSubscribe Expected decode error, got <%#v>\n", dm)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestDecoderSubscribe bad nothing delivered\n")
+	}
+	// Removed registration falls back to raw bytes
+	c.RegisterDecoder(decoderPointType, nil)
+	go func() {
+		_ = fb.write(MESSAGE + "\ndestination:/queue/decode\nsubscription:dec1\n" +
+			"message-id:raw\ncontent-type:" + decoderPointType + "\n\n5,6\x00")
+	}()
+	select {
+	case dm := <-dc:
+		if b, ok := dm.Value.([]byte); !ok || string(b) != "5,6" {
+			t.Fatalf("TestDecoderSubscribe Expected raw bytes, got <%#v>\n", dm.Value)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestDecoderSubscribe raw nothing delivered\n")
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	if _, ok := <-dc; ok {
+		t.Fatalf("TestDecoderSubscribe Expected closed channel\n")
+	}
+	_ = nc.Close()
+	fb.close()
+}
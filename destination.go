@@ -0,0 +1,78 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"strings"
+)
+
+/*
+	DestinationValidator is a client supplied function used to check
+	destination names before SEND and SUBSCRIBE frames are put on the wire.
+	A non-nil return value is returned to the caller, and the frame is not
+	sent.
+*/
+type DestinationValidator func(d string) error
+
+/*
+	Destination prefixes accepted by ValidateDestinationPrefix.
+*/
+var DestinationPrefixes = []string{"/queue/", "/topic/", "/exchange/",
+	"/temp-queue/"}
+
+/*
+	ValidateDestinationPrefix is a DestinationValidator that accepts only
+	destinations starting with one of the DestinationPrefixes.  EBADDEST
+	is returned otherwise.
+*/
+func ValidateDestinationPrefix(d string) error {
+	for _, p := range DestinationPrefixes {
+		if strings.HasPrefix(d, p) && len(d) > len(p) {
+			return nil
+		}
+	}
+	return EBADDEST
+}
+
+/*
+	SetDestinationValidator sets a destination validator for this connection.
+	It is applied by Send, SendBytes, and Subscribe.
+
+	By default no validator is set, and all destinations are permitted.  Set
+	to "nil" to restore the default.
+
+	Example:
+		c.SetDestinationValidator(stompngo.ValidateDestinationPrefix)
+*/
+func (c *Connection) SetDestinationValidator(dv DestinationValidator) {
+	c.dvLock.Lock()
+	c.dv = dv
+	c.dvLock.Unlock()
+}
+
+/*
+	Check the destination header value with any client validator.
+*/
+func (c *Connection) checkDestination(h Headers) error {
+	c.dvLock.RLock()
+	dv := c.dv
+	c.dvLock.RUnlock()
+	if dv == nil {
+		return nil
+	}
+	return dv(h.Value(HK_DESTINATION))
+}
@@ -0,0 +1,68 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"testing"
+)
+
+/*
+	Destination Test: default prefix validator.
+*/
+func TestDestinationPrefix(t *testing.T) {
+	for _, dd := range destPrefixList {
+		if e := ValidateDestinationPrefix(dd.dest); e != dd.errval {
+			t.Fatalf("TestDestinationPrefix Expected <%v>, got <%v>, dest: %s\n",
+				dd.errval, e, dd.dest)
+		}
+	}
+}
+
+/*
+	Destination Test: validator applied to SEND and SUBSCRIBE.
+*/
+func TestDestinationValidator(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestDestinationValidator Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	bh := Headers{HK_DESTINATION, "/qeueu/typo"}
+	if e = c.Send(bh, tm); e != nil {
+		t.Fatalf("TestDestinationValidator Expected nil, got <%v>\n", e)
+	}
+	c.SetDestinationValidator(ValidateDestinationPrefix)
+	if e = c.Send(bh, tm); e != EBADDEST {
+		t.Fatalf("TestDestinationValidator Expected <%v>, got <%v>\n", EBADDEST, e)
+	}
+	if e = c.SendBytes(bh, []byte(tm)); e != EBADDEST {
+		t.Fatalf("TestDestinationValidator Expected <%v>, got <%v>\n", EBADDEST, e)
+	}
+	if _, e = c.Subscribe(bh); e != EBADDEST {
+		t.Fatalf("TestDestinationValidator Expected <%v>, got <%v>\n", EBADDEST, e)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = fb.nextFrame(t) // The first SEND
+	if f := fb.nextFrame(t); f.Command != DISCONNECT {
+		t.Fatalf("TestDestinationValidator Expected <%v>, got <%v>\n",
+			DISCONNECT, f.Command)
+	}
+	_ = nc.Close()
+	fb.close()
+}
@@ -0,0 +1,243 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+/*
+	Dial is a convenience helper that obtains a network connection to a
+	broker at addr ("host:port"), and then performs a STOMP Connect over it.
+	The network is "tcp" unless overridden with WithNetwork.
+
+	The returned Connection owns the network connection, which is closed
+	after Disconnect, or if Connect fails.
+
+	STOMP 1.1 and 1.2 require a host header.  If h requests a level above
+	1.0 and has no host header, Dial adds one from the host part of addr.
+	A caller supplied host header is always used as is, and the
+	WithoutAutoHost option disables this.  DialUnix never adds one.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_ACCEPT_VERSION, "1.2"}
+		c, e := stompngo.Dial("localhost:61613", h) // host:localhost
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func Dial(addr string, h Headers, opts ...ConnectOption) (*Connection, error) {
+	o := newConnectOptions(opts)
+	nw, e := dialNetwork(o)
+	if e != nil {
+		return nil, e
+	}
+	if !o.nahs {
+		h = dialHostHeaders(addr, h)
+	}
+	return dialConnect(nw, addr, h, opts)
+}
+
+/*
+	Add a host header from the dial address, when h requests a level above
+	1.0 and has none.  h itself is not modified.
+*/
+func dialHostHeaders(addr string, h Headers) Headers {
+	if h == nil {
+		return h
+	}
+	if _, ok := h.Contains(HK_HOST); ok {
+		return h
+	}
+	v11 := false
+	for _, v := range strings.Split(h.Value(HK_ACCEPT_VERSION), ",") {
+		if v != "" && v != SPL_10 {
+			v11 = true
+		}
+	}
+	if !v11 {
+		return h
+	}
+	hn, _, e := net.SplitHostPort(addr)
+	if e != nil || hn == "" {
+		return h
+	}
+	return h.Clone().Add(HK_HOST, hn)
+}
+
+/*
+	Determine and validate the network for Dial.
+*/
+func dialNetwork(o *connectOptions) (string, error) {
+	switch o.netw {
+	case "":
+		return NetProtoTCP, nil
+	case NetProtoTCP, NetProtoTCP4, NetProtoTCP6:
+		return o.netw, nil
+	}
+	return "", EBADNET
+}
+
+/*
+	DialUnix is a convenience helper that obtains a Unix domain socket
+	connection to a broker listening on path, and then performs a STOMP
+	Connect over it.
+
+	The returned Connection owns the network connection, which is closed
+	after Disconnect, or if Connect fails.
+
+	Example:
+		c, e := stompngo.DialUnix("/var/run/broker/stomp.sock", h)
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func DialUnix(path string, h Headers, opts ...ConnectOption) (*Connection, error) {
+	return dialConnect(NetProtoUnix, path, h, opts)
+}
+
+/*
+	RetryPolicy controls connect retries by the dial helpers, see
+	WithConnectRetry.  The delay before the first retry is Initial, and each
+	later delay is the previous one times Factor, limited to Max.
+*/
+type RetryPolicy struct {
+	Attempts int           // Total connect attempts, < 1 means 1
+	Initial  time.Duration // Delay before the first retry
+	Max      time.Duration // Delay limit, 0 means no limit
+	Factor   float64       // Delay multiplier, < 1 means 2
+}
+
+/*
+	WithConnectRetry makes Dial and DialUnix retry the whole connect, the
+	network dial and the STOMP handshake, after a transient failure, with
+	backoff per the policy p.  This helps at startup in orchestrated
+	environments, where the broker may become available a little later than
+	the client.
+
+	Transient failures are connection refused or reset, a network timeout,
+	the broker closing the connection during the handshake, and an expired
+	handshake timeout (see WithHandshakeWriteTimeout).  Other failures are
+	permanent and are returned at once, e.g. an unknown host or an invalid
+	address, a ConnectError when the broker rejects the credentials with an
+	ERROR frame, or a protocol level mismatch.  After the last attempt the
+	last error is returned.
+
+	Retries stop if the context set by WithContext is done.
+
+	Example:
+		c, e := stompngo.Dial("broker:61613", h,
+			stompngo.WithConnectRetry(stompngo.RetryPolicy{Attempts: 10,
+				Initial: 100 * time.Millisecond, Max: 5 * time.Second}))
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func WithConnectRetry(p RetryPolicy) ConnectOption {
+	return func(o *connectOptions) {
+		o.rtry = &p
+	}
+}
+
+/*
+	A network dialer, net.Dial by default.
+*/
+type dialFunc func(network, addr string) (net.Conn, error)
+
+/*
+	Check for a transient connect failure, worth a retry.
+*/
+func transientConnectError(e error) bool {
+	if errors.Is(e, EHSTMO) || errors.Is(e, io.EOF) || errors.Is(e, io.ErrUnexpectedEOF) {
+		return true
+	}
+	if errors.Is(e, syscall.ECONNREFUSED) || errors.Is(e, syscall.ECONNRESET) {
+		return true
+	}
+	var ne net.Error // DNS and address errors are not timeouts
+	return errors.As(e, &ne) && ne.Timeout()
+}
+
+/*
+	Common dial and connect logic, with any connect retries.
+*/
+func dialConnect(network, addr string, h Headers,
+	opts []ConnectOption) (*Connection, error) {
+	if _, ok := h.Contains(HK_RECEIPT); ok { // Before dialing, see Connect
+		return nil, ENORECPT
+	}
+	o := newConnectOptions(opts)
+	if o.rtry == nil {
+		return dialConnectOnce(network, addr, h, opts)
+	}
+	p := *o.rtry
+	if p.Factor < 1 {
+		p.Factor = 2
+	}
+	d := p.Initial
+	for n := 1; ; n++ {
+		c, e := dialConnectOnce(network, addr, h, opts)
+		if e == nil || n >= p.Attempts || !transientConnectError(e) {
+			return c, e
+		}
+		if o.ctx != nil {
+			tm := time.NewTimer(d)
+			select {
+			case _ = <-o.ctx.Done():
+				tm.Stop()
+				return c, o.ctx.Err()
+			case _ = <-tm.C:
+			}
+		} else {
+			time.Sleep(d)
+		}
+		d = time.Duration(float64(d) * p.Factor)
+		if p.Max > 0 && d > p.Max {
+			d = p.Max
+		}
+	}
+}
+
+/*
+	One dial and connect attempt.
+*/
+func dialConnectOnce(network, addr string, h Headers,
+	opts []ConnectOption) (*Connection, error) {
+	df := net.Dial
+	if o := newConnectOptions(opts); o.dlfn != nil {
+		df = o.dlfn
+	}
+	n, e := df(network, addr)
+	if e != nil {
+		return nil, e
+	}
+	opts = append(opts[:len(opts):len(opts)], func(o *connectOptions) {
+		o.ownc = true
+		o.dlnw, o.dlad = network, addr
+	})
+	c, e := Connect(n, h, opts...)
+	if e != nil {
+		_ = n.Close()
+		return c, e
+	}
+	return c, nil
+}
@@ -0,0 +1,301 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/*
+	Dial Test: STOMP over a Unix domain socket.
+*/
+func TestDialUnix(t *testing.T) {
+	td, e := ioutil.TempDir("", "stompngo")
+	if e != nil {
+		t.Fatalf("TestDialUnix TempDir error <%v>\n", e)
+	}
+	defer os.RemoveAll(td)
+	sp := filepath.Join(td, "stomp.sock")
+	l, fbc := listenFakeBroker(t, NetProtoUnix, sp)
+	defer l.Close()
+	c, e := DialUnix(sp, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestDialUnix Expected nil, got <%v>\n", e)
+	}
+	fb := <-fbc
+	if c.Protocol() != SPL_12 {
+		t.Fatalf("TestDialUnix Expected <%v>, got <%v>\n", SPL_12, c.Protocol())
+	}
+	if e = c.Send(Headers{HK_DESTINATION, "/queue/unix"}, tm); e != nil {
+		t.Fatalf("TestDialUnix Expected nil, got <%v>\n", e)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = fb.nextFrame(t) // CONNECT
+	if f := fb.nextFrame(t); f.Command != SEND || string(f.Body) != tm {
+		t.Fatalf("TestDialUnix Expected <%v>, got <%v>\n", SEND, f.Command)
+	}
+	fb.close()
+}
+
+/*
+	Dial Test: network selection and validation.
+*/
+func TestDialNetwork(t *testing.T) {
+	for _, nd := range dialNetworkList {
+		nw, e := dialNetwork(newConnectOptions([]ConnectOption{WithNetwork(nd.netw)}))
+		if e != nd.e {
+			t.Fatalf("TestDialNetwork Network <%v> Expected <%v>, got <%v>\n",
+				nd.netw, nd.e, e)
+		}
+		if nw != nd.want {
+			t.Fatalf("TestDialNetwork Network <%v> Expected <%v>, got <%v>\n",
+				nd.netw, nd.want, nw)
+		}
+	}
+	_, e := Dial("localhost:61613", fake12Headers, WithNetwork("udp"))
+	if e != EBADNET {
+		t.Fatalf("TestDialNetwork Expected <%v>, got <%v>\n", EBADNET, e)
+	}
+}
+
+/*
+	Dial Test: IPv4 forced over loopback.
+*/
+func TestDialTCP4(t *testing.T) {
+	l, fbc := listenFakeBroker(t, NetProtoTCP4, "127.0.0.1:0")
+	defer l.Close()
+	c, e := Dial(l.Addr().String(), fake12Headers, WithNetwork(NetProtoTCP4))
+	if e != nil {
+		t.Fatalf("TestDialTCP4 Expected nil, got <%v>\n", e)
+	}
+	fb := <-fbc
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
+
+/*
+	Dial Test: network connection accessors.
+*/
+func TestDialNetConn(t *testing.T) {
+	var nc *Connection
+	if nc.NetConn() != nil || nc.LocalAddr() != nil || nc.RemoteAddr() != nil {
+		t.Fatalf("TestDialNetConn Expected nil for nil Connection\n")
+	}
+	c := &Connection{}
+	if c.NetConn() != nil || c.LocalAddr() != nil || c.RemoteAddr() != nil {
+		t.Fatalf("TestDialNetConn Expected nil before connect\n")
+	}
+	l, fbc := listenFakeBroker(t, NetProtoTCP4, "127.0.0.1:0")
+	defer l.Close()
+	c, e := Dial(l.Addr().String(), fake12Headers)
+	if e != nil {
+		t.Fatalf("TestDialNetConn Expected nil, got <%v>\n", e)
+	}
+	fb := <-fbc
+	if c.NetConn() == nil {
+		t.Fatalf("TestDialNetConn Expected a net.Conn, got nil\n")
+	}
+	if ra := c.RemoteAddr(); ra == nil || ra.String() != l.Addr().String() {
+		t.Fatalf("TestDialNetConn Expected <%v>, got <%v>\n", l.Addr(), ra)
+	}
+	if c.LocalAddr() == nil {
+		t.Fatalf("TestDialNetConn Expected a local address, got nil\n")
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
+
+/*
+	Dial Test: host header derived from the dial address.
+*/
+func TestDialAutoHost(t *testing.T) {
+	for _, hd := range dialHostList {
+		hc := hd.h.Clone()
+		r := dialHostHeaders(hd.addr, hd.h)
+		if v := r.Value(HK_HOST); v != hd.want {
+			t.Fatalf("TestDialAutoHost Addr <%v> Expected <%v>, got <%v>\n",
+				hd.addr, hd.want, v)
+		}
+		if !hd.h.Compare(hc) {
+			t.Fatalf("TestDialAutoHost Addr <%v> headers modified <%v>\n",
+				hd.addr, hd.h)
+		}
+	}
+	// On the wire, and disabled
+	for _, auto := range []bool{true, false} {
+		l, fbc := listenFakeBroker(t, NetProtoTCP4, "127.0.0.1:0")
+		var opts []ConnectOption
+		if !auto {
+			opts = append(opts, WithoutAutoHost())
+		}
+		c, e := Dial(l.Addr().String(), Headers{HK_ACCEPT_VERSION, SPL_12}, opts...)
+		if !auto {
+			if e != EREQHOST {
+				t.Fatalf("TestDialAutoHost Expected <%v>, got <%v>\n", EREQHOST, e)
+			}
+			_ = l.Close()
+			continue
+		}
+		if e != nil {
+			t.Fatalf("TestDialAutoHost Expected nil, got <%v>\n", e)
+		}
+		fb := <-fbc
+		if f := fb.nextFrame(t); f.Headers.Value(HK_HOST) != "127.0.0.1" {
+			t.Fatalf("TestDialAutoHost Expected <127.0.0.1>, got <%v>\n",
+				f.Headers.Value(HK_HOST))
+		}
+		e = c.Disconnect(empty_headers)
+		checkDisconnectError(t, e)
+		fb.close()
+		_ = l.Close()
+	}
+}
+
+/*
+	Test helper.  Listen on IPv4 loopback, close the first drop accepted
+	connections at once, and serve later ones with a fake broker answering
+	resp.  The returned channel receives each fake broker.
+*/
+func listenDropBroker(t *testing.T, drop int, resp string) (net.Listener,
+	<-chan *fakeBroker) {
+	l, e := net.Listen(NetProtoTCP4, "127.0.0.1:0")
+	if e != nil {
+		t.Skipf("listenDropBroker not available <%v>\n", e)
+	}
+	fbc := make(chan *fakeBroker, dialRetryAttempts)
+	go func() {
+		for n := 0; ; n++ {
+			sn, e := l.Accept()
+			if e != nil {
+				close(fbc)
+				return
+			}
+			if n < drop {
+				_ = sn.Close()
+				continue
+			}
+			fbc <- newFakeBroker(sn, resp)
+		}
+	}()
+	return l, fbc
+}
+
+/*
+	Dial Test: transient failures, a broker closing during the handshake
+	and a refused connection, are retried.
+*/
+func TestDialRetryTransient(t *testing.T) {
+	l, fbc := listenDropBroker(t, 2, fakeConnected12)
+	defer l.Close()
+	c, e := Dial(l.Addr().String(), fake12Headers, WithConnectRetry(dialRetryPolicy))
+	if e != nil {
+		t.Fatalf("TestDialRetryTransient Expected nil, got <%v>\n", e)
+	}
+	fb := <-fbc
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+	// Nothing listening, every attempt is refused
+	ra := l.Addr().String()
+	_ = l.Close()
+	st := time.Now()
+	_, e = Dial(ra, fake12Headers, WithConnectRetry(dialRetryPolicy))
+	if !transientConnectError(e) {
+		t.Fatalf("TestDialRetryTransient Expected a network error, got <%v>\n", e)
+	}
+	// Backoff waits 10, 20, and then 30 ms at most
+	if el := time.Since(st); el < 60*time.Millisecond {
+		t.Fatalf("TestDialRetryTransient Expected retries, took <%v>\n", el)
+	}
+}
+
+/*
+	Dial Test: a broker ERROR rejecting CONNECT is permanent, and not
+	retried.
+*/
+func TestDialRetryPermanent(t *testing.T) {
+	l, fbc := listenDropBroker(t, 0, fakeErrorFrame)
+	defer l.Close()
+	_, e := Dial(l.Addr().String(), fake12Headers, WithConnectRetry(dialRetryPolicy))
+	if _, ok := e.(ConnectError); !ok {
+		t.Fatalf("TestDialRetryPermanent Expected ConnectError, got <%v>\n", e)
+	}
+	fb := <-fbc
+	fb.close()
+	_ = l.Close()
+	n := 0
+	for fb = range fbc {
+		n++
+		fb.close()
+	}
+	if n != 0 {
+		t.Fatalf("TestDialRetryPermanent Expected 1 attempt, got <%d>\n", n+1)
+	}
+}
+
+/*
+	Dial Test: an unknown host or an invalid address is permanent, and
+	dialed only once.
+*/
+func TestDialRetryNoHost(t *testing.T) {
+	for _, addr := range dialNoHostAddrs {
+		n := 0
+		cd := func(o *connectOptions) {
+			o.dlfn = func(network, addr string) (net.Conn, error) {
+				n++
+				return net.Dial(network, addr)
+			}
+		}
+		_, e := Dial(addr, fake12Headers, WithConnectRetry(dialRetryPolicy), cd)
+		if e == nil {
+			t.Fatalf("TestDialRetryNoHost Expected an error, addr <%s>\n", addr)
+		}
+		if n != 1 {
+			t.Fatalf("TestDialRetryNoHost Expected 1 attempt, got <%d>, addr <%s>, error <%v>\n",
+				n, addr, e)
+		}
+	}
+}
+
+/*
+	Dial Test: a receipt on connect fails before dialing.  The address has
+	no listener, so any dial attempt would fail differently.
+*/
+func TestDialNoReceipt(t *testing.T) {
+	l, e := net.Listen(NetProtoTCP4, "127.0.0.1:0")
+	if e != nil {
+		t.Skipf("TestDialNoReceipt listen not available <%v>\n", e)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	if _, e = Dial(addr, dialReceiptHeaders,
+		WithConnectRetry(dialRetryPolicy)); e != ENORECPT {
+		t.Fatalf("TestDialNoReceipt Expected <%v>, got <%v>\n", ENORECPT, e)
+	}
+	if _, e = DialUnix(filepath.Join(os.TempDir(), "stompngo-none.sock"),
+		dialReceiptHeaders); e != ENORECPT {
+		t.Fatalf("TestDialNoReceipt Expected <%v>, got <%v>\n", ENORECPT, e)
+	}
+}
@@ -16,6 +16,11 @@
 
 package stompngo
 
+import (
+	"sync/atomic"
+	"time"
+)
+
 /*
 	Disconnect from a STOMP broker.
 
@@ -29,6 +34,11 @@ package stompngo
 	supplied receipt id.  Otherwise generate a unique receipt id and add that
 	to the DISCONNECT headers.
 
+	Some brokers close the network connection as soon as DISCONNECT is
+	received.  That is not treated as an error if no receipt was requested.
+	If a receipt was requested and the broker closes the connection before
+	sending it, EDISCEOF is returned.
+
 	Example:
 		h := stompngo.Headers{HK_RECEIPT, "receipt-id1"} // Ask for a receipt
 		e := c.Disconnect(h)
@@ -46,44 +56,151 @@ package stompngo
 
 */
 func (c *Connection) Disconnect(h Headers) error {
+	return c.disconnect(h, nil, 0)
+}
+
+/*
+	DisconnectConfirmed disconnects with a generated receipt request, and
+	waits up to timeout for the matching RECEIPT, which is then available
+	in DisconnectReceipt.  The connection is shut down in all cases.  This
+	is the reliable shutdown most applications want.
+
+	EDRCPTTMO is returned if the RECEIPT does not arrive in time, EDISCEOF if
+	the broker closes the connection first, and a BrokerError if the broker
+	answers with an ERROR frame.  As with Disconnect, the network connection
+	is only closed if the Connection owns it, e.g. after Dial.
+
+	Example:
+		e := c.DisconnectConfirmed(5 * time.Second)
+		if e != nil {
+			// Shutdown not confirmed by the broker ...
+		}
+*/
+func (c *Connection) DisconnectConfirmed(timeout time.Duration) error {
+	e := c.disconnect(Headers{}, nil, timeout)
+	if e == nil && c.DisconnectReceipt.Message.Command == ERROR {
+		return BrokerError{c.DisconnectReceipt.Message}
+	}
+	return e
+}
+
+/*
+	Disconnect logic, with a reason for any state change callback, and a
+	receipt wait limit, 0 meaning wait for as long as it takes.
+*/
+func (c *Connection) disconnect(h Headers, why error, t time.Duration) error {
 	c.discLock.Lock()
 	defer c.discLock.Unlock()
 	//
-	if !c.connected {
+	if !c.Connected() {
 		return ECONBAD
 	}
 	c.log(DISCONNECT, "start", h)
-	e := checkHeaders(h, c.Protocol())
+	e := c.validateHeaders(h)
 	if e != nil {
 		return e
 	}
+	c.ResumeSubscriptions() // The receipt may be behind a held MESSAGE
 	ch := h.Clone()
 	// If the caller does not want a receipt do not ask for one.  Otherwise,
 	// add a receipt request if caller did not specifically ask for one.  This is
 	// in the spirit of the specification, and allows reasonable resource cleanup
 	// in both the client and the message broker.
 	_, cwr := ch.Contains("noreceipt")
+	var rid string
+	var rc chan MessageData
 	if !cwr {
-		if _, ok := ch.Contains(HK_RECEIPT); !ok {
-			ch = append(ch, HK_RECEIPT, Uuid())
+		var ok bool
+		if rid, ok = ch.Contains(HK_RECEIPT); !ok {
+			rid = c.newId(IdReceipt)
+			ch = append(ch, HK_RECEIPT, rid)
+		}
+		// The reader delivers the receipt to the registry, not MessageData
+		if rc, e = c.registerReceipt(rid, false, false); e != nil {
+			return e
 		}
 	}
 	//
 	f := Frame{DISCONNECT, ch, NULLBUFF}
 	//
-	r := make(chan error)
-	c.output <- wiredata{f, r}
-	e = <-r
+	atomic.StoreInt32(&c.dsnt, 1) // A broker EOF from here on is expected
+	e = c.wireSend(f, 0)
 	// Drive shutdown logic
-	c.shutdown()
+	c.shutdown(why)
 	// Only set DisconnectReceipt if we sucessfully received one.
-	if !cwr && e == nil {
-		// Receipt
-		c.DisconnectReceipt = <-c.input
-		c.log(DISCONNECT, "dr", ch, c.DisconnectReceipt)
+	if !cwr {
+		if e == nil {
+			// Receipt, or the read error that prevents one
+			c.DisconnectReceipt = c.waitDisconnectReceipt(rc, t)
+			c.drr = true
+			if de := c.DisconnectReceipt.Error; de == EDISCEOF || de == EDRCPTTMO {
+				e = de
+			}
+			c.log(DISCONNECT, "dr", ch, c.DisconnectReceipt)
+		}
+		c.removeReceipt(rid)
 	}
+	close(c.drc)
 	c.log(DISCONNECT, "ends", ch)
 	close(c.ssdc)
 	c.log(DISCONNECT, "system shutdown cannel closed")
+	if c.copts.ownc {
+		_ = c.netconn.Close()
+	}
 	return e
 }
+
+/*
+	WaitDisconnectReceipt waits for a Disconnect, possibly in progress in
+	another goroutine, to complete, and returns the DISCONNECT receipt.  This
+	makes a clean shutdown verifiable.
+
+	EDRCPTTMO is returned if the Disconnect does not complete within the
+	duration t.  EDRCPTNO is returned if the Disconnect did not request a
+	receipt, or failed to send the DISCONNECT frame.  An ERROR frame in
+	response to the DISCONNECT is returned as a BrokerError, and a read error
+	as itself.
+
+	Example:
+		go func() {
+			_ = c.Disconnect(stompngo.Headers{})
+		}()
+		md, e := c.WaitDisconnectReceipt(5 * time.Second)
+		if e != nil {
+			// Shutdown not confirmed by the broker ...
+		}
+*/
+func (c *Connection) WaitDisconnectReceipt(t time.Duration) (MessageData, error) {
+	tm := time.NewTimer(t)
+	defer tm.Stop()
+	select {
+	case _ = <-c.drc:
+	case _ = <-tm.C:
+		return MessageData{}, EDRCPTTMO
+	}
+	if !c.drr {
+		return MessageData{}, EDRCPTNO
+	}
+	md := c.DisconnectReceipt
+	if md.Error == nil && md.Message.Command == ERROR {
+		return md, BrokerError{md.Message}
+	}
+	return md, md.Error
+}
+
+/*
+	Wait for the DISCONNECT receipt, for at most t if t is positive.
+*/
+func (c *Connection) waitDisconnectReceipt(rc chan MessageData, t time.Duration) MessageData {
+	if t <= 0 {
+		return <-rc
+	}
+	tm := time.NewTimer(t)
+	defer tm.Stop()
+	select {
+	case md := <-rc:
+		return md
+	case _ = <-tm.C:
+		return MessageData{Error: EDRCPTTMO}
+	}
+}
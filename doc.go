@@ -85,8 +85,10 @@
 
 	Receipts are never received on a subscription unique MessageData channel.
 
-	They are always queued to the shared connection level
-	stompgo.Connection.MessageData channel.
+	Unless a receipt is waited for, e.g. by SendBytesR and WaitReceipt, it is
+	queued to the shared connection level stompgo.Connection.MessageData
+	channel, or to the channel set by SetDefaultMessageSink.  See
+	SetDefaultMessageSink for the routing of every frame type.
 
 	The reason for this behavior is because RECEIPT frames do not contain a subscription Header
 	(per the STOMP specifications).  See the:
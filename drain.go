@@ -0,0 +1,227 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"context"
+	"time"
+)
+
+/*
+	Poll interval for DrainSubscriptions.
+*/
+const drainPollInterval = 10 * time.Millisecond
+
+/*
+	DrainSubscriptions stops new MESSAGE deliveries, and waits until
+	consumers have read every message buffered in the subscription channels
+	and, for client and client-individual subscriptions, acknowledged every
+	delivered message.  It returns nil once drained, or ctx.Err() if ctx is
+	done first.
+
+	Unlike Unsubscribe or Disconnect, subscriptions and the connection stay
+	open, and deliveries stay stopped in both cases until
+	ResumeSubscriptions is called.  This supports rolling consumer restarts.
+
+	While stopped the reader holds the next MESSAGE frame received, and reads
+	nothing after it, so heart beats and receipts behind it are not seen.
+	Keep the stop short on connections with broker heart beats.  Disconnect
+	resumes deliveries itself.  ECONBAD is returned if the connection is not
+	connected.
+
+	Example:
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if e := c.DrainSubscriptions(ctx); e != nil {
+			// Not fully drained ...
+		}
+		// Checkpoint, then later ...
+		c.ResumeSubscriptions()
+*/
+func (c *Connection) DrainSubscriptions(ctx context.Context) error {
+	if !c.Connected() {
+		return ECONBAD
+	}
+	c.rpLock.Lock()
+	if c.rpc == nil {
+		c.rpc = make(chan struct{})
+	}
+	c.rpLock.Unlock()
+	c.log("DRAIN", "subscriptions start")
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for !c.subscriptionsDrained() {
+		select {
+		case <-ctx.Done():
+			c.log("DRAIN", "subscriptions incomplete", ctx.Err())
+			return ctx.Err()
+		case _ = <-c.ssdc:
+			return ECONBAD
+		case <-ticker.C:
+		}
+	}
+	c.log("DRAIN", "subscriptions complete")
+	return nil
+}
+
+/*
+	ResumeSubscriptions restarts MESSAGE deliveries stopped by
+	DrainSubscriptions.  It does nothing if deliveries are not stopped.
+*/
+func (c *Connection) ResumeSubscriptions() {
+	c.rpLock.Lock()
+	if c.rpc != nil {
+		close(c.rpc)
+		c.rpc = nil
+	}
+	c.rpLock.Unlock()
+}
+
+/*
+	True when all subscription channels are empty and no acks are
+	outstanding.
+*/
+func (c *Connection) subscriptionsDrained() bool {
+	if c.OutstandingAcksTotal() > 0 {
+		return false
+	}
+	c.subsLock.RLock()
+	defer c.subsLock.RUnlock()
+	for _, ps := range c.subs {
+		if len(ps.md) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+	Wait while deliveries are stopped by DrainSubscriptions, reader only.
+	Returns false if the connection shuts down meanwhile.
+*/
+func (c *Connection) waitReaderResume() bool {
+	c.rpLock.Lock()
+	rc := c.rpc
+	c.rpLock.Unlock()
+	if rc == nil {
+		return true
+	}
+	c.log("RDR_PAUSED")
+	select {
+	case <-rc:
+		return true
+	case _ = <-c.ssdc:
+		return false
+	}
+}
+
+/*
+	DrainBuffered removes and returns any MESSAGE frames still buffered in
+	subscription channels, keyed by subscription id.  Subscriptions with
+	nothing buffered are omitted.
+
+	It is intended for use during or after shutdown, e.g. after an unexpected
+	disconnect, so that applications can persist or reprocess messages which
+	would otherwise be lost.  Error notifications queued on the channels are
+	consumed and discarded.  Messages displaced from a full channel to make
+	room for a final read error are included, oldest first.
+
+	Example:
+		for id, mds := range c.DrainBuffered() {
+			for _, md := range mds {
+				// Persist or reprocess md.Message for subscription id ...
+			}
+		}
+*/
+func (c *Connection) DrainBuffered() map[string][]MessageData {
+	r := make(map[string][]MessageData)
+	// This is a write lock, subscription channels can not be closed or
+	// removed while draining.
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	for key, ps := range c.subs {
+		mds := ps.dspl
+		ps.dspl = nil
+	drainLoop:
+		for {
+			select {
+			case md, ok := <-ps.md:
+				if !ok {
+					break drainLoop
+				}
+				if md.Error == nil {
+					mds = append(mds, md)
+				}
+			default:
+				break drainLoop
+			}
+		}
+		if len(mds) > 0 {
+			r[key] = mds
+		}
+	}
+	return r
+}
+
+/*
+	SubscribeDrainAfterDuration subscribes as Subscribe does, and closes the
+	subscription after duration d.  When d elapses the subscription is
+	unsubscribed and its MessageData channel is closed, so a range over the
+	channel ends.  The "sng_draftertime" header is set to d.
+
+	EBADDRAT is returned if d is not positive.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/batch"}
+		s, e := c.SubscribeDrainAfterDuration(h, 30*time.Second)
+		if e != nil {
+			// Do something sane ...
+		}
+		for md := range s {
+			// Consume for 30 seconds ...
+		}
+*/
+func (c *Connection) SubscribeDrainAfterDuration(h Headers, d time.Duration) (<-chan MessageData, error) {
+	if h == nil {
+		return nil, EHDRNIL
+	}
+	if d <= 0 {
+		return nil, EBADDRAT
+	}
+	ch := h.Clone()
+	for ch.Index(StompPlusDrainAfterTime) >= 0 {
+		ch = ch.Delete(StompPlusDrainAfterTime)
+	}
+	return subChan(c.subscribe(ch.Add(StompPlusDrainAfterTime, d.String()), 0))
+}
+
+/*
+	Start the close after duration timer for a new subscription.
+*/
+func (c *Connection) startDrainTimer(sd *subscription) {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	if sd.cs {
+		return
+	}
+	sd.drtm = time.AfterFunc(sd.drat, func() {
+		c.subLog(sd, UNSUBSCRIBE, "drain after time", sd.id, sd.drat)
+		if e := c.closeSubscription(sd); e != nil {
+			c.subLog(sd, UNSUBSCRIBE, "drain after time", sd.id, e)
+		}
+	})
+}
@@ -0,0 +1,317 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+/*
+	Drain Test: buffered messages are returned after an unexpected disconnect.
+*/
+func TestDrainBuffered(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestDrainBuffered Expected nil, got <%v>\n", e)
+	}
+	c.SetSubChanCap(8)
+	sh := Headers{HK_DESTINATION, "/queue/drain", HK_ID, "drain1"}
+	sc, e := c.Subscribe(sh)
+	if e != nil {
+		t.Fatalf("TestDrainBuffered Expected nil, got <%v>\n", e)
+	}
+	for i := 0; i < 3; i++ {
+		_ = fb.write(fakeDrainMessage)
+	}
+	to := time.After(5 * time.Second)
+	for len(sc) < 3 {
+		select {
+		case <-to:
+			t.Fatalf("TestDrainBuffered Expected 3 buffered, got <%v>\n", len(sc))
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	fb.close() // Unexpected broker disconnect
+	select {
+	case <-c.MessageData: // The read error
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestDrainBuffered read error not delivered\n")
+	}
+	d := c.DrainBuffered()
+	if len(d["drain1"]) != 3 {
+		t.Fatalf("TestDrainBuffered Expected 3, got <%v>\n", len(d["drain1"]))
+	}
+	for _, md := range d["drain1"] {
+		if md.Message.Command != MESSAGE {
+			t.Fatalf("TestDrainBuffered Expected <%v>, got <%v>\n",
+				MESSAGE, md.Message.Command)
+		}
+	}
+	if d = c.DrainBuffered(); len(d) != 0 {
+		t.Fatalf("TestDrainBuffered Expected empty, got <%v>\n", d)
+	}
+	_ = nc.Close()
+}
+
+/*
+	Drain Test: subscribers receive the read error before channel close.
+*/
+func TestDrainReadError(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestDrainReadError Expected nil, got <%v>\n", e)
+	}
+	c.SetSubChanCap(2) // Room for the message and the error
+	sh := Headers{HK_DESTINATION, "/queue/drain", HK_ID, "drain1"}
+	sc, e := c.Subscribe(sh)
+	if e != nil {
+		t.Fatalf("TestDrainReadError Expected nil, got <%v>\n", e)
+	}
+	_ = fb.write(fakeDrainMessage)
+	fb.close() // Unexpected broker disconnect
+	var mds []MessageData
+	to := time.After(5 * time.Second)
+readLoop:
+	for {
+		select {
+		case md, ok := <-sc:
+			if !ok {
+				break readLoop
+			}
+			mds = append(mds, md)
+		case <-to:
+			t.Fatalf("TestDrainReadError subscription channel not closed\n")
+		}
+	}
+	if len(mds) != 2 {
+		t.Fatalf("TestDrainReadError Expected 2, got <%v>\n", len(mds))
+	}
+	if mds[0].Error != nil || mds[0].Message.Command != MESSAGE {
+		t.Fatalf("TestDrainReadError Expected <%v>, got <%v>\n", MESSAGE, mds[0])
+	}
+	if mds[1].Error == nil {
+		t.Fatalf("TestDrainReadError Expected a read error, got nil\n")
+	}
+	_ = nc.Close()
+}
+
+/*
+	Drain Test: a full subscription channel with no reader gets the read
+	error without blocking, and the displaced message is drained.
+*/
+func TestDrainReadErrorFull(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestDrainReadErrorFull Expected nil, got <%v>\n", e)
+	}
+	sh := Headers{HK_DESTINATION, "/queue/drain", HK_ID, "drain1"}
+	sc, e := c.Subscribe(sh) // Capacity 1
+	if e != nil {
+		t.Fatalf("TestDrainReadErrorFull Expected nil, got <%v>\n", e)
+	}
+	st := make(chan error, 1)
+	c.OnStateChange(func(connected bool, reason error) {
+		if !connected {
+			st <- reason
+		}
+	})
+	_ = fb.write(fakeDrainMessage)
+	for c.SubscriptionMessageCount("drain1") != 1 {
+		// Wait for the channel to fill
+	}
+	fb.close() // Unexpected broker disconnect
+	select {
+	case _ = <-st:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestDrainReadErrorFull Expected disconnect\n")
+	}
+	if len(sc) != 1 {
+		t.Fatalf("TestDrainReadErrorFull Expected 1, got <%v>\n", len(sc))
+	}
+	mds := c.DrainBuffered()["drain1"]
+	if len(mds) != 1 || mds[0].Message.Command != MESSAGE {
+		t.Fatalf("TestDrainReadErrorFull Expected 1 MESSAGE, got <%v>\n", mds)
+	}
+	if _, ok := <-sc; ok {
+		t.Fatalf("TestDrainReadErrorFull Expected closed channel\n")
+	}
+	_ = nc.Close()
+}
+
+/*
+	Drain Test: a drain after duration subscription delivers messages, then
+	unsubscribes and closes its channel once the duration elapses.
+*/
+func TestDrainAfterDuration(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestDrainAfterDuration Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	sh := Headers{HK_DESTINATION, "/queue/drain", HK_ID, "drain1"}
+	if _, e = c.SubscribeDrainAfterDuration(sh, 0); e != EBADDRAT {
+		t.Fatalf("TestDrainAfterDuration Expected <%v>, got <%v>\n", EBADDRAT, e)
+	}
+	if _, e = c.SubscribeDrainAfterDuration(nil, drainAfterTime); e != EHDRNIL {
+		t.Fatalf("TestDrainAfterDuration Expected <%v>, got <%v>\n", EHDRNIL, e)
+	}
+	st := time.Now()
+	sc, e := c.SubscribeDrainAfterDuration(sh, drainAfterTime)
+	if e != nil {
+		t.Fatalf("TestDrainAfterDuration Expected nil, got <%v>\n", e)
+	}
+	f := fb.nextFrame(t)
+	if v := f.Headers.Value(StompPlusDrainAfterTime); v != drainAfterTime.String() {
+		t.Fatalf("TestDrainAfterDuration Expected <%v>, got <%v>\n", drainAfterTime, v)
+	}
+	_ = fb.write(fakeDrainMessage)
+	n := 0
+	to := time.After(5 * time.Second)
+recvLoop:
+	for {
+		select {
+		case _, ok := <-sc:
+			if !ok {
+				break recvLoop
+			}
+			n++
+		case <-to:
+			t.Fatalf("TestDrainAfterDuration Expected channel closed\n")
+		}
+	}
+	if el := time.Since(st); el < drainAfterTime {
+		t.Fatalf("TestDrainAfterDuration Expected close after <%v>, got <%v>\n", drainAfterTime, el)
+	}
+	if n != 1 {
+		t.Fatalf("TestDrainAfterDuration Expected 1, got <%v>\n", n)
+	}
+	f = fb.nextFrame(t)
+	if f.Command != UNSUBSCRIBE || f.Headers.Value(HK_ID) != "drain1" {
+		t.Fatalf("TestDrainAfterDuration Expected UNSUBSCRIBE drain1, got <%v>\n", f)
+	}
+	c.subsLock.RLock()
+	ns := len(c.subs)
+	c.subsLock.RUnlock()
+	if ns != 0 {
+		t.Fatalf("TestDrainAfterDuration Expected 0 subscriptions, got <%v>\n", ns)
+	}
+	// Disconnect before the duration elapses: the timer is stopped.
+	_, e = c.SubscribeDrainAfterDuration(sh, time.Hour)
+	if e != nil {
+		t.Fatalf("TestDrainAfterDuration Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // SUBSCRIBE
+	c.subsLock.RLock()
+	tmr := c.subs["drain1"].drtm
+	c.subsLock.RUnlock()
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	if tmr.Stop() {
+		t.Fatalf("TestDrainAfterDuration Expected timer stopped\n")
+	}
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Drain Test: DrainSubscriptions waits for buffered messages to be read
+	and acked, stops new deliveries until ResumeSubscriptions, and leaves
+	the connection open.
+*/
+func TestDrainSubscriptions(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestDrainSubscriptions Expected nil, got <%v>\n", e)
+	}
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/drain", HK_ID, "drain1",
+		HK_ACK, AckModeClientIndividual})
+	if e != nil {
+		t.Fatalf("TestDrainSubscriptions Expected nil, got <%v>\n", e)
+	}
+	go func() {
+		_ = fb.write(fmt.Sprintf(fakeDrainSubsMessage, "m1"))
+	}()
+	var md MessageData
+	select {
+	case md = <-sc:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestDrainSubscriptions m1 not delivered\n")
+	}
+	// Not acked, the drain is incomplete
+	ctx, cancel := context.WithTimeout(context.Background(), drainSubsShort)
+	e = c.DrainSubscriptions(ctx)
+	cancel()
+	if e != context.DeadlineExceeded {
+		t.Fatalf("TestDrainSubscriptions Expected <%v>, got <%v>\n",
+			context.DeadlineExceeded, e)
+	}
+	// Deliveries are stopped
+	go func() {
+		_ = fb.write(fmt.Sprintf(fakeDrainSubsMessage, "m2"))
+	}()
+	select {
+	case md := <-sc:
+		t.Fatalf("TestDrainSubscriptions Expected no delivery, got <%v>\n", md.Message.Headers)
+	case <-time.After(drainSubsShort):
+	}
+	if e = c.Ack(Headers{HK_ID, md.Message.Headers.Value(HK_ACK)}); e != nil {
+		t.Fatalf("TestDrainSubscriptions Expected nil, got <%v>\n", e)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	e = c.DrainSubscriptions(ctx)
+	cancel()
+	if e != nil {
+		t.Fatalf("TestDrainSubscriptions Expected nil, got <%v>\n", e)
+	}
+	if !c.Connected() {
+		t.Fatalf("TestDrainSubscriptions Expected connected\n")
+	}
+	c.ResumeSubscriptions()
+	select {
+	case md = <-sc:
+		if v := md.Message.Headers.Value(HK_MESSAGE_ID); v != "m2" {
+			t.Fatalf("TestDrainSubscriptions Expected <m2>, got <%v>\n", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestDrainSubscriptions m2 not delivered after resume\n")
+	}
+	if e = c.Ack(Headers{HK_ID, "m2"}); e != nil {
+		t.Fatalf("TestDrainSubscriptions Expected nil, got <%v>\n", e)
+	}
+	// Disconnect while stopped
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	e = c.DrainSubscriptions(ctx)
+	cancel()
+	if e != nil {
+		t.Fatalf("TestDrainSubscriptions Expected nil, got <%v>\n", e)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	if e = c.DrainSubscriptions(context.Background()); e != ECONBAD {
+		t.Fatalf("TestDrainSubscriptions Expected <%v>, got <%v>\n", ECONBAD, e)
+	}
+	_ = nc.Close()
+	fb.close()
+}
@@ -16,9 +16,140 @@
 
 package stompngo
 
+import (
+	"strconv"
+)
+
 /*
 	Error returns a string for a particular Error.
 */
 func (e Error) Error() string {
 	return string(e)
 }
+
+/*
+	Error returns a string for an AckModeError, naming the mode and protocol.
+*/
+func (e AckModeError) Error() string {
+	return string(ESBADAM) + "\nmode:" + e.Mode + " protocol:" + e.Protocol
+}
+
+/*
+	Unwrap returns ESBADAM.
+*/
+func (e AckModeError) Unwrap() error {
+	return ESBADAM
+}
+
+/*
+	Error returns a string for an AckModeChangeError, naming the id and both
+	modes.
+*/
+func (e AckModeChangeError) Error() string {
+	return string(EDUPSID) + ", ack mode can not be changed, subscribe with a new id" +
+		"\nid:" + e.Id + " mode:" + e.Mode + " requested:" + e.NewMode
+}
+
+/*
+	Unwrap returns EDUPSID.
+*/
+func (e AckModeChangeError) Unwrap() error {
+	return EDUPSID
+}
+
+/*
+	Error returns a string for a BrokerError, the ERROR frame "message"
+	header if present, otherwise the ERROR frame body.
+*/
+func (e BrokerError) Error() string {
+	if m, ok := e.Frame.Headers.Contains(HK_MESSAGE); ok {
+		return "broker ERROR: " + m
+	}
+	return "broker ERROR: " + string(e.Frame.Body)
+}
+
+/*
+	ErrorFrame returns the broker ERROR frame as an ErrorFrame.
+*/
+func (e BrokerError) ErrorFrame() ErrorFrame {
+	return ErrorFrame{e.Frame}
+}
+
+/*
+	Error returns a string for a ConnectError, with the ERROR frame "message"
+	header if present, otherwise the ERROR frame body.
+*/
+func (e ConnectError) Error() string {
+	if m, ok := e.f.Headers.Contains(HK_MESSAGE); ok {
+		return string(ECONERR) + "\nmessage:" + m
+	}
+	if len(e.f.Body) > 0 {
+		return string(ECONERR) + "\nbody:" + string(e.f.Body)
+	}
+	return string(ECONERR)
+}
+
+/*
+	Unwrap returns ECONERR.
+*/
+func (e ConnectError) Unwrap() error {
+	return ECONERR
+}
+
+/*
+	Frame returns the broker ERROR frame.
+*/
+func (e ConnectError) Frame() Message {
+	return e.f
+}
+
+/*
+	ErrorFrame returns the broker ERROR frame as an ErrorFrame.
+*/
+func (e ConnectError) ErrorFrame() ErrorFrame {
+	return ErrorFrame{e.f}
+}
+
+/*
+	Error returns a string for a DuplicateHeaderError, naming the header and
+	frame command.
+*/
+func (e DuplicateHeaderError) Error() string {
+	return string(EDUPHDR) + "\nkey:" + e.Key + " command:" + e.Command
+}
+
+/*
+	Unwrap returns EDUPHDR.
+*/
+func (e DuplicateHeaderError) Unwrap() error {
+	return EDUPHDR
+}
+
+/*
+	Error returns a string for a HandshakeTimeoutError, naming the phase and
+	timeout.
+*/
+func (e HandshakeTimeoutError) Error() string {
+	return string(EHSTMO) + "\nphase:" + e.Phase + " timeout:" + e.Timeout.String()
+}
+
+/*
+	Unwrap returns EHSTMO.
+*/
+func (e HandshakeTimeoutError) Unwrap() error {
+	return EHSTMO
+}
+
+/*
+	Error returns a string for a HeaderSizeError, naming the limit.
+*/
+func (e HeaderSizeError) Error() string {
+	return string(EHDRMAX) + "\nlimit:" + strconv.Itoa(e.Limit)
+}
+
+/*
+	Unwrap returns EHDRMAX.
+*/
+func (e HeaderSizeError) Unwrap() error {
+	return EHDRMAX
+}
@@ -0,0 +1,80 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+/*
+	ErrorFrame is a broker ERROR frame, with accessors for the diagnostic
+	detail brokers commonly provide: a short "message" header, a longer
+	body, and the "receipt-id" of the frame that caused the error when that
+	frame requested a receipt.  See AsErrorFrame, and BrokerError.ErrorFrame.
+
+	An ERROR frame with a receipt-id answering a receipt that is waited for,
+	e.g. by WaitReceipt, SendBytesAck, or SubscribeConfirmed, ends that wait
+	at once with a BrokerError.  Uncorrelated ERROR frames are routed as
+	described for SetDefaultMessageSink.
+
+	Example:
+		_, e := c.WaitReceipt(id, 5*time.Second)
+		var be stompngo.BrokerError
+		if errors.As(e, &be) {
+			ef := be.ErrorFrame()
+			log.Printf("send %s failed: %s\n%s\n", ef.ReceiptId(), ef.Summary(),
+				ef.Detail())
+		}
+*/
+type ErrorFrame struct {
+	Message // The ERROR frame
+}
+
+/*
+	AsErrorFrame returns m as an ErrorFrame, and false if m is not an ERROR
+	frame.
+*/
+func AsErrorFrame(m Message) (ErrorFrame, bool) {
+	return ErrorFrame{m}, m.Command == ERROR
+}
+
+/*
+	Summary returns the ERROR frame "message" header, "" if there is none.
+*/
+func (ef ErrorFrame) Summary() string {
+	return ef.Headers.Value(HK_MESSAGE)
+}
+
+/*
+	Detail returns the ERROR frame body, the broker's full diagnostic text,
+	decoded per any "content-type" charset, see Message.BodyString.
+*/
+func (ef ErrorFrame) Detail() string {
+	return ef.BodyString()
+}
+
+/*
+	ReceiptId returns the ERROR frame "receipt-id" header, the receipt id
+	of the frame that caused the error, "" if there is none.
+*/
+func (ef ErrorFrame) ReceiptId() string {
+	return ef.Headers.Value(HK_RECEIPT_ID)
+}
+
+/*
+	ContentType returns the ERROR frame "content-type" header, "" if there is
+	none, e.g. to select a parser for structured detail.
+*/
+func (ef ErrorFrame) ContentType() string {
+	return ef.Headers.Value(HK_CONTENT_TYPE)
+}
@@ -0,0 +1,100 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+/*
+	ErrorFrame Test: accessors, and a non ERROR frame.
+*/
+func TestErrorFrameFields(t *testing.T) {
+	ef, ok := AsErrorFrame(errFrameMessage)
+	if !ok {
+		t.Fatalf("TestErrorFrameFields Expected ERROR, got <%v>\n", errFrameMessage)
+	}
+	if ef.Summary() != "bad destination" || ef.ReceiptId() != "r1" ||
+		ef.Detail() != errFrameDetail || ef.ContentType() != "text/plain" {
+		t.Fatalf("TestErrorFrameFields Unexpected <%q %q %q %q>\n", ef.Summary(),
+			ef.ReceiptId(), ef.Detail(), ef.ContentType())
+	}
+	if _, ok = AsErrorFrame(Message{MESSAGE, Headers{}, NULLBUFF}); ok {
+		t.Fatalf("TestErrorFrameFields Expected not an ERROR\n")
+	}
+}
+
+/*
+	ErrorFrame Test: an ERROR with a receipt-id fails the matching receipt
+	waiter at once, and only that one.
+*/
+func TestErrorFrameReceiptCorrelation(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestErrorFrameReceiptCorrelation Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	fb.setAutoReceipt(false)
+	ids := []string{}
+	for _, rid := range errFrameReceipts {
+		id, e := c.SendBytesR(Headers{HK_DESTINATION, "/queue/errframe",
+			HK_RECEIPT, rid}, []byte(tm))
+		if e != nil {
+			t.Fatalf("TestErrorFrameReceiptCorrelation Expected nil, got <%v>\n", e)
+		}
+		_ = fb.nextFrame(t) // SEND
+		ids = append(ids, id)
+	}
+	// ERROR for the second, encoded, receipt-id
+	go func() {
+		_ = fb.write("ERROR\nmessage:bad destination\nreceipt-id:" +
+			encode(ids[1]) + "\n\n" + errFrameDetail + "\x00")
+	}()
+	st := time.Now()
+	_, e = c.WaitReceipt(ids[1], 5*time.Second)
+	var be BrokerError
+	if !errors.As(e, &be) {
+		t.Fatalf("TestErrorFrameReceiptCorrelation Expected BrokerError, got <%v>\n", e)
+	}
+	if time.Since(st) > time.Second {
+		t.Fatalf("TestErrorFrameReceiptCorrelation Expected fail fast, took <%v>\n",
+			time.Since(st))
+	}
+	ef := be.ErrorFrame()
+	if ef.ReceiptId() != ids[1] || ef.Detail() != errFrameDetail {
+		t.Fatalf("TestErrorFrameReceiptCorrelation Unexpected <%q %q>\n",
+			ef.ReceiptId(), ef.Detail())
+	}
+	// The first waiter is unaffected
+	go func() { _ = fb.write("RECEIPT\nreceipt-id:" + ids[0] + "\n\n\x00") }()
+	if _, e = c.WaitReceipt(ids[0], 5*time.Second); e != nil {
+		t.Fatalf("TestErrorFrameReceiptCorrelation Expected nil, got <%v>\n", e)
+	}
+	select {
+	case md := <-c.MessageData:
+		t.Fatalf("TestErrorFrameReceiptCorrelation Unexpected <%v>\n", md)
+	default:
+	}
+	fb.setAutoReceipt(true)
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
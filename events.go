@@ -0,0 +1,122 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+	Default number of connection events retained, see ConnectionEvents.
+*/
+const DefaultConnEvents = 16
+
+/*
+	ConnEvent is one connection state change, see ConnectionEvents.  Reason
+	is nil for a normal connect or DISCONNECT, and otherwise describes why
+	the connection was lost.
+*/
+type ConnEvent struct {
+	Time      time.Time
+	Connected bool
+	Reason    error
+}
+
+/*
+	ConnEventLog is a bounded history of connection state changes.  One log
+	may be shared by successive connections to the same broker, e.g. by a
+	reconnect loop, with the WithConnEventLog option, so that it records
+	the reconnection history.  It is safe for concurrent use.
+*/
+type ConnEventLog struct {
+	lk sync.Mutex
+	b  []ConnEvent // Ring storage
+	nx int         // Next slot to write
+	fl bool        // Ring is full
+}
+
+/*
+	NewConnEventLog returns a ConnEventLog retaining the last n events.  An
+	n less than 1 means DefaultConnEvents.
+*/
+func NewConnEventLog(n int) *ConnEventLog {
+	if n < 1 {
+		n = DefaultConnEvents
+	}
+	return &ConnEventLog{b: make([]ConnEvent, n)}
+}
+
+/*
+	Record an event, discarding the oldest if the ring is full.
+*/
+func (l *ConnEventLog) add(ev ConnEvent) {
+	l.lk.Lock()
+	l.b[l.nx] = ev
+	l.nx++
+	if l.nx == len(l.b) {
+		l.nx = 0
+		l.fl = true
+	}
+	l.lk.Unlock()
+}
+
+/*
+	Events returns a copy of the retained events, oldest first.
+*/
+func (l *ConnEventLog) Events() []ConnEvent {
+	if l == nil {
+		return nil
+	}
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	if !l.fl {
+		return append([]ConnEvent(nil), l.b[:l.nx]...)
+	}
+	evs := make([]ConnEvent, 0, len(l.b))
+	evs = append(evs, l.b[l.nx:]...)
+	return append(evs, l.b[:l.nx]...)
+}
+
+/*
+	WithConnEventLog sets the log that records the connection state changes,
+	see ConnectionEvents.  Pass the same log to each Connect of a reconnect
+	loop to keep the history across connections.  By default each
+	connection has its own log of DefaultConnEvents events.
+
+	Example:
+		el := stompngo.NewConnEventLog(64)
+		for {
+			c, e := stompngo.Dial(addr, h, stompngo.WithConnEventLog(el))
+			// Run until the connection is lost ...
+		}
+*/
+func WithConnEventLog(l *ConnEventLog) ConnectOption {
+	return func(o *connectOptions) {
+		o.celg = l
+	}
+}
+
+/*
+	ConnectionEvents returns the connection state changes recorded, oldest
+	first: connects and disconnects, with their times and reasons.  With a
+	shared ConnEventLog this includes earlier connections.  Together with
+	Running this gives a picture of connection stability.
+*/
+func (c *Connection) ConnectionEvents() []ConnEvent {
+	return c.celg.Events()
+}
@@ -0,0 +1,84 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"testing"
+	"time"
+)
+
+/*
+	Events Test: a shared log records connects and disconnects across
+	simulated reconnects, oldest first, within its bound.
+*/
+func TestEventsReconnect(t *testing.T) {
+	el := NewConnEventLog(len(connEventStates))
+	st := time.Now()
+	// First connection, a normal DISCONNECT
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers, WithConnEventLog(el))
+	if e != nil {
+		t.Fatalf("TestEventsReconnect Expected nil, got <%v>\n", e)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+	// Second connection, lost
+	nc, fb = openFakeConn(t, fakeConnected12)
+	c, e = Connect(nc, fake12Headers, WithConnEventLog(el))
+	if e != nil {
+		t.Fatalf("TestEventsReconnect Expected nil, got <%v>\n", e)
+	}
+	fb.close()
+	select {
+	case <-c.MessageData: // The read error
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestEventsReconnect read error not delivered\n")
+	}
+	_ = nc.Close()
+	evs := c.ConnectionEvents()
+	if len(evs) != len(connEventStates) {
+		t.Fatalf("TestEventsReconnect Expected %d events, got <%v>\n",
+			len(connEventStates), evs)
+	}
+	for i, ev := range evs {
+		if ev.Connected != connEventStates[i] {
+			t.Fatalf("TestEventsReconnect %d Expected <%v>, got <%v>\n", i,
+				connEventStates[i], ev)
+		}
+		if ev.Time.Before(st) || (i > 0 && ev.Time.Before(evs[i-1].Time)) {
+			t.Fatalf("TestEventsReconnect %d Expected ordered times, got <%v>\n", i, evs)
+		}
+		if wr := i == len(evs)-1; (ev.Reason != nil) != wr {
+			t.Fatalf("TestEventsReconnect %d Expected reason %v, got <%v>\n", i, wr,
+				ev.Reason)
+		}
+	}
+	// Bounded, the oldest are discarded
+	bl := NewConnEventLog(connEventLogSize)
+	for _, ev := range evs {
+		bl.add(ev)
+	}
+	if b := bl.Events(); len(b) != connEventLogSize || b[0] != evs[1] {
+		t.Fatalf("TestEventsReconnect Expected the last %d, got <%v>\n",
+			connEventLogSize, b)
+	}
+	if len(NewConnEventLog(0).b) != DefaultConnEvents {
+		t.Fatalf("TestEventsReconnect Expected default size <%d>\n", DefaultConnEvents)
+	}
+}
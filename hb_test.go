@@ -565,3 +565,124 @@ func errorE1OrD1(t *testing.T, conn *Connection, sp, id string, e error) {
 		t.Fatalf("E1OrD1 %v %v %v %v\n", e, conn.hbd, sp, id)
 	}
 }
+
+/*
+	HB Test: heart beats are suppressed while frames are being sent, and
+	resume once sending stops.
+*/
+func TestHBSendSuppressed(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnectedHB)
+	c, e := Connect(nc, Headers{HK_ACCEPT_VERSION, SPL_12, HK_HOST, "localhost",
+		HK_HEART_BEAT, "50,0"})
+	if e != nil {
+		t.Fatalf("TestHBSendSuppressed Expected nil, got <%v>\n", e)
+	}
+	if c.hbd == nil || !c.hbd.hbs {
+		t.Fatalf("TestHBSendSuppressed Expected heartbeat sends\n")
+	}
+	go func() {
+		for { // Keep the broker reading
+			select {
+			case <-fb.frames:
+			case <-fb.done:
+				return
+			}
+		}
+	}()
+	st := time.Now()
+	for time.Since(st) < 300*time.Millisecond {
+		if e = c.Send(Headers{HK_DESTINATION, "/queue/hb"}, tm); e != nil {
+			t.Fatalf("TestHBSendSuppressed Expected nil, got <%v>\n", e)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := c.SendTickerCount(); n != 0 {
+		t.Fatalf("TestHBSendSuppressed Expected 0 heartbeats while sending, got <%d>\n", n)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if n := c.SendTickerCount(); n == 0 {
+		t.Fatalf("TestHBSendSuppressed Expected heartbeats when idle\n")
+	}
+	e = c.Disconnect(NoDiscReceipt)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Test Healthy: a connection receiving heart beats is healthy until the
+	broker goes silent past the receive window.
+*/
+func TestHBHealthy(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnectedHBSend)
+	c, e := Connect(nc, Headers{HK_ACCEPT_VERSION, SPL_12, HK_HOST, "localhost",
+		HK_HEART_BEAT, "0,50"})
+	if e != nil {
+		t.Fatalf("TestHBHealthy Expected nil, got <%v>\n", e)
+	}
+	if c.hbd == nil || !c.hbd.hbr {
+		t.Fatalf("TestHBHealthy Expected heartbeat receives\n")
+	}
+	if !c.Healthy() {
+		t.Fatalf("TestHBHealthy Expected healthy at start\n")
+	}
+	time.Sleep(200 * time.Millisecond) // Broker silent
+	if c.Healthy() {
+		t.Fatalf("TestHBHealthy Expected unhealthy after silence\n")
+	}
+	if !c.Connected() {
+		t.Fatalf("TestHBHealthy Expected still connected\n")
+	}
+	e = c.Disconnect(NoDiscReceipt)
+	checkDisconnectError(t, e)
+	if c.Healthy() {
+		t.Fatalf("TestHBHealthy Expected unhealthy after disconnect\n")
+	}
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Test Healthy: without heart beats it is the same as Connected.
+*/
+func TestHBHealthyNone(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestHBHealthyNone Expected nil, got <%v>\n", e)
+	}
+	if !c.Healthy() {
+		t.Fatalf("TestHBHealthyNone Expected healthy\n")
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	if c.Healthy() {
+		t.Fatalf("TestHBHealthyNone Expected unhealthy after disconnect\n")
+	}
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	HB Test: the requested, advertised, and effective heart beat values
+	are reported, also when negotiation disables heart beats.
+*/
+func TestHBNegotiation(t *testing.T) {
+	for _, hn := range hbNegList {
+		nc, fb := openFakeConn(t, hn.resp)
+		c, e := Connect(nc, Headers{HK_ACCEPT_VERSION, "1.0,1.1,1.2",
+			HK_HOST, "localhost", HK_HEART_BEAT, hn.chb})
+		if e != nil {
+			t.Fatalf("TestHBNegotiation <%s> Expected nil, got <%v>\n", hn.chb, e)
+		}
+		cr, sa, ef := c.HeartBeatNegotiation()
+		if cr != hn.cr || sa != hn.sa || ef != hn.ef {
+			t.Fatalf("TestHBNegotiation <%s> Expected <%v %v %v>, got <%v %v %v>\n",
+				hn.chb, hn.cr, hn.sa, hn.ef, cr, sa, ef)
+		}
+		e = c.Disconnect(NoDiscReceipt)
+		checkDisconnectError(t, e)
+		_ = nc.Close()
+		fb.close()
+	}
+}
@@ -0,0 +1,136 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*
+	Header Limit Test: a header section at the limit is read, one byte over
+	is a HeaderSizeError.  The large header line is longer than the read
+	buffer.
+*/
+func TestHdrLimitMaxHeaderBytes(t *testing.T) {
+	hs := "destination:/queue/big\nsubscription:big1\nmessage-id:m1\n" +
+		"x-big:" + strings.Repeat("v", hdrLimitValueLen) + "\n\n"
+	fr := MESSAGE + "\n" + hs + "body\x00"
+	for _, over := range []bool{false, true} {
+		nc, fb := openFakeConn(t, fakeConnected12)
+		c, e := Connect(nc, fake12Headers)
+		if e != nil {
+			t.Fatalf("TestHdrLimitMaxHeaderBytes Expected nil, got <%v>\n", e)
+		}
+		sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/big", HK_ID, "big1"})
+		if e != nil {
+			t.Fatalf("TestHdrLimitMaxHeaderBytes Expected nil, got <%v>\n", e)
+		}
+		l := len(hs)
+		if over {
+			l--
+		}
+		c.SetMaxHeaderBytes(l)
+		go func() {
+			_ = fb.write(fr)
+		}()
+		var md MessageData
+		select {
+		case md = <-sc:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestHdrLimitMaxHeaderBytes over:%v nothing delivered\n", over)
+		}
+		if !over {
+			if md.Error != nil || md.Message.BodyString() != "body" ||
+				len(md.Message.Headers.Value("x-big")) != hdrLimitValueLen {
+				t.Fatalf("TestHdrLimitMaxHeaderBytes Expected message, got <%v>\n", md.Error)
+			}
+			e = c.Disconnect(empty_headers)
+			checkDisconnectError(t, e)
+		} else {
+			if !errors.Is(md.Error, EHDRMAX) {
+				t.Fatalf("TestHdrLimitMaxHeaderBytes Expected <%v>, got <%v>\n", EHDRMAX, md.Error)
+			}
+			if he, ok := md.Error.(HeaderSizeError); !ok || he.Limit != l {
+				t.Fatalf("TestHdrLimitMaxHeaderBytes Expected limit <%d>, got <%v>\n", l, md.Error)
+			}
+		}
+		_ = nc.Close()
+		fb.close()
+	}
+}
+
+/*
+	Header Limit Test: repeated critical headers.  Lenient mode delivers the
+	frame with the first value winning, strict mode is a DuplicateHeaderError.
+*/
+func TestHdrLimitDuplicateCritical(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		for _, hd := range hdrDupFrames {
+			nc, fb := openFakeConn(t, fakeConnected12)
+			c, e := Connect(nc, fake12Headers)
+			if e != nil {
+				t.Fatalf("TestHdrLimitDuplicateCritical Expected nil, got <%v>\n", e)
+			}
+			sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/dup", HK_ID, "dup1"})
+			if e != nil {
+				t.Fatalf("TestHdrLimitDuplicateCritical Expected nil, got <%v>\n", e)
+			}
+			c.SetStrictHeaders(strict)
+			go func(fr string) {
+				_ = fb.write(fr)
+			}(hd.frame)
+			var md MessageData
+			select {
+			case md = <-sc:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("TestHdrLimitDuplicateCritical strict:%v key:%s nothing delivered\n",
+					strict, hd.key)
+			}
+			if !strict {
+				if md.Error != nil {
+					t.Fatalf("TestHdrLimitDuplicateCritical key:%s Expected nil, got <%v>\n",
+						hd.key, md.Error)
+				}
+				if v := md.Message.Headers.Value(HK_MESSAGE_ID); v != "m1" {
+					t.Fatalf("TestHdrLimitDuplicateCritical Expected <m1>, got <%s>\n", v)
+				}
+				if v := md.Message.Headers.Value(HK_DESTINATION); v != "/queue/dup" {
+					t.Fatalf("TestHdrLimitDuplicateCritical Expected </queue/dup>, got <%s>\n", v)
+				}
+				if b := md.Message.BodyString(); b != "body" {
+					t.Fatalf("TestHdrLimitDuplicateCritical Expected <body>, got <%s>\n", b)
+				}
+				e = c.Disconnect(empty_headers)
+				checkDisconnectError(t, e)
+			} else {
+				if !errors.Is(md.Error, EDUPHDR) {
+					t.Fatalf("TestHdrLimitDuplicateCritical Expected <%v>, got <%v>\n",
+						EDUPHDR, md.Error)
+				}
+				if de, ok := md.Error.(DuplicateHeaderError); !ok || de.Key != hd.key {
+					t.Fatalf("TestHdrLimitDuplicateCritical Expected key <%s>, got <%v>\n",
+						hd.key, md.Error)
+				}
+			}
+			_ = nc.Close()
+			fb.close()
+		}
+	}
+}
@@ -182,3 +182,36 @@ func (h Headers) Bytes() []byte {
 	}
 	return b
 }
+
+/*
+	NewHeaders returns Headers built from key and value pairs.  The result
+	always has an even length.
+
+	Example:
+		h := stompngo.NewHeaders([2]string{stompngo.HK_DESTINATION, "/queue/a"},
+			[2]string{"priority", "4"})
+*/
+func NewHeaders(pairs ...[2]string) Headers {
+	h := make(Headers, 0, 2*len(pairs))
+	for _, p := range pairs {
+		h = append(h, p[0], p[1])
+	}
+	return h
+}
+
+/*
+	Pairs returns Headers as key and value pairs, in order.  A trailing key
+	without a value, in invalid odd length Headers, is omitted.
+
+	Example:
+		for _, p := range md.Message.Headers.Pairs() {
+			fmt.Printf("%s = %s\n", p[0], p[1])
+		}
+*/
+func (h Headers) Pairs() [][2]string {
+	r := make([][2]string, 0, len(h)/2)
+	for i := 0; i+1 < len(h); i += 2 {
+		r = append(r, [2]string{h[i], h[i+1]})
+	}
+	return r
+}
@@ -18,6 +18,7 @@ package stompngo
 
 import (
 	"testing"
+	"time"
 )
 
 /*
@@ -133,6 +134,27 @@ func TestHeadersAddDelete(t *testing.T) {
 	}
 }
 
+/*
+	Data Test: Headers pair form, NewHeaders / Pairs.
+*/
+func TestHeadersPairs(t *testing.T) {
+	wh := Headers{"ka", "va", "kb", "vb", "kc", "vc"}
+	p := wh.Pairs()
+	if len(p) != 3 || p[1] != [2]string{"kb", "vb"} {
+		t.Fatalf("TestHeadersPairs Unexpected pairs, got: [%v], for: [%v]\n", p, wh)
+	}
+	hn := NewHeaders(p...)
+	if !wh.Compare(hn) || hn.Validate() != nil {
+		t.Fatalf("TestHeadersPairs Unexpected round trip, got: [%v], expected: [%v]\n", hn, wh)
+	}
+	if hn = NewHeaders(); hn == nil || len(hn) != 0 {
+		t.Fatalf("TestHeadersPairs Unexpected empty headers, got: [%v]\n", hn)
+	}
+	if p = (Headers{"ka", "va", "kb"}).Pairs(); len(p) != 1 {
+		t.Fatalf("TestHeadersPairs Unexpected odd length pairs, got: [%v]\n", p)
+	}
+}
+
 /*
 	Data Test: Headers ContainsKV
 */
@@ -241,3 +263,64 @@ func TestHeadersEmtKV(t *testing.T) {
 		}
 	}
 }
+
+/*
+	Data Test: empty header values at 1.0, rejected by default and allowed
+	with SetAllowEmptyHeaderValues.  Empty keys are rejected in both modes.
+*/
+func TestHeadersEmtKVAllow(t *testing.T) {
+	ev := Headers{"a", "", "c", "d"} // empty value
+	ek := Headers{"a", "b", "", "d"} // empty key
+	if e := checkHeadersEmpty(ev, SPL_10, true); e != nil {
+		t.Fatalf("TestHeadersEmtKVAllow Expected [nil], got [%v]\n", e)
+	}
+	if e := checkHeadersEmpty(ek, SPL_10, true); e != EHDRMTK {
+		t.Fatalf("TestHeadersEmtKVAllow Expected [%v], got [%v]\n", EHDRMTK, e)
+	}
+	//
+	nc, fb := openFakeConn(t, fakeConnected10)
+	c, e := Connect(nc, Headers{HK_HOST, "localhost"})
+	if e != nil {
+		t.Fatalf("TestHeadersEmtKVAllow Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	sh := Headers{HK_DESTINATION, "/queue/empty", "x-empty", ""}
+	if e = c.Send(sh, "body"); e != EHDRMTV {
+		t.Fatalf("TestHeadersEmtKVAllow Expected [%v], got [%v]\n", EHDRMTV, e)
+	}
+	c.SetAllowEmptyHeaderValues(true)
+	if e = c.Send(Headers{HK_DESTINATION, "/queue/empty", "", "v"}, "body"); e != EHDRMTK {
+		t.Fatalf("TestHeadersEmtKVAllow Expected [%v], got [%v]\n", EHDRMTK, e)
+	}
+	if e = c.Send(sh, "body"); e != nil {
+		t.Fatalf("TestHeadersEmtKVAllow Expected nil, got <%v>\n", e)
+	}
+	f := fb.nextFrame(t)
+	if v, ok := f.Headers.Contains("x-empty"); !ok || v != "" {
+		t.Fatalf("TestHeadersEmtKVAllow Expected empty x-empty, got <%v> <%v>\n", v, ok)
+	}
+	// Received empty value
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/empty", HK_ID, "emt1"})
+	if e != nil {
+		t.Fatalf("TestHeadersEmtKVAllow Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t)
+	go func() {
+		_ = fb.write(MESSAGE + "\ndestination:/queue/empty\nsubscription:emt1\nmessage-id:m1\nx-empty:\n\nbody\x00")
+	}()
+	select {
+	case md := <-sc:
+		if md.Error != nil {
+			t.Fatalf("TestHeadersEmtKVAllow Expected nil, got <%v>\n", md.Error)
+		}
+		if v, ok := md.Message.Headers.Contains("x-empty"); !ok || v != "" {
+			t.Fatalf("TestHeadersEmtKVAllow Expected empty x-empty, got <%v> <%v>\n", v, ok)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestHeadersEmtKVAllow nothing delivered\n")
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
@@ -92,8 +92,8 @@ func (c *Connection) initializeHeartBeats(ch Headers) (e error) {
 
 	// ========================================================================
 
-	c.hbd = w                   // OK, we are doing some kind of heartbeating
-	ct := time.Now().UnixNano() // Prime current time
+	c.hbd = w           // OK, we are doing some kind of heartbeating
+	ct := c.monoNanos() // Prime current time
 
 	if w.hbs { // Finish sender parameters if required
 		sm := max(w.cx, w.sy)       // ticker interval, ms
@@ -116,21 +116,75 @@ func (c *Connection) initializeHeartBeats(ch Headers) (e error) {
 }
 
 /*
-	The heart beat send ticker.
+	Note the raw heart-beat values requested and advertised, for
+	HeartBeatNegotiation.  Missing or malformed values are noted as 0.
+*/
+func (c *Connection) noteHeartBeats(ch Headers) {
+	c.hbcr = heartBeatPair(ch.Value(HK_HEART_BEAT))
+	c.hbsa = heartBeatPair(c.ConnectResponse.Headers.Value(HK_HEART_BEAT))
+}
+
+/*
+	Parse a heart-beat header value, 0,0 if missing or malformed.
+*/
+func heartBeatPair(v string) [2]int64 {
+	var r [2]int64
+	p := strings.Split(v, ",")
+	if len(p) != 2 {
+		return r
+	}
+	for i := range p {
+		if n, e := strconv.ParseInt(p[i], 10, 64); e == nil && n > 0 {
+			r[i] = n
+		}
+	}
+	return r
+}
+
+/*
+	HeartBeatNegotiation returns the heart beat values of the CONNECT
+	handshake, all in ms: the client requested "heart-beat" header (cx,
+	cy), the broker advertised CONNECTED "heart-beat" header (sx, sy), and
+	the effective send and receive intervals.  An effective value of 0
+	means no heart beats in that direction.
+
+	The raw values are kept even when negotiation disables heart beats, e.g.
+	when one side offers 0, or the protocol level is 1.0, which helps
+	explain why heart beats are not active.
+
+	Example:
+		cr, sa, ef := c.HeartBeatNegotiation()
+		log.Printf("requested %v, broker advertised %v, using %v\n", cr, sa, ef)
+*/
+func (c *Connection) HeartBeatNegotiation() (clientReq, serverAdv, effective [2]int64) {
+	return c.hbcr, c.hbsa, [2]int64{c.SendTickerInterval(),
+		c.ReceiveTickerInterval()}
+}
+
+/*
+	The heart beat send ticker.  A heart beat is sent only when nothing has
+	been written for the send interval: any frame written is liveness for
+	the broker, so heart beats are suppressed while data traffic flows.
 */
 func (c *Connection) sendTicker() {
 	c.hbd.sc = 0
-	ticker := time.NewTicker(time.Duration(c.hbd.sti))
+	tm := time.NewTimer(time.Duration(c.hbd.sti))
+	defer tm.Stop()
 hbSend:
 	for {
 		select {
-		case <-ticker.C:
+		case <-tm.C:
+			c.hbd.sdl.Lock()
+			idle := c.monoNanos() - c.hbd.ls
+			c.hbd.sdl.Unlock()
+			if idle < c.hbd.sti { // Written recently, wait for the next due time
+				tm.Reset(time.Duration(c.hbd.sti - idle))
+				continue hbSend
+			}
 			c.log("HeartBeat Send data")
 			// Send a heartbeat
 			f := Frame{"\n", Headers{}, NULLBUFF} // Heartbeat frame
-			r := make(chan error)
-			c.output <- wiredata{f, r}
-			e := <-r
+			e := c.wireSend(f, 0)
 			//
 			c.hbd.sdl.Lock()
 			if e != nil {
@@ -141,6 +195,12 @@ hbSend:
 				c.hbd.sc++
 			}
 			c.hbd.sdl.Unlock()
+			if e == nil {
+				if hh := c.heartBeatSentHandler(); hh != nil {
+					hh()
+				}
+			}
+			tm.Reset(time.Duration(c.hbd.sti))
 			//
 		case _ = <-c.hbd.ssd:
 			break hbSend
@@ -168,13 +228,13 @@ hbGet:
 		}
 		ticker := time.NewTicker(time.Duration(nd))
 		select {
-		case ct := <-ticker.C:
-			first = time.Now().UnixNano()
+		case _ = <-ticker.C:
+			first = c.monoNanos()
 			ticker.Stop()
 			c.hbd.rdl.Lock()
 			flr := c.hbd.lr
-			ld := ct.UnixNano() - flr
-			c.log("HeartBeat Receive TIC", "TickerVal", ct.UnixNano(),
+			ld := first - flr
+			c.log("HeartBeat Receive TIC", "TickerVal", first,
 				"LastReceive", flr, "Diff", ld)
 			if ld > (c.hbd.rti + (c.hbd.rti / 5)) { // swag plus to be tolerant
 				c.log("HeartBeat Receive Read is dirty")
@@ -184,7 +244,7 @@ hbGet:
 				c.hbd.rc++
 			}
 			c.hbd.rdl.Unlock()
-			last = time.Now().UnixNano()
+			last = c.monoNanos()
 		case _ = <-c.hbd.rsd:
 			break hbGet
 		case _ = <-c.ssdc:
@@ -0,0 +1,146 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+)
+
+/*
+	Direction selects frames read or frames written.
+*/
+type Direction int
+
+const (
+	DirectionRead  Direction = iota // Frames read from the broker
+	DirectionWrite                  // Frames written to the broker
+)
+
+/*
+	Bucket is one frame size histogram bucket.  Count is the number of frames
+	with a wire size greater than the previous bucket's UpperBound, and less
+	than or equal to this UpperBound.  The last bucket's UpperBound is
+	math.MaxInt64.
+*/
+type Bucket struct {
+	UpperBound int64 `json:"upper_bound"` // Inclusive upper bound, bytes
+	Count      int64 `json:"count"`       // Frames in this bucket
+}
+
+/*
+	Default frame size histogram bucket upper bounds, bytes.
+*/
+var DefaultFrameSizeBounds = []int64{256, 1024, 4 * 1024, 16 * 1024,
+	64 * 1024, 256 * 1024, 1024 * 1024}
+
+/*
+	Frame size histogram data.
+*/
+type frameSizeHist struct {
+	ub []int64 // Bucket upper bounds, last is math.MaxInt64
+	rc []int64 // Read counts
+	wc []int64 // Write counts
+}
+
+/*
+	EnableFrameSizeHistogram starts collecting frame size histograms for
+	frames read and written, heart beats excluded.  The bounds are the
+	bucket upper bounds in bytes; nil means DefaultFrameSizeBounds.  An
+	overflow bucket is always added.  Any previous counts are discarded.
+
+	Histograms are off by default, to avoid the overhead.
+*/
+func (c *Connection) EnableFrameSizeHistogram(bounds []int64) {
+	if bounds == nil {
+		bounds = DefaultFrameSizeBounds
+	}
+	ub := make([]int64, 0, len(bounds)+1)
+	ub = append(ub, bounds...)
+	sort.Sort(int64s(ub))
+	if len(ub) == 0 || ub[len(ub)-1] != math.MaxInt64 {
+		ub = append(ub, math.MaxInt64)
+	}
+	h := &frameSizeHist{ub: ub, rc: make([]int64, len(ub)),
+		wc: make([]int64, len(ub))}
+	c.mets.hlk.Lock()
+	c.mets.fsh = h
+	atomic.StoreInt32(&c.mets.fse, 1)
+	c.mets.hlk.Unlock()
+}
+
+/*
+	DisableFrameSizeHistogram stops collecting frame size histograms, and
+	discards the counts.
+*/
+func (c *Connection) DisableFrameSizeHistogram() {
+	c.mets.hlk.Lock()
+	c.mets.fsh = nil
+	atomic.StoreInt32(&c.mets.fse, 0)
+	c.mets.hlk.Unlock()
+}
+
+/*
+	FrameSizeHistogram returns a copy of the frame size histogram for the
+	given direction, or nil if histograms are not enabled.
+*/
+func (c *Connection) FrameSizeHistogram(dir Direction) []Bucket {
+	c.mets.hlk.Lock()
+	defer c.mets.hlk.Unlock()
+	h := c.mets.fsh
+	if h == nil {
+		return nil
+	}
+	cs := h.rc
+	if dir == DirectionWrite {
+		cs = h.wc
+	}
+	r := make([]Bucket, len(h.ub))
+	for i, ub := range h.ub {
+		r[i] = Bucket{ub, cs[i]}
+	}
+	return r
+}
+
+/*
+	Count a frame size.  No lock is taken when histograms are not enabled.
+*/
+func (c *Connection) countFrameSize(dir Direction, sz int64) {
+	if atomic.LoadInt32(&c.mets.fse) == 0 {
+		return
+	}
+	c.mets.hlk.Lock()
+	if h := c.mets.fsh; h != nil {
+		i := sort.Search(len(h.ub), func(i int) bool { return h.ub[i] >= sz })
+		if dir == DirectionWrite {
+			h.wc[i]++
+		} else {
+			h.rc[i]++
+		}
+	}
+	c.mets.hlk.Unlock()
+}
+
+/*
+	Sort support.
+*/
+type int64s []int64
+
+func (s int64s) Len() int           { return len(s) }
+func (s int64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
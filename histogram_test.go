@@ -0,0 +1,74 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+/*
+	Histogram Test: read and write frame sizes are bucketed.
+*/
+func TestHistogramFrameSizes(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestHistogramFrameSizes Expected nil, got <%v>\n", e)
+	}
+	if h := c.FrameSizeHistogram(DirectionRead); h != nil {
+		t.Fatalf("TestHistogramFrameSizes Expected nil, got <%v>\n", h)
+	}
+	c.EnableFrameSizeHistogram(histBounds)
+	sh := Headers{HK_DESTINATION, "/queue/drain", HK_ID, "drain1"}
+	sc, e := c.Subscribe(sh) // Small written frame
+	if e != nil {
+		t.Fatalf("TestHistogramFrameSizes Expected nil, got <%v>\n", e)
+	}
+	e = c.Send(Headers{HK_DESTINATION, "/queue/big"},
+		strings.Repeat("x", 300)) // Large written frame
+	if e != nil {
+		t.Fatalf("TestHistogramFrameSizes Expected nil, got <%v>\n", e)
+	}
+	_ = fb.write(fakeDrainMessage) // Less than 128 bytes
+	_ = <-sc
+	//
+	wh := c.FrameSizeHistogram(DirectionWrite)
+	if len(wh) != 3 {
+		t.Fatalf("TestHistogramFrameSizes Expected 3, got <%v>\n", len(wh))
+	}
+	if wh[2].UpperBound != math.MaxInt64 {
+		t.Fatalf("TestHistogramFrameSizes Expected MaxInt64, got <%v>\n",
+			wh[2].UpperBound)
+	}
+	if wh[0].Count != 1 || wh[1].Count != 0 || wh[2].Count != 1 {
+		t.Fatalf("TestHistogramFrameSizes Expected <1 0 1>, got <%v>\n", wh)
+	}
+	rh := c.FrameSizeHistogram(DirectionRead)
+	if rh[0].Count != 1 || rh[1].Count != 0 || rh[2].Count != 0 {
+		t.Fatalf("TestHistogramFrameSizes Expected <1 0 0>, got <%v>\n", rh)
+	}
+	//
+	c.DisableFrameSizeHistogram()
+	if h := c.FrameSizeHistogram(DirectionWrite); h != nil {
+		t.Fatalf("TestHistogramFrameSizes Expected nil, got <%v>\n", h)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
@@ -0,0 +1,87 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+/*
+	IdKind is the kind of id requested from an id generator, see
+	SetIdGenerator.
+*/
+type IdKind int
+
+const (
+	IdSubscription IdKind = iota // SUBSCRIBE "id" header
+	IdReceipt                    // "receipt" header
+	IdTransaction                // BEGIN "transaction" header, see BeginTx
+)
+
+/*
+	String returns a short name for an IdKind.
+*/
+func (k IdKind) String() string {
+	switch k {
+	case IdSubscription:
+		return "subscription"
+	case IdReceipt:
+		return "receipt"
+	case IdTransaction:
+		return "transaction"
+	}
+	return "unknown"
+}
+
+/*
+	SetIdGenerator sets the function used when the client generates an id,
+	in place of the default type 4 UUID (see Uuid).  It is used for
+	subscription ids when Subscribe has no "id" header (STOMP 1.1+, at 1.0
+	the id is derived from the destination), for receipt ids when a receipt
+	is requested without a "receipt" header, e.g. by SendBytesR or
+	Disconnect, and for transaction ids from BeginTx.
+
+	The generator may be called from several goroutines at once.  An empty
+	id is replaced by a UUID.  Set to nil to restore the default.
+
+	Uniqueness is the responsibility of the generator.  A duplicate
+	subscription id fails Subscribe with EDUPSID, and a duplicate pending
+	receipt id fails with ERCPTDUP, but ids are not checked against those
+	used earlier on the connection, nor across connections.
+
+	Example:
+		var n uint64
+		c.SetIdGenerator(func(k stompngo.IdKind) string {
+			return fmt.Sprintf("billing-%s-%d", k, atomic.AddUint64(&n, 1))
+		})
+*/
+func (c *Connection) SetIdGenerator(f func(kind IdKind) string) {
+	c.cbLock.Lock()
+	c.idgn = f
+	c.cbLock.Unlock()
+}
+
+/*
+	Generate an id of the given kind.
+*/
+func (c *Connection) newId(kind IdKind) string {
+	c.cbLock.RLock()
+	f := c.idgn
+	c.cbLock.RUnlock()
+	if f != nil {
+		if id := f(kind); id != "" {
+			return id
+		}
+	}
+	return Uuid()
+}
@@ -0,0 +1,73 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"fmt"
+	"testing"
+)
+
+/*
+	IdGen Test: generated subscription, receipt, and transaction ids come
+	from the generator, and an empty id falls back to a UUID.
+*/
+func TestIdGenKinds(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestIdGenKinds Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	n := 0
+	c.SetIdGenerator(func(k IdKind) string {
+		n++
+		return fmt.Sprintf("%s-%s-%d", idGenPrefix, k, n)
+	})
+	if _, e = c.Subscribe(Headers{HK_DESTINATION, "/queue/idgen"}); e != nil {
+		t.Fatalf("TestIdGenKinds Expected nil, got <%v>\n", e)
+	}
+	if _, e = c.SendBytesR(Headers{HK_DESTINATION, "/queue/idgen"}, []byte(tm)); e != nil {
+		t.Fatalf("TestIdGenKinds Expected nil, got <%v>\n", e)
+	}
+	tx, e := c.BeginTx(Headers{HK_TRANSACTION, "replaced"})
+	if e != nil {
+		t.Fatalf("TestIdGenKinds Expected nil, got <%v>\n", e)
+	}
+	if tx != idGenWant[2][2] {
+		t.Fatalf("TestIdGenKinds Expected <%s>, got <%s>\n", idGenWant[2][2], tx)
+	}
+	for _, w := range idGenWant {
+		f := fb.nextFrame(t)
+		if f.Command != w[0] || !f.Headers.ContainsKV(w[1], w[2]) {
+			t.Fatalf("TestIdGenKinds Expected <%v>, got <%v>\n", w, f)
+		}
+		if w[0] == BEGIN && f.Headers.Delete(HK_TRANSACTION).Index(HK_TRANSACTION) >= 0 {
+			t.Fatalf("TestIdGenKinds Expected one transaction, got <%v>\n", f.Headers)
+		}
+	}
+	// Empty, and no generator, mean a UUID
+	for _, g := range []func(IdKind) string{func(IdKind) string { return "" }, nil} {
+		c.SetIdGenerator(g)
+		if id := c.newId(IdReceipt); len(id) != len(Uuid()) {
+			t.Fatalf("TestIdGenKinds Expected a UUID, got <%s>\n", id)
+		}
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
@@ -0,0 +1,77 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+/*
+	SetIdleTimeout disconnects from the broker if no frames are sent or
+	received for the duration d.  Heart beats are not counted as activity.
+
+	The DISCONNECT is sent without a receipt request.  Any state change
+	callback is invoked with a reason of EIDLETMO.
+
+	A duration of zero disables the idle timeout.
+
+	Example:
+		c.SetIdleTimeout(5 * time.Minute)
+*/
+func (c *Connection) SetIdleTimeout(d time.Duration) {
+	c.itLock.Lock()
+	defer c.itLock.Unlock()
+	if c.itsd != nil {
+		close(c.itsd)
+		c.itsd = nil
+	}
+	c.itd = d
+	if d <= 0 {
+		return
+	}
+	c.log("Idle Timeout", d)
+	c.itsd = make(chan struct{})
+	go c.idleTimer(d, c.itsd)
+}
+
+/*
+	Record frame (not heart beat) activity.
+*/
+func (c *Connection) updateActivity() {
+	atomic.StoreInt64(&c.lat, c.monoNanos())
+}
+
+/*
+	The idle timer.
+*/
+func (c *Connection) idleTimer(d time.Duration, sd chan struct{}) {
+	st := c.monoNanos() // Timer start
+	c.checkLoop(d, sd, func(now int64) bool {
+		la := atomic.LoadInt64(&c.lat)
+		if la < st {
+			la = st
+		}
+		if now-la > int64(d) {
+			c.log("Idle Timeout expired", d)
+			_ = c.disconnect(NoDiscReceipt, EIDLETMO, 0)
+			return true
+		}
+		return false
+	})
+	c.log("Idle Timer Ends", time.Now())
+}
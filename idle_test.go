@@ -0,0 +1,102 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"testing"
+	"time"
+)
+
+/*
+	Idle Test: idle connection is disconnected.
+*/
+func TestIdleTimeout(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestIdleTimeout Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	sr := make(chan error, 1)
+	c.OnStateChange(func(connected bool, reason error) {
+		if !connected {
+			sr <- reason
+		}
+	})
+	c.SetIdleTimeout(100 * time.Millisecond)
+	if f := fb.nextFrame(t); f.Command != DISCONNECT {
+		t.Fatalf("TestIdleTimeout Expected <%v>, got <%v>\n", DISCONNECT, f.Command)
+	}
+	select {
+	case r := <-sr:
+		if r != EIDLETMO {
+			t.Fatalf("TestIdleTimeout Expected <%v>, got <%v>\n", EIDLETMO, r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestIdleTimeout state change callback not invoked\n")
+	}
+	if c.Connected() {
+		t.Fatalf("TestIdleTimeout Expected not connected\n")
+	}
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Idle Test: sends are activity, heart beats are not.
+*/
+func TestIdleActivity(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestIdleActivity Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	c.SetIdleTimeout(200 * time.Millisecond)
+	sh := Headers{HK_DESTINATION, "/queue/idle.activity"}
+	for i := 0; i < 10; i++ {
+		time.Sleep(40 * time.Millisecond)
+		if e = c.Send(sh, tm); e != nil {
+			t.Fatalf("TestIdleActivity Expected nil, got <%v>\n", e)
+		}
+		_ = fb.write("\n") // Heart beat
+	}
+	c.SetIdleTimeout(0)
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Idle Test: a tiny timeout does not panic, and disconnects.
+*/
+func TestIdleTinyTimeout(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestIdleTinyTimeout Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	c.SetIdleTimeout(time.Nanosecond)
+	if f := fb.nextFrame(t); f.Command != DISCONNECT {
+		t.Fatalf("TestIdleTinyTimeout Expected <%v>, got <%v>\n", DISCONNECT,
+			f.Command)
+	}
+	_ = nc.Close()
+	fb.close()
+}
@@ -0,0 +1,110 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"strconv"
+	"time"
+)
+
+/*
+	JMSProperties are JMS style message properties, for use with JMSHeaders.
+	Zero values are omitted.
+*/
+type JMSProperties struct {
+	CorrelationID string    // JMSCorrelationID
+	ReplyTo       string    // JMSReplyTo, a destination
+	Expiration    time.Time // JMSExpiration, zero means never
+}
+
+/*
+	STOMP header names for JMS properties, for one broker type.
+*/
+type jmsNames struct {
+	cid string // Correlation id
+	rto string // Reply to
+	exp string // Expiration
+	ttl bool   // Expiration is a time to live, not an absolute time
+}
+
+/*
+	JMS property mapping by broker type.  Broker types not in the table use
+	the BrokerUnknown entry.
+*/
+var jmsTable = map[BrokerType]jmsNames{
+	BrokerUnknown:  {"correlation-id", "reply-to", "expires", false},
+	BrokerActiveMQ: {"correlation-id", "reply-to", "expires", false},
+	BrokerArtemis:  {"correlation-id", "reply-to", "expires", false},
+	BrokerApollo:   {"correlation-id", "reply-to", "expires", false},
+	BrokerRabbitMQ: {"correlation-id", "reply-to", "expiration", true},
+}
+
+/*
+	JMSHeaders returns the STOMP headers for JMS style properties, using the
+	header conventions of broker type bt, usually c.BrokerType().  The
+	result can be added to SEND headers with Headers.AddHeaders.
+
+	Mapping, for all broker types:
+
+		CorrelationID -> "correlation-id"
+		ReplyTo       -> "reply-to"
+
+	Expiration, ActiveMQ, Artemis, Apollo, and unknown brokers:
+
+		"expires", milliseconds since the Unix epoch
+
+	Expiration, RabbitMQ:
+
+		"expiration", milliseconds from now (a per message TTL), never
+		less than 0
+
+	Example:
+		j := stompngo.JMSProperties{CorrelationID: "req-42",
+			ReplyTo: "/queue/replies"}
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/requests"}
+		h = h.AddHeaders(stompngo.JMSHeaders(c.BrokerType(), j))
+		e := c.Send(h, "request")
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func JMSHeaders(bt BrokerType, j JMSProperties) Headers {
+	n, ok := jmsTable[bt]
+	if !ok {
+		n = jmsTable[BrokerUnknown]
+	}
+	h := Headers{}
+	if j.CorrelationID != "" {
+		h = h.Add(n.cid, j.CorrelationID)
+	}
+	if j.ReplyTo != "" {
+		h = h.Add(n.rto, j.ReplyTo)
+	}
+	if !j.Expiration.IsZero() {
+		var ms int64
+		if n.ttl {
+			ms = int64(j.Expiration.Sub(time.Now()) / time.Millisecond)
+			if ms < 0 {
+				ms = 0
+			}
+		} else {
+			ms = j.Expiration.UnixNano() / int64(time.Millisecond)
+		}
+		h = h.Add(n.exp, strconv.FormatInt(ms, 10))
+	}
+	return h
+}
@@ -0,0 +1,61 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+/*
+	JMS Test: property to header mapping for each broker type.
+*/
+func TestJMSHeaders(t *testing.T) {
+	ex := time.Now().Add(time.Hour)
+	j := JMSProperties{CorrelationID: "req-42", ReplyTo: "/queue/replies", Expiration: ex}
+	for _, jd := range jmsList {
+		h := JMSHeaders(jd.bt, j)
+		if len(h) != 6 {
+			t.Fatalf("TestJMSHeaders %v Expected 3 headers, got <%v>\n", jd.bt, h)
+		}
+		if v := h.Value("correlation-id"); v != "req-42" {
+			t.Fatalf("TestJMSHeaders %v Expected <req-42>, got <%s>\n", jd.bt, v)
+		}
+		if v := h.Value("reply-to"); v != "/queue/replies" {
+			t.Fatalf("TestJMSHeaders %v Expected </queue/replies>, got <%s>\n", jd.bt, v)
+		}
+		v, ok := h.Contains(jd.exp)
+		if !ok {
+			t.Fatalf("TestJMSHeaders %v Expected <%s>, got <%v>\n", jd.bt, jd.exp, h)
+		}
+		ms, _ := strconv.ParseInt(v, 10, 64)
+		want := ex.UnixNano() / int64(time.Millisecond)
+		if jd.ttl {
+			want = int64(time.Hour / time.Millisecond)
+		}
+		if ms > want || ms < want-60*1000 {
+			t.Fatalf("TestJMSHeaders %v Expected about <%d>, got <%d>\n", jd.bt, want, ms)
+		}
+	}
+	if h := JMSHeaders(BrokerRabbitMQ, JMSProperties{Expiration: time.Now().Add(-time.Hour)}); h.Value("expiration") != "0" {
+		t.Fatalf("TestJMSHeaders Expected <0>, got <%v>\n", h)
+	}
+	if h := JMSHeaders(BrokerType(99), JMSProperties{}); len(h) != 0 {
+		t.Fatalf("TestJMSHeaders Expected empty, got <%v>\n", h)
+	}
+}
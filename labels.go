@@ -0,0 +1,90 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"sort"
+	"strings"
+)
+
+/*
+	SetLabels sets arbitrary key/value labels for this connection, e.g. a
+	tenant or application name.  Labels are included in every log line
+	written by the connection logger, and are available to metrics
+	exporters from Labels.
+
+	The map is copied.  A nil or empty map removes all labels.  Labels may
+	also be set at connect time with WithLabels.
+
+	Example:
+		c.SetLabels(map[string]string{"tenant": "acme", "app": "billing"})
+*/
+func (c *Connection) SetLabels(l map[string]string) {
+	lc, ls := copyLabels(l)
+	logLock.Lock()
+	c.lbl = lc
+	c.lbs = ls
+	logLock.Unlock()
+}
+
+/*
+	Labels returns a copy of the labels set for this connection.
+*/
+func (c *Connection) Labels() map[string]string {
+	logLock.Lock()
+	defer logLock.Unlock()
+	l, _ := copyLabels(c.lbl)
+	return l
+}
+
+/*
+	WithLabels sets connection labels before the CONNECT frame is sent,
+	so connect time log lines are labeled as well.  See SetLabels.
+
+	Example:
+		c, e := stompngo.Connect(n, h,
+			stompngo.WithLabels(map[string]string{"tenant": "acme"}))
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func WithLabels(l map[string]string) ConnectOption {
+	return func(o *connectOptions) {
+		o.lbl = l
+	}
+}
+
+/*
+	Copy a label map, and render it as "k=v" pairs, sorted by key, for log
+	output.
+*/
+func copyLabels(l map[string]string) (map[string]string, string) {
+	if len(l) == 0 {
+		return nil, ""
+	}
+	lc := make(map[string]string, len(l))
+	ks := make([]string, 0, len(l))
+	for k, v := range l {
+		lc[k] = v
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	for i, k := range ks {
+		ks[i] = k + "=" + lc[k]
+	}
+	return lc, "{" + strings.Join(ks, " ") + "}"
+}
@@ -0,0 +1,67 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+/*
+	Labels Test: labels set at connect time and later are copied, and are
+	included in log lines.
+*/
+func TestLabelsLog(t *testing.T) {
+	var b bytes.Buffer
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers, WithLabels(labelsTenant))
+	if e != nil {
+		t.Fatalf("TestLabelsLog Expected nil, got <%v>\n", e)
+	}
+	if l := c.Labels(); l["tenant"] != "acme" || len(l) != 1 {
+		t.Fatalf("TestLabelsLog Expected <%v>, got <%v>\n", labelsTenant, l)
+	}
+	c.Labels()["tenant"] = "changed"
+	if v := c.Labels()["tenant"]; v != "acme" {
+		t.Fatalf("TestLabelsLog Expected <acme>, got <%s>\n", v)
+	}
+	c.SetLogger(log.New(&b, "", 0))
+	c.SetLabels(labelsTenantApp)
+	e = c.Send(Headers{HK_DESTINATION, "/queue/labels"}, tm)
+	if e != nil {
+		t.Fatalf("TestLabelsLog Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	_ = fb.nextFrame(t) // SEND
+	logLock.Lock()
+	lo := b.String()
+	logLock.Unlock()
+	if !strings.Contains(lo, labelsLogText) {
+		t.Fatalf("TestLabelsLog Expected <%s> in log, got <%s>\n", labelsLogText, lo)
+	}
+	c.SetLabels(nil)
+	if l := c.Labels(); l != nil {
+		t.Fatalf("TestLabelsLog Expected nil, got <%v>\n", l)
+	}
+	c.SetLogger(nil)
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
@@ -16,10 +16,22 @@
 
 package stompngo
 
+import (
+	"strconv"
+	"time"
+)
+
 /*
-	BodyString returns a Message body as a string.
+	BodyString returns a Message body as a string.  A body with a
+	content-type "charset" parameter naming a registered charset other than
+	UTF-8, see RegisterCharset, is decoded from that charset.  Otherwise,
+	or if the body is not valid in the charset, the body bytes are used
+	as is.
 */
 func (m *Message) BodyString() string {
+	if s, ok := m.charsetBody(); ok {
+		return s
+	}
 	return string(m.Body)
 }
 
@@ -40,3 +52,205 @@ func (m *Message) Size(e bool) int64 {
 	r += int64(len(m.Command)) + 1 + m.Headers.Size(e) + 1 + int64(len(m.Body)) + 1
 	return r
 }
+
+/*
+	Copy returns a deep copy of a Message.  The copy shares no Headers or
+	Body storage with the original.
+*/
+func (m *Message) Copy() Message {
+	r := Message{Command: m.Command, Headers: m.Headers.Clone()}
+	if m.Body != nil {
+		r.Body = make([]uint8, len(m.Body))
+		copy(r.Body, m.Body)
+	}
+	return r
+}
+
+/*
+	ToSend returns a SEND frame suitable for forwarding a received Message to
+	the destination dest.  The body is copied, the broker assigned
+	"message-id", "subscription", and "ack" headers are removed, and the
+	"destination" header is replaced.
+
+	Example:
+		f := md.Message.ToSend("/queue/forwarded")
+		e := c.SendBytes(f.Headers, f.Body)
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func (m *Message) ToSend(dest string) Frame {
+	mc := m.Copy()
+	h := Headers{HK_DESTINATION, dest}
+	for i := 0; i < len(mc.Headers); i += 2 {
+		switch mc.Headers[i] {
+		case HK_DESTINATION, HK_MESSAGE_ID, HK_SUBSCRIPTION, HK_ACK:
+			continue
+		}
+		h = append(h, mc.Headers[i], mc.Headers[i+1])
+	}
+	return Frame{SEND, h, mc.Body}
+}
+
+/*
+	Broker specific redelivery count headers.  The count is the header value
+	less adj.  BrokerUnknown entries are generic, and apply to all brokers.
+*/
+var redeliveryCountHeaders = []struct {
+	bt  BrokerType // Broker type
+	k   string     // Header key
+	adj int64      // Deliveries counted that are not redeliveries
+}{
+	{BrokerApollo, "redeliveries", 0},
+	{BrokerArtemis, "JMSXDeliveryCount", 1},
+	{BrokerRabbitMQ, "x-delivery-count", 0},
+	{BrokerUnknown, "x-redelivery-count", 0},
+}
+
+/*
+	MessageId returns the "message-id" header value, and false if absent.
+*/
+func (m *Message) MessageId() (string, bool) {
+	return m.Headers.Contains(HK_MESSAGE_ID)
+}
+
+/*
+	Subscription returns the "subscription" header value, and false if
+	absent.
+*/
+func (m *Message) Subscription() (string, bool) {
+	return m.Headers.Contains(HK_SUBSCRIPTION)
+}
+
+/*
+	Destination returns the "destination" header value, and false if absent.
+*/
+func (m *Message) Destination() (string, bool) {
+	return m.Headers.Contains(HK_DESTINATION)
+}
+
+/*
+	ContentType returns the "content-type" header value, and false if
+	absent.
+*/
+func (m *Message) ContentType() (string, bool) {
+	return m.Headers.Contains(HK_CONTENT_TYPE)
+}
+
+/*
+	Redelivered reports whether the broker flagged a Message as redelivered,
+	and false if no redelivery header is present or parseable.  The
+	"redelivered" header (ActiveMQ, RabbitMQ) is checked first, then broker
+	specific redelivery counts.
+*/
+func (m *Message) Redelivered() (bool, bool) {
+	if r, ok := m.redeliveredFlag(); ok {
+		return r, true
+	}
+	if n, ok := m.redeliveryCount(BrokerUnknown, true); ok {
+		return n > 0, true
+	}
+	return false, false
+}
+
+/*
+	RedeliveryCount returns the number of times a Message has been
+	redelivered, 0 for a first delivery, and false if no redelivery header
+	is present or parseable.  The headers of all known brokers are checked:
+
+		"redeliveries"        Apollo
+		"JMSXDeliveryCount"   Artemis, less the first delivery
+		"x-delivery-count"    RabbitMQ
+		"x-redelivery-count"  Any broker
+
+	If only a "redelivered" flag is present, the count is 1 when it is true,
+	and 0 otherwise.  See also Connection.RedeliveryCount, which checks only
+	the headers used by the connected broker.
+
+	Example:
+		if n, ok := md.Message.RedeliveryCount(); ok && n >= 5 {
+			// Dead letter it ...
+		}
+*/
+func (m *Message) RedeliveryCount() (int, bool) {
+	if n, ok := m.redeliveryCount(BrokerUnknown, true); ok {
+		return n, true
+	}
+	return m.flagCount()
+}
+
+/*
+	RedeliveryCount returns the redelivery count of a Message as
+	Message.RedeliveryCount does, checking only the redelivery headers of the
+	connected broker type, and the broker independent headers.
+*/
+func (c *Connection) RedeliveryCount(m Message) (int, bool) {
+	if n, ok := m.redeliveryCount(c.BrokerType(), false); ok {
+		return n, true
+	}
+	return m.flagCount()
+}
+
+/*
+	The "redelivered" flag header.
+*/
+func (m *Message) redeliveredFlag() (bool, bool) {
+	v, ok := m.Headers.Contains(HK_REDELIVERED)
+	if !ok {
+		return false, false
+	}
+	r, e := strconv.ParseBool(v)
+	return r, e == nil
+}
+
+/*
+	Redelivery count from the "redelivered" flag: 1 when set.
+*/
+func (m *Message) flagCount() (int, bool) {
+	r, ok := m.redeliveredFlag()
+	if !ok {
+		return 0, false
+	}
+	if r {
+		return 1, true
+	}
+	return 0, true
+}
+
+/*
+	Redelivery count from the count headers for broker type bt, or for all
+	broker types.
+*/
+func (m *Message) redeliveryCount(bt BrokerType, all bool) (int, bool) {
+	for _, rc := range redeliveryCountHeaders {
+		if !all && rc.bt != bt && rc.bt != BrokerUnknown {
+			continue
+		}
+		if v, ok := m.Headers.Contains(rc.k); ok {
+			if n, e := strconv.ParseInt(v, 10, 64); e == nil {
+				if n -= rc.adj; n < 0 {
+					n = 0
+				}
+				return int(n), true
+			}
+		}
+	}
+	return 0, false
+}
+
+/*
+	Timestamp returns the broker "timestamp" header, milliseconds since the
+	Unix epoch, as a time.Time.  The zero time and false are returned if the
+	header is absent or not parseable.
+*/
+func (m *Message) Timestamp() (time.Time, bool) {
+	v, ok := m.Headers.Contains(HK_TIMESTAMP)
+	if !ok {
+		return time.Time{}, false
+	}
+	ms, e := strconv.ParseInt(v, 10, 64)
+	if e != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)), true
+}
@@ -0,0 +1,121 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"sync"
+)
+
+/*
+	Multiplex merges several MessageData channels, e.g. subscription
+	channels, into one.  The returned channel is closed when all source
+	channels are closed.  Messages can be told apart by their "subscription"
+	header.
+
+	The merged channel is unbuffered.  The consumer should read it until it
+	is closed: a source that is never read from again holds a goroutine.
+
+	Each source is read by a single goroutine, and nothing is buffered or
+	reordered, so the messages of any one source arrive in the merged
+	channel in exactly their source order.  The interleaving of messages
+	from different sources is not specified.
+
+	Example:
+		s1, _ := c.Subscribe(h1)
+		s2, _ := c.Subscribe(h2)
+		for md := range stompngo.Multiplex(s1, s2) {
+			// Process md ...
+		}
+*/
+func Multiplex(chans ...<-chan MessageData) <-chan MessageData {
+	r := make(chan MessageData)
+	var wg sync.WaitGroup
+	wg.Add(len(chans))
+	for _, mc := range chans {
+		go func(mc <-chan MessageData) {
+			defer wg.Done()
+			for md := range mc {
+				r <- md
+			}
+		}(mc)
+	}
+	go func() {
+		wg.Wait()
+		close(r)
+	}()
+	return r
+}
+
+/*
+	SubscribeMany subscribes to each destination in dests with the given ack
+	mode, and merges the subscription channels into one with Multiplex.  An
+	empty ack mode means "auto".  Subscription ids are generated, and the
+	returned map gives the id used for each destination, for a later
+	Unsubscribe.  Messages can be told apart by their "subscription" header.
+
+	The merged channel is closed once every subscription channel is closed,
+	e.g. by UnsubscribeReceipt or Disconnect.  A plain Unsubscribe does not
+	close the subscription channel.
+
+	If any subscription fails, those already made are unsubscribed and the
+	error is returned.  EREQDSTSUB is returned if dests is empty, and
+	EDUPDEST if it contains a destination more than once.
+
+	Example:
+		mc, ids, e := c.SubscribeMany([]string{"/queue/a", "/queue/b"},
+			stompngo.AckModeAuto)
+		if e != nil {
+			// Do something sane ...
+		}
+		for md := range mc {
+			// Process md ...
+		}
+*/
+func (c *Connection) SubscribeMany(dests []string, ackMode string) (<-chan MessageData, map[string]string, error) {
+	if len(dests) == 0 {
+		return nil, nil, EREQDSTSUB
+	}
+	if ackMode == "" {
+		ackMode = AckModeAuto
+	}
+	ids := make(map[string]string, len(dests))
+	sds := make([]*subscription, 0, len(dests))
+	chans := make([]<-chan MessageData, 0, len(dests))
+	for _, d := range dests {
+		var e error
+		if _, ok := ids[d]; ok {
+			e = EDUPDEST
+		}
+		var sd *subscription
+		if e == nil {
+			sd, e = c.subscribe(Headers{HK_DESTINATION, d, HK_ACK, ackMode}, 0)
+		}
+		if sd != nil {
+			sds = append(sds, sd)
+		}
+		if e != nil {
+			c.log(SUBSCRIBE, "many rollback", d, e)
+			for _, sd := range sds {
+				_ = c.closeSubscription(sd)
+			}
+			return nil, nil, e
+		}
+		ids[d] = sd.id
+		chans = append(chans, sd.md)
+	}
+	return Multiplex(chans...), ids, nil
+}
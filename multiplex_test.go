@@ -0,0 +1,171 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+/*
+	Multiplex Test: SubscribeMany merges the subscriptions into one channel,
+	and the merged channel closes when all are unsubscribed.
+*/
+func TestMultiplexSubscribeMany(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestMultiplexSubscribeMany Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	mc, ids, e := c.SubscribeMany(multiplexDests, AckModeClient)
+	if e != nil {
+		t.Fatalf("TestMultiplexSubscribeMany Expected nil, got <%v>\n", e)
+	}
+	for _, d := range multiplexDests {
+		f := fb.nextFrame(t)
+		if f.Command != SUBSCRIBE || f.Headers.Value(HK_DESTINATION) != d ||
+			f.Headers.Value(HK_ACK) != AckModeClient ||
+			f.Headers.Value(HK_ID) != ids[d] {
+			t.Fatalf("TestMultiplexSubscribeMany Expected SUBSCRIBE <%s>, got <%v>\n", d, f)
+		}
+		_ = fb.write(MESSAGE + "\n" + HK_DESTINATION + ":" + d + "\n" +
+			HK_SUBSCRIPTION + ":" + ids[d] + "\n" + HK_MESSAGE_ID + ":" + d +
+			"\n\n" + d + "\x00")
+	}
+	got := map[string]bool{}
+	for range multiplexDests {
+		select {
+		case md := <-mc:
+			d := md.Message.BodyString()
+			if md.Error != nil || md.Message.Headers.Value(HK_SUBSCRIPTION) != ids[d] {
+				t.Fatalf("TestMultiplexSubscribeMany Expected <%s>, got <%v>\n", d, md)
+			}
+			got[d] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestMultiplexSubscribeMany nothing delivered\n")
+		}
+	}
+	if len(got) != len(multiplexDests) {
+		t.Fatalf("TestMultiplexSubscribeMany Expected all destinations, got <%v>\n", got)
+	}
+	for d, id := range ids {
+		_, e = c.UnsubscribeReceipt(Headers{HK_DESTINATION, d, HK_ID, id}, 5*time.Second)
+		if e != nil {
+			t.Fatalf("TestMultiplexSubscribeMany Expected nil, got <%v>\n", e)
+		}
+	}
+	select {
+	case md, ok := <-mc:
+		if ok {
+			t.Fatalf("TestMultiplexSubscribeMany Expected closed, got <%v>\n", md)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestMultiplexSubscribeMany merged channel not closed\n")
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Multiplex Test: a failed SubscribeMany unsubscribes the subscriptions
+	already made.
+*/
+func TestMultiplexSubscribeManyRollback(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestMultiplexSubscribeManyRollback Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	if _, _, e = c.SubscribeMany(nil, ""); e != EREQDSTSUB {
+		t.Fatalf("TestMultiplexSubscribeManyRollback Expected <%v>, got <%v>\n",
+			EREQDSTSUB, e)
+	}
+	d := multiplexDests[0]
+	if _, _, e = c.SubscribeMany([]string{d, d}, ""); e != EDUPDEST {
+		t.Fatalf("TestMultiplexSubscribeManyRollback Expected <%v>, got <%v>\n",
+			EDUPDEST, e)
+	}
+	s := fb.nextFrame(t)
+	u := fb.nextFrame(t)
+	if s.Command != SUBSCRIBE || s.Headers.Value(HK_ACK) != AckModeAuto ||
+		u.Command != UNSUBSCRIBE || u.Headers.Value(HK_ID) != s.Headers.Value(HK_ID) {
+		t.Fatalf("TestMultiplexSubscribeManyRollback Expected rollback, got <%v> <%v>\n",
+			s, u)
+	}
+	if n := len(c.Subscriptions()); n != 0 {
+		t.Fatalf("TestMultiplexSubscribeManyRollback Expected no subscriptions, got <%d>\n", n)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Multiplex Test: each source keeps its own order in the merged channel,
+	however the sources interleave.
+*/
+func TestMultiplexFIFOPerSource(t *testing.T) {
+	chans := make([]<-chan MessageData, multiplexSources)
+	for i := range chans {
+		sc := make(chan MessageData, i) // Unbuffered to well buffered
+		chans[i] = sc
+		go func(i int, sc chan MessageData) {
+			for n := 0; n < multiplexPerSource; n++ {
+				if n%(i+2) == 0 {
+					runtime.Gosched() // Vary the interleaving
+				}
+				sc <- MessageData{Message: Message{MESSAGE,
+					Headers{HK_SUBSCRIPTION, strconv.Itoa(i),
+						HK_MESSAGE_ID, strconv.Itoa(n)}, NULLBUFF}}
+			}
+			close(sc)
+		}(i, sc)
+	}
+	mc := Multiplex(chans...)
+	next := make([]int, multiplexSources)
+	tmo := time.After(10 * time.Second)
+	for total := 0; ; total++ {
+		var md MessageData
+		var ok bool
+		select {
+		case md, ok = <-mc:
+		case <-tmo:
+			t.Fatalf("TestMultiplexFIFOPerSource merged channel not closed\n")
+		}
+		if !ok {
+			if total != multiplexSources*multiplexPerSource {
+				t.Fatalf("TestMultiplexFIFOPerSource Expected <%d>, got <%d>\n",
+					multiplexSources*multiplexPerSource, total)
+			}
+			break
+		}
+		src, _ := strconv.Atoi(md.Message.Headers.Value(HK_SUBSCRIPTION))
+		seq, _ := strconv.Atoi(md.Message.Headers.Value(HK_MESSAGE_ID))
+		if seq != next[src] {
+			t.Fatalf("TestMultiplexFIFOPerSource source <%d> Expected <%d>, got <%d>\n",
+				src, next[src], seq)
+		}
+		next[src]++
+	}
+}
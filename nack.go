@@ -31,6 +31,13 @@ var _ = fmt.Println
 
 	For Stomp 1.2 Headers must contain a unique "id" header key.
 
+	As for Ack, the required headers are checked for the negotiated protocol
+	level, and must not be empty.  EREQMIDNAK, EREQSUBNAK, or EREQIDNAK is
+	returned, and nothing is sent, if one is missing.
+
+	As with Ack, a NACK on a subscription in "client" ack mode is
+	cumulative, and covers every earlier MESSAGE delivered on that
+	subscription.
 
 	See the specifications at http://stomp.github.com/ for details.
 
@@ -47,33 +54,49 @@ var _ = fmt.Println
 
 */
 func (c *Connection) Nack(h Headers) error {
-	c.log(NACK, "start", h, c.Protocol())
-	if !c.connected {
+	s := c.ackSubscription(h) // For logging
+	c.subLog(s, NACK, "start", h, c.Protocol())
+	if !c.Connected() {
 		return ECONBAD
 	}
 	if c.Protocol() == SPL_10 {
 		return EBADVERNAK
 	}
-	e := checkHeaders(h, c.Protocol())
+	e := c.validateHeaders(h)
 	if e != nil {
 		return e
 	}
-
-	switch c.Protocol() {
-	case SPL_12:
-		if _, ok := h.Contains(HK_ID); !ok {
-			return EREQIDNAK
-		}
-	default: // SPL_11
-		if _, ok := h.Contains(HK_SUBSCRIPTION); !ok {
-			return EREQSUBNAK
-		}
-		if _, ok := h.Contains(HK_MESSAGE_ID); !ok {
-			return EREQMIDNAK
-		}
+	if e = checkAckHeaders(c.Protocol(), h, true); e != nil {
+		return e
 	}
 
 	e = c.transmitCommon(NACK, h) // transmitCommon Clones() the headers
-	c.log(NACK, "end", h, c.Protocol())
+	if e == nil {
+		c.clearAck(h)
+	}
+	c.subLog(s, NACK, "end", h, c.Protocol())
 	return e
 }
+
+/*
+	NackMessage NACKs a received MESSAGE, building the required headers from
+	the MESSAGE for the current protocol level, as AckMessage does.
+
+	For Stomp 1.2 the MESSAGE "ack" header value is used as the NACK "id", and
+	EREQIDNAK is returned if the MESSAGE has no, or an empty, "ack" header.
+	A NACK carrying a 1.1 style "message-id" would be ignored by the broker.
+
+	For Stomp 1.1 the "message-id" and "subscription" headers are used.
+
+	Disallowed for an established STOMP 1.0 connection, and EBADVERNAK is returned.
+*/
+func (c *Connection) NackMessage(m Message) error {
+	if c.Protocol() == SPL_10 {
+		return EBADVERNAK
+	}
+	h, e := c.ackHeaders(m, EREQIDNAK)
+	if e != nil {
+		return e
+	}
+	return c.Nack(h)
+}
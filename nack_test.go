@@ -48,3 +48,44 @@ func TestNackErrors(t *testing.T) {
 	checkDisconnectError(t, e)
 	_ = closeConn(t, n)
 }
+
+/*
+	Test NackMessage headers by protocol level.
+*/
+func TestNackMessage(t *testing.T) {
+	for ti, tv := range nackMsgList {
+		nc, fb := openFakeConn(t, tv.resp)
+		c, e := Connect(nc, tv.ch)
+		if e != nil {
+			t.Fatalf("TestNackMessage[%d] CONNECT expected nil, got %v\n", ti, e)
+		}
+		_ = fb.nextFrame(t) // CONNECT
+		e = c.NackMessage(Message{MESSAGE, tv.mh, []byte{}})
+		if e != tv.exe {
+			t.Fatalf("TestNackMessage[%d] proto:%s expected:%v got:%v\n",
+				ti, tv.proto, tv.exe, e)
+		}
+		if e == nil {
+			f := fb.nextFrame(t)
+			if f.Command != NACK {
+				t.Fatalf("TestNackMessage[%d] proto:%s expected:%v got:%v\n",
+					ti, tv.proto, NACK, f.Command)
+			}
+			for i := 0; i < len(tv.want); i += 2 {
+				if !f.Headers.ContainsKV(tv.want[i], tv.want[i+1]) {
+					t.Fatalf("TestNackMessage[%d] proto:%s expected:%v got:%v\n",
+						ti, tv.proto, tv.want, f.Headers)
+				}
+			}
+			for _, k := range []string{HK_ID, HK_MESSAGE_ID, HK_SUBSCRIPTION} {
+				if _, ok := f.Headers.Contains(k); ok && tv.want.Index(k) < 0 {
+					t.Fatalf("TestNackMessage[%d] proto:%s unexpected header:%s\n",
+						ti, tv.proto, k)
+				}
+			}
+		}
+		e = c.Disconnect(empty_headers)
+		checkDisconnectError(t, e)
+		fb.close()
+	}
+}
@@ -0,0 +1,76 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"sync"
+)
+
+/*
+	Ordered send sequencer, a FIFO (ticket) lock.  Unlike sync.Mutex, waiters
+	are served strictly in the order they arrive.
+*/
+type sendSequencer struct {
+	mu   sync.Mutex
+	cv   *sync.Cond
+	next uint64 // Next ticket to issue
+	turn uint64 // Ticket now being served
+}
+
+/*
+	New ordered send sequencer.
+*/
+func newSendSequencer() *sendSequencer {
+	s := &sendSequencer{}
+	s.cv = sync.NewCond(&s.mu)
+	return s
+}
+
+/*
+	Take a ticket, and wait for its turn.
+*/
+func (s *sendSequencer) lock() {
+	s.mu.Lock()
+	t := s.next
+	s.next++
+	for t != s.turn {
+		s.cv.Wait()
+	}
+	s.mu.Unlock()
+}
+
+/*
+	End the current turn.
+*/
+func (s *sendSequencer) unlock() {
+	s.mu.Lock()
+	s.turn++
+	s.cv.Broadcast()
+	s.mu.Unlock()
+}
+
+/*
+	Serialize a send if ordered sends are enabled.  Returns the function to
+	end the send.
+*/
+func (c *Connection) orderSend() func() {
+	if c.sseq == nil {
+		return func() {}
+	}
+	c.sseq.lock()
+	return c.sseq.unlock
+}
@@ -0,0 +1,59 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+/*
+	Ordered Test: concurrent sends reach the wire in call order.
+*/
+func TestOrderedSends(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	sc := &slowConn{Conn: nc}
+	c, e := Connect(sc, fake12Headers, WithOrderedSends())
+	if e != nil {
+		t.Fatalf("TestOrderedSends Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	sc.setDelay(10 * time.Millisecond)
+	sh := Headers{HK_DESTINATION, "/queue/ordered"}
+	ec := make(chan error, orderedSendCount)
+	for i := 0; i < orderedSendCount; i++ {
+		go func(b string) {
+			ec <- c.Send(sh, b)
+		}(strconv.Itoa(i))
+		for c.sseq.issued() != uint64(i+1) {
+			// Wait for the call to be ticketed
+		}
+	}
+	for i := 0; i < orderedSendCount; i++ {
+		if f := fb.nextFrame(t); string(f.Body) != strconv.Itoa(i) {
+			t.Fatalf("TestOrderedSends Expected <%v>, got <%v>\n", i, string(f.Body))
+		}
+		if e = <-ec; e != nil {
+			t.Fatalf("TestOrderedSends Expected nil, got <%v>\n", e)
+		}
+	}
+	sc.setDelay(0)
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
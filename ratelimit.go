@@ -0,0 +1,130 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	Send rate limiter, a token bucket.
+*/
+type rateLimiter struct {
+	lk     sync.Mutex
+	rate   float64   // Tokens per second
+	burst  float64   // Bucket size
+	tokens float64   // Tokens currently available
+	last   time.Time // Last refill time
+}
+
+/*
+	SetSendRateLimit limits the rate of SEND frames on this connection to
+	perSecond messages per second, allowing bursts of up to burst messages.
+
+	By default a send that exceeds the limit blocks until it is permitted.
+	A blocked send returns early with ctx.Err() if the WithContext context is
+	done, or ECONBAD if the connection shuts down.  See
+	SetSendRateLimitNoWait for an alternative.
+
+	A perSecond value of zero or less removes any limit.
+
+	Example:
+		c.SetSendRateLimit(100, 10) // 100 msgs/sec, bursts of 10
+*/
+func (c *Connection) SetSendRateLimit(perSecond int, burst int) {
+	c.log("Send Rate Limit", perSecond, burst)
+	c.rlLock.Lock()
+	defer c.rlLock.Unlock()
+	if perSecond <= 0 {
+		c.rl = nil
+		return
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	c.rl = &rateLimiter{rate: float64(perSecond), burst: float64(burst),
+		tokens: float64(burst), last: time.Now()}
+}
+
+/*
+	SetSendRateLimitNoWait controls what happens when a send exceeds the rate
+	limit.  If nw is true the send is not performed, and ERATELIM is
+	returned.  If nw is false (the default) the send blocks until permitted.
+*/
+func (c *Connection) SetSendRateLimitNoWait(nw bool) {
+	c.rlLock.Lock()
+	c.rlnw = nw
+	c.rlLock.Unlock()
+}
+
+/*
+	ThrottledSends returns a count of the SEND frames that were delayed or
+	rejected by the send rate limiter.
+*/
+func (c *Connection) ThrottledSends() int64 {
+	return atomic.LoadInt64(&c.tsc)
+}
+
+/*
+	Apply any send rate limit.
+*/
+func (c *Connection) throttleSend() error {
+	c.rlLock.Lock()
+	rl, nw := c.rl, c.rlnw
+	c.rlLock.Unlock()
+	if rl == nil {
+		return nil
+	}
+	rl.lk.Lock()
+	now := time.Now()
+	rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+	if rl.tokens > rl.burst {
+		rl.tokens = rl.burst
+	}
+	rl.last = now
+	if rl.tokens >= 1 {
+		rl.tokens--
+		rl.lk.Unlock()
+		return nil
+	}
+	atomic.AddInt64(&c.tsc, 1)
+	if nw {
+		rl.lk.Unlock()
+		return ERATELIM
+	}
+	// Reserve a token, and wait for it
+	rl.tokens--
+	w := time.Duration(-rl.tokens / rl.rate * float64(time.Second))
+	rl.lk.Unlock()
+	c.log("SEND throttled", w)
+	var cd <-chan struct{}
+	if c.copts != nil && c.copts.ctx != nil {
+		cd = c.copts.ctx.Done()
+	}
+	tm := time.NewTimer(w)
+	defer tm.Stop()
+	select {
+	case _ = <-tm.C:
+		return nil
+	case _ = <-cd:
+		return c.copts.ctx.Err()
+	case _ = <-c.ssdc:
+		return ECONBAD
+	}
+}
@@ -0,0 +1,93 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+/*
+	RateLimit Test: blocking sends.
+*/
+func TestRateLimitBlock(t *testing.T) {
+	c := &Connection{}
+	c.SetSendRateLimit(20, 1)
+	st := time.Now()
+	for i := 0; i < 3; i++ {
+		if e := c.throttleSend(); e != nil {
+			t.Fatalf("TestRateLimitBlock Expected nil, got <%v>\n", e)
+		}
+	}
+	if d := time.Since(st); d < 90*time.Millisecond {
+		t.Fatalf("TestRateLimitBlock Expected >= 90ms, got <%v>\n", d)
+	}
+	if c.ThrottledSends() != 2 {
+		t.Fatalf("TestRateLimitBlock Expected 2 throttled, got <%v>\n",
+			c.ThrottledSends())
+	}
+}
+
+/*
+	RateLimit Test: non blocking sends.
+*/
+func TestRateLimitNoWait(t *testing.T) {
+	c := &Connection{}
+	c.SetSendRateLimit(1, 2)
+	c.SetSendRateLimitNoWait(true)
+	for i := 0; i < 2; i++ {
+		if e := c.throttleSend(); e != nil {
+			t.Fatalf("TestRateLimitNoWait Expected nil, got <%v>\n", e)
+		}
+	}
+	if e := c.throttleSend(); e != ERATELIM {
+		t.Fatalf("TestRateLimitNoWait Expected <%v>, got <%v>\n", ERATELIM, e)
+	}
+	if c.ThrottledSends() != 1 {
+		t.Fatalf("TestRateLimitNoWait Expected 1 throttled, got <%v>\n",
+			c.ThrottledSends())
+	}
+	c.SetSendRateLimit(0, 0) // No limit
+	if e := c.throttleSend(); e != nil {
+		t.Fatalf("TestRateLimitNoWait Expected nil, got <%v>\n", e)
+	}
+}
+
+/*
+	RateLimit Test: a blocked send ends when the context is cancelled.
+*/
+func TestRateLimitContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Connection{copts: &connectOptions{ctx: ctx}}
+	c.SetSendRateLimit(1, 1)
+	if e := c.throttleSend(); e != nil {
+		t.Fatalf("TestRateLimitContext Expected nil, got <%v>\n", e)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	st := time.Now()
+	if e := c.throttleSend(); e != context.Canceled {
+		t.Fatalf("TestRateLimitContext Expected <%v>, got <%v>\n",
+			context.Canceled, e)
+	}
+	if d := time.Since(st); d > 500*time.Millisecond {
+		t.Fatalf("TestRateLimitContext Expected < 500ms, got <%v>\n", d)
+	}
+}
@@ -17,11 +17,13 @@
 package stompngo
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"net"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -49,8 +51,15 @@ readLoop:
 			//debug.PrintStack()
 			f.Headers = append(f.Headers, "connection_read_error", e.Error())
 			md := MessageData{Message(f), e}
+			if e == io.EOF && atomic.LoadInt32(&c.dsnt) == 1 {
+				// Broker closed after DISCONNECT, shutdown is under way
+				c.log("RDR_DISCONNECT_EOF", e)
+				md.Error = EDISCEOF
+				c.failReceipts(md)
+				break readLoop
+			}
 			c.handleReadError(md)
-			if e == io.EOF && !c.connected {
+			if e == io.EOF && !c.Connected() {
 				c.log("RDR_SHUTDOWN_EOF", e)
 			} else {
 				c.log("RDR_CONN_GENL_ERR", e)
@@ -61,11 +70,21 @@ readLoop:
 		if f.Command == "" {
 			continue readLoop
 		}
+		c.updateActivity()
+		if f.Command == MESSAGE && !c.waitReaderResume() {
+			c.log("RDR_SHUTDOWN detected")
+			break readLoop
+		}
 
 		m := Message(f)
-		c.mets.tfr += 1 // Total frames read
+		atomic.AddInt64(&c.mets.tfr, 1) // Total frames read
 		// Headers already decoded
-		c.mets.tbr += m.Size(false) // Total bytes read
+		atomic.AddInt64(&c.mets.tbr, m.Size(false)) // Total bytes read
+		c.countFrameSize(DirectionRead, m.Size(false))
+		if f.Command == MESSAGE {
+			c.decodeBody(&f) // Wire sizes are counted above
+			m = Message(f)
+		}
 
 		//*************************************************************************
 		// Replacement START
@@ -74,48 +93,58 @@ readLoop:
 		//
 		case MESSAGE:
 			sid, ok := f.Headers.Contains(HK_SUBSCRIPTION)
+			sid = c.decodedValue(sid)
 			if !ok { // This should *NEVER* happen
 				panic(fmt.Sprintf("stompngo INTERNAL ERROR: command:<%s> headers:<%v>",
 					f.Command, f.Headers))
 			}
-			c.subsLock.RLock()
-			ps, sok := c.subs[sid] // This is a map of pointers .....
-			//
-			if !sok {
-				// The sub can be gone under some timing conditions.  In that case
-				// we log it of possible, and continue (hope for the best).
-				c.log("RDR_NOSUB", sid, m.Command, m.Headers)
-				goto csRUnlock
-			}
-			if ps.cs {
-				// The sub can also already be closed under some conditions.
-				// Again, we log that if possible, and continue
-				c.log("RDR_CLSUB", sid, m.Command, m.Headers)
-				goto csRUnlock
-			}
-			// Handle subscription draining
-			switch ps.drav {
-			case false:
-				ps.md <- md
-			default:
-				ps.drmc++
-				if ps.drmc > ps.dra {
-					c.log("RDR_DROPM", ps.drmc, sid, m.Command,
-						m.Headers, HexData(m.Body))
-				} else {
-					ps.md <- md
+			if ps := c.lockSubDelivery(sid, m); ps != nil {
+				// Not delivered if closed while waiting for credits
+				if ps.crc == nil || c.takeCredit(ps) {
+					c.trackAck(ps, m)
+					atomic.AddInt64(&ps.mc, 1)
+					if ps.rpl != nil {
+						ps.rpl.add(md)
+					}
+					if c.deliverSub(ps, md) {
+						c.noteBuffered(ps, int64(len(m.Body)))
+						c.subTrace(ps, "RDR_DELIVER", ps.id, m.Headers)
+					}
 				}
+				ps.dlk.Unlock()
+			}
+			if !c.waitByteBudget() {
+				c.log("RDR_SHUTDOWN detected")
+				break readLoop
 			}
-		csRUnlock:
-			c.subsLock.RUnlock()
 		//
 		case ERROR:
-			fallthrough
+			eh := c.errorHandler()
+			if eh != nil {
+				c.log("RDR_ERROR_CALLBACK", m.Command, m.Headers)
+				eh(m)
+			}
+			// A receipt waiter also gets the ERROR
+			if !c.deliverReceipt(md) && eh == nil {
+				c.defaultSink() <- md
+			}
 		//
 		case RECEIPT:
-			c.input <- md
+			if c.deliverReceipt(md) {
+				break
+			}
+			c.defaultSink() <- md
 		//
 		default:
+			if !c.strictCommands() { // Lenient, unknown broker command
+				if uh := c.unknownFrameHandler(); uh != nil {
+					c.log("RDR_UNKNOWN_CALLBACK", f.Command, f.Headers)
+					uh(f)
+				} else {
+					c.log("RDR_UNKNOWN_DROP", f.Command, f.Headers)
+				}
+				break
+			}
 			panic(fmt.Sprintf("Broker SEVERE ERROR, not STOMP? command:<%s> headers:<%v>",
 				f.Command, f.Headers))
 		}
@@ -131,7 +160,7 @@ readLoop:
 		c.log("RDR_RELOOP")
 	}
 	close(c.input)
-	c.connected = false
+	c.setConnected(false)
 	c.log("RDR_SHUTDOWN", time.Now())
 }
 
@@ -145,6 +174,10 @@ readLoop:
 	if running against a non-compliant STOMP server.
 */
 func (c *Connection) readFrame() (f Frame, e error) {
+	c.armFrameIdle()
+	if c.frameCodec() != nil {
+		return c.readCodecFrame()
+	}
 	f = Frame{"", Headers{}, NULLBUFF}
 
 	// Read f.Command or line ends (maybe heartbeats)
@@ -156,56 +189,63 @@ func (c *Connection) readFrame() (f Frame, e error) {
 	if s == "" {
 		return f, e
 	}
-	if c.hbd != nil {
-		c.updateHBReads()
-	}
-	f.Command = s[0 : len(s)-1]
-	if s == "\n" {
+	c.updateReads()
+	f.Command = c.trimEOL(s)
+	if f.Command == "" { // LF, or CRLF at 1.2
+		if hh := c.heartBeatReceivedHandler(); hh != nil {
+			hh()
+		}
 		return f, e
 	}
 
 	// Validate the command
-	if _, ok := validCmds[f.Command]; !ok {
+	if _, ok := validCmds[f.Command]; !ok && c.strictCommands() {
 		ev := fmt.Errorf("%s\n%s", EINVBCMD, HexData([]byte(f.Command)))
 		return f, ev
 	}
 	// Read f.Headers
+	hl := 0 // Header section length so far
 	for {
 		c.setReadDeadline()
-		s, e := c.rdr.ReadString('\n')
+		s, e := c.readHeaderLine(hl)
 		if c.checkReadError(e) != nil {
 			return f, e
 		}
-		if c.hbd != nil {
-			c.updateHBReads()
-		}
-		if s == "\n" {
+		hl += len(s)
+		c.updateReads()
+		s = c.trimEOL(s)
+		if s == "" {
 			break
 		}
-		s = s[0 : len(s)-1]
 		p := strings.SplitN(s, ":", 2)
 		if len(p) != 2 {
 			return f, EUNKHDR
 		}
-		if c.Protocol() != SPL_10 {
+		if c.Protocol() != SPL_10 && !c.copts.rawh {
 			p[0] = decode(p[0])
 			p[1] = decode(p[1])
 		}
 		f.Headers = append(f.Headers, p[0], p[1])
 	}
 	//
-	e = checkHeaders(f.Headers, c.Protocol())
+	e = c.validateHeaders(f.Headers)
 	if e != nil {
 		return f, e
 	}
+	if e = c.checkDuplicateHeaders(&f); e != nil {
+		return f, e
+	}
 	// Read f.Body
 	if v, ok := f.Headers.Contains(HK_CONTENT_LENGTH); ok {
-		l, e := strconv.Atoi(strings.TrimSpace(v))
-		if e != nil {
-			return f, e
+		l, ce := strconv.Atoi(strings.TrimSpace(v))
+		if ce != nil {
+			return f, ce
+		}
+		if l < 0 {
+			return f, EBADCLEN
 		}
 		if l == 0 {
-			f.Body, e = readUntilNul(c)
+			f.Body, e = readEmptyBody(c)
 		} else {
 			f.Body, e = readBody(c, l)
 		}
@@ -216,9 +256,7 @@ func (c *Connection) readFrame() (f Frame, e error) {
 	if c.checkReadError(e) != nil {
 		return f, e
 	}
-	if c.hbd != nil {
-		c.updateHBReads()
-	}
+	c.updateReads()
 	// End of read loop - set no deadline
 	if c.dld.rde {
 		_ = c.netconn.SetReadDeadline(c.dld.t0)
@@ -226,13 +264,107 @@ func (c *Connection) readFrame() (f Frame, e error) {
 	return f, e
 }
 
+/*
+	Find the subscription for a MESSAGE and lock it for delivery.  Returns
+	nil if the MESSAGE is not to be delivered.
+
+	The subs lock is only held for the lookup, so a blocked delivery does not
+	hold up Subscribe, Unsubscribe, or Close.  The subscription channel can
+	not be closed while the delivery lock is held, see closeSub.
+*/
+func (c *Connection) lockSubDelivery(sid string, m Message) *subscription {
+	c.subsLock.RLock()
+	defer c.subsLock.RUnlock()
+	ps, sok := c.subs[sid] // This is a map of pointers .....
+	//
+	if !sok {
+		// The sub can be gone under some timing conditions.  In that case
+		// we log it of possible, and continue (hope for the best).
+		c.log("RDR_NOSUB", sid, m.Command, m.Headers)
+		return nil
+	}
+	if ps.cs {
+		// The sub can also already be closed under some conditions.
+		// Again, we log that if possible, and continue
+		c.subLog(ps, "RDR_CLSUB", sid, m.Command, m.Headers)
+		return nil
+	}
+	// Handle subscription draining
+	if ps.drav {
+		ps.drmc++
+		if ps.drmc > ps.dra {
+			c.subLog(ps, "RDR_DROPM", ps.drmc, sid, m.Command,
+				m.Headers, HexData(m.Body))
+			return nil
+		}
+	}
+	ps.dlk.Lock()
+	return ps
+}
+
+/*
+	Deliver a MESSAGE to a subscription channel, noting slow consumers.
+	Caller holds the subscription delivery lock.  A delivery blocked on a
+	full channel is abandoned if the subscription is closed meanwhile.
+	Returns true if delivered.
+*/
+func (c *Connection) deliverSub(ps *subscription, md MessageData) bool {
+	select {
+	case ps.md <- md:
+		return true
+	default: // Channel is full
+	}
+	sh, d := c.slowConsumerHandler()
+	if sh != nil {
+		st := time.Now()
+		tm := time.NewTimer(d)
+		select {
+		case ps.md <- md:
+			tm.Stop()
+			return true
+		case _ = <-ps.qc:
+			tm.Stop()
+			c.subLog(ps, "RDR_CLSUB", ps.id, md.Message.Command, md.Message.Headers)
+			return false
+		case _ = <-tm.C:
+		}
+		c.subLog(ps, "RDR_SLOW_CONSUMER", ps.id, d)
+		ps.dlk.Unlock() // The callback may close the subscription
+		sh(ps.id, time.Since(st))
+		ps.dlk.Lock()
+		select {
+		case _ = <-ps.qc:
+			c.subLog(ps, "RDR_CLSUB", ps.id, md.Message.Command, md.Message.Headers)
+			return false
+		default:
+		}
+	}
+	select {
+	case ps.md <- md:
+		return true
+	case _ = <-ps.qc:
+		c.subLog(ps, "RDR_CLSUB", ps.id, md.Message.Command, md.Message.Headers)
+	}
+	return false
+}
+
+func (c *Connection) updateReads() {
+	atomic.StoreInt64(&c.lrt, c.monoNanos()) // Latest read activity
+	if c.hbd != nil {
+		c.updateHBReads()
+	}
+}
+
 func (c *Connection) updateHBReads() {
 	c.hbd.rdl.Lock()
-	c.hbd.lr = time.Now().UnixNano() // Latest good read
+	c.hbd.lr = c.monoNanos() // Latest good read
 	c.hbd.rdl.Unlock()
 }
 
 func (c *Connection) setReadDeadline() {
+	if c.dld.fia { // The frame idle timeout is used instead
+		return
+	}
 	if c.dld.rde && c.dld.rds {
 		_ = c.netconn.SetReadDeadline(time.Now().Add(c.dld.rdld))
 	}
@@ -256,3 +388,91 @@ func (c *Connection) checkReadError(e error) error {
 	}
 	return e
 }
+
+/*
+	Strip the EOL from a command or header line.  STOMP 1.2 allows an
+	optional CR before the LF.
+*/
+func (c *Connection) trimEOL(s string) string {
+	s = s[0 : len(s)-1]
+	if c.Protocol() == SPL_12 && strings.HasSuffix(s, "\r") {
+		s = s[0 : len(s)-1]
+	}
+	return s
+}
+
+/*
+	SetStrictHeaders sets how received frames that repeat a critical single
+	valued header, "message-id", "destination" or "content-length", are
+	handled.  In lenient mode (the default) the first occurrence wins, as
+	the specification requires, which can mask a broker bug or a forged
+	frame.  In strict mode such a frame is a read error, a
+	DuplicateHeaderError, and the connection is shut down as for other read
+	errors.  Other repeated headers are allowed in both modes.
+*/
+func (c *Connection) SetStrictHeaders(s bool) {
+	var v int32
+	if s {
+		v = 1
+	}
+	atomic.StoreInt32(&c.sthd, v)
+}
+
+/*
+	Check for repeated critical headers, if strict headers are set.
+*/
+func (c *Connection) checkDuplicateHeaders(f *Frame) error {
+	if atomic.LoadInt32(&c.sthd) == 0 {
+		return nil
+	}
+	for _, k := range criticalHeaders {
+		n := 0
+		for i := 0; i < len(f.Headers); i += 2 {
+			if f.Headers[i] == k {
+				n++
+			}
+		}
+		if n > 1 {
+			return DuplicateHeaderError{k, f.Command}
+		}
+	}
+	return nil
+}
+
+/*
+	SetMaxHeaderBytes limits the size of the header section of received
+	frames to n bytes, all header lines and EOLs included.  A frame with a
+	larger header section is a read error, a HeaderSizeError, and the
+	connection is shut down as for other read errors.  Header lines longer
+	than the read buffer are handled up to the limit.
+
+	A value of n <= 0 removes any limit, which is the default.
+
+	Example:
+		c.SetMaxHeaderBytes(64 * 1024)
+*/
+func (c *Connection) SetMaxHeaderBytes(n int) {
+	atomic.StoreInt64(&c.mhb, int64(n))
+}
+
+/*
+	Read one header line, of a header section that has used u bytes so far,
+	enforcing any header section limit.
+*/
+func (c *Connection) readHeaderLine(u int) (string, error) {
+	m := int(atomic.LoadInt64(&c.mhb))
+	if m <= 0 {
+		return c.rdr.ReadString('\n')
+	}
+	var b []byte
+	for {
+		l, e := c.rdr.ReadSlice('\n')
+		if u+len(b)+len(l) > m {
+			return "", HeaderSizeError{m}
+		}
+		b = append(b, l...)
+		if e != bufio.ErrBufferFull {
+			return string(b), e
+		}
+	}
+}
@@ -0,0 +1,368 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"time"
+)
+
+/*
+	Receipt correlation registry.
+
+	Callers that wait for a specific RECEIPT register the receipt id before
+	the frame is sent.  The reader delivers matching RECEIPT frames to the
+	registered waiter instead of the shared Connection.MessageData channel.
+	Unregistered RECEIPT frames are queued to Connection.MessageData as
+	always.  A registration is removed once its receipt has been waited for.
+
+	An ERROR frame with a receipt-id header matching a registered waiter is
+	delivered to that waiter instead of Connection.MessageData, and the
+	waiter returns a BrokerError.  Any OnError callback is still invoked.
+	An ERROR frame with no receipt-id header can not be correlated: it is
+	also delivered to every waiter registered by SendBytesAck.
+*/
+
+/*
+	Receipt registry entry.
+*/
+type receiptWaiter struct {
+	rc   chan MessageData // Receipt delivery, never blocks the reader
+	exp  int64            // Hold expiry, monotonic ns, 0 while waited for
+	aerr bool             // Also receives ERROR frames with no receipt-id
+	cf   func()           // Called by the reader for the RECEIPT, nil means none
+	drp  bool             // Removed on delivery, nobody waits
+}
+
+/*
+	SetReceiptHold sets how long a receipt requested by SendBytesR is held
+	for a later WaitReceipt.  The default is DefaultReceiptHold.  After the
+	hold time the registration is removed: a RECEIPT already received is
+	queued to Connection.MessageData, and a later RECEIPT is queued there as
+	for any unregistered receipt.
+*/
+func (c *Connection) SetReceiptHold(d time.Duration) {
+	c.rcptLock.Lock()
+	c.rchd = d
+	c.rcptLock.Unlock()
+}
+
+/*
+	SetMaxPendingReceipts limits the number of pending receipts, see
+	PendingReceipts.  Once the limit is reached, requesting another receipt,
+	e.g. with SendBytesR or SubscribeConfirmed, returns ERCPTMAX without
+	sending anything, until the broker confirms earlier ones.  This gives
+	producers back pressure tied to the broker confirmation rate.  The
+	DISCONNECT receipt is never limited.
+
+	A limit of zero or less, the default, means no limit.
+
+	Example:
+		c.SetMaxPendingReceipts(1000)
+		id, e := c.SendBytesR(h, b)
+		if e == stompngo.ERCPTMAX {
+			// Back off, and wait for outstanding receipts ...
+		}
+*/
+func (c *Connection) SetMaxPendingReceipts(n int) {
+	c.rcptLock.Lock()
+	c.rcmx = n
+	c.rcptLock.Unlock()
+}
+
+/*
+	PendingReceipts returns the number of pending receipts: those requested
+	and not yet waited for, whether or not the RECEIPT has arrived.
+*/
+func (c *Connection) PendingReceipts() int {
+	c.rcptLock.Lock()
+	defer c.rcptLock.Unlock()
+	return len(c.rcpts)
+}
+
+/*
+	Register a receipt waiter, subject to any pending receipt limit.  A held
+	registration expires if it is not waited for within the receipt hold
+	time.
+*/
+func (c *Connection) addReceipt(id string, hold bool) (chan MessageData, error) {
+	return c.registerReceipt(id, hold, true)
+}
+
+/*
+	Register a receipt waiter, optionally subject to the pending receipt
+	limit.
+*/
+func (c *Connection) registerReceipt(id string, hold, lim bool) (chan MessageData, error) {
+	rw := &receiptWaiter{rc: make(chan MessageData, 1)}
+	c.rcptLock.Lock()
+	defer c.rcptLock.Unlock()
+	if _, ok := c.rcpts[id]; ok {
+		return nil, ERCPTDUP
+	}
+	if lim && c.rcmx > 0 && len(c.rcpts) >= c.rcmx {
+		return nil, ERCPTMAX
+	}
+	if hold {
+		d := c.rchd
+		if d <= 0 {
+			d = DefaultReceiptHold
+		}
+		rw.exp = c.monoNanos() + int64(d)
+		if !c.rcpr {
+			c.rcpr = true
+			go c.receiptExpiry(d)
+		}
+	}
+	c.rcpts[id] = rw
+	return rw.rc, nil
+}
+
+/*
+	Unregister a receipt waiter.
+*/
+func (c *Connection) removeReceipt(id string) {
+	c.rcptLock.Lock()
+	delete(c.rcpts, id)
+	c.rcptLock.Unlock()
+}
+
+/*
+	Remove expired held registrations, and queue any RECEIPT they hold to
+	Connection.MessageData.  Runs while held registrations exist.
+*/
+func (c *Connection) receiptExpiry(d time.Duration) {
+	c.checkLoop(d, nil, func(now int64) bool {
+		var mds []MessageData
+		held := false
+		c.rcptLock.Lock()
+		for id, rw := range c.rcpts {
+			switch {
+			case rw.exp == 0:
+			case rw.exp > now:
+				held = true
+			default:
+				delete(c.rcpts, id)
+				select {
+				case md := <-rw.rc:
+					mds = append(mds, md)
+				default:
+				}
+			}
+		}
+		if !held {
+			c.rcpr = false
+		}
+		c.rcptLock.Unlock()
+		for _, md := range mds {
+			c.log("RECEIPT hold expired", md.Message.Headers)
+			select {
+			case c.defaultSink() <- md:
+			case _ = <-c.ssdc:
+				return true
+			case _ = <-c.wtrsdc:
+				return true
+			}
+		}
+		return !held
+	})
+}
+
+/*
+	Deliver a RECEIPT to a registered waiter.  Returns false if there is no
+	waiter for this receipt.
+*/
+func (c *Connection) deliverReceipt(md MessageData) bool {
+	id := c.decodedValue(md.Message.Headers.Value(HK_RECEIPT_ID))
+	c.rcptLock.Lock()
+	rw, ok := c.rcpts[id]
+	var cf func()
+	var drp bool
+	if ok {
+		cf, drp = rw.cf, rw.drp
+		if drp {
+			delete(c.rcpts, id)
+		}
+	}
+	if !ok && id == "" && md.Message.Command == ERROR {
+		for _, aw := range c.rcpts {
+			if aw.aerr {
+				select {
+				case aw.rc <- md:
+				default: // Receipt already delivered
+				}
+			}
+		}
+	}
+	c.rcptLock.Unlock()
+	if !ok {
+		return false
+	}
+	if drp && md.Message.Command != RECEIPT {
+		// Nobody waits, handled as any uncorrelated ERROR
+		return false
+	}
+	if !drp {
+		select {
+		case rw.rc <- md:
+		default: // Duplicate receipt id, first one wins
+		}
+	}
+	if cf != nil && md.Message.Command == RECEIPT {
+		cf()
+	}
+	return true
+}
+
+/*
+	Notify all receipt waiters of a read error.
+*/
+func (c *Connection) failReceipts(md MessageData) {
+	c.rcptLock.Lock()
+	for _, rw := range c.rcpts {
+		select {
+		case rw.rc <- md:
+		default: // Receipt already delivered
+		}
+	}
+	c.rcptLock.Unlock()
+}
+
+/*
+	Wait for a registered receipt.
+*/
+func (c *Connection) waitReceipt(id string, rc chan MessageData,
+	t time.Duration) (MessageData, error) {
+	tm := time.NewTimer(t)
+	defer tm.Stop()
+	select {
+	case md := <-rc:
+		c.removeReceipt(id)
+		if md.Error == nil && md.Message.Command == ERROR {
+			return md, BrokerError{md.Message}
+		}
+		return md, md.Error
+	case _ = <-tm.C:
+		c.removeReceipt(id)
+		return MessageData{}, ERCPTTMO
+	}
+}
+
+/*
+	WaitReceipt waits for the RECEIPT for a receipt id returned by SendBytesR.
+	The RECEIPT may already have arrived.  ERCPTTMO is returned if the
+	RECEIPT does not arrive within the duration t, and ERCPTUNK if the id is
+	not registered, e.g. it has already been waited for, or its hold time
+	(see SetReceiptHold) has passed.
+
+	Example:
+		id, e := c.SendBytesR(h, b)
+		if e != nil {
+			// Do something sane ...
+		}
+		// ... later
+		md, e := c.WaitReceipt(id, 10*time.Second)
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func (c *Connection) WaitReceipt(id string, t time.Duration) (MessageData, error) {
+	c.rcptLock.Lock()
+	rw, ok := c.rcpts[id]
+	if ok {
+		rw.exp = 0 // Now waited for, no expiry
+	}
+	c.rcptLock.Unlock()
+	if !ok {
+		return MessageData{}, ERCPTUNK
+	}
+	return c.waitReceipt(id, rw.rc, t)
+}
+
+/*
+	Common logic for frames that request a receipt and wait for it.  The
+	supplied function actually sends the frame.  Any client supplied receipt
+	id is used, otherwise a unique id is generated.  ERCPTDUP is returned if
+	the receipt id is already being waited for.
+*/
+func (c *Connection) transmitReceipt(h Headers, t time.Duration,
+	sf func(Headers) error) (MessageData, error) {
+	return c.transmitReceiptErr(h, t, sf, false)
+}
+
+/*
+	Common logic for frames that request a receipt and wait for it, aerr
+	true also ends the wait on any ERROR frame with no receipt-id.
+*/
+func (c *Connection) transmitReceiptErr(h Headers, t time.Duration,
+	sf func(Headers) error, aerr bool) (MessageData, error) {
+	if !c.Connected() {
+		return MessageData{}, ECONBAD
+	}
+	if e := h.Validate(); e != nil {
+		return MessageData{}, e
+	}
+	ch := h.Clone()
+	id, ok := ch.Contains(HK_RECEIPT)
+	if !ok {
+		id = c.newId(IdReceipt)
+		ch = ch.Add(HK_RECEIPT, id)
+	}
+	rc, e := c.addReceipt(id, false)
+	if e != nil {
+		return MessageData{}, e
+	}
+	if aerr {
+		c.rcptLock.Lock()
+		c.rcpts[id].aerr = true
+		c.rcptLock.Unlock()
+	}
+	if e := sf(ch); e != nil {
+		c.removeReceipt(id)
+		return MessageData{}, e
+	}
+	return c.waitReceipt(id, rc, t)
+}
+
+/*
+	AckReceipt acknowledges a STOMP MESSAGE exactly as Ack does, and waits
+	for the broker RECEIPT confirming the ACK was processed.
+
+	A receipt header is added to the ACK if the client did not supply one.
+	ERCPTTMO is returned if the RECEIPT does not arrive within the timeout.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_ID, md.Message.Headers.Value(stompngo.HK_ACK)}
+		r, e := c.AckReceipt(h, 5*time.Second)
+		if e != nil {
+			// Do something sane ...
+		}
+		fmt.Println(r.Message.Headers.Value(stompngo.HK_RECEIPT_ID))
+*/
+func (c *Connection) AckReceipt(h Headers, t time.Duration) (MessageData, error) {
+	return c.transmitReceipt(h, t, c.Ack)
+}
+
+/*
+	NackReceipt negatively acknowledges a STOMP MESSAGE exactly as Nack does,
+	and waits for the broker RECEIPT confirming the NACK was processed.
+
+	A receipt header is added to the NACK if the client did not supply one.
+	ERCPTTMO is returned if the RECEIPT does not arrive within the timeout.
+*/
+func (c *Connection) NackReceipt(h Headers, t time.Duration) (MessageData, error) {
+	return c.transmitReceipt(h, t, c.Nack)
+}
@@ -0,0 +1,330 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"testing"
+	"time"
+)
+
+/*
+	Receipts Test: ACK and NACK with receipt.
+*/
+func TestReceiptsAckNack(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestReceiptsAckNack Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	h := Headers{HK_ID, "ack-id-1"}
+	md, e := c.AckReceipt(h, 5*time.Second)
+	if e != nil {
+		t.Fatalf("TestReceiptsAckNack Expected nil, got <%v>\n", e)
+	}
+	f := fb.nextFrame(t)
+	if f.Command != ACK {
+		t.Fatalf("TestReceiptsAckNack Expected <%v>, got <%v>\n", ACK, f.Command)
+	}
+	if w := f.Headers.Value(HK_RECEIPT); w != md.Message.Headers.Value(HK_RECEIPT_ID) {
+		t.Fatalf("TestReceiptsAckNack Expected receipt-id <%v>, got <%v>\n",
+			w, md.Message.Headers.Value(HK_RECEIPT_ID))
+	}
+	//
+	md, e = c.NackReceipt(h.Add(HK_RECEIPT, rid), 5*time.Second)
+	if e != nil {
+		t.Fatalf("TestReceiptsAckNack Expected nil, got <%v>\n", e)
+	}
+	if v := md.Message.Headers.Value(HK_RECEIPT_ID); v != rid {
+		t.Fatalf("TestReceiptsAckNack Expected receipt-id <%v>, got <%v>\n", rid, v)
+	}
+	// Nothing should show up on the connection level channel
+	checkReceived(t, c)
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Receipts Test: receipt wait timeout.
+*/
+func TestReceiptsTimeout(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestReceiptsTimeout Expected nil, got <%v>\n", e)
+	}
+	fb.setAutoReceipt(false)
+	_, e = c.AckReceipt(Headers{HK_ID, "ack-id-1"}, 100*time.Millisecond)
+	if e != ERCPTTMO {
+		t.Fatalf("TestReceiptsTimeout Expected <%v>, got <%v>\n", ERCPTTMO, e)
+	}
+	// Validation errors are returned without waiting
+	_, e = c.AckReceipt(Headers{HK_MESSAGE_ID, "m1"}, time.Minute)
+	if e != EREQIDACK {
+		t.Fatalf("TestReceiptsTimeout Expected <%v>, got <%v>\n", EREQIDACK, e)
+	}
+	e = c.Disconnect(NoDiscReceipt)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Receipts Test: UNSUBSCRIBE with receipt, in flight messages delivered.
+*/
+func TestReceiptsUnsubscribe(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestReceiptsUnsubscribe Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	fb.setAutoReceipt(false)
+	sh := Headers{HK_DESTINATION, "/queue/unsub.receipt", HK_ID, "sub1"}
+	s, e := c.Subscribe(sh)
+	if e != nil {
+		t.Fatalf("TestReceiptsUnsubscribe Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // SUBSCRIBE
+	ue := make(chan error, 1)
+	go func() {
+		_, e := c.UnsubscribeReceipt(sh, 5*time.Second)
+		ue <- e
+	}()
+	f := fb.nextFrame(t)
+	if f.Command != UNSUBSCRIBE {
+		t.Fatalf("TestReceiptsUnsubscribe Expected <%v>, got <%v>\n", UNSUBSCRIBE, f.Command)
+	}
+	_ = fb.write("MESSAGE\nsubscription:sub1\nmessage-id:m1\ndestination:/queue/unsub.receipt\n\ninflight\x00")
+	_ = fb.write("RECEIPT\nreceipt-id:" + f.Headers.Value(HK_RECEIPT) + "\n\n\x00")
+	md := <-s
+	if md.Message.BodyString() != "inflight" {
+		t.Fatalf("TestReceiptsUnsubscribe Expected <%v>, got <%v>\n", "inflight",
+			md.Message.BodyString())
+	}
+	if e = <-ue; e != nil {
+		t.Fatalf("TestReceiptsUnsubscribe Expected nil, got <%v>\n", e)
+	}
+	if _, ok := <-s; ok {
+		t.Fatalf("TestReceiptsUnsubscribe Expected closed subscription channel\n")
+	}
+	e = c.Disconnect(NoDiscReceipt)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Receipts Test: SendBytesR with a later WaitReceipt.
+*/
+func TestReceiptsSendBytesR(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestReceiptsSendBytesR Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	sh := Headers{HK_DESTINATION, "/queue/sendbytesr"}
+	id1, e := c.SendBytesR(sh, []byte(tm))
+	if e != nil || id1 == "" {
+		t.Fatalf("TestReceiptsSendBytesR Expected an id, got <%v> <%v>\n", id1, e)
+	}
+	id2, e := c.SendBytesR(sh.Add(HK_RECEIPT, "my-receipt"), []byte(tm))
+	if e != nil || id2 != "my-receipt" {
+		t.Fatalf("TestReceiptsSendBytesR Expected <%v>, got <%v> <%v>\n",
+			"my-receipt", id2, e)
+	}
+	for _, id := range []string{id1, id2} {
+		if f := fb.nextFrame(t); f.Headers.Value(HK_RECEIPT) != id {
+			t.Fatalf("TestReceiptsSendBytesR Expected <%v>, got <%v>\n", id, f.Headers)
+		}
+	}
+	// Receipts have (very likely) arrived before the waits
+	time.Sleep(50 * time.Millisecond)
+	for _, id := range []string{id2, id1} {
+		md, e := c.WaitReceipt(id, 5*time.Second)
+		if e != nil || md.Message.Headers.Value(HK_RECEIPT_ID) != id {
+			t.Fatalf("TestReceiptsSendBytesR Expected <%v>, got <%v> <%v>\n", id, md, e)
+		}
+	}
+	if _, e = c.WaitReceipt(id1, time.Second); e != ERCPTUNK {
+		t.Fatalf("TestReceiptsSendBytesR Expected <%v>, got <%v>\n", ERCPTUNK, e)
+	}
+	e = c.Disconnect(NoDiscReceipt)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Receipts Test: duplicate receipt ids are rejected.
+*/
+func TestReceiptsDuplicateId(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestReceiptsDuplicateId Expected nil, got <%v>\n", e)
+	}
+	fb.setAutoReceipt(false)
+	sh := Headers{HK_DESTINATION, "/queue/sendbytesr", HK_RECEIPT, "dup-1"}
+	if _, e = c.SendBytesR(sh, []byte(tm)); e != nil {
+		t.Fatalf("TestReceiptsDuplicateId Expected nil, got <%v>\n", e)
+	}
+	if _, e = c.SendBytesR(sh, []byte(tm)); e != ERCPTDUP {
+		t.Fatalf("TestReceiptsDuplicateId Expected <%v>, got <%v>\n", ERCPTDUP, e)
+	}
+	if _, e = c.AckReceipt(Headers{HK_ID, "a1", HK_RECEIPT, "dup-1"},
+		time.Second); e != ERCPTDUP {
+		t.Fatalf("TestReceiptsDuplicateId Expected <%v>, got <%v>\n", ERCPTDUP, e)
+	}
+	e = c.Disconnect(NoDiscReceipt)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Receipts Test: an unwaited SendBytesR receipt expires to MessageData.
+*/
+func TestReceiptsHoldExpiry(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestReceiptsHoldExpiry Expected nil, got <%v>\n", e)
+	}
+	c.SetReceiptHold(50 * time.Millisecond)
+	id, e := c.SendBytesR(Headers{HK_DESTINATION, "/queue/sendbytesr"},
+		[]byte(tm))
+	if e != nil {
+		t.Fatalf("TestReceiptsHoldExpiry Expected nil, got <%v>\n", e)
+	}
+	select {
+	case md := <-c.MessageData:
+		if md.Message.Command != RECEIPT ||
+			md.Message.Headers.Value(HK_RECEIPT_ID) != id {
+			t.Fatalf("TestReceiptsHoldExpiry Expected <%v %v>, got <%v>\n",
+				RECEIPT, id, md)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestReceiptsHoldExpiry Expected RECEIPT on MessageData\n")
+	}
+	if _, e = c.WaitReceipt(id, time.Second); e != ERCPTUNK {
+		t.Fatalf("TestReceiptsHoldExpiry Expected <%v>, got <%v>\n", ERCPTUNK, e)
+	}
+	e = c.Disconnect(NoDiscReceipt)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Receipts Test: WaitDisconnectReceipt times out while the receipt is
+	outstanding, then returns the DISCONNECT receipt, not an earlier
+	unrelated one.
+*/
+func TestReceiptsDisconnectWait(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestReceiptsDisconnectWait Expected nil, got <%v>\n", e)
+	}
+	fb.setAutoReceipt(false)
+	_ = fb.nextFrame(t) // CONNECT
+	dc := make(chan error, 1)
+	go func() {
+		dc <- c.Disconnect(Headers{HK_RECEIPT, "disc-1"})
+	}()
+	f := fb.nextFrame(t)
+	if _, e = c.WaitDisconnectReceipt(20 * time.Millisecond); e != EDRCPTTMO {
+		t.Fatalf("TestReceiptsDisconnectWait Expected <%v>, got <%v>\n", EDRCPTTMO, e)
+	}
+	_ = fb.write(RECEIPT + "\n" + HK_RECEIPT_ID + ":other\n\n\x00")
+	_ = fb.write(RECEIPT + "\n" + HK_RECEIPT_ID + ":" + f.Headers.Value(HK_RECEIPT) + "\n\n\x00")
+	md, e := c.WaitDisconnectReceipt(5 * time.Second)
+	if e != nil {
+		t.Fatalf("TestReceiptsDisconnectWait Expected nil, got <%v>\n", e)
+	}
+	if id := md.Message.Headers.Value(HK_RECEIPT_ID); id != "disc-1" {
+		t.Fatalf("TestReceiptsDisconnectWait Expected <disc-1>, got <%s>\n", id)
+	}
+	if e = <-dc; e != nil {
+		t.Fatalf("TestReceiptsDisconnectWait Expected nil, got <%v>\n", e)
+	}
+	_ = nc.Close()
+	fb.close()
+	//
+	nc, fb = openFakeConn(t, fakeConnected12)
+	c, e = Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestReceiptsDisconnectWait Expected nil, got <%v>\n", e)
+	}
+	e = c.Disconnect(NoDiscReceipt)
+	checkDisconnectError(t, e)
+	if _, e = c.WaitDisconnectReceipt(time.Second); e != EDRCPTNO {
+		t.Fatalf("TestReceiptsDisconnectWait Expected <%v>, got <%v>\n", EDRCPTNO, e)
+	}
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Receipts Test: the pending receipt limit is enforced, and a waited for
+	receipt makes room.  The DISCONNECT receipt is not limited.
+*/
+func TestReceiptsMaxPending(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestReceiptsMaxPending Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	c.SetMaxPendingReceipts(rcptMaxPending)
+	sh := Headers{HK_DESTINATION, "/queue/maxpending"}
+	ids := []string{}
+	for i := 0; i < rcptMaxPending; i++ {
+		id, e := c.SendBytesR(sh, []byte(tm))
+		if e != nil {
+			t.Fatalf("TestReceiptsMaxPending Expected nil, got <%v>\n", e)
+		}
+		ids = append(ids, id)
+		_ = fb.nextFrame(t) // SEND
+	}
+	if n := c.PendingReceipts(); n != rcptMaxPending {
+		t.Fatalf("TestReceiptsMaxPending Expected <%d>, got <%d>\n", rcptMaxPending, n)
+	}
+	if _, e = c.SendBytesR(sh, []byte(tm)); e != ERCPTMAX {
+		t.Fatalf("TestReceiptsMaxPending Expected <%v>, got <%v>\n", ERCPTMAX, e)
+	}
+	if _, e = c.AckReceipt(Headers{HK_ID, "a1"}, time.Second); e != ERCPTMAX {
+		t.Fatalf("TestReceiptsMaxPending Expected <%v>, got <%v>\n", ERCPTMAX, e)
+	}
+	if _, e = c.WaitReceipt(ids[0], 5*time.Second); e != nil {
+		t.Fatalf("TestReceiptsMaxPending Expected nil, got <%v>\n", e)
+	}
+	if n := c.PendingReceipts(); n != rcptMaxPending-1 {
+		t.Fatalf("TestReceiptsMaxPending Expected <%d>, got <%d>\n", rcptMaxPending-1, n)
+	}
+	if _, e = c.SendBytesR(sh, []byte(tm)); e != nil {
+		t.Fatalf("TestReceiptsMaxPending Expected nil, got <%v>\n", e)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
@@ -0,0 +1,120 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"strconv"
+	"sync"
+)
+
+/*
+	Replay ring buffer, the last n MESSAGE frames delivered to a
+	subscription.
+*/
+type replayBuffer struct {
+	lk sync.Mutex
+	b  []MessageData // Ring storage
+	nx int           // Next slot to write
+	fl bool          // Ring is full
+}
+
+/*
+	New replay ring buffer, retaining n messages.
+*/
+func newReplayBuffer(n int) *replayBuffer {
+	return &replayBuffer{b: make([]MessageData, n)}
+}
+
+/*
+	Retain a message, discarding the oldest if the ring is full.
+*/
+func (r *replayBuffer) add(md MessageData) {
+	r.lk.Lock()
+	r.b[r.nx] = md
+	r.nx++
+	if r.nx == len(r.b) {
+		r.nx = 0
+		r.fl = true
+	}
+	r.lk.Unlock()
+}
+
+/*
+	Copy of the retained messages, oldest first.
+*/
+func (r *replayBuffer) messages() []MessageData {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	if !r.fl {
+		return append([]MessageData(nil), r.b[:r.nx]...)
+	}
+	mds := make([]MessageData, 0, len(r.b))
+	mds = append(mds, r.b[r.nx:]...)
+	return append(mds, r.b[:r.nx]...)
+}
+
+/*
+	SubscribeWithReplay subscribes as SubscribeHandle does, and retains the
+	last n MESSAGE frames delivered to the subscription, for later callers
+	of Replay.  This is a purely client side cache, intended for in process
+	observers that attach late: the broker is not asked to redeliver
+	anything.  The "sng_replay" header is set to n.
+
+	Retained messages are held in memory until displaced by newer messages,
+	or until the Subscription is no longer referenced, including after it
+	is closed.  Memory use is n times the typical message size, so a large
+	n with large bodies can be costly.  Message bodies are shared with the
+	MessageData channel consumer, not copied, and must not be modified.
+
+	EBADRPLN is returned if n is not positive.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/topic/prices"}
+		s, e := c.SubscribeWithReplay(h, 100)
+		if e != nil {
+			// Do something sane ...
+		}
+		// Later, for a new observer:
+		for _, md := range s.Replay() {
+			// Process md ...
+		}
+*/
+func (c *Connection) SubscribeWithReplay(h Headers, n int) (*Subscription, error) {
+	if h == nil {
+		return nil, EHDRNIL
+	}
+	if n <= 0 {
+		return nil, EBADRPLN
+	}
+	ch := h.Clone()
+	for ch.Index(StompPlusReplay) >= 0 {
+		ch = ch.Delete(StompPlusReplay)
+	}
+	return c.SubscribeHandle(ch.Add(StompPlusReplay, strconv.Itoa(n)))
+}
+
+/*
+	Replay returns a copy of the messages retained for the subscription,
+	oldest first.  It returns nil if the subscription was not created with
+	SubscribeWithReplay or a "sng_replay" header.
+*/
+func (s *Subscription) Replay() []MessageData {
+	if s.sd.rpl == nil {
+		return nil
+	}
+	return s.sd.rpl.messages()
+}
@@ -0,0 +1,113 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"testing"
+	"time"
+)
+
+/*
+	Test helper.  Next frame on a MessageData channel, with a timeout.
+*/
+func routedFrame(t *testing.T, ch <-chan MessageData) MessageData {
+	select {
+	case md := <-ch:
+		return md
+	case <-time.After(5 * time.Second):
+		t.Fatalf("routedFrame: nothing received\n")
+	}
+	return MessageData{}
+}
+
+/*
+	Routing Test: each received frame type reaches exactly one place.
+*/
+func TestRoutingFrameTypes(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestRoutingFrameTypes Expected nil, got <%v>\n", e)
+	}
+	sink := make(chan MessageData, 8)
+	c.SetDefaultMessageSink(sink)
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/route", HK_ID, "rt1"})
+	if e != nil {
+		t.Fatalf("TestRoutingFrameTypes Expected nil, got <%v>\n", e)
+	}
+	// A waited for RECEIPT goes to the waiter only
+	id, e := c.SendBytesR(Headers{HK_DESTINATION, "/queue/route"}, []byte("r"))
+	if e != nil {
+		t.Fatalf("TestRoutingFrameTypes Expected nil, got <%v>\n", e)
+	}
+	if _, e = c.WaitReceipt(id, 5*time.Second); e != nil {
+		t.Fatalf("TestRoutingFrameTypes Expected nil, got <%v>\n", e)
+	}
+	go func() { _ = fb.write(routingFrames) }()
+	if md := routedFrame(t, sc); md.Message.BodyString() != "sub" {
+		t.Fatalf("TestRoutingFrameTypes Expected <sub>, got <%v>\n", md)
+	}
+	for _, w := range routingSinkOrder {
+		md := routedFrame(t, sink)
+		if md.Message.Command != w[0] || !md.Message.Headers.ContainsKV(w[1], w[2]) {
+			t.Fatalf("TestRoutingFrameTypes Expected <%v>, got <%v>\n", w, md.Message)
+		}
+	}
+	select {
+	case md := <-sc:
+		t.Fatalf("TestRoutingFrameTypes Unexpected subscription frame <%v>\n", md)
+	case md := <-c.MessageData:
+		t.Fatalf("TestRoutingFrameTypes Unexpected MessageData frame <%v>\n", md)
+	case md := <-sink:
+		t.Fatalf("TestRoutingFrameTypes Unexpected sink frame <%v>\n", md)
+	default:
+	}
+	// An ERROR handled by OnError is not queued
+	ec := make(chan Message, 1)
+	c.OnError(func(m Message) { ec <- m })
+	go func() { _ = fb.write(routingErrorFrames) }()
+	if md := routedFrame(t, sink); md.Message.Command != RECEIPT {
+		t.Fatalf("TestRoutingFrameTypes Expected RECEIPT, got <%v>\n", md.Message)
+	}
+	if m := <-ec; m.Headers.Value(HK_MESSAGE) != "e2" {
+		t.Fatalf("TestRoutingFrameTypes Expected <e2>, got <%v>\n", m)
+	}
+	// No sink, MessageData again
+	c.SetDefaultMessageSink(nil)
+	go func() { _ = fb.write("RECEIPT\nreceipt-id:md1\n\n\x00") }()
+	if md := routedFrame(t, c.MessageData); md.Message.Headers.Value(HK_RECEIPT_ID) != "md1" {
+		t.Fatalf("TestRoutingFrameTypes Expected <md1>, got <%v>\n", md.Message)
+	}
+	// A read error goes to the sink and the subscription, the sink stays open
+	c.SetDefaultMessageSink(sink)
+	_ = nc.Close()
+	fb.close()
+	if md := routedFrame(t, sink); md.Error == nil {
+		t.Fatalf("TestRoutingFrameTypes Expected read error, got <%v>\n", md)
+	}
+	if md := routedFrame(t, sc); md.Error == nil {
+		t.Fatalf("TestRoutingFrameTypes Expected read error, got <%v>\n", md)
+	}
+	if _, ok := <-c.MessageData; ok {
+		t.Fatalf("TestRoutingFrameTypes Expected MessageData closed\n")
+	}
+	select {
+	case md, ok := <-sink:
+		t.Fatalf("TestRoutingFrameTypes Unexpected sink <%v %v>\n", md, ok)
+	default:
+	}
+}
@@ -0,0 +1,128 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"strings"
+	"time"
+)
+
+/*
+	SubscribeSelector subscribes as Subscribe does, with a message selector.
+	The "selector" header is set to selector, replacing any client supplied
+	value.
+
+	Selectors are broker specific.  ActiveMQ, Artemis and Apollo accept JMS
+	style SQL-92 expressions over message headers, e.g.
+	"priority > 4 AND region = 'eu'".  RabbitMQ does not support selectors,
+	and ignores the header.  A broker usually reports a bad selector with an
+	ERROR frame, which is easy to miss: use SubscribeSelectorConfirmed to
+	have it returned directly.
+
+	A light client side check is done first: the selector must not be
+	empty, and quotes and parentheses must balance.  ESELSYN is returned if
+	the check fails.  The check does not validate the expression itself.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/orders"}
+		s, e := c.SubscribeSelector(h, "region = 'eu'")
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func (c *Connection) SubscribeSelector(h Headers, selector string) (<-chan MessageData, error) {
+	ch, e := selectorHeaders(h, selector)
+	if e != nil {
+		return nil, e
+	}
+	return c.Subscribe(ch)
+}
+
+/*
+	SubscribeSelectorConfirmed subscribes as SubscribeSelector does, and
+	waits for the broker to confirm the subscription, as SubscribeConfirmed
+	does.  A broker ERROR for the selector is returned as a BrokerError.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/orders"}
+		s, e := c.SubscribeSelectorConfirmed(h, "region = 'eu'", 5*time.Second)
+		if be, ok := e.(stompngo.BrokerError); ok {
+			fmt.Println(be.Frame.Headers.Value(stompngo.HK_MESSAGE))
+		}
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func (c *Connection) SubscribeSelectorConfirmed(h Headers, selector string,
+	t time.Duration) (*Subscription, error) {
+	ch, e := selectorHeaders(h, selector)
+	if e != nil {
+		return nil, e
+	}
+	return c.SubscribeConfirmed(ch, t)
+}
+
+/*
+	Check a selector and set it in a copy of the SUBSCRIBE headers.
+*/
+func selectorHeaders(h Headers, selector string) (Headers, error) {
+	if h == nil {
+		return nil, EHDRNIL
+	}
+	if e := checkSelector(selector); e != nil {
+		return nil, e
+	}
+	ch := h.Clone()
+	for ch.Index(HK_SELECTOR) >= 0 {
+		ch = ch.Delete(HK_SELECTOR)
+	}
+	return ch.Add(HK_SELECTOR, selector), nil
+}
+
+/*
+	Client side selector sanity check: not empty, with balanced quotes and
+	parentheses.  A doubled quote inside a string literal is an escaped
+	quote, as in SQL.
+*/
+func checkSelector(s string) error {
+	if strings.TrimSpace(s) == "" {
+		return ESELSYN
+	}
+	var q rune // Open quote, 0 if none
+	p := 0     // Open parentheses
+	for _, r := range s {
+		switch {
+		case q != 0:
+			if r == q {
+				q = 0 // A doubled quote reopens at once
+			}
+		case r == '\'' || r == '"':
+			q = r
+		case r == '(':
+			p++
+		case r == ')':
+			p--
+			if p < 0 {
+				return ESELSYN
+			}
+		}
+	}
+	if q != 0 || p != 0 {
+		return ESELSYN
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"testing"
+)
+
+/*
+	Selector Test: the client side sanity check.
+*/
+func TestSelectorCheck(t *testing.T) {
+	for _, sv := range selectorList {
+		if e := checkSelector(sv.s); e != sv.e {
+			t.Fatalf("TestSelectorCheck <%s> Expected <%v>, got <%v>\n", sv.s, sv.e, e)
+		}
+	}
+}
+
+/*
+	Selector Test: the selector header is sent, and a broker ERROR for a bad
+	selector is returned by SubscribeSelectorConfirmed.
+*/
+func TestSelectorConfirmed(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSelectorConfirmed Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	h := Headers{HK_DESTINATION, "/queue/sel", HK_ID, "sel1", HK_SELECTOR, "old"}
+	if _, e = c.SubscribeSelector(h, "a = 'b"); e != ESELSYN {
+		t.Fatalf("TestSelectorConfirmed Expected <%v>, got <%v>\n", ESELSYN, e)
+	}
+	if _, e = c.SubscribeSelector(h, selectorGood); e != nil {
+		t.Fatalf("TestSelectorConfirmed Expected nil, got <%v>\n", e)
+	}
+	f := fb.nextFrame(t)
+	if f.Headers.Value(HK_SELECTOR) != selectorGood ||
+		f.Headers.Delete(HK_SELECTOR).Index(HK_SELECTOR) >= 0 {
+		t.Fatalf("TestSelectorConfirmed Expected one selector, got <%v>\n", f.Headers)
+	}
+	//
+	fb.setAutoReceipt(false)
+	go func() {
+		_ = fb.nextFrame(t) // SUBSCRIBE
+		_ = fb.write(fakeSelectorErrorFrame)
+	}()
+	bh := Headers{HK_DESTINATION, "/queue/sel", HK_ID, "sel2", HK_RECEIPT, "sel-r1"}
+	s, e := c.SubscribeSelectorConfirmed(bh, "a ==== 1", subConfTmo)
+	if s != nil {
+		t.Fatalf("TestSelectorConfirmed Expected nil, got <%v>\n", s)
+	}
+	if be, ok := e.(BrokerError); !ok || be.Frame.Headers.Value(HK_MESSAGE) != "bad selector" {
+		t.Fatalf("TestSelectorConfirmed Expected BrokerError, got <%v>\n", e)
+	}
+	e = c.Disconnect(NoDiscReceipt)
+	checkDisconnectError(t, e)
+	fb.close()
+}
@@ -34,21 +34,38 @@ package stompngo
 */
 func (c *Connection) Send(h Headers, b string) error {
 	c.log(SEND, "start", h)
-	if !c.connected {
+	defer c.orderSend()()
+	if e := c.contextErr(); e != nil {
+		return e
+	}
+	if !c.Connected() {
 		return ECONBAD
 	}
-	e := checkHeaders(h, c.Protocol())
+	e := c.validateHeaders(h)
 	if e != nil {
 		return e
 	}
 	if _, ok := h.Contains(HK_DESTINATION); !ok {
 		return EREQDSTSND
 	}
+	if e = c.checkDestination(h); e != nil {
+		return e
+	}
+	if e = c.txCheck(h); e != nil {
+		return e
+	}
+	if e = c.throttleSend(); e != nil {
+		return e
+	}
 	ch := h.Clone()
 	f := Frame{SEND, ch, []uint8(b)}
-	r := make(chan error)
-	c.output <- wiredata{f, r}
-	e = <-r
+	if e = c.encodeBody(&f); e != nil {
+		return e
+	}
+	e = c.wireSend(f, 0)
+	if e == nil {
+		c.txFrame(f)
+	}
 	c.log(SEND, "end", ch)
 	return e // nil or not
 }
@@ -17,7 +17,9 @@
 package stompngo
 
 import (
+	"sync"
 	"testing"
+	"time"
 )
 
 /*
@@ -83,3 +85,58 @@ func TestSendMultiple(t *testing.T) {
 		_ = closeConn(t, n)
 	}
 }
+
+/*
+	Test Send racing Disconnect, and a lost broker: every pending send
+	returns, nil or ECONBAD, rather than hanging.
+*/
+func TestSendDisconnectRace(t *testing.T) {
+	for _, lost := range []bool{false, true} {
+		nc, fb := openFakeConn(t, fakeConnected12)
+		sc := &slowConn{Conn: nc}
+		c, e := Connect(sc, fake12Headers, WithOutputCapacity(4))
+		if e != nil {
+			t.Fatalf("TestSendDisconnectRace Expected nil, got <%v>\n", e)
+		}
+		sc.setDelay(time.Millisecond) // Keep the output queue busy
+		var wg sync.WaitGroup
+		ec := make(chan error, sendRaceSenders)
+		for i := 0; i < sendRaceSenders; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					if e := c.Send(Headers{HK_DESTINATION, "/queue/race"}, tm); e != nil {
+						ec <- e
+						return
+					}
+				}
+			}()
+		}
+		time.Sleep(20 * time.Millisecond)
+		if lost {
+			fb.close()
+		} else {
+			_ = c.Disconnect(NoDiscReceipt)
+		}
+		dc := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(dc)
+		}()
+		select {
+		case <-dc:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestSendDisconnectRace lost:%v Expected all sends done\n", lost)
+		}
+		close(ec)
+		for e := range ec {
+			if !lost && e != ECONBAD { // A lost broker may also fail a write
+				t.Fatalf("TestSendDisconnectRace lost:%v Expected <%v>, got <%v>\n",
+					lost, ECONBAD, e)
+			}
+		}
+		_ = nc.Close()
+		fb.close()
+	}
+}
@@ -16,6 +16,10 @@
 
 package stompngo
 
+import (
+	"time"
+)
+
 /*
 	Send a STOMP MESSAGE.
 
@@ -33,22 +37,256 @@ package stompngo
 
 */
 func (c *Connection) SendBytes(h Headers, b []byte) error {
+	return c.sendBytes(h, b, 0)
+}
+
+/*
+	SendBytesDeadline sends as SendBytes does, using a one off write deadline
+	of duration d for this frame only.  The connection write deadline
+	settings are in effect again for subsequent frames.  The deadline d
+	applies even if write deadlines are not enabled for the connection.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/bigmessages"}
+		e := c.SendBytesDeadline(h, big, 2*time.Minute)
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func (c *Connection) SendBytesDeadline(h Headers, b []byte, d time.Duration) error {
+	return c.sendBytes(h, b, d)
+}
+
+/*
+	SendBytesTx sends as SendBytes does, within the transaction txId.  The
+	"transaction" header is set to txId, replacing any client supplied
+	value.  ETIDSNDEMT is returned if txId is empty.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/mymessages"}
+		e := c.SendBytesTx(h, []byte("My message"), "tx1")
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func (c *Connection) SendBytesTx(h Headers, b []byte, txId string) error {
+	if h == nil {
+		return EHDRNIL
+	}
+	if txId == "" {
+		return ETIDSNDEMT
+	}
+	ch := h.Clone()
+	for ch.Index(HK_TRANSACTION) >= 0 {
+		ch = ch.Delete(HK_TRANSACTION)
+	}
+	return c.SendBytes(ch.Add(HK_TRANSACTION, txId), b)
+}
+
+/*
+	SendBytesNoClone sends as SendBytes does, without first copying the
+	Headers.  SendBytes copies the Headers so a caller may change them as
+	soon as it returns, at the cost of an allocation for every SEND.
+
+	The caller MUST NOT modify h, or its backing array, after the call.  The
+	same unmodified h may be passed again, also from several goroutines at
+	once, e.g. a prebuilt header set used by a high rate producer.  If h
+	must change, build a new Headers value instead.
+
+	When a body codec is in use (see WithBodyCodec) the Headers are copied
+	anyway.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/ticks",
+			stompngo.HK_CONTENT_TYPE, "application/octet-stream"}
+		for _, b := range ticks {
+			if e := c.SendBytesNoClone(h, b); e != nil {
+				// Do something sane ...
+			}
+		}
+*/
+func (c *Connection) SendBytesNoClone(h Headers, b []byte) error {
 	c.log(SEND, "start", h)
-	if !c.connected {
-		return ECONBAD
+	defer c.orderSend()()
+	f, e := c.sendFrame(h, b, false)
+	if e != nil {
+		return e
 	}
-	e := checkHeaders(h, c.Protocol())
+	e = c.wireSend(f, 0)
+	if e == nil {
+		c.txFrame(f)
+	}
+	c.log(SEND, "end", f.Headers)
+	return e // nil or not
+}
+
+/*
+	Common SEND logic for []byte bodies, with an optional one off write
+	deadline.
+*/
+func (c *Connection) sendBytes(h Headers, b []byte, d time.Duration) error {
+	c.log(SEND, "start", h)
+	defer c.orderSend()()
+	f, e := c.sendFrame(h, b, true)
 	if e != nil {
 		return e
 	}
+	e = c.wireSend(f, d)
+	if e == nil {
+		c.txFrame(f)
+	}
+	c.log(SEND, "end", f.Headers)
+	return e // nil or not
+}
+
+/*
+	SendBytesFuture sends as SendBytes does, but does not wait for the frame
+	to be written.  The frame is queued for the writer, and a channel is
+	returned that receives exactly one value: the write result, nil or not.
+	This allows several sends to be in flight at once, with the results
+	collected later.
+
+	Errors found before the frame is queued are returned directly, with a
+	nil channel.  The channel is buffered, so a caller may abandon it
+	without leaking the writer or any other goroutine.  Ordered sends, see
+	WithOrderedSends, are ordered by the time the frame is queued.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/mymessages"}
+		r, e := c.SendBytesFuture(h, []byte("My message"))
+		if e != nil {
+			// Do something sane ...
+		}
+		// Do other work ...
+		if e = <-r; e != nil {
+			// Do something sane ...
+		}
+*/
+func (c *Connection) SendBytesFuture(h Headers, b []byte) (<-chan error, error) {
+	c.log(SEND, "start future", h)
+	defer c.orderSend()()
+	f, e := c.sendFrame(h, b, true)
+	if e != nil {
+		return nil, e
+	}
+	r, e := c.wireQueue(f, 0)
+	if e != nil {
+		return nil, e
+	}
+	c.txFrame(f) // Queued, the write result is the caller's
+	fr := make(chan error, 1)
+	go func() {
+		fr <- c.wireResult(r)
+	}()
+	c.log(SEND, "end future", f.Headers)
+	return fr, nil
+}
+
+/*
+	Validate a SEND request and build the frame.  With cl false the frame
+	shares the caller Headers, capped so that appends never write to the
+	caller backing array.
+*/
+func (c *Connection) sendFrame(h Headers, b []byte, cl bool) (Frame, error) {
+	if e := c.contextErr(); e != nil {
+		return Frame{}, e
+	}
+	if !c.Connected() {
+		return Frame{}, ECONBAD
+	}
+	e := c.validateHeaders(h)
+	if e != nil {
+		return Frame{}, e
+	}
 	if _, ok := h.Contains(HK_DESTINATION); !ok {
-		return EREQDSTSND
+		return Frame{}, EREQDSTSND
+	}
+	if e = c.checkDestination(h); e != nil {
+		return Frame{}, e
+	}
+	if e = c.txCheck(h); e != nil {
+		return Frame{}, e
+	}
+	if e = c.throttleSend(); e != nil {
+		return Frame{}, e
+	}
+	fh := h[:len(h):len(h)]
+	if cl || (c.copts != nil && c.copts.bcod != nil) {
+		fh = h.Clone()
+	}
+	f := Frame{SEND, fh, b}
+	if e = c.encodeBody(&f); e != nil {
+		return Frame{}, e
+	}
+	return f, nil
+}
+
+/*
+	SendBytesAck sends as SendBytes does, requests a RECEIPT, and waits for
+	the broker verdict on the frame.  It returns nil when the RECEIPT
+	arrives, a BrokerError holding the ERROR frame if the broker reports an
+	error first, or ERCPTTMO if neither arrives within timeout.
+
+	An ERROR frame ends the wait if its receipt-id matches the receipt, or
+	if it has no receipt-id at all, since such an ERROR can not be
+	correlated with a frame: it fails every SendBytesAck in progress.  Any
+	client supplied receipt header value is used, otherwise a unique id is
+	generated.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/orders"}
+		e := c.SendBytesAck(h, []byte("critical"), 5*time.Second)
+		if be, ok := e.(stompngo.BrokerError); ok {
+			// Rejected, see be.Frame ...
+		} else if e != nil {
+			// Do something sane ...
+		}
+*/
+func (c *Connection) SendBytesAck(h Headers, b []byte, timeout time.Duration) error {
+	if h == nil {
+		return EHDRNIL
+	}
+	_, e := c.transmitReceiptErr(h, timeout, func(ch Headers) error {
+		return c.SendBytes(ch, b)
+	}, true)
+	return e
+}
+
+/*
+	SendBytesR sends as SendBytes does, and also requests a RECEIPT.  The
+	receipt id used is returned: any client supplied "receipt" header value,
+	otherwise a generated unique id.
+
+	The RECEIPT is held for a later call to WaitReceipt, and is not queued to
+	the Connection.MessageData channel.  Every successful SendBytesR should
+	be followed by a WaitReceipt within the receipt hold time, see
+	SetReceiptHold.  ERCPTDUP is returned if a client supplied receipt id is
+	already registered.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/mymessages"}
+		id, e := c.SendBytesR(h, []byte("My Message"))
+		if e != nil {
+			// Do something sane ...
+		}
+		md, e := c.WaitReceipt(id, 10*time.Second)
+*/
+func (c *Connection) SendBytesR(h Headers, b []byte) (string, error) {
+	if h == nil {
+		return "", EHDRNIL
 	}
 	ch := h.Clone()
-	f := Frame{SEND, ch, b}
-	r := make(chan error)
-	c.output <- wiredata{f, r}
-	e = <-r
-	c.log(SEND, "end", ch)
-	return e // nil or not
+	id, ok := ch.Contains(HK_RECEIPT)
+	if !ok {
+		id = c.newId(IdReceipt)
+		ch = ch.Add(HK_RECEIPT, id)
+	}
+	if _, e := c.addReceipt(id, true); e != nil {
+		return "", e
+	}
+	if e := c.SendBytes(ch, b); e != nil {
+		c.removeReceipt(id)
+		return "", e
+	}
+	return id, nil
 }
@@ -17,7 +17,9 @@
 package stompngo
 
 import (
+	"strconv"
 	"testing"
+	"time"
 )
 
 /*
@@ -84,3 +86,233 @@ func TestSendBytesMultiple(t *testing.T) {
 		_ = closeConn(t, n)
 	}
 }
+
+/*
+	Test SendBytesTx validation, and the transaction header stamp.
+*/
+func TestSendBytesTx(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSendBytesTx Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	if e = c.SendBytesTx(nil, []byte(tm), "tx1"); e != EHDRNIL {
+		t.Fatalf("TestSendBytesTx Expected <%v>, got <%v>\n", EHDRNIL, e)
+	}
+	h := Headers{HK_DESTINATION, "/queue/sendtx"}
+	if e = c.SendBytesTx(h, []byte(tm), ""); e != ETIDSNDEMT {
+		t.Fatalf("TestSendBytesTx Expected <%v>, got <%v>\n", ETIDSNDEMT, e)
+	}
+	for _, sh := range []Headers{h, h.Add(HK_TRANSACTION, "old")} {
+		if e = c.SendBytesTx(sh, []byte(tm), "tx1"); e != nil {
+			t.Fatalf("TestSendBytesTx Expected nil, got <%v>\n", e)
+		}
+		f := fb.nextFrame(t)
+		if f.Command != SEND {
+			t.Fatalf("TestSendBytesTx Expected <%s>, got <%s>\n", SEND, f.Command)
+		}
+		if v := f.Headers.Value(HK_TRANSACTION); v != "tx1" {
+			t.Fatalf("TestSendBytesTx Expected <tx1>, got <%s>\n", v)
+		}
+		if i := f.Headers.Delete(HK_TRANSACTION).Index(HK_TRANSACTION); i >= 0 {
+			t.Fatalf("TestSendBytesTx Expected one transaction header, got <%v>\n", f.Headers)
+		}
+		if string(f.Body) != tm {
+			t.Fatalf("TestSendBytesTx Expected <%s>, got <%s>\n", tm, f.Body)
+		}
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Test SendBytesFuture: several sends are in flight at once, each result
+	channel receives one value, and validation errors are returned directly.
+*/
+func TestSendBytesFuture(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers, WithOrderedSends())
+	if e != nil {
+		t.Fatalf("TestSendBytesFuture Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	if r, e := c.SendBytesFuture(empty_headers, []byte(tm)); e != EREQDSTSND || r != nil {
+		t.Fatalf("TestSendBytesFuture Expected <%v>, got <%v>\n", EREQDSTSND, e)
+	}
+	h := Headers{HK_DESTINATION, "/queue/sendfuture"}
+	rs := make([]<-chan error, 0, sendFutureCount)
+	for i := 0; i < sendFutureCount; i++ {
+		r, e := c.SendBytesFuture(h, []byte(strconv.Itoa(i)))
+		if e != nil {
+			t.Fatalf("TestSendBytesFuture Expected nil, got <%v>\n", e)
+		}
+		rs = append(rs, r)
+	}
+	for i, r := range rs {
+		select {
+		case e = <-r:
+			if e != nil {
+				t.Fatalf("TestSendBytesFuture Expected nil, got <%v>\n", e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestSendBytesFuture send %d no result\n", i)
+		}
+		select {
+		case e = <-r:
+			t.Fatalf("TestSendBytesFuture send %d second result <%v>\n", i, e)
+		default:
+		}
+		f := fb.nextFrame(t)
+		if f.Command != SEND || string(f.Body) != strconv.Itoa(i) {
+			t.Fatalf("TestSendBytesFuture Expected send <%d>, got <%v>\n", i, f)
+		}
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	if _, e = c.SendBytesFuture(h, []byte(tm)); e != ECONBAD {
+		t.Fatalf("TestSendBytesFuture Expected <%v>, got <%v>\n", ECONBAD, e)
+	}
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Test SendBytesAck: a RECEIPT is success, an ERROR frame, correlated or
+	not, is a BrokerError, and no verdict is a timeout.
+*/
+func TestSendBytesAck(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSendBytesAck Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	h := Headers{HK_DESTINATION, "/queue/sendack"}
+	if e = c.SendBytesAck(h, []byte(tm), 5*time.Second); e != nil {
+		t.Fatalf("TestSendBytesAck Expected nil, got <%v>\n", e)
+	}
+	if f := fb.nextFrame(t); f.Command != SEND || f.Headers.Value(HK_RECEIPT) == "" {
+		t.Fatalf("TestSendBytesAck Expected SEND with receipt, got <%v>\n", f)
+	}
+	fb.setAutoReceipt(false)
+	for _, rid := range []bool{true, false} {
+		r := make(chan error, 1)
+		go func() {
+			r <- c.SendBytesAck(h, []byte(tm), 5*time.Second)
+		}()
+		f := fb.nextFrame(t)
+		ef := "ERROR\nmessage:rejected\n"
+		if rid {
+			ef += "receipt-id:" + f.Headers.Value(HK_RECEIPT) + "\n"
+		}
+		go func() {
+			_ = fb.write(ef + "\n\x00")
+		}()
+		if !rid { // Uncorrelated, also queued to MessageData
+			select {
+			case md := <-c.MessageData:
+				if md.Message.Command != ERROR {
+					t.Fatalf("TestSendBytesAck Expected <%v>, got <%v>\n", ERROR, md)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("TestSendBytesAck ERROR not queued\n")
+			}
+		}
+		select {
+		case e = <-r:
+			be, ok := e.(BrokerError)
+			if !ok || be.Frame.Headers.Value(HK_MESSAGE) != "rejected" {
+				t.Fatalf("TestSendBytesAck receipt-id:%v Expected BrokerError, got <%v>\n",
+					rid, e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestSendBytesAck receipt-id:%v no verdict\n", rid)
+		}
+	}
+	if e = c.SendBytesAck(h, []byte(tm), sendAckTimeout); e != ERCPTTMO {
+		t.Fatalf("TestSendBytesAck Expected <%v>, got <%v>\n", ERCPTTMO, e)
+	}
+	if n := c.PendingReceipts(); n != 0 {
+		t.Fatalf("TestSendBytesAck Expected 0 pending, got <%v>\n", n)
+	}
+	fb.setAutoReceipt(true)
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Test SendBytesNoClone: shared Headers, also from several goroutines, are
+	sent encoded exactly once and are never modified.
+*/
+func TestSendBytesNoClone(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSendBytesNoClone Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	h := noCloneHeaders.Clone()
+	hc := h.Clone()
+	for i := 0; i < noCloneSenders; i++ {
+		go func() {
+			for j := 0; j < noCloneSends; j++ {
+				if e := c.SendBytesNoClone(h, []byte(tm)); e != nil {
+					t.Errorf("TestSendBytesNoClone Expected nil, got <%v>\n", e)
+				}
+			}
+		}()
+	}
+	for i := 0; i < noCloneSenders*noCloneSends; i++ {
+		f := fb.nextFrame(t)
+		if v := f.Headers.Value(noCloneHeaders[2]); v != noCloneEncoded {
+			t.Fatalf("TestSendBytesNoClone Expected <%q>, got <%q>\n",
+				noCloneEncoded, v)
+		}
+	}
+	if !h.Compare(hc) || len(h) != len(noCloneHeaders) {
+		t.Fatalf("TestSendBytesNoClone Expected <%v>, got <%v>\n", hc, h)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Test helper.  Benchmark a send function against a discarding broker.
+*/
+func benchmarkSend(b *testing.B, sf func(c *Connection, h Headers, m []byte) error) {
+	c, e := Connect(openDiscardConn(fakeConnected12), fake12Headers)
+	if e != nil {
+		b.Fatalf("benchmarkSend Expected nil, got <%v>\n", e)
+	}
+	h := Headers{HK_DESTINATION, "/queue/bench", HK_CONTENT_TYPE, "text/plain",
+		"x-app", "bench"}
+	m := []byte(tm)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if e = sf(c, h, m); e != nil {
+			b.Fatalf("benchmarkSend Expected nil, got <%v>\n", e)
+		}
+	}
+	b.StopTimer()
+	_ = c.Disconnect(NoDiscReceipt)
+}
+
+func BenchmarkSendBytes(b *testing.B) {
+	benchmarkSend(b, func(c *Connection, h Headers, m []byte) error {
+		return c.SendBytes(h, m)
+	})
+}
+
+func BenchmarkSendBytesNoClone(b *testing.B) {
+	benchmarkSend(b, func(c *Connection, h Headers, m []byte) error {
+		return c.SendBytesNoClone(h, m)
+	})
+}
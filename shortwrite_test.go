@@ -0,0 +1,62 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"bytes"
+	"testing"
+)
+
+/*
+	ShortWrite Test: recovery from a throttled partial write.
+*/
+func TestShortWriteRecovery(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	sc := &shortConn{Conn: nc, chunk: 100}
+	c, e := Connect(sc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestShortWriteRecovery Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	c.ShortWriteRecovery(true)
+	var sw, st int
+	c.OnShortWrite(func(written, total int) {
+		sw, st = written, total
+	})
+	b := bytes.Repeat([]byte("0123456789"), 100)
+	sc.arm()
+	e = c.SendBytes(Headers{HK_DESTINATION, "/queue/short.write"}, b)
+	if e != nil {
+		t.Fatalf("TestShortWriteRecovery Expected nil, got <%v>\n", e)
+	}
+	f := fb.nextFrame(t)
+	if !bytes.Equal(f.Body, b) {
+		t.Fatalf("TestShortWriteRecovery Body mismatch, got length <%v>\n", len(f.Body))
+	}
+	if c.ShortWrites() != 1 {
+		t.Fatalf("TestShortWriteRecovery Expected 1 short write, got <%v>\n",
+			c.ShortWrites())
+	}
+	if sw != 100 || st != len(b) {
+		t.Fatalf("TestShortWriteRecovery Expected <100, %v>, got <%v, %v>\n",
+			len(b), sw, st)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
@@ -0,0 +1,108 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"context"
+	"time"
+)
+
+/*
+	StateChange is a callback function, provided by the client and called
+	when the connection state changes.  The connected parameter is the new
+	state.  The reason parameter is nil for a normal connect or DISCONNECT,
+	and otherwise describes why the connection was lost.
+*/
+type StateChange func(connected bool, reason error)
+
+/*
+	OnStateChange sets a callback function invoked when the connection
+	changes state.  A callback set after Connect returns will only see the
+	transition to disconnected.
+
+	Set to "nil" to disable.
+
+	Example:
+		c.OnStateChange(func(connected bool, reason error) {
+			log.Printf("connected:%v reason:%v\n", connected, reason)
+		})
+*/
+func (c *Connection) OnStateChange(f StateChange) {
+	c.stLock.Lock()
+	c.sch = f
+	c.stLock.Unlock()
+}
+
+/*
+	Record a connection state change, and notify the client once per actual
+	change of state.
+*/
+func (c *Connection) notifyState(connected bool, reason error) {
+	c.stLock.Lock()
+	if c.cst == connected {
+		c.stLock.Unlock()
+		return
+	}
+	c.cst = connected
+	if c.celg != nil {
+		c.celg.add(ConnEvent{time.Now(), connected, reason})
+	}
+	if c.stcc != nil {
+		close(c.stcc) // Wake all WaitConnected callers
+		c.stcc = nil
+	}
+	f := c.sch
+	c.stLock.Unlock()
+	c.log("STATE", connected, reason)
+	if f != nil {
+		f(connected, reason)
+	}
+}
+
+/*
+	WaitConnected blocks until the connection is connected, or the supplied
+	context is done.  It returns nil when connected, or ctx.Err().
+
+	A connection that has been shut down does not connect again, so a
+	WaitConnected call on such a connection returns only when ctx is done.
+
+	Example:
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if e := c.WaitConnected(ctx); e != nil {
+			// Not connected in time
+		}
+*/
+func (c *Connection) WaitConnected(ctx context.Context) error {
+	for {
+		c.stLock.Lock()
+		if c.cst {
+			c.stLock.Unlock()
+			return nil
+		}
+		if c.stcc == nil {
+			c.stcc = make(chan struct{})
+		}
+		w := c.stcc
+		c.stLock.Unlock()
+		select {
+		case <-w:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
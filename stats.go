@@ -0,0 +1,131 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"encoding/json"
+)
+
+/*
+	StatsSchema is the version of the Stats JSON schema.  It changes only if
+	a field is removed or its meaning changes.  New fields may be added
+	without a version change.
+*/
+const StatsSchema = 1
+
+/*
+	Stats is a point in time snapshot of connection metrics, see Stats and
+	MetricsJSON.  The JSON field names are part of the schema and are
+	stable:
+
+		schema              StatsSchema
+		session             Broker session id
+		protocol            Negotiated protocol level
+		connected           Connection status
+		uptime_ms           Time since connection start, ms
+		frames_read         Frames read, heart beats excluded
+		bytes_read          Bytes read
+		frames_written      Frames written, heart beats included
+		bytes_written       Bytes written
+		heartbeats          Heart beat data, see HeartBeatStats
+		subscription_count  Active subscriptions
+		subscriptions       Per subscription data, see SubscriptionInfo
+		read_sizes          Read frame size histogram, when enabled
+		write_sizes         Write frame size histogram, when enabled
+		labels              Connection labels, when set
+*/
+type Stats struct {
+	Schema            int                `json:"schema"`
+	Session           string             `json:"session"`
+	Protocol          string             `json:"protocol"`
+	Connected         bool               `json:"connected"`
+	UptimeMs          int64              `json:"uptime_ms"`
+	FramesRead        int64              `json:"frames_read"`
+	BytesRead         int64              `json:"bytes_read"`
+	FramesWritten     int64              `json:"frames_written"`
+	BytesWritten      int64              `json:"bytes_written"`
+	HeartBeats        HeartBeatStats     `json:"heartbeats"`
+	SubscriptionCount int                `json:"subscription_count"`
+	Subscriptions     []SubscriptionInfo `json:"subscriptions"`
+	ReadSizes         []Bucket           `json:"read_sizes,omitempty"`
+	WriteSizes        []Bucket           `json:"write_sizes,omitempty"`
+	Labels            map[string]string  `json:"labels,omitempty"`
+}
+
+/*
+	HeartBeatStats is the heart beat part of a Stats snapshot.  Intervals
+	are in ms, and zero means heart beats are not active in that direction.
+*/
+type HeartBeatStats struct {
+	SendInterval    int64 `json:"send_interval_ms"`
+	ReceiveInterval int64 `json:"receive_interval_ms"`
+	SendCount       int64 `json:"send_count"`
+	ReceiveCount    int64 `json:"receive_count"`
+}
+
+/*
+	Stats returns a snapshot of the connection metrics.  Each value is read
+	separately, so the snapshot is not atomic across values.
+
+	Example:
+		s := c.Stats()
+		log.Printf("read %d frames, %d bytes\n", s.FramesRead, s.BytesRead)
+*/
+func (c *Connection) Stats() Stats {
+	subs := c.Subscriptions()
+	return Stats{
+		Schema:        StatsSchema,
+		Session:       c.Session(),
+		Protocol:      c.Protocol(),
+		Connected:     c.Connected(),
+		UptimeMs:      int64(c.Running() / 1000000),
+		FramesRead:    c.FramesRead(),
+		BytesRead:     c.BytesRead(),
+		FramesWritten: c.FramesWritten(),
+		BytesWritten:  c.BytesWritten(),
+		HeartBeats: HeartBeatStats{
+			SendInterval:    c.SendTickerInterval(),
+			ReceiveInterval: c.ReceiveTickerInterval(),
+			SendCount:       c.SendTickerCount(),
+			ReceiveCount:    c.ReceiveTickerCount(),
+		},
+		SubscriptionCount: len(subs),
+		Subscriptions:     subs,
+		ReadSizes:         c.FrameSizeHistogram(DirectionRead),
+		WriteSizes:        c.FrameSizeHistogram(DirectionWrite),
+		Labels:            c.Labels(),
+	}
+}
+
+/*
+	MetricsJSON returns the Stats snapshot as JSON, e.g. for a debug HTTP
+	endpoint.  The result unmarshals back into a Stats value.
+
+	Example:
+		http.HandleFunc("/debug/stomp", func(w http.ResponseWriter, r *http.Request) {
+			b, e := c.MetricsJSON()
+			if e != nil {
+				http.Error(w, e.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(b)
+		})
+*/
+func (c *Connection) MetricsJSON() ([]byte, error) {
+	return json.Marshal(c.Stats())
+}
@@ -0,0 +1,149 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+/*
+	Stats Test: MetricsJSON round trips through Stats, with stable names.
+*/
+func TestStatsMetricsJSON(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers, WithLabels(statsLabels))
+	if e != nil {
+		t.Fatalf("TestStatsMetricsJSON Expected nil, got <%v>\n", e)
+	}
+	c.EnableFrameSizeHistogram(nil)
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/stats", HK_ID, "st1"})
+	if e != nil {
+		t.Fatalf("TestStatsMetricsJSON Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	_ = fb.nextFrame(t) // SUBSCRIBE
+	go func() {
+		_ = fb.write("MESSAGE\ndestination:/queue/stats\nsubscription:st1\n" +
+			"message-id:s1\n\nstats\x00")
+	}()
+	if md := <-sc; md.Error != nil {
+		t.Fatalf("TestStatsMetricsJSON Expected nil, got <%v>\n", md.Error)
+	}
+	b, e := c.MetricsJSON()
+	if e != nil {
+		t.Fatalf("TestStatsMetricsJSON Expected nil, got <%v>\n", e)
+	}
+	var s Stats
+	if e = json.Unmarshal(b, &s); e != nil {
+		t.Fatalf("TestStatsMetricsJSON Expected nil, got <%v>\n", e)
+	}
+	if b2, _ := json.Marshal(s); string(b2) != string(b) {
+		t.Fatalf("TestStatsMetricsJSON Expected <%s>, got <%s>\n", b, b2)
+	}
+	if s.Schema != StatsSchema || s.Protocol != SPL_12 || !s.Connected ||
+		s.SubscriptionCount != 1 || !reflect.DeepEqual(s.Labels, statsLabels) {
+		t.Fatalf("TestStatsMetricsJSON Unexpected <%+v>\n", s)
+	}
+	if s.FramesRead != c.FramesRead() || s.FramesWritten != c.FramesWritten() {
+		t.Fatalf("TestStatsMetricsJSON Expected frames <%d %d>, got <%d %d>\n",
+			c.FramesRead(), c.FramesWritten(), s.FramesRead, s.FramesWritten)
+	}
+	want := SubscriptionInfo{Id: "st1", Destination: "/queue/stats",
+		AckMode: AckModeAuto, Messages: 1}
+	if len(s.Subscriptions) != 1 || s.Subscriptions[0] != want {
+		t.Fatalf("TestStatsMetricsJSON Expected <%v>, got <%v>\n", want,
+			s.Subscriptions)
+	}
+	if len(s.ReadSizes) != len(DefaultFrameSizeBounds)+1 {
+		t.Fatalf("TestStatsMetricsJSON Expected <%d> buckets, got <%v>\n",
+			len(DefaultFrameSizeBounds)+1, s.ReadSizes)
+	}
+	// Field names are the schema
+	var m map[string]interface{}
+	if e = json.Unmarshal(b, &m); e != nil {
+		t.Fatalf("TestStatsMetricsJSON Expected nil, got <%v>\n", e)
+	}
+	for _, k := range statsKeys {
+		if _, ok := m[k]; !ok {
+			t.Fatalf("TestStatsMetricsJSON Expected key <%s>, got <%s>\n", k, b)
+		}
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Stats Test: MetricsJSON may be called while frames are sent and
+	received, e.g. from an HTTP debug handler.  Run with -race.
+*/
+func TestStatsConcurrent(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestStatsConcurrent Expected nil, got <%v>\n", e)
+	}
+	c.EnableFrameSizeHistogram(nil)
+	sc, e := c.Subscribe(Headers{HK_DESTINATION, "/queue/stats", HK_ID, "st2"})
+	if e != nil {
+		t.Fatalf("TestStatsConcurrent Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	_ = fb.nextFrame(t) // SUBSCRIBE
+	sd := make(chan struct{})
+	md := make(chan struct{})
+	go func() {
+		defer close(md)
+		for {
+			select {
+			case <-sd:
+				return
+			default:
+			}
+			if _, e := c.MetricsJSON(); e != nil {
+				t.Errorf("TestStatsConcurrent Expected nil, got <%v>\n", e)
+				return
+			}
+		}
+	}()
+	go func() {
+		for i := 0; i < statsSends; i++ {
+			_ = fb.write("MESSAGE\ndestination:/queue/stats\nsubscription:st2\n" +
+				"message-id:s" + strconv.Itoa(i) + "\n\nstats\x00")
+		}
+	}()
+	for i := 0; i < statsSends; i++ {
+		if e = c.Send(Headers{HK_DESTINATION, "/queue/stats"}, tm); e != nil {
+			t.Fatalf("TestStatsConcurrent Expected nil, got <%v>\n", e)
+		}
+		_ = fb.nextFrame(t) // SEND
+		_ = <-sc
+	}
+	close(sd)
+	<-md
+	if n := c.FramesWritten(); n < statsSends {
+		t.Fatalf("TestStatsConcurrent Expected at least <%d>, got <%d>\n",
+			statsSends, n)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
@@ -0,0 +1,160 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+/*
+	Helper package for stompngo users' tests.
+
+	ChaosConn wraps any net.Conn, and injects latency, random disconnects,
+	and fragmented writes.  Use it between a stompngo Connection and a real
+	or fake broker to exercise reconnect and timeout handling.  A fixed Seed
+	makes every run take the same decisions.
+
+	Example:
+		n, e := net.Dial("tcp", "localhost:61613")
+		if e != nil {
+			// Do something sane ...
+		}
+		cc := stompngotest.NewChaosConn(n, stompngotest.Config{Seed: 42,
+			DropProb: 0.001, MaxDelay: 20 * time.Millisecond, WriteChunk: 7})
+		c, e := stompngo.Connect(cc, h)
+
+*/
+package stompngotest
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+/*
+	ErrDropped is returned by a ChaosConn once it has injected a disconnect.
+*/
+var ErrDropped = errors.New("stompngotest: connection dropped")
+
+/*
+	Config controls the faults a ChaosConn injects.  The zero value injects
+	nothing.
+*/
+type Config struct {
+	Seed       int64                            // Random source seed
+	DropProb   float64                          // Disconnect probability per Read, Write, or write chunk
+	MinDelay   time.Duration                    // Minimum latency per Read or write chunk
+	MaxDelay   time.Duration                    // Maximum latency, uniform between MinDelay and MaxDelay
+	Delay      func(r *rand.Rand) time.Duration // Latency distribution, overrides MinDelay and MaxDelay
+	WriteChunk int                              // Maximum bytes per underlying Write, 0 means no limit
+}
+
+/*
+	ChaosConn is a net.Conn that injects faults per its Config.
+*/
+type ChaosConn struct {
+	net.Conn
+	cfg Config
+	lk  sync.Mutex // Random source and state lock
+	rnd *rand.Rand // Random source
+	drp bool       // Disconnect injected
+}
+
+/*
+	NewChaosConn wraps c.
+*/
+func NewChaosConn(c net.Conn, cfg Config) *ChaosConn {
+	return &ChaosConn{Conn: c, cfg: cfg, rnd: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+/*
+	Dropped reports whether a disconnect has been injected.
+*/
+func (cc *ChaosConn) Dropped() bool {
+	cc.lk.Lock()
+	defer cc.lk.Unlock()
+	return cc.drp
+}
+
+/*
+	Decide the fault for one operation: a latency, and whether to drop.
+*/
+func (cc *ChaosConn) fault() (time.Duration, bool) {
+	cc.lk.Lock()
+	defer cc.lk.Unlock()
+	if cc.drp {
+		return 0, true
+	}
+	var d time.Duration
+	switch {
+	case cc.cfg.Delay != nil:
+		d = cc.cfg.Delay(cc.rnd)
+	case cc.cfg.MaxDelay > cc.cfg.MinDelay:
+		d = cc.cfg.MinDelay +
+			time.Duration(cc.rnd.Int63n(int64(cc.cfg.MaxDelay-cc.cfg.MinDelay)))
+	default:
+		d = cc.cfg.MinDelay
+	}
+	if cc.cfg.DropProb > 0 && cc.rnd.Float64() < cc.cfg.DropProb {
+		cc.drp = true
+		return d, true
+	}
+	return d, false
+}
+
+/*
+	Inject a disconnect: the underlying connection is closed.
+*/
+func (cc *ChaosConn) drop() error {
+	_ = cc.Conn.Close()
+	return ErrDropped
+}
+
+/*
+	Read reads from the underlying connection, after any injected latency.
+*/
+func (cc *ChaosConn) Read(b []byte) (int, error) {
+	d, dr := cc.fault()
+	time.Sleep(d)
+	if dr {
+		return 0, cc.drop()
+	}
+	return cc.Conn.Read(b)
+}
+
+/*
+	Write writes to the underlying connection in chunks of at most
+	WriteChunk bytes, each after any injected latency.  A disconnect may be
+	injected between chunks, leaving a partial write on the wire.
+*/
+func (cc *ChaosConn) Write(b []byte) (int, error) {
+	n := 0
+	for n < len(b) || len(b) == 0 {
+		d, dr := cc.fault()
+		time.Sleep(d)
+		if dr {
+			return n, cc.drop()
+		}
+		e := len(b)
+		if cc.cfg.WriteChunk > 0 && e-n > cc.cfg.WriteChunk {
+			e = n + cc.cfg.WriteChunk
+		}
+		w, err := cc.Conn.Write(b[n:e])
+		n += w
+		if err != nil || len(b) == 0 {
+			return n, err
+		}
+	}
+	return n, nil
+}
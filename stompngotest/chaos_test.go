@@ -0,0 +1,112 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngotest
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+/*
+	Test fragmented writes arrive complete.
+*/
+func TestChaosWriteChunk(t *testing.T) {
+	cn, sn := net.Pipe()
+	cc := NewChaosConn(cn, Config{WriteChunk: 3})
+	wd := make(chan error, 1)
+	go func() {
+		_, e := cc.Write([]byte("SEND\n\nhello\x00"))
+		wd <- e
+	}()
+	var got []byte
+	b := make([]byte, 64)
+	for len(got) < 12 {
+		n, e := sn.Read(b)
+		if e != nil {
+			t.Fatalf("TestChaosWriteChunk read error <%v>\n", e)
+		}
+		if n > 3 {
+			t.Fatalf("TestChaosWriteChunk expected chunks <= 3, got [%d]\n", n)
+		}
+		got = append(got, b[:n]...)
+	}
+	if string(got) != "SEND\n\nhello\x00" {
+		t.Fatalf("TestChaosWriteChunk expected frame, got [%q]\n", got)
+	}
+	if e := <-wd; e != nil {
+		t.Fatalf("TestChaosWriteChunk expected nil, got [%v]\n", e)
+	}
+	_ = cc.Close()
+}
+
+/*
+	Test injected disconnects.
+*/
+func TestChaosDrop(t *testing.T) {
+	cn, sn := net.Pipe()
+	cc := NewChaosConn(cn, Config{DropProb: 1})
+	if _, e := cc.Write([]byte("x")); e != ErrDropped {
+		t.Fatalf("TestChaosDrop expected [%v], got [%v]\n", ErrDropped, e)
+	}
+	if !cc.Dropped() {
+		t.Fatalf("TestChaosDrop expected dropped\n")
+	}
+	if _, e := cc.Read(make([]byte, 1)); e != ErrDropped {
+		t.Fatalf("TestChaosDrop expected [%v], got [%v]\n", ErrDropped, e)
+	}
+	if _, e := sn.Read(make([]byte, 1)); e != io.EOF {
+		t.Fatalf("TestChaosDrop expected peer EOF, got [%v]\n", e)
+	}
+}
+
+/*
+	Test seeded runs repeat, and latency is injected.
+*/
+func TestChaosSeeded(t *testing.T) {
+	cfg := Config{Seed: 7, DropProb: 0.5, MinDelay: time.Millisecond,
+		MaxDelay: 3 * time.Millisecond}
+	run := func() []bool {
+		cc := NewChaosConn(nil, cfg)
+		var r []bool
+		for i := 0; i < 8; i++ {
+			cc.drp = false
+			_, dr := cc.fault()
+			r = append(r, dr)
+		}
+		return r
+	}
+	a, b := run(), run()
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("TestChaosSeeded expected repeatable decisions, got [%v] [%v]\n", a, b)
+		}
+	}
+	cn, sn := net.Pipe()
+	cc := NewChaosConn(cn, Config{MinDelay: 20 * time.Millisecond})
+	go func() { _, _ = sn.Write([]byte("x")) }()
+	st := time.Now()
+	if _, e := cc.Read(make([]byte, 1)); e != nil {
+		t.Fatalf("TestChaosSeeded expected nil, got [%v]\n", e)
+	}
+	if d := time.Since(st); d < 20*time.Millisecond {
+		t.Fatalf("TestChaosSeeded expected >= 20ms, got [%v]\n", d)
+	}
+	_ = cc.Close()
+	_ = sn.Close()
+}
@@ -0,0 +1,110 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"strconv"
+	"time"
+)
+
+/*
+	StreamPosition is a starting position for SubscribeFrom.  Use
+	StreamFirst, StreamLast, StreamOffset, or StreamTimestamp.
+*/
+type StreamPosition struct {
+	k string    // Position kind
+	n int64     // Offset
+	t time.Time // Timestamp
+}
+
+var (
+	StreamFirst = StreamPosition{k: "first"} // The first message in the stream
+	StreamLast  = StreamPosition{k: "last"}  // The last chunk of the stream
+)
+
+/*
+	StreamOffset is the stream position at offset n, n >= 0.
+*/
+func StreamOffset(n int64) StreamPosition {
+	return StreamPosition{k: "offset", n: n}
+}
+
+/*
+	StreamTimestamp is the stream position of the first message stored at
+	or after t.  Broker timestamps have one second resolution.
+*/
+func StreamTimestamp(t time.Time) StreamPosition {
+	return StreamPosition{k: "timestamp", t: t}
+}
+
+/*
+	Header value for a stream position.
+*/
+func (p StreamPosition) value() (string, error) {
+	switch p.k {
+	case "first", "last":
+		return p.k, nil
+	case "offset":
+		if p.n < 0 {
+			return "", ESTRMPOS
+		}
+		return "offset=" + strconv.FormatInt(p.n, 10), nil
+	case "timestamp":
+		if p.t.IsZero() {
+			return "", ESTRMPOS
+		}
+		return "timestamp=" + strconv.FormatInt(p.t.Unix(), 10), nil
+	}
+	return "", ESTRMPOS
+}
+
+/*
+	SubscribeFrom subscribes as Subscribe does, starting from stream position
+	pos.  The position is sent in the stream position header of the broker,
+	e.g. "x-stream-offset" for RabbitMQ streams.  Any client supplied value
+	for that header is replaced.
+
+	ESTRMBRK is returned if the broker type does not support stream
+	positions, see Capabilities.  ESTRMPOS is returned for an invalid
+	position.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/amq/queue/events",
+			stompngo.HK_ACK, stompngo.AckModeClient, "prefetch-count", "100"}
+		s, e := c.SubscribeFrom(h, stompngo.StreamOffset(5000))
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func (c *Connection) SubscribeFrom(h Headers, pos StreamPosition) (<-chan MessageData, error) {
+	if h == nil {
+		return nil, EHDRNIL
+	}
+	k := c.BrokerType().quirks().sph
+	if k == "" {
+		return nil, ESTRMBRK
+	}
+	v, e := pos.value()
+	if e != nil {
+		return nil, e
+	}
+	ch := h.Clone()
+	for ch.Index(k) >= 0 {
+		ch = ch.Delete(k)
+	}
+	return subChan(c.subscribe(ch.Add(k, v), 0))
+}
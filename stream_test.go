@@ -0,0 +1,73 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"testing"
+	"time"
+)
+
+/*
+	Stream Test: SubscribeFrom validation, and the stream position header.
+*/
+func TestStreamSubscribeFrom(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestStreamSubscribeFrom Expected nil, got <%v>\n", e)
+	}
+	sh := Headers{HK_DESTINATION, "/amq/queue/stream", HK_ACK, AckModeClient}
+	if _, e = c.SubscribeFrom(sh, StreamFirst); e != ESTRMBRK {
+		t.Fatalf("TestStreamSubscribeFrom Expected <%v>, got <%v>\n", ESTRMBRK, e)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+	//
+	nc, fb = openFakeConn(t, fakeConnectedRabbit)
+	c, e = Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestStreamSubscribeFrom Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	for _, bp := range []StreamPosition{StreamOffset(-1), StreamTimestamp(time.Time{}), {}} {
+		if _, e = c.SubscribeFrom(sh, bp); e != ESTRMPOS {
+			t.Fatalf("TestStreamSubscribeFrom Expected <%v>, got <%v>\n", ESTRMPOS, e)
+		}
+	}
+	if _, e = c.SubscribeFrom(nil, StreamFirst); e != EHDRNIL {
+		t.Fatalf("TestStreamSubscribeFrom Expected <%v>, got <%v>\n", EHDRNIL, e)
+	}
+	for i, sp := range streamList {
+		h := sh.Add(HK_ID, "stream"+string('a'+rune(i))).Add(streamHeader, "stale")
+		if _, e = c.SubscribeFrom(h, sp.pos); e != nil {
+			t.Fatalf("TestStreamSubscribeFrom Expected nil, got <%v>\n", e)
+		}
+		f := fb.nextFrame(t)
+		if v := f.Headers.Value(streamHeader); v != sp.v {
+			t.Fatalf("TestStreamSubscribeFrom Expected <%s>, got <%s>\n", sp.v, v)
+		}
+		if i := f.Headers.Delete(streamHeader).Index(streamHeader); i >= 0 {
+			t.Fatalf("TestStreamSubscribeFrom Expected one <%s>, got <%v>\n", streamHeader, f.Headers)
+		}
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
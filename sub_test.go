@@ -17,11 +17,14 @@
 package stompngo
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	//"os"
+	"strings"
+	"sync"
 	"testing"
-	//"time"
+	"time"
 )
 
 func TestSubNoHeader(t *testing.T) {
@@ -231,7 +234,7 @@ func TestSubAckModes(t *testing.T) {
 					ti, tv.proto)
 			}
 		}
-		if e != tv.exe {
+		if !errors.Is(e, tv.exe) {
 			t.Fatalf("TestSubAckModes[%d] SUBSCRIBE, proto:%s expected:%v got:%v\n",
 				ti, tv.proto, tv.exe, e)
 		}
@@ -242,3 +245,239 @@ func TestSubAckModes(t *testing.T) {
 	}
 	log.Printf("TestSubAckModes %d tests complete.\n", len(subAckDataList))
 }
+
+/*
+	Test ack mode validity by protocol level.
+*/
+func TestSubValidAckMode(t *testing.T) {
+	for _, tv := range validAckModeList {
+		if r := ValidAckMode(tv.mode, tv.proto); r != tv.want {
+			t.Fatalf("TestSubValidAckMode mode:%s proto:%s expected:%v got:%v\n",
+				tv.mode, tv.proto, tv.want, r)
+		}
+	}
+	// The SUBSCRIBE error names the mode and protocol
+	nc, fb := openFakeConn(t, fakeConnected10)
+	c, e := Connect(nc, Headers{HK_HOST, "localhost"})
+	if e != nil {
+		t.Fatalf("TestSubValidAckMode CONNECT expected nil, got %v\n", e)
+	}
+	_, e = c.Subscribe(Headers{HK_DESTINATION, "/queue/subAckTest.10",
+		HK_ACK, AckModeClientIndividual})
+	if !errors.Is(e, ESBADAM) ||
+		!strings.Contains(e.Error(), "mode:"+AckModeClientIndividual+" protocol:"+SPL_10) {
+		t.Fatalf("TestSubValidAckMode expected:%v got:%v\n", ESBADAM, e)
+	}
+	if ae, ok := e.(AckModeError); !ok || ae.Mode != AckModeClientIndividual ||
+		ae.Protocol != SPL_10 {
+		t.Fatalf("TestSubValidAckMode expected AckModeError, got:%#v\n", e)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
+
+/*
+	Test Subscribe: reusing a live subscription id with a different ack mode
+	returns an AckModeChangeError, the same ack mode returns EDUPSID.
+*/
+func TestSubAckModeChange(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSubAckModeChange Expected nil, got <%v>\n", e)
+	}
+	h := Headers{HK_DESTINATION, "/queue/amchange", HK_ID, "amc1"}
+	if _, e = c.Subscribe(h.Add(HK_ACK, AckModeClient)); e != nil {
+		t.Fatalf("TestSubAckModeChange Expected nil, got <%v>\n", e)
+	}
+	_, e = c.Subscribe(h)
+	ae, ok := e.(AckModeChangeError)
+	if !ok || !errors.Is(e, EDUPSID) {
+		t.Fatalf("TestSubAckModeChange Expected AckModeChangeError, got <%v>\n", e)
+	}
+	if ae.Id != "amc1" || ae.Mode != AckModeClient || ae.NewMode != AckModeAuto {
+		t.Fatalf("TestSubAckModeChange Expected modes, got <%+v>\n", ae)
+	}
+	if _, e = c.Subscribe(h.Add(HK_ACK, AckModeClient)); e != EDUPSID {
+		t.Fatalf("TestSubAckModeChange Expected <%v>, got <%v>\n", EDUPSID, e)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Test Subscribe: concurrent subscribe and unsubscribe churn, on shared
+	ids, with MESSAGE frames arriving for them.  Each subscription ends in
+	one of the three ways: Unsubscribe, UnsubscribeReceipt, or
+	Subscription.Close, and its consumer then stops reading.  Run with
+	-race.
+*/
+func TestSubChurn(t *testing.T) {
+	l, fbc := listenFakeBroker(t, NetProtoTCP4, "127.0.0.1:0")
+	defer l.Close()
+	c, e := Dial(l.Addr().String(), fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSubChurn Expected nil, got <%v>\n", e)
+	}
+	fb := <-fbc
+	stop := make(chan struct{})
+	var bg sync.WaitGroup
+	bg.Add(3)
+	go func() { // Client frames, not checked
+		defer bg.Done()
+		for {
+			select {
+			case <-fb.frames:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	go func() { // Deliveries to the shared ids
+		defer bg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			case <-time.After(subChurnGap):
+			}
+			_ = fb.write(fmt.Sprintf("MESSAGE\ndestination:/queue/churn\n"+
+				"subscription:churn%d\nmessage-id:m%d\n\nchurn\x00", i%subChurnIds, i))
+		}
+	}()
+	ie := make(chan error, 1)
+	go func() { // Invariants hold throughout
+		defer bg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+			}
+			if e := c.subsInvariant(); e != nil {
+				ie <- e
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	we := make(chan error, subChurnWorkers)
+	for w := 0; w < subChurnWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < subChurnIters; i++ {
+				id := fmt.Sprintf("churn%d", (w+i)%subChurnIds)
+				h := Headers{HK_DESTINATION, "/queue/churn", HK_ID, id}
+				s, e := c.SubscribeHandle(h)
+				if e == EDUPSID {
+					continue // Another worker holds the id
+				}
+				if e != nil {
+					we <- fmt.Errorf("worker %d subscribe: %v", w, e)
+					return
+				}
+				done := make(chan struct{})
+				go func() { // Consumer
+					for {
+						select {
+						case _, ok := <-s.MessageData:
+							if !ok {
+								return
+							}
+						case <-done:
+							return
+						}
+					}
+				}()
+				switch i % 3 {
+				case 0:
+					e = c.Unsubscribe(h)
+				case 1:
+					_, e = c.UnsubscribeReceipt(h, 5*time.Second)
+				default:
+					e = s.Close()
+				}
+				close(done)
+				if e != nil {
+					we <- fmt.Errorf("worker %d end %d: %v", w, i%3, e)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(stop)
+	bg.Wait()
+	select {
+	case e = <-we:
+		t.Fatalf("TestSubChurn Expected nil, got <%v>\n", e)
+	case e = <-ie:
+		t.Fatalf("TestSubChurn invariant <%v>\n", e)
+	default:
+	}
+	if e = c.subsInvariant(); e != nil {
+		t.Fatalf("TestSubChurn invariant <%v>\n", e)
+	}
+	c.subsLock.RLock()
+	n := len(c.subs)
+	c.subsLock.RUnlock()
+	if n != 0 {
+		t.Fatalf("TestSubChurn Expected no subscriptions, got <%d>\n", n)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
+
+/*
+	Test Subscribe: Unsubscribe abandons a delivery blocked on a full
+	subscription channel, so the reader carries on.
+*/
+func TestSubChurnBlockedDelivery(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSubChurnBlockedDelivery Expected nil, got <%v>\n", e)
+	}
+	h := Headers{HK_DESTINATION, "/queue/blocked", HK_ID, "blk1"}
+	sc, e := c.Subscribe(h)
+	if e != nil {
+		t.Fatalf("TestSubChurnBlockedDelivery Expected nil, got <%v>\n", e)
+	}
+	for i := 0; i < 2; i++ { // The second blocks, the channel holds one
+		_ = fb.write(fmt.Sprintf("MESSAGE\ndestination:/queue/blocked\n"+
+			"subscription:blk1\nmessage-id:b%d\n\nblocked\x00", i))
+	}
+	time.Sleep(20 * time.Millisecond)
+	if e = c.Unsubscribe(h); e != nil {
+		t.Fatalf("TestSubChurnBlockedDelivery Expected nil, got <%v>\n", e)
+	}
+	h2 := Headers{HK_DESTINATION, "/queue/blocked", HK_ID, "blk2"}
+	sc2, e := c.Subscribe(h2)
+	if e != nil {
+		t.Fatalf("TestSubChurnBlockedDelivery Expected nil, got <%v>\n", e)
+	}
+	go func() {
+		_ = fb.write("MESSAGE\ndestination:/queue/blocked\n" +
+			"subscription:blk2\nmessage-id:b2\n\nnext\x00")
+	}()
+	select {
+	case md := <-sc2:
+		if md.Message.BodyString() != "next" {
+			t.Fatalf("TestSubChurnBlockedDelivery Expected <next>, got <%v>\n", md)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestSubChurnBlockedDelivery reader still blocked\n")
+	}
+	if len(sc) != 1 {
+		t.Fatalf("TestSubChurnBlockedDelivery Expected 1 buffered, got <%d>\n", len(sc))
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
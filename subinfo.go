@@ -0,0 +1,81 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+/*
+	SubscriptionInfo is a point in time description of an active
+	subscription.
+*/
+type SubscriptionInfo struct {
+	Id          string `json:"id"`          // Subscription id
+	Destination string `json:"destination"` // Subscribed destination
+	AckMode     string `json:"ack_mode"`    // Ack mode
+	Messages    int64  `json:"messages"`    // MESSAGE frames delivered to the subscription channel
+}
+
+/*
+	Subscriptions returns information about the currently active
+	subscriptions, ordered by subscription id.
+
+	Example:
+		for _, si := range c.Subscriptions() {
+			log.Printf("%s %s %d\n", si.Id, si.Destination, si.Messages)
+		}
+*/
+func (c *Connection) Subscriptions() []SubscriptionInfo {
+	c.subsLock.RLock()
+	r := make([]SubscriptionInfo, 0, len(c.subs))
+	for _, ps := range c.subs {
+		if ps.cs {
+			continue
+		}
+		r = append(r, SubscriptionInfo{Id: ps.id, Destination: ps.dest,
+			AckMode: ps.am, Messages: atomic.LoadInt64(&ps.mc)})
+	}
+	c.subsLock.RUnlock()
+	sort.Sort(subscriptionInfos(r))
+	return r
+}
+
+/*
+	SubscriptionMessageCount returns the number of MESSAGE frames delivered
+	to the subscription with the given id.  Zero is returned for an unknown
+	subscription id.
+*/
+func (c *Connection) SubscriptionMessageCount(id string) int64 {
+	c.subsLock.RLock()
+	defer c.subsLock.RUnlock()
+	ps, ok := c.subs[id]
+	if !ok {
+		return 0
+	}
+	return atomic.LoadInt64(&ps.mc)
+}
+
+/*
+	Sort support, by subscription id.
+*/
+type subscriptionInfos []SubscriptionInfo
+
+func (s subscriptionInfos) Len() int           { return len(s) }
+func (s subscriptionInfos) Less(i, j int) bool { return s[i].Id < s[j].Id }
+func (s subscriptionInfos) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,66 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"testing"
+)
+
+/*
+	Subscription Info Test: per subscription message counts.
+*/
+func TestSubInfoCounts(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSubInfoCounts Expected nil, got <%v>\n", e)
+	}
+	c.SetSubChanCap(4)
+	sh := Headers{HK_DESTINATION, "/queue/drain", HK_ID, "drain1"}
+	sc, e := c.Subscribe(sh)
+	if e != nil {
+		t.Fatalf("TestSubInfoCounts Expected nil, got <%v>\n", e)
+	}
+	_, e = c.Subscribe(Headers{HK_DESTINATION, "/queue/other", HK_ID, "another"})
+	if e != nil {
+		t.Fatalf("TestSubInfoCounts Expected nil, got <%v>\n", e)
+	}
+	for i := 0; i < 3; i++ {
+		_ = fb.write(fakeDrainMessage)
+		_ = <-sc
+	}
+	if n := c.SubscriptionMessageCount("drain1"); n != 3 {
+		t.Fatalf("TestSubInfoCounts Expected 3, got <%v>\n", n)
+	}
+	if n := c.SubscriptionMessageCount("nosuchsub"); n != 0 {
+		t.Fatalf("TestSubInfoCounts Expected 0, got <%v>\n", n)
+	}
+	si := c.Subscriptions()
+	if len(si) != 2 {
+		t.Fatalf("TestSubInfoCounts Expected 2, got <%v>\n", len(si))
+	}
+	if si[0].Id != "another" || si[0].Messages != 0 {
+		t.Fatalf("TestSubInfoCounts Expected <another 0>, got <%v>\n", si[0])
+	}
+	if si[1].Id != "drain1" || si[1].Destination != "/queue/drain" ||
+		si[1].AckMode != AckModeAuto || si[1].Messages != 3 {
+		t.Fatalf("TestSubInfoCounts Expected <drain1 3>, got <%v>\n", si[1])
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
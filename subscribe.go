@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"time"
 )
 
 var _ = fmt.Println
@@ -56,11 +57,28 @@ var _ = fmt.Println
 
 */
 func (c *Connection) Subscribe(h Headers) (<-chan MessageData, error) {
+	return subChan(c.subscribe(h, 0))
+}
+
+/*
+	Subscription channel for the public API.
+*/
+func subChan(sd *subscription, e error) (<-chan MessageData, error) {
+	if sd == nil {
+		return nil, e
+	}
+	return sd.md, e
+}
+
+/*
+	Common SUBSCRIBE logic, with an optional ack timeout.
+*/
+func (c *Connection) subscribe(h Headers, d time.Duration) (*subscription, error) {
 	c.log(SUBSCRIBE, "start", h, c.Protocol())
-	if !c.connected {
+	if !c.Connected() {
 		return nil, ECONBAD
 	}
-	e := checkHeaders(h, c.Protocol())
+	e := c.validateHeaders(h)
 	if e != nil {
 		return nil, e
 	}
@@ -76,14 +94,30 @@ func (c *Connection) Subscribe(h Headers) (<-chan MessageData, error) {
 	if e != nil {
 		return nil, e
 	}
+	if d > 0 {
+		c.startAckTimeout(sub, d)
+	}
 	//
 	f := Frame{SUBSCRIBE, ch, NULLBUFF}
 	//
-	r := make(chan error)
-	c.output <- wiredata{f, r}
-	e = <-r
+	e = c.wireSend(f, 0)
+	if e != nil {
+		// Not subscribed, the subscription map holds only subscriptions
+		// whose SUBSCRIBE was sent.
+		c.subsLock.Lock()
+		if ps, ok := c.subs[sub.id]; ok && ps == sub {
+			delete(c.subs, sub.id)
+		}
+		c.closeSub(sub, nil)
+		c.subsLock.Unlock()
+		c.log(SUBSCRIBE, "failed", ch, e)
+		return nil, e
+	}
+	if sub.drat > 0 {
+		c.startDrainTimer(sub)
+	}
 	c.log(SUBSCRIBE, "end", ch, c.Protocol())
-	return sub.md, e
+	return sub, nil
 }
 
 /*
@@ -93,26 +127,14 @@ func (c *Connection) checkSubscribeHeaders(h Headers) error {
 	if _, ok := h.Contains(HK_DESTINATION); !ok {
 		return EREQDSTSUB
 	}
+	if e := c.checkDestination(h); e != nil {
+		return e
+	}
 	//
-	am, ok := h.Contains(HK_ACK)
-	//
-	switch c.Protocol() {
-	case SPL_10:
-		if ok { // Client supplied ack header
-			if !validAckModes10[am] {
-				return ESBADAM
-			}
-		}
-	case SPL_11:
-		fallthrough
-	case SPL_12:
-		if ok { // Client supplied ack header
-			if !(validAckModes10[am] || validAckModes1x[am]) {
-				return ESBADAM
-			}
+	if am, ok := h.Contains(HK_ACK); ok { // Client supplied ack header
+		if !ValidAckMode(am, c.Protocol()) {
+			return AckModeError{am, c.Protocol()}
 		}
-	default:
-		log.Fatalf("Internal protocol level error:<%s>\n", c.Protocol())
 	}
 	return nil
 }
@@ -124,14 +146,22 @@ func (c *Connection) establishSubscription(h Headers) (*subscription, error, Hea
 	// c.log(SUBSCRIBE, "start establishSubscription")
 	//
 	id, hid := h.Contains(HK_ID)
-	uuid1 := Uuid()
+	var uuid1 string // Generated id, 1.1+
+	if !hid && c.Protocol() != SPL_10 {
+		uuid1 = c.newId(IdSubscription)
+	}
 	sha11 := Sha1(h.Value(HK_DESTINATION))
 	//
 	c.subsLock.RLock() // Acquire Read lock
 	// No duplicates
 	if hid {
-		if _, q := c.subs[id]; q {
-			c.subsLock.RUnlock()   // Release Read lock
+		if ps, q := c.subs[id]; q {
+			am := ps.am
+			c.subsLock.RUnlock() // Release Read lock
+			if nm := h.Value(HK_ACK); nm != am {
+				// Ack mode can not be changed on a live subscription
+				return nil, AckModeChangeError{id, am, nm}, h
+			}
 			return nil, EDUPSID, h // Duplicate subscriptions not allowed
 		}
 		if _, q := c.subs[sha11]; q {
@@ -155,7 +185,9 @@ func (c *Connection) establishSubscription(h Headers) (*subscription, error, Hea
 	sd.dra = 0                            // Never drain MESSAGE frames
 	sd.drmc = 0                           // Current drain count
 	sd.md = make(chan MessageData, c.scc) // Make subscription MD channel
+	sd.qc = make(chan struct{})           // Subscription close signal
 	sd.am = h.Value(HK_ACK)               // Set subscription ack mode
+	sd.dest = h.Value(HK_DESTINATION)     // Subscription destination
 	//
 	if !hid {
 		// No caller supplied ID.  This STOMP client package supplies one.  It is the
@@ -186,9 +218,45 @@ func (c *Connection) establishSubscription(h Headers) (*subscription, error, Hea
 			sd.dra = uint(n) // Drain after count
 		}
 	}
+	if dt, okdt := h.Contains(StompPlusDrainAfterTime); okdt {
+		d, e := time.ParseDuration(dt)
+		if e != nil {
+			log.Printf("sng_draftertime conversion error: %v\n", e)
+		} else if d > 0 {
+			sd.drat = d // Close after duration
+		}
+	}
+	if cc, okcr := h.Contains(StompPlusCredits); okcr {
+		n, e := strconv.Atoi(cc)
+		if e != nil || n < 0 {
+			log.Printf("sng_credits conversion error: %v\n", cc)
+		} else {
+			sd.crn = n                      // Initial delivery credits
+			sd.crc = make(chan struct{}, 1) // Flow control wake up
+		}
+	}
+	if ar, okar := h.Contains(StompPlusAckReceipts); okar {
+		sd.ackr = ar == "true" // Receipt for every ACK
+	}
+	if rc, okrp := h.Contains(StompPlusReplay); okrp {
+		n, e := strconv.Atoi(rc)
+		if e != nil {
+			log.Printf("sng_replay conversion error: %v\n", e)
+		} else if n > 0 {
+			sd.rpl = newReplayBuffer(n) // Replay buffer
+		}
+	}
 
-	// This is a write lock
+	// This is a write lock.  The checks above are repeated, a concurrent
+	// Subscribe with the same id may have won meanwhile.
 	c.subsLock.Lock()
+	if ps, q := c.subs[sd.id]; q {
+		c.subsLock.Unlock()
+		if nm := h.Value(HK_ACK); hid && nm != ps.am {
+			return nil, AckModeChangeError{id, ps.am, nm}, h
+		}
+		return nil, EDUPSID, h
+	}
 	c.subs[sd.id] = sd // Add subscription to the connection subscription map
 	c.subsLock.Unlock()
 	//c.log(SUBSCRIBE, "end establishSubscription")
@@ -0,0 +1,284 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+/*
+	Subscription is a handle for a single subscription, returned by
+	SubscribeHandle and related methods.  Messages for the subscription
+	arrive on the MessageData channel, exactly as with the channel Subscribe
+	returns.
+*/
+type Subscription struct {
+	MessageData <-chan MessageData // Subscription MessageData channel
+	c           *Connection        // Owning connection
+	sd          *subscription      // Subscription data
+	clk         sync.Once          // Close once
+	ce          error              // Close result
+}
+
+/*
+	SubscribeHandle subscribes exactly as Subscribe does, and returns a
+	Subscription handle rather than a bare channel.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/myqueue",
+			stompngo.HK_ID, "myid"}
+		s, e := c.SubscribeHandle(h)
+		if e != nil {
+			// Do something sane ...
+		}
+		defer s.Close()
+		for md := range s.MessageData {
+			// Process md ...
+		}
+*/
+func (c *Connection) SubscribeHandle(h Headers) (*Subscription, error) {
+	sd, e := c.subscribe(h, 0)
+	if e != nil {
+		return nil, e
+	}
+	return c.newSubscription(sd), nil
+}
+
+/*
+	SubscribeConfirmed subscribes exactly as SubscribeHandle does, and waits
+	for the broker RECEIPT confirming the subscription was registered.
+
+	A receipt header is added to the SUBSCRIBE if the client did not supply
+	one.  ERCPTTMO is returned if the RECEIPT does not arrive within the
+	timeout.  If the broker answers with an ERROR frame instead, e.g. for a
+	bad destination, a BrokerError is returned.  In both cases the
+	subscription is closed and no handle is returned.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/critical",
+			stompngo.HK_ID, "crit1"}
+		s, e := c.SubscribeConfirmed(h, 5*time.Second)
+		if be, ok := e.(stompngo.BrokerError); ok {
+			fmt.Println(be.Frame.Headers.Value(stompngo.HK_MESSAGE))
+		}
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func (c *Connection) SubscribeConfirmed(h Headers, t time.Duration) (*Subscription, error) {
+	var sd *subscription
+	_, e := c.transmitReceipt(h, t, func(ch Headers) error {
+		var se error
+		sd, se = c.subscribe(ch, 0)
+		return se
+	})
+	if e != nil {
+		if sd != nil {
+			_ = c.newSubscription(sd).Close()
+		}
+		return nil, e
+	}
+	return c.newSubscription(sd), nil
+}
+
+/*
+	Build a handle for a just established subscription.
+*/
+func (c *Connection) newSubscription(sd *subscription) *Subscription {
+	return &Subscription{MessageData: sd.md, c: c, sd: sd}
+}
+
+/*
+	SetLogger sets a logger for this subscription only.  Delivery, ack, and
+	drain events for the subscription are logged to it, rather than to the
+	connection logger, with a "sub=<id>" field after the session.  Each
+	MESSAGE delivered is also logged, which the connection logger never
+	does, so one noisy subscription can be traced on its own.
+
+	A nil logger, the default, returns to the connection logger.
+
+	Example:
+		s.SetLogger(log.New(os.Stderr, "orders ", log.Lmicroseconds))
+*/
+func (s *Subscription) SetLogger(l *log.Logger) {
+	logLock.Lock()
+	s.sd.lgr = l
+	logLock.Unlock()
+}
+
+/*
+	Id returns the subscription id.
+*/
+func (s *Subscription) Id() string {
+	return s.sd.id
+}
+
+/*
+	Close unsubscribes, and then closes the MessageData channel exactly once.
+	No further messages are delivered after Close returns.  Messages already
+	buffered in the channel remain available to the consumer, which should
+	read the channel until it is closed.
+
+	Close is idempotent and safe for concurrent use.  Every call returns the
+	result of the first.  The channel is closed even if the UNSUBSCRIBE can
+	not be sent, e.g. after a disconnect.
+
+	Close does not wait for the consumer.  A delivery blocked on a full
+	channel is abandoned, and that message is dropped.
+*/
+func (s *Subscription) Close() error {
+	s.clk.Do(func() {
+		c := s.c
+		c.subLog(s.sd, UNSUBSCRIBE, "close start", s.sd.id)
+		s.ce = c.closeSubscription(s.sd)
+		c.subLog(s.sd, UNSUBSCRIBE, "close end", s.sd.id, s.ce)
+	})
+	return s.ce
+}
+
+/*
+	ReceiveInto waits for the next message on the subscription, and copies
+	the body into buf.  buf is grown only if it is too small.  It returns the
+	message, with Body referencing the (possibly grown) buffer, and the body
+	length.  ESUBCLSD is returned once the subscription channel is closed,
+	and any error delivered on the channel is returned as is.
+
+	The returned Body is only valid until buf is next reused.  Pass
+	Body[:cap(Body)] to the next call to reuse any grown buffer.  The
+	returned Headers are not shared, and may be retained.
+
+	Example:
+		buf := make([]byte, 64*1024)
+		for {
+			m, n, e := s.ReceiveInto(buf)
+			if e != nil {
+				break
+			}
+			process(m.Headers, m.Body[:n])
+			buf = m.Body[:cap(m.Body)]
+		}
+*/
+func (s *Subscription) ReceiveInto(buf []byte) (Message, int, error) {
+	md, ok := <-s.MessageData
+	if !ok {
+		return Message{}, 0, ESUBCLSD
+	}
+	if md.Error != nil {
+		return md.Message, 0, md.Error
+	}
+	n := len(md.Message.Body)
+	if cap(buf) < n {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+	copy(buf, md.Message.Body)
+	m := Message{md.Message.Command, md.Message.Headers, buf}
+	return m, n, nil
+}
+
+/*
+	Collect waits for up to n messages on the subscription, and returns those
+	received once n have arrived or the timeout expires, whichever is first.
+	A timeout is not an error: fewer than n, possibly no, messages are
+	returned with a nil error.  A t <= 0 collects only messages already
+	buffered.
+
+	ESUBCLSD is returned, with any messages collected so far, if the
+	subscription channel is closed.  An error delivered on the channel is
+	returned the same way, and is not included in the messages.
+
+	Example:
+		mds, e := s.Collect(100, 2*time.Second)
+		if e != nil {
+			// Do something sane ...
+		}
+		for _, md := range mds {
+			// Process md ...
+		}
+*/
+func (s *Subscription) Collect(n int, t time.Duration) ([]MessageData, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	mds := make([]MessageData, 0, n)
+	var tc <-chan time.Time
+	if t > 0 {
+		tm := time.NewTimer(t)
+		defer tm.Stop()
+		tc = tm.C
+	} else {
+		dc := make(chan time.Time)
+		close(dc)
+		tc = dc
+	}
+	for len(mds) < n {
+		var md MessageData
+		var ok bool
+		select {
+		case md, ok = <-s.MessageData:
+		default:
+			select {
+			case md, ok = <-s.MessageData:
+			case _ = <-tc:
+				return mds, nil
+			}
+		}
+		if !ok {
+			return mds, ESUBCLSD
+		}
+		if md.Error != nil {
+			return mds, md.Error
+		}
+		mds = append(mds, md)
+	}
+	return mds, nil
+}
+
+/*
+	CollectAck collects exactly as Collect does, and then acknowledges the
+	messages collected for subscriptions in a client ack mode.  In "client"
+	mode a single cumulative ACK is sent for the last message, in
+	"client-individual" mode each message is ACKed.  Nothing is sent in
+	"auto" mode.
+
+	If an ACK fails the messages are still returned, with the ACK error.  A
+	Collect error takes precedence, and the messages collected before it are
+	ACKed first.
+*/
+func (s *Subscription) CollectAck(n int, t time.Duration) ([]MessageData, error) {
+	mds, e := s.Collect(n, t)
+	if len(mds) == 0 {
+		return mds, e
+	}
+	var ae error
+	switch s.sd.am {
+	case AckModeClient:
+		ae = s.c.AckMessage(mds[len(mds)-1].Message)
+	case AckModeClientIndividual:
+		for _, md := range mds {
+			if ae = s.c.AckMessage(md.Message); ae != nil {
+				break
+			}
+		}
+	}
+	if e != nil {
+		return mds, e
+	}
+	return mds, ae
+}
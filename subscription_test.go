@@ -0,0 +1,512 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/*
+	Subscription Test: concurrent Close calls unsubscribe and close once.
+*/
+func TestSubscriptionCloseConcurrent(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSubscriptionCloseConcurrent Expected nil, got <%v>\n", e)
+	}
+	c.SetSubChanCap(4)
+	sh := Headers{HK_DESTINATION, "/queue/drain", HK_ID, "drain1"}
+	s, e := c.SubscribeHandle(sh)
+	if e != nil {
+		t.Fatalf("TestSubscriptionCloseConcurrent Expected nil, got <%v>\n", e)
+	}
+	if s.Id() != "drain1" {
+		t.Fatalf("TestSubscriptionCloseConcurrent Expected drain1, got <%v>\n",
+			s.Id())
+	}
+	_ = fb.write(fakeDrainMessage)
+	for c.SubscriptionMessageCount("drain1") != 1 {
+		// Wait for the buffered delivery
+	}
+	//
+	var wg sync.WaitGroup
+	for i := 0; i < subCloseCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ce := s.Close(); ce != nil {
+				t.Errorf("TestSubscriptionCloseConcurrent Expected nil, got <%v>\n",
+					ce)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(c.Subscriptions()) != 0 {
+		t.Fatalf("TestSubscriptionCloseConcurrent Expected none, got <%v>\n",
+			c.Subscriptions())
+	}
+	//
+	md, ok := <-s.MessageData // Buffered message is still delivered
+	if !ok || md.Message.Command != MESSAGE {
+		t.Fatalf("TestSubscriptionCloseConcurrent Expected MESSAGE, got <%v>\n", md)
+	}
+	if _, ok = <-s.MessageData; ok {
+		t.Fatalf("TestSubscriptionCloseConcurrent Expected closed channel\n")
+	}
+	//
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	for _, w := range []string{CONNECT, SUBSCRIBE, UNSUBSCRIBE, DISCONNECT} {
+		if f := fb.nextFrame(t); f.Command != w {
+			t.Fatalf("TestSubscriptionCloseConcurrent Expected <%v>, got <%v>\n",
+				w, f.Command)
+		}
+	}
+	fb.close()
+}
+
+/*
+	Subscription Test: Close after disconnect still closes the channel.
+*/
+func TestSubscriptionCloseDisconnected(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSubscriptionCloseDisconnected Expected nil, got <%v>\n", e)
+	}
+	s, e := c.SubscribeHandle(Headers{HK_DESTINATION, "/queue/a", HK_ID, "a"})
+	if e != nil {
+		t.Fatalf("TestSubscriptionCloseDisconnected Expected nil, got <%v>\n", e)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	if e = s.Close(); e != ECONBAD {
+		t.Fatalf("TestSubscriptionCloseDisconnected Expected <%v>, got <%v>\n",
+			ECONBAD, e)
+	}
+	if e = s.Close(); e != ECONBAD {
+		t.Fatalf("TestSubscriptionCloseDisconnected Expected <%v>, got <%v>\n",
+			ECONBAD, e)
+	}
+	if _, ok := <-s.MessageData; ok {
+		t.Fatalf("TestSubscriptionCloseDisconnected Expected closed channel\n")
+	}
+	fb.close()
+}
+
+/*
+	Subscription Test: SubscribeConfirmed waits for the RECEIPT.
+*/
+func TestSubscriptionConfirmed(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSubscriptionConfirmed Expected nil, got <%v>\n", e)
+	}
+	sh := Headers{HK_DESTINATION, "/queue/drain", HK_ID, "drain1"}
+	s, e := c.SubscribeConfirmed(sh, subConfTmo)
+	if e != nil {
+		t.Fatalf("TestSubscriptionConfirmed Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	f := fb.nextFrame(t)
+	if _, ok := f.Headers.Contains(HK_RECEIPT); f.Command != SUBSCRIBE || !ok {
+		t.Fatalf("TestSubscriptionConfirmed Expected SUBSCRIBE receipt, got <%v>\n",
+			f)
+	}
+	_ = fb.write(fakeDrainMessage)
+	if md := <-s.MessageData; md.Message.Command != MESSAGE {
+		t.Fatalf("TestSubscriptionConfirmed Expected MESSAGE, got <%v>\n", md)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
+
+/*
+	Subscription Test: SubscribeConfirmed returns a broker ERROR.
+*/
+func TestSubscriptionConfirmedError(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSubscriptionConfirmedError Expected nil, got <%v>\n", e)
+	}
+	var ec int32
+	c.OnError(func(m Message) { atomic.AddInt32(&ec, 1) })
+	fb.setAutoReceipt(false)
+	go func() {
+		_ = fb.nextFrame(t) // CONNECT
+		_ = fb.nextFrame(t) // SUBSCRIBE
+		_ = fb.write(fakeSubErrorFrame)
+	}()
+	sh := Headers{HK_DESTINATION, "/queue/bad", HK_ID, "bad1",
+		HK_RECEIPT, "sub-r1"}
+	s, e := c.SubscribeConfirmed(sh, subConfTmo)
+	if s != nil {
+		t.Fatalf("TestSubscriptionConfirmedError Expected nil, got <%v>\n", s)
+	}
+	be, ok := e.(BrokerError)
+	if !ok {
+		t.Fatalf("TestSubscriptionConfirmedError Expected BrokerError, got <%v>\n",
+			e)
+	}
+	if n := atomic.LoadInt32(&ec); n != 1 {
+		t.Fatalf("TestSubscriptionConfirmedError Expected 1 OnError, got <%v>\n", n)
+	}
+	if be.Error() != "broker ERROR: bad destination" {
+		t.Fatalf("TestSubscriptionConfirmedError Expected message, got <%v>\n",
+			be.Error())
+	}
+	if len(c.Subscriptions()) != 0 {
+		t.Fatalf("TestSubscriptionConfirmedError Expected none, got <%v>\n",
+			c.Subscriptions())
+	}
+	e = c.Disconnect(NoDiscReceipt)
+	checkDisconnectError(t, e)
+	fb.close()
+}
+
+/*
+	Subscription Test: ReceiveInto copies bodies into a caller buffer.
+*/
+func TestSubscriptionReceiveInto(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSubscriptionReceiveInto Expected nil, got <%v>\n", e)
+	}
+	s, e := c.SubscribeHandle(Headers{HK_DESTINATION, "/queue/drain",
+		HK_ID, "drain1"})
+	if e != nil {
+		t.Fatalf("TestSubscriptionReceiveInto Expected nil, got <%v>\n", e)
+	}
+	// Too small, grown
+	_ = fb.write(fakeDrainMessage)
+	m, n, e := s.ReceiveInto(make([]byte, 4))
+	if e != nil || n != len("buffered") || string(m.Body) != "buffered" {
+		t.Fatalf("TestSubscriptionReceiveInto Expected buffered, got <%v> <%v> <%v>\n",
+			string(m.Body), n, e)
+	}
+	if m.Headers.Value(HK_MESSAGE_ID) != "m1" {
+		t.Fatalf("TestSubscriptionReceiveInto Expected m1, got <%v>\n", m.Headers)
+	}
+	// Large enough, reused
+	buf := make([]byte, 64)
+	_ = fb.write(fakeDrainMessage)
+	m, n, e = s.ReceiveInto(buf)
+	if e != nil || string(m.Body[:n]) != "buffered" || &m.Body[0] != &buf[0] {
+		t.Fatalf("TestSubscriptionReceiveInto Expected buffer reuse, got <%v> <%v>\n",
+			string(m.Body), e)
+	}
+	if e = s.Close(); e != nil {
+		t.Fatalf("TestSubscriptionReceiveInto Expected nil, got <%v>\n", e)
+	}
+	if _, _, e = s.ReceiveInto(buf); e != ESUBCLSD {
+		t.Fatalf("TestSubscriptionReceiveInto Expected <%v>, got <%v>\n", ESUBCLSD, e)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
+
+/*
+	Test SubscribeWithReplay: the last n delivered messages are retained,
+	oldest first.
+*/
+func TestSubscriptionReplay(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSubscriptionReplay Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	h := Headers{HK_DESTINATION, "/queue/replay", HK_ID, "rpl1"}
+	if _, e = c.SubscribeWithReplay(h, 0); e != EBADRPLN {
+		t.Fatalf("TestSubscriptionReplay Expected <%v>, got <%v>\n", EBADRPLN, e)
+	}
+	s, e := c.SubscribeWithReplay(h, subReplaySize)
+	if e != nil {
+		t.Fatalf("TestSubscriptionReplay Expected nil, got <%v>\n", e)
+	}
+	f := fb.nextFrame(t)
+	if v := f.Headers.Value(StompPlusReplay); v != strconv.Itoa(subReplaySize) {
+		t.Fatalf("TestSubscriptionReplay Expected <%d>, got <%s>\n", subReplaySize, v)
+	}
+	if mds := s.Replay(); len(mds) != 0 {
+		t.Fatalf("TestSubscriptionReplay Expected nothing, got <%v>\n", mds)
+	}
+	ids := []string{"r0", "r1", "r2"}
+	for _, id := range ids {
+		_ = fb.write(MESSAGE + "\ndestination:/queue/replay\nsubscription:rpl1\nmessage-id:" +
+			id + "\n\n" + id + "\x00")
+		select {
+		case md := <-s.MessageData:
+			if md.Error != nil || md.Message.BodyString() != id {
+				t.Fatalf("TestSubscriptionReplay Expected <%s>, got <%v>\n", id, md)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("TestSubscriptionReplay nothing delivered\n")
+		}
+	}
+	mds := s.Replay()
+	if len(mds) != subReplaySize {
+		t.Fatalf("TestSubscriptionReplay Expected <%d>, got <%d>\n", subReplaySize, len(mds))
+	}
+	for i, md := range mds {
+		if w := ids[len(ids)-subReplaySize+i]; md.Message.BodyString() != w {
+			t.Fatalf("TestSubscriptionReplay Expected <%s>, got <%s>\n", w,
+				md.Message.BodyString())
+		}
+	}
+	ps, e := c.SubscribeHandle(Headers{HK_DESTINATION, "/queue/plain", HK_ID, "rpl2"})
+	if e != nil {
+		t.Fatalf("TestSubscriptionReplay Expected nil, got <%v>\n", e)
+	}
+	if mds = ps.Replay(); mds != nil {
+		t.Fatalf("TestSubscriptionReplay Expected nil, got <%v>\n", mds)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Test SubscribeWithCredits: no more than the requested number of messages
+	are delivered before the next Request.
+*/
+func TestSubscriptionCredits(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSubscriptionCredits Expected nil, got <%v>\n", e)
+	}
+	_ = fb.nextFrame(t)            // CONNECT
+	c.SetSubChanCap(subCreditMsgs) // Room for everything, only credits gate
+	h := Headers{HK_DESTINATION, "/queue/credits", HK_ID, "crd1"}
+	if _, e = c.SubscribeWithCredits(h, -1); e != ECRDNEG {
+		t.Fatalf("TestSubscriptionCredits Expected <%v>, got <%v>\n", ECRDNEG, e)
+	}
+	s, e := c.SubscribeWithCredits(h, subCredits)
+	if e != nil {
+		t.Fatalf("TestSubscriptionCredits Expected nil, got <%v>\n", e)
+	}
+	if f := fb.nextFrame(t); f.Headers.Value(StompPlusCredits) != strconv.Itoa(subCredits) {
+		t.Fatalf("TestSubscriptionCredits Expected credits header, got <%v>\n", f.Headers)
+	}
+	go func() { // The reader waits for credits
+		for i := 0; i < subCreditMsgs; i++ {
+			_ = fb.write(MESSAGE + "\ndestination:/queue/credits\nsubscription:crd1\n" +
+				"message-id:c" + strconv.Itoa(i) + "\n\n" + strconv.Itoa(i) + "\x00")
+		}
+	}()
+	got := 0
+	for r := 0; got < subCreditMsgs; r++ {
+		w := got + subCredits
+		if w > subCreditMsgs {
+			w = subCreditMsgs
+		}
+		for ; got < w; got++ {
+			select {
+			case md := <-s.MessageData:
+				if md.Message.BodyString() != strconv.Itoa(got) {
+					t.Fatalf("TestSubscriptionCredits Expected <%d>, got <%v>\n", got, md)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("TestSubscriptionCredits message %d not delivered\n", got)
+			}
+		}
+		select {
+		case md := <-s.MessageData:
+			t.Fatalf("TestSubscriptionCredits Expected no delivery, got <%v>\n", md)
+		case <-time.After(100 * time.Millisecond):
+		}
+		s.Request(subCredits)
+	}
+	if e = s.Close(); e != nil {
+		t.Fatalf("TestSubscriptionCredits Expected nil, got <%v>\n", e)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Subscription Test: Collect returns early with what arrived by the
+	timeout, and ESUBCLSD once the channel is closed.
+*/
+func TestSubscriptionCollect(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSubscriptionCollect Expected nil, got <%v>\n", e)
+	}
+	c.SetSubChanCap(subCollectMsgs)
+	s, e := c.SubscribeHandle(Headers{HK_DESTINATION, "/queue/coll", HK_ID, "coll1"})
+	if e != nil {
+		t.Fatalf("TestSubscriptionCollect Expected nil, got <%v>\n", e)
+	}
+	if mds, e := s.Collect(0, subCollectTmo); len(mds) != 0 || e != nil {
+		t.Fatalf("TestSubscriptionCollect Expected <0 nil>, got <%d %v>\n",
+			len(mds), e)
+	}
+	go func() {
+		for i := 0; i < subCollectMsgs; i++ {
+			_ = fb.write(fmt.Sprintf(fakeCollectMsg, "coll1", i, i))
+		}
+	}()
+	st := time.Now()
+	mds, e := s.Collect(subCollectMsgs+1, subCollectTmo)
+	if e != nil || len(mds) != subCollectMsgs {
+		t.Fatalf("TestSubscriptionCollect Expected <%d nil>, got <%d %v>\n",
+			subCollectMsgs, len(mds), e)
+	}
+	if el := time.Since(st); el < subCollectTmo {
+		t.Fatalf("TestSubscriptionCollect Expected timeout wait, got <%v>\n", el)
+	}
+	for i, md := range mds {
+		if w := "m" + strconv.Itoa(i); md.Message.Headers.Value(HK_MESSAGE_ID) != w {
+			t.Fatalf("TestSubscriptionCollect Expected <%s>, got <%v>\n", w,
+				md.Message.Headers)
+		}
+	}
+	//
+	if e = s.Close(); e != nil {
+		t.Fatalf("TestSubscriptionCollect Expected nil, got <%v>\n", e)
+	}
+	if mds, e = s.Collect(1, subCollectTmo); len(mds) != 0 || e != ESUBCLSD {
+		t.Fatalf("TestSubscriptionCollect Expected <0 %v>, got <%d %v>\n",
+			ESUBCLSD, len(mds), e)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
+
+/*
+	Subscription Test: CollectAck ACKs according to the subscription ack mode.
+*/
+func TestSubscriptionCollectAck(t *testing.T) {
+	for _, am := range []string{AckModeAuto, AckModeClient, AckModeClientIndividual} {
+		nc, fb := openFakeConn(t, fakeConnected12)
+		c, e := Connect(nc, fake12Headers)
+		if e != nil {
+			t.Fatalf("TestSubscriptionCollectAck Expected nil, got <%v>\n", e)
+		}
+		c.SetSubChanCap(subCollectMsgs)
+		s, e := c.SubscribeHandle(Headers{HK_DESTINATION, "/queue/coll",
+			HK_ID, "coll2", HK_ACK, am})
+		if e != nil {
+			t.Fatalf("TestSubscriptionCollectAck Expected nil, got <%v>\n", e)
+		}
+		_ = fb.nextFrame(t) // CONNECT
+		_ = fb.nextFrame(t) // SUBSCRIBE
+		go func() {
+			for i := 0; i < subCollectMsgs; i++ {
+				_ = fb.write(fmt.Sprintf(fakeCollectMsg, "coll2", i, i))
+			}
+		}()
+		mds, e := s.CollectAck(subCollectMsgs, subConfTmo)
+		if e != nil || len(mds) != subCollectMsgs {
+			t.Fatalf("TestSubscriptionCollectAck[%s] Expected <%d nil>, got <%d %v>\n",
+				am, subCollectMsgs, len(mds), e)
+		}
+		for _, id := range collectAckIds[am] {
+			if f := fb.nextFrame(t); f.Command != ACK || f.Headers.Value(HK_ID) != id {
+				t.Fatalf("TestSubscriptionCollectAck[%s] Expected <%v %s>, got <%v %v>\n",
+					am, ACK, id, f.Command, f.Headers)
+			}
+		}
+		e = c.Disconnect(empty_headers)
+		checkDisconnectError(t, e)
+		if f := fb.nextFrame(t); f.Command != DISCONNECT {
+			t.Fatalf("TestSubscriptionCollectAck[%s] Expected <%v>, got <%v %v>\n",
+				am, DISCONNECT, f.Command, f.Headers)
+		}
+		fb.close()
+	}
+}
+
+/*
+	Subscription Test: a subscription logger receives that subscription's
+	delivery, ack, and close events, and other subscriptions still log to
+	the connection logger.
+*/
+func TestSubscriptionLogger(t *testing.T) {
+	var cb, sb bytes.Buffer
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSubscriptionLogger Expected nil, got <%v>\n", e)
+	}
+	c.SetLogger(log.New(&cb, "", 0))
+	c.SetSubChanCap(subCollectMsgs)
+	s1, e := c.SubscribeHandle(Headers{HK_DESTINATION, "/queue/coll", HK_ID, "lg1",
+		HK_ACK, AckModeClientIndividual})
+	if e != nil {
+		t.Fatalf("TestSubscriptionLogger Expected nil, got <%v>\n", e)
+	}
+	s1.SetLogger(log.New(&sb, "", 0))
+	s2, e := c.SubscribeHandle(Headers{HK_DESTINATION, "/queue/coll", HK_ID, "lg2"})
+	if e != nil {
+		t.Fatalf("TestSubscriptionLogger Expected nil, got <%v>\n", e)
+	}
+	go func() {
+		_ = fb.write(fmt.Sprintf(fakeCollectMsg, "lg1", 1, 1))
+		_ = fb.write(fmt.Sprintf(fakeCollectMsg, "lg2", 2, 2))
+	}()
+	md := <-s1.MessageData
+	_ = <-s2.MessageData
+	if e = c.AckMessage(md.Message); e != nil {
+		t.Fatalf("TestSubscriptionLogger Expected nil, got <%v>\n", e)
+	}
+	for _, s := range []*Subscription{s1, s2} {
+		if e = s.Close(); e != nil {
+			t.Fatalf("TestSubscriptionLogger Expected nil, got <%v>\n", e)
+		}
+	}
+	logLock.Lock()
+	co, so := cb.String(), sb.String()
+	logLock.Unlock()
+	for _, w := range subLoggerOnly {
+		if !strings.Contains(so, w) || strings.Contains(co, w) {
+			t.Fatalf("TestSubscriptionLogger Expected <%s> in subscription log only, got <%s> <%s>\n",
+				w, so, co)
+		}
+	}
+	for _, w := range connLoggerOnly {
+		if strings.Contains(so, w) || !strings.Contains(co, w) {
+			t.Fatalf("TestSubscriptionLogger Expected <%s> in connection log only, got <%s> <%s>\n",
+				w, so, co)
+		}
+	}
+	c.SetLogger(nil)
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
@@ -160,3 +160,98 @@ func TestSuppressContentType(t *testing.T) {
 		_ = closeConn(t, n)
 	}
 }
+
+/*
+	Test connection level content type suppression.
+*/
+func TestSuppressContentTypeConn(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSuppressContentTypeConn CONNECT expected nil, got %v\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	sh := Headers{HK_DESTINATION, "/queue/suppress.conn"}
+	for _, tv := range tsctConnData {
+		c.SuppressContentType(tv.sct)
+		h := sh
+		if tv.ct != "" {
+			h = sh.Add(HK_CONTENT_TYPE, tv.ct)
+		}
+		if e = c.Send(h, tm); e != nil {
+			t.Fatalf("TestSuppressContentTypeConn Expected nil, got <%v>\n", e)
+		}
+		if v := fb.nextFrame(t).Headers.Value(HK_CONTENT_TYPE); v != tv.wanted {
+			t.Fatalf("TestSuppressContentTypeConn Expected <%v>, got <%v>\n", tv.wanted, v)
+		}
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
+
+/*
+	Test connection level content-type suppression toggled during sends.
+	Run with -race.
+*/
+func TestSuppressContentTypeConnConcurrent(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSuppressContentTypeConnConcurrent CONNECT expected nil, got %v\n", e)
+	}
+	sh := Headers{HK_DESTINATION, "/queue/suppress.conn"}
+	dc := make(chan struct{})
+	go func() {
+		defer close(dc)
+		for i := 0; i < 20; i++ {
+			c.SuppressContentType(i%2 == 0)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if e = c.Send(sh, tm); e != nil {
+			t.Fatalf("TestSuppressContentTypeConnConcurrent Expected nil, got <%v>\n", e)
+		}
+	}
+	<-dc
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
+
+/*
+	Test the connection default content-type, used for frames sent without
+	one unless suppressed.  An empty default adds nothing.
+*/
+func TestSuppressContentTypeDefault(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestSuppressContentTypeDefault CONNECT expected nil, got %v\n", e)
+	}
+	_ = fb.nextFrame(t) // CONNECT
+	sh := Headers{HK_DESTINATION, "/queue/suppress.default"}
+	if e = c.Send(sh, tm); e != nil {
+		t.Fatalf("TestSuppressContentTypeDefault Expected nil, got <%v>\n", e)
+	}
+	if v := fb.nextFrame(t).Headers.Value(HK_CONTENT_TYPE); v != DFLT_CONTENT_TYPE {
+		t.Fatalf("TestSuppressContentTypeDefault Expected <%v>, got <%v>\n", DFLT_CONTENT_TYPE, v)
+	}
+	for _, tv := range tsctDefaultData {
+		c.SetDefaultContentType(tv.dct)
+		c.SuppressContentType(tv.sct)
+		h := sh
+		if tv.ct != "" {
+			h = sh.Add(HK_CONTENT_TYPE, tv.ct)
+		}
+		if e = c.Send(h, tm); e != nil {
+			t.Fatalf("TestSuppressContentTypeDefault Expected nil, got <%v>\n", e)
+		}
+		if v := fb.nextFrame(t).Headers.Value(HK_CONTENT_TYPE); v != tv.wanted {
+			t.Fatalf("TestSuppressContentTypeDefault Expected <%v>, got <%v>\n", tv.wanted, v)
+		}
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	fb.close()
+}
@@ -1,9 +1,12 @@
 package stompngo
 
 import (
+	"bufio"
 	"log"
 	"net"
 	"os"
+	"sync"
+	"time"
 )
 
 func init() {
@@ -22,6 +25,24 @@ type (
 		headers Headers
 		errval  Error
 	}
+
+	ackMsgData struct {
+		proto string
+		resp  string
+		ch    Headers
+		mh    Headers
+		want  Headers
+		exe   error
+	}
+
+	ackVersionData struct {
+		proto string
+		resp  string
+		ch    Headers
+		nack  bool
+		h     Headers
+		want  error
+	}
 )
 
 //=============================================================================
@@ -42,6 +63,53 @@ var (
 			Headers{HK_DESTINATION, "/queue/a"},
 			EREQIDACK},
 	}
+
+	ackMsgList = []ackMsgData{
+		{SPL_10, fakeConnected10, Headers{HK_HOST, "localhost"},
+			Headers{HK_MESSAGE_ID, "m1", HK_SUBSCRIPTION, "s1", HK_ACK, "a1"},
+			Headers{HK_MESSAGE_ID, "m1"}, nil},
+		{SPL_11, fakeConnected11, Headers{HK_ACCEPT_VERSION, SPL_11, HK_HOST, "localhost"},
+			Headers{HK_MESSAGE_ID, "m1", HK_SUBSCRIPTION, "s1", HK_ACK, "a1"},
+			Headers{HK_MESSAGE_ID, "m1", HK_SUBSCRIPTION, "s1"}, nil},
+		{SPL_12, fakeConnected12, fake12Headers,
+			Headers{HK_MESSAGE_ID, "m1", HK_SUBSCRIPTION, "s1", HK_ACK, "a1"},
+			Headers{HK_ID, "a1"}, nil},
+		{SPL_12, fakeConnected12, fake12Headers,
+			Headers{HK_MESSAGE_ID, "m1", HK_SUBSCRIPTION, "s1"},
+			nil, EREQIDACK},
+		{SPL_12, fakeConnected12, fake12Headers,
+			Headers{HK_MESSAGE_ID, "m1", HK_SUBSCRIPTION, "s1", HK_ACK, ""},
+			nil, EREQIDACK},
+	}
+
+	// Headers for the wrong level, and empty values, per protocol level
+	ackVersionList = []ackVersionData{
+		{SPL_10, fakeConnected10, Headers{HK_HOST, "localhost"}, false,
+			Headers{HK_ID, "a1"}, EREQMIDACK},
+		{SPL_10, fakeConnected10, Headers{HK_HOST, "localhost"}, true,
+			Headers{HK_MESSAGE_ID, "m1"}, EBADVERNAK},
+		{SPL_11, fakeConnected11, Headers{HK_ACCEPT_VERSION, SPL_11, HK_HOST, "localhost"}, false,
+			Headers{HK_ID, "a1"}, EREQSUBACK},
+		{SPL_11, fakeConnected11, Headers{HK_ACCEPT_VERSION, SPL_11, HK_HOST, "localhost"}, false,
+			Headers{HK_SUBSCRIPTION, "s1", HK_MESSAGE_ID, ""}, EREQMIDACK},
+		{SPL_11, fakeConnected11, Headers{HK_ACCEPT_VERSION, SPL_11, HK_HOST, "localhost"}, true,
+			Headers{HK_ID, "a1"}, EREQSUBNAK},
+		{SPL_11, fakeConnected11, Headers{HK_ACCEPT_VERSION, SPL_11, HK_HOST, "localhost"}, true,
+			Headers{HK_SUBSCRIPTION, "s1"}, EREQMIDNAK},
+		{SPL_12, fakeConnected12, fake12Headers, false,
+			Headers{HK_MESSAGE_ID, "m1", HK_SUBSCRIPTION, "s1"}, EREQIDACK},
+		{SPL_12, fakeConnected12, fake12Headers, false,
+			Headers{HK_ID, ""}, EREQIDACK},
+		{SPL_12, fakeConnected12, fake12Headers, true,
+			Headers{HK_MESSAGE_ID, "m1", HK_SUBSCRIPTION, "s1"}, EREQIDNAK},
+	}
+
+	// Valid ACK headers, per protocol level
+	ackVersionGood = map[string]Headers{
+		SPL_10: Headers{HK_MESSAGE_ID, "m1"},
+		SPL_11: Headers{HK_MESSAGE_ID, "m1", HK_SUBSCRIPTION, "s1"},
+		SPL_12: Headers{HK_ID, "a1"},
+	}
 )
 
 //=============================================================================
@@ -51,6 +119,282 @@ const (
 // None at present.
 )
 
+//=============================================================================
+//= ackreceipts_test type =====================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= ackreceipts_test var ======================================================
+//=============================================================================
+var (
+	ackReceiptIds = []string{"audit-1", "audit-2"} // MESSAGE ids ACKed
+)
+
+//=============================================================================
+//= ackreceipts_test const ====================================================
+//=============================================================================
+const (
+// None at present.
+)
+
+//=============================================================================
+//= acktimeout_test type ======================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= acktimeout_test var =======================================================
+//=============================================================================
+var (
+	fakeAckTmoMsg1      = "MESSAGE\ndestination:/queue/atmo\nsubscription:atmo1\nmessage-id:m1\nack:a1\n\none\x00"
+	fakeAckTmoMsg2      = "MESSAGE\ndestination:/queue/atmo\nsubscription:atmo1\nmessage-id:m2\nack:a2\n\ntwo\x00"
+	ackOutstandingModes = map[string]string{ // Subscription id to ack mode
+		"cum11": AckModeClient,
+		"ind11": AckModeClientIndividual,
+	}
+	ackOutstandingMsgs = []string{
+		"MESSAGE\ndestination:/queue/cum\nsubscription:cum1\nmessage-id:c1\nack:c1\n\none\x00",
+		"MESSAGE\ndestination:/queue/cum\nsubscription:cum1\nmessage-id:c2\nack:c2\n\ntwo\x00",
+		"MESSAGE\ndestination:/queue/cum\nsubscription:cum1\nmessage-id:c3\nack:c3\n\nthree\x00",
+	}
+)
+
+//=============================================================================
+//= acktimeout_test const =====================================================
+//=============================================================================
+const (
+// None at present.
+)
+
+//=============================================================================
+//= body_codec_test type ======================================================
+//=============================================================================
+type (
+	bodyCodecData struct {
+		ce  string // Caller content-encoding, "" for none
+		bl  int    // Body length
+		enc bool   // Body encoded on the wire
+		wce string // Wire content-encoding, "" for none
+	}
+)
+
+//=============================================================================
+//= body_codec_test var =======================================================
+//=============================================================================
+var (
+	bodyCodecList = []bodyCodecData{
+		{"", bodyCodecMin - 1, false, ""},
+		{"", bodyCodecMin, true, "gzip"},
+		{"gzip", 1, true, "gzip"},
+		{ContentEncodingIdentity, bodyCodecMin * 2, false, ""},
+		{"br", bodyCodecMin * 2, false, "br"},
+	}
+)
+
+//=============================================================================
+//= body_codec_test const =====================================================
+//=============================================================================
+const (
+	bodyCodecMin = 100 // Default encoding threshold
+)
+
+//=============================================================================
+//= bytebudget_test type ======================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= bytebudget_test var =======================================================
+//=============================================================================
+var (
+	byteBudgetSizes = []int{600, 50, 50, 900, 10} // Body sizes, in arrival order
+)
+
+//=============================================================================
+//= bytebudget_test const =====================================================
+//=============================================================================
+const (
+	byteBudget = 1000 // Read byte budget
+)
+
+//=============================================================================
+//= callbacks_test type =======================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= callbacks_test var ========================================================
+//=============================================================================
+var (
+	fakeUnknownFrame    = "PING\nx-ext:1\ncontent-length:4\n\nping\x00"
+	fakeReceiptFrame    = "RECEIPT\nreceipt-id:after-unknown\n\n\x00"
+	fakeConnectedHB     = "CONNECTED\nversion:1.2\nheart-beat:0,50\n\n\x00"
+	fakeConnectedHBSend = "CONNECTED\nversion:1.2\nheart-beat:50,0\n\n\x00"
+)
+
+//=============================================================================
+//= callbacks_test const ======================================================
+//=============================================================================
+const (
+// None at present.
+)
+
+//=============================================================================
+//= capabilities_test type ====================================================
+//=============================================================================
+type (
+	capsData struct {
+		name string
+		resp string
+		bt   BrokerType
+		caps Capabilities
+	}
+)
+
+//=============================================================================
+//= capabilities_test var =====================================================
+//=============================================================================
+var (
+	capsList = []capsData{
+		{"none 1.0", fakeConnected10, BrokerUnknown,
+			Capabilities{false, false, true, false}},
+		{"other 1.2", "CONNECTED\nversion:1.2\nserver:other/1.0\n\n\x00", BrokerUnknown,
+			Capabilities{true, false, true, false}},
+		{"activemq 1.0", "CONNECTED\nserver:ActiveMQ/5.15.0\n\n\x00", BrokerActiveMQ,
+			Capabilities{false, true, true, false}},
+		{"artemis 1.2", "CONNECTED\nversion:1.2\nserver:ActiveMQ-Artemis/2.4.0\n\n\x00", BrokerArtemis,
+			Capabilities{true, true, true, false}},
+		{"apollo 1.1", "CONNECTED\nversion:1.1\nserver:apache-apollo/1.7.1\n\n\x00", BrokerApollo,
+			Capabilities{true, true, true, false}},
+		{"rabbitmq 1.2", "CONNECTED\nversion:1.2\nserver:RabbitMQ/3.6.10\n\n\x00", BrokerRabbitMQ,
+			Capabilities{true, true, true, true}},
+	}
+)
+
+//=============================================================================
+//= capabilities_test const ===================================================
+//=============================================================================
+const (
+// None at present.
+)
+
+//=============================================================================
+//= charset_test type =========================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= charset_test var ==========================================================
+//=============================================================================
+var (
+	// Charsets, strings, and supplied content-type, for round trips
+	charsetList = []struct {
+		cs   Charset
+		s    string
+		ct   string
+		want string // Sent content-type
+	}{
+		{CharsetUTF16LE, "Grüße, 世界", "", "text/plain; charset=UTF-16LE"},
+		{CharsetUTF16, "Grüße", "application/xml; charset=UTF-8", "application/xml; charset=UTF-16"},
+		{CharsetUTF16BE, "abc", "", "text/plain; charset=UTF-16BE"},
+		{CharsetLatin1, "Grüße", "text/plain", "text/plain; charset=ISO-8859-1"},
+	}
+)
+
+//=============================================================================
+//= charset_test const ========================================================
+//=============================================================================
+const (
+// None at present.
+)
+
+//=============================================================================
+//= clock_test type ===========================================================
+//=============================================================================
+type (
+	fakeClock struct {
+		ns int64 // Current reading, ns, atomic
+	}
+)
+
+//=============================================================================
+//= clock_test var ============================================================
+//=============================================================================
+var (
+// None at present.
+)
+
+//=============================================================================
+//= clock_test const ==========================================================
+//=============================================================================
+const (
+// None at present.
+)
+
+//=============================================================================
+//= clone_test type ===========================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= clone_test var ============================================================
+//=============================================================================
+var (
+	cloneLabels        = map[string]string{"tenant": "t1", "app": "clone"} // SetLabels
+	cloneRedialHeaders = Headers{HK_ACCEPT_VERSION, SPL_12, HK_HOST, "localhost",
+		HK_LOGIN, "guest", HK_PASSCODE, "guest"} // Redial CONNECT headers
+)
+
+//=============================================================================
+//= clone_test const ==========================================================
+//=============================================================================
+const (
+	cloneSubChanCap = 7           // SetSubChanCap
+	cloneBudget     = 5000        // SetReadByteBudget
+	cloneTimers     = time.Hour   // Idle timeout and read watchdog
+	cloneDeadline   = time.Second // Read and write deadlines
+	cloneRateLimit  = 100         // SetSendRateLimit, per second
+	cloneRateBurst  = 10          // SetSendRateLimit, burst
+)
+
+//=============================================================================
+//= codec_frame_test type =====================================================
+//=============================================================================
+type (
+	testCodec struct {
+		lk sync.Mutex
+		nr int // frames read
+		nw int // frames written
+	}
+)
+
+//=============================================================================
+//= codec_frame_test var ======================================================
+//=============================================================================
+var (
+	frameCodecMsg = "MESSAGE\ndestination:/queue/fc\nsubscription:fc1\nmessage-id:fc-m1\n\nfc body\x00"
+)
+
+//=============================================================================
+//= codec_frame_test const ====================================================
+//=============================================================================
+const (
+	frameCodecHeader = "x-test-codec"
+)
+
 //=============================================================================
 //= codec_test type ===========================================================
 //=============================================================================
@@ -88,160 +432,654 @@ var (
 )
 
 //=============================================================================
-//= codec_test const ==========================================================
+//= codec_test const ==========================================================
+//=============================================================================
+const (
+// None at present.
+)
+
+//=============================================================================
+//= connbv_test type ==========================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= connbv_test var ===========================================================
+//=============================================================================
+var (
+// None at present.
+)
+
+//=============================================================================
+//= connbv_test const =========================================================
+//=============================================================================
+const (
+// None at present.
+)
+
+//=============================================================================
+//= conndisc_test type ========================================================
+//=============================================================================
+type (
+	frameData struct {
+		data string
+		resp error
+	}
+	verData struct {
+		ch Headers // Client headers
+		sh Headers // Server headers
+		e  error   // Expected error
+	}
+)
+
+//=============================================================================
+//= conndisc_test var =========================================================
+//=============================================================================
+var (
+	anonConnectHeaders = []Headers{
+		{HK_ACCEPT_VERSION, SPL_12, HK_HOST, "localhost"},
+		{HK_ACCEPT_VERSION, SPL_12, HK_HOST, "localhost", HK_LOGIN, "",
+			HK_PASSCODE, ""},
+		{HK_ACCEPT_VERSION, SPL_12, HK_HOST, "localhost", HK_PASSCODE, ""},
+	}
+	fakeConnectRejected = "ERROR\nmessage:login failed\n\nbad credentials\x00"
+	frames              = []frameData{ // Many are possible but very unlikely
+		{"EBADFRM", EBADFRM},
+		{"EUNKFRM\n\n\x00", EUNKFRM},
+		{"ERROR\n\n\x00", nil},
+		{"ERROR\n\x00", EBADFRM},
+		{"ERROR\n\n", EBADFRM},
+		{"ERROR\nbadconhdr\n\n\x00", EUNKHDR},
+		{"ERROR\nbadcon:badmsg\n\n\x00", nil},
+		{"ERROR\nbadcon:badmsg\n\nbad message\x00", nil},
+		{"CONNECTED\n\n\x00", nil},
+		{"CONNECTED\n\nconnbody\x00", EBDYDATA},
+		{"CONNECTED\n\nconnbadbody", EBDYDATA},
+		{"CONNECTED\nk1:v1\nk2:v2\n\nconnbody\x00", EBDYDATA},
+		{"CONNECTED\nk1:v1\nk2:v2\n\nconnbody", EBDYDATA},
+		{"CONNECTED\nk1:v1\nk2:v2\n\n\x00", nil},
+	}
+	verChecks = []verData{
+		{Headers{HK_ACCEPT_VERSION, SPL_11}, Headers{HK_VERSION, SPL_11}, nil},
+		{Headers{}, Headers{}, nil},
+		{Headers{HK_ACCEPT_VERSION, "1.0,1.1,1.2"}, Headers{HK_VERSION, SPL_12}, nil},
+		{Headers{HK_ACCEPT_VERSION, "1.3"}, Headers{HK_VERSION, "1.3"}, EBADVERSVR},
+		{Headers{HK_ACCEPT_VERSION, "1.3"}, Headers{HK_VERSION, "1.1"}, EBADVERCLI},
+		{Headers{HK_ACCEPT_VERSION, "1.0,1.1,1.2"}, Headers{}, nil},
+	}
+)
+
+//=============================================================================
+//= conndisc_test const =======================================================
+//=============================================================================
+const (
+	discConfTmo = 200 * time.Millisecond // DisconnectConfirmed timeout
+)
+
+//=============================================================================
+//= connopts_test type ========================================================
+//=============================================================================
+type (
+	minProtoData struct {
+		minp    string
+		headers Headers
+		offer   string
+		errval  error
+	}
+)
+
+//=============================================================================
+//= connopts_test var =========================================================
+//=============================================================================
+var (
+	minProtoList = []minProtoData{
+		{SPL_12, Headers{HK_ACCEPT_VERSION, "1.0,1.1,1.2"}, SPL_12, nil},
+		{SPL_11, Headers{HK_ACCEPT_VERSION, "1.0,1.1,1.2"}, "1.1,1.2", nil},
+		{SPL_10, Headers{HK_ACCEPT_VERSION, "1.0,1.1"}, "1.0,1.1", nil},
+		{SPL_12, Headers{HK_ACCEPT_VERSION, "1.0,1.1"}, "", EBADVERCLI},
+		{SPL_11, Headers{}, "", EBADVERCLI},
+		{"9.9", Headers{HK_ACCEPT_VERSION, SPL_12}, "", EBADVERCLI},
+	}
+
+	connHdrConflictList = []Headers{
+		{HK_ACCEPT_VERSION, SPL_11},
+		{HK_HEART_BEAT, "0,0"},
+		{HK_RECEIPT, "r1"},
+		{"client-id", "app1", HK_HOST, "otherhost"},
+	}
+
+	fakeRawMessage = "MESSAGE\ndestination:/queue/raw\nsubscription:raw1\nmessage-id:m1\nk:a\\cb\\nc\n\nraw\x00"
+)
+
+//=============================================================================
+//= connopts_test const =======================================================
+//=============================================================================
+const (
+	handshakeTmo = 100 * time.Millisecond // Handshake timeout
+)
+
+//=============================================================================
+//= contentlen_test type ======================================================
+//=============================================================================
+type (
+	contentLenData struct {
+		name  string
+		frame string
+	}
+)
+
+//=============================================================================
+//= contentlen_test var =======================================================
+//=============================================================================
+var (
+	contentLenList = []contentLenData{
+		{"too short",
+			"MESSAGE\ndestination:/queue/cl\nsubscription:cl1\nmessage-id:m1\ncontent-length:3\n\nabcdef\x00"},
+		{"too long",
+			"MESSAGE\ndestination:/queue/cl\nsubscription:cl1\nmessage-id:m1\ncontent-length:8\n\nabc\x00" +
+				"MESSAGE\ndestination:/queue/cl\nsubscription:cl1\nmessage-id:m2\n\nnext\x00"},
+		{"negative",
+			"MESSAGE\ndestination:/queue/cl\nsubscription:cl1\nmessage-id:m1\ncontent-length:-1\n\nabc\x00"},
+		{"zero with body",
+			"MESSAGE\ndestination:/queue/cl\nsubscription:cl1\nmessage-id:m1\ncontent-length:0\n\nabc\x00"},
+	}
+	// Heartbeats (LF and CRLF) interleaved with frames, some of which have
+	// empty bodies, or bodies that are only EOLs.
+	contentLenHBStream = "\n\r\n\n" +
+		"MESSAGE\r\ndestination:/queue/cl\r\nsubscription:cl1\r\nmessage-id:m1\r\ncontent-length:0\r\n\r\n\x00" +
+		"\n\n" +
+		"MESSAGE\ndestination:/queue/cl\nsubscription:cl1\nmessage-id:m2\ncontent-length:1\n\n\n\x00" +
+		"\r\n" +
+		"MESSAGE\ndestination:/queue/cl\nsubscription:cl1\nmessage-id:m3\n\n\x00\n" +
+		"MESSAGE\ndestination:/queue/cl\nsubscription:cl1\nmessage-id:m4\n\n\nbody\n\x00" +
+		"\n"
+	contentLenHBBodies = []string{"", "\n", "", "\nbody\n"}
+)
+
+//=============================================================================
+//= contentlen_test const =====================================================
+//=============================================================================
+const (
+// None at present.
+)
+
+//=============================================================================
+//= data_test type ============================================================
+//=============================================================================
+type (
+	redelData struct {
+		h  Headers
+		r  bool // Redelivered
+		ok bool // Header present
+	}
+	redelCountData struct {
+		h   Headers
+		srv string // Broker "server" header
+		n   int    // Message.RedeliveryCount
+		ok  bool
+		cn  int // Connection.RedeliveryCount
+		cok bool
+	}
+)
+
+//=============================================================================
+//= data_test var =============================================================
+//=============================================================================
+var (
+	suptests = []supdata{
+		{SPL_10, true},
+		{SPL_11, true},
+		{SPL_12, true},
+		{"1.3", false},
+		{"2.0", false},
+		{"2.1", false},
+	}
+	metaMessage = Message{Command: MESSAGE,
+		Headers: Headers{HK_DESTINATION, "/queue/meta", HK_SUBSCRIPTION, "meta1",
+			HK_MESSAGE_ID, "m1", HK_CONTENT_TYPE, "text/plain",
+			HK_TIMESTAMP, "1500000000123"}}
+	redelList = []redelData{
+		{Headers{}, false, false},
+		{Headers{HK_REDELIVERED, "true"}, true, true},
+		{Headers{HK_REDELIVERED, "false"}, false, true},
+		{Headers{HK_REDELIVERED, "maybe"}, false, false},
+		{Headers{"redeliveries", "0"}, false, true},
+		{Headers{"redeliveries", "2"}, true, true},
+		{Headers{"JMSXDeliveryCount", "1"}, false, true},
+		{Headers{"JMSXDeliveryCount", "2"}, true, true},
+	}
+	redelCountList = []redelCountData{
+		{Headers{}, "", 0, false, 0, false},
+		{Headers{HK_REDELIVERED, "true"}, "ActiveMQ/5.15.0", 1, true, 1, true},
+		{Headers{HK_REDELIVERED, "false"}, "ActiveMQ/5.15.0", 0, true, 0, true},
+		{Headers{"redeliveries", "3"}, "apache-apollo/1.7.1", 3, true, 3, true},
+		{Headers{"redeliveries", "3"}, "RabbitMQ/3.8.0", 3, true, 0, false},
+		{Headers{"JMSXDeliveryCount", "1"}, "ActiveMQ-Artemis/2.4.0", 0, true, 0, true},
+		{Headers{"JMSXDeliveryCount", "4"}, "ActiveMQ-Artemis/2.4.0", 3, true, 3, true},
+		{Headers{"x-delivery-count", "2", HK_REDELIVERED, "true"}, "RabbitMQ/3.8.0", 2, true, 2, true},
+		{Headers{"x-redelivery-count", "7"}, "", 7, true, 7, true},
+		{Headers{"x-redelivery-count", "bad"}, "", 0, false, 0, false},
+	}
+)
+
+//=============================================================================
+//= data_test const ===========================================================
+//=============================================================================
+const (
+// None at present.
+)
+
+//=============================================================================
+//= deadletter_test type ======================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= deadletter_test var =======================================================
+//=============================================================================
+var (
+	// A redelivered MESSAGE, dead lettered once before
+	fakeDeadLetterMessage = "MESSAGE\ndestination:/queue/orders\nsubscription:dlq1\nmessage-id:m7\nack:a7\n" +
+		"x-redelivery-count:5\nsng_dlq_reason:old\ncontent-type:text/plain\n\npoison\x00"
+)
+
+//=============================================================================
+//= deadletter_test const =====================================================
+//=============================================================================
+const (
+	deadLetterQueue = "/queue/DLQ.orders" // Dead letter destination
+)
+
+//=============================================================================
+//= decoder_test type =========================================================
+//=============================================================================
+type (
+	// Custom decoded type
+	decoderPoint struct {
+		x, y int
+	}
+)
+
+//=============================================================================
+//= decoder_test var ==========================================================
+//=============================================================================
+var (
+	// Content types, bodies, and expected decoded values
+	decoderList = []struct {
+		ct   string
+		body string
+		want interface{}
+	}{
+		{"application/json", `{"k":"v"}`, map[string]interface{}{"k": "v"}},
+		{"Application/JSON; charset=utf-8", `{"n":1}`, map[string]interface{}{"n": float64(1)}},
+		{decoderPointType, "3,4", decoderPoint{3, 4}},
+		{"text/plain", "raw", []byte("raw")},
+		{"", "none", []byte("none")},
+	}
+)
+
+//=============================================================================
+//= decoder_test const ========================================================
+//=============================================================================
+const (
+	decoderPointType = "application/x-point" // Custom type content-type
+)
+
+//=============================================================================
+//= destination_test type =====================================================
+//=============================================================================
+type (
+	destPrefixData struct {
+		dest   string
+		errval error
+	}
+)
+
+//=============================================================================
+//= destination_test var ======================================================
+//=============================================================================
+var (
+	destPrefixList = []destPrefixData{
+		{"/queue/a", nil},
+		{"/topic/a.b", nil},
+		{"/exchange/amq.direct/k", nil},
+		{"/temp-queue/t1", nil},
+		{"/queue/", EBADDEST},
+		{"/qeueu/a", EBADDEST},
+		{"queue/a", EBADDEST},
+		{"", EBADDEST},
+	}
+)
+
+//=============================================================================
+//= destination_test const ====================================================
+//=============================================================================
+const (
+// None at present.
+)
+
+//=============================================================================
+//= dial_test type ============================================================
+//=============================================================================
+type (
+	dialNetworkData struct {
+		netw string
+		want string
+		e    error
+	}
+	dialHostData struct {
+		addr string
+		h    Headers
+		want string // Expected host, "" means none
+	}
+)
+
+//=============================================================================
+//= dial_test var =============================================================
+//=============================================================================
+var (
+	dialReceiptHeaders = Headers{HK_ACCEPT_VERSION, SPL_12, HK_HOST, "localhost",
+		HK_RECEIPT, "connect-r1"} // Receipt not allowed on CONNECT
+	dialNetworkList = []dialNetworkData{
+		{"", NetProtoTCP, nil},
+		{NetProtoTCP, NetProtoTCP, nil},
+		{NetProtoTCP4, NetProtoTCP4, nil},
+		{NetProtoTCP6, NetProtoTCP6, nil},
+		{"udp", "", EBADNET},
+		{"tcp5", "", EBADNET},
+		{NetProtoUnix, "", EBADNET},
+	}
+	dialHostList = []dialHostData{
+		{"broker.example.com:61613", Headers{HK_ACCEPT_VERSION, SPL_12}, "broker.example.com"},
+		{"127.0.0.1:61613", Headers{HK_ACCEPT_VERSION, "1.0,1.1"}, "127.0.0.1"},
+		{"[::1]:61613", Headers{HK_ACCEPT_VERSION, SPL_11}, "::1"},
+		{"broker.example.com:61613", Headers{HK_ACCEPT_VERSION, SPL_12,
+			HK_HOST, "vhost1"}, "vhost1"},
+		{"broker.example.com:61613", Headers{HK_ACCEPT_VERSION, SPL_10}, ""},
+		{"broker.example.com:61613", Headers{}, ""},
+		{"broker.example.com", Headers{HK_ACCEPT_VERSION, SPL_12}, ""},
+	}
+	dialRetryPolicy = RetryPolicy{Attempts: dialRetryAttempts,
+		Initial: 10 * time.Millisecond, Max: 30 * time.Millisecond}
+	// Unknown host, and no port
+	dialNoHostAddrs = []string{"stompngo.invalid:61613", "127.0.0.1"}
+)
+
+//=============================================================================
+//= dial_test const ===========================================================
+//=============================================================================
+const (
+	dialRetryAttempts = 4 // Connect attempts
+)
+
+//=============================================================================
+//= drain_test type ===========================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= drain_test var ============================================================
+//=============================================================================
+var (
+	fakeDrainMessage = "MESSAGE\ndestination:/queue/drain\nsubscription:drain1\nmessage-id:m1\n\nbuffered\x00"
+	// Message id and ack id from the format argument
+	fakeDrainSubsMessage = "MESSAGE\ndestination:/queue/drain\nsubscription:drain1\nmessage-id:%[1]s\nack:%[1]s\n\nbuffered\x00"
+)
+
+//=============================================================================
+//= drain_test const ==========================================================
+//=============================================================================
+const (
+	drainAfterTime = 50 * time.Millisecond
+	drainSubsShort = 50 * time.Millisecond // Incomplete drain, and no delivery, wait
+)
+
+//=============================================================================
+//= hb_test type ==============================================================
+//=============================================================================
+type (
+	hbrundata struct {
+		testhbl  bool // Run long heartbeat tests
+		testhbvb bool // Verbose long heartbeat tests
+	}
+	hbNegData struct {
+		chb        string   // Client heart-beat header
+		resp       string   // Broker CONNECTED frame
+		cr, sa, ef [2]int64 // Expected requested, advertised, effective
+	}
+)
+
+//=============================================================================
+//= hb_test var ===============================================================
+//=============================================================================
+var (
+	testhbrd = hbrundata{
+		testhbl:  false,
+		testhbvb: false,
+	}
+	hbNegList = []hbNegData{
+		{"100,200", "CONNECTED\nversion:1.2\nheart-beat:300,50\n\n\x00",
+			[2]int64{100, 200}, [2]int64{300, 50}, [2]int64{100, 300}},
+		{"100,0", "CONNECTED\nversion:1.2\nheart-beat:0,0\n\n\x00",
+			[2]int64{100, 0}, [2]int64{0, 0}, [2]int64{0, 0}},
+		{"0,0", "CONNECTED\nversion:1.1\nheart-beat:1000,1000\n\n\x00",
+			[2]int64{0, 0}, [2]int64{1000, 1000}, [2]int64{0, 0}},
+		{"0,100", "CONNECTED\nversion:1.2\n\n\x00",
+			[2]int64{0, 100}, [2]int64{0, 0}, [2]int64{0, 0}},
+		{"100,100", "CONNECTED\nheart-beat:500,500\n\n\x00", // 1.0, none
+			[2]int64{100, 100}, [2]int64{500, 500}, [2]int64{0, 0}},
+	}
+)
+
+//=============================================================================
+//= hb_test const =============================================================
+//=============================================================================
+const (
+	//
+	hbs = 45 // Wait time (secs)
+)
+
+//=============================================================================
+//= hdrlimit_test type ========================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= hdrlimit_test var =========================================================
+//=============================================================================
+var (
+	// Frames repeating a critical header, and the repeated key
+	hdrDupFrames = []struct {
+		frame string
+		key   string
+	}{
+		{MESSAGE + "\ndestination:/queue/dup\nsubscription:dup1\nmessage-id:m1\nmessage-id:m2\n\nbody\x00",
+			HK_MESSAGE_ID},
+		{MESSAGE + "\ndestination:/queue/dup\nsubscription:dup1\nmessage-id:m1\ndestination:/queue/other\n\nbody\x00",
+			HK_DESTINATION},
+		{MESSAGE + "\ndestination:/queue/dup\nsubscription:dup1\nmessage-id:m1\ncontent-length:4\ncontent-length:2\n\nbody\x00",
+			HK_CONTENT_LENGTH},
+	}
+)
+
+//=============================================================================
+//= hdrlimit_test const =======================================================
+//=============================================================================
+const (
+	hdrLimitValueLen = 10000 // Longer than the default read buffer
+)
+
+//=============================================================================
+//= errorframe_test type ======================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= errorframe_test var =======================================================
+//=============================================================================
+var (
+	errFrameMessage = Message{ERROR, Headers{HK_MESSAGE, "bad destination",
+		HK_RECEIPT_ID, "r1", HK_CONTENT_TYPE, "text/plain"},
+		[]byte(errFrameDetail)}
+	errFrameReceipts = []string{"ef-1", "ef:2"} // The second needs 1.2 encoding
+)
+
+//=============================================================================
+//= errorframe_test const =====================================================
+//=============================================================================
+const (
+	errFrameDetail = "destination /bad/x is not allowed\nsee broker log"
+)
+
+//=============================================================================
+//= events_test type ==========================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= events_test var ===========================================================
+//=============================================================================
+var (
+	// Connected state of each expected event, two connections
+	connEventStates = []bool{true, false, true, false}
+)
+
+//=============================================================================
+//= events_test const =========================================================
 //=============================================================================
 const (
-// None at present.
+	connEventLogSize = 3 // Smaller than the events recorded
 )
 
 //=============================================================================
-//= connbv_test type ==========================================================
+//= headers_test type =========================================================
 //=============================================================================
 type (
 // None at present.
 )
 
 //=============================================================================
-//= connbv_test var ===========================================================
+//= headers_test var ==========================================================
 //=============================================================================
 var (
 // None at present.
 )
 
 //=============================================================================
-//= connbv_test const =========================================================
+//= headers_test const ========================================================
 //=============================================================================
 const (
 // None at present.
 )
 
 //=============================================================================
-//= conndisc_test type ========================================================
+//= histogram_test type =======================================================
 //=============================================================================
 type (
-	frameData struct {
-		data string
-		resp error
-	}
-	verData struct {
-		ch Headers // Client headers
-		sh Headers // Server headers
-		e  error   // Expected error
-	}
+// None at present.
 )
 
 //=============================================================================
-//= conndisc_test var =========================================================
+//= histogram_test var ========================================================
 //=============================================================================
 var (
-	frames = []frameData{ // Many are possible but very unlikely
-		{"EBADFRM", EBADFRM},
-		{"EUNKFRM\n\n\x00", EUNKFRM},
-		{"ERROR\n\n\x00", nil},
-		{"ERROR\n\x00", EBADFRM},
-		{"ERROR\n\n", EBADFRM},
-		{"ERROR\nbadconhdr\n\n\x00", EUNKHDR},
-		{"ERROR\nbadcon:badmsg\n\n\x00", nil},
-		{"ERROR\nbadcon:badmsg\n\nbad message\x00", nil},
-		{"CONNECTED\n\n\x00", nil},
-		{"CONNECTED\n\nconnbody\x00", EBDYDATA},
-		{"CONNECTED\n\nconnbadbody", EBDYDATA},
-		{"CONNECTED\nk1:v1\nk2:v2\n\nconnbody\x00", EBDYDATA},
-		{"CONNECTED\nk1:v1\nk2:v2\n\nconnbody", EBDYDATA},
-		{"CONNECTED\nk1:v1\nk2:v2\n\n\x00", nil},
-	}
-	verChecks = []verData{
-		{Headers{HK_ACCEPT_VERSION, SPL_11}, Headers{HK_VERSION, SPL_11}, nil},
-		{Headers{}, Headers{}, nil},
-		{Headers{HK_ACCEPT_VERSION, "1.0,1.1,1.2"}, Headers{HK_VERSION, SPL_12}, nil},
-		{Headers{HK_ACCEPT_VERSION, "1.3"}, Headers{HK_VERSION, "1.3"}, EBADVERSVR},
-		{Headers{HK_ACCEPT_VERSION, "1.3"}, Headers{HK_VERSION, "1.1"}, EBADVERCLI},
-		{Headers{HK_ACCEPT_VERSION, "1.0,1.1,1.2"}, Headers{}, nil},
-	}
+	histBounds = []int64{128, 256}
 )
 
 //=============================================================================
-//= conndisc_test const =======================================================
+//= histogram_test const ======================================================
 //=============================================================================
 const (
 // None at present.
 )
 
 //=============================================================================
-//= data_test type ============================================================
+//= idgen_test type ===========================================================
 //=============================================================================
 type (
 // None at present.
 )
 
 //=============================================================================
-//= data_test var =============================================================
+//= idgen_test var ============================================================
 //=============================================================================
 var (
-	suptests = []supdata{
-		{SPL_10, true},
-		{SPL_11, true},
-		{SPL_12, true},
-		{"1.3", false},
-		{"2.0", false},
-		{"2.1", false},
-	}
+	idGenWant = [][3]string{{SUBSCRIBE, HK_ID, idGenPrefix + "-subscription-1"},
+		{SEND, HK_RECEIPT, idGenPrefix + "-receipt-2"},
+		{BEGIN, HK_TRANSACTION, idGenPrefix + "-transaction-3"}}
 )
 
 //=============================================================================
-//= data_test const ===========================================================
+//= idgen_test const ==========================================================
 //=============================================================================
 const (
-// None at present.
+	idGenPrefix = "svc" // Generated id prefix
 )
 
 //=============================================================================
-//= hb_test type ==============================================================
+//= jms_test type =============================================================
 //=============================================================================
 type (
-	hbrundata struct {
-		testhbl  bool // Run long heartbeat tests
-		testhbvb bool // Verbose long heartbeat tests
+	jmsData struct {
+		bt  BrokerType
+		exp string // Expiration header
+		ttl bool   // Expiration is relative
 	}
 )
 
 //=============================================================================
-//= hb_test var ===============================================================
+//= jms_test var ==============================================================
 //=============================================================================
 var (
-	testhbrd = hbrundata{
-		testhbl:  false,
-		testhbvb: false,
+	jmsList = []jmsData{
+		{BrokerUnknown, "expires", false},
+		{BrokerActiveMQ, "expires", false},
+		{BrokerArtemis, "expires", false},
+		{BrokerApollo, "expires", false},
+		{BrokerRabbitMQ, "expiration", true},
+		{BrokerType(99), "expires", false},
 	}
 )
 
 //=============================================================================
-//= hb_test const =============================================================
+//= jms_test const ============================================================
 //=============================================================================
 const (
-	//
-	hbs = 45 // Wait time (secs)
+// None at present.
 )
 
 //=============================================================================
-//= headers_test type =========================================================
+//= labels_test type ==========================================================
 //=============================================================================
 type (
 // None at present.
 )
 
 //=============================================================================
-//= headers_test var ==========================================================
+//= labels_test var ===========================================================
 //=============================================================================
 var (
-// None at present.
+	labelsTenant    = map[string]string{"tenant": "acme"}
+	labelsTenantApp = map[string]string{"tenant": "acme", "app": "billing"}
 )
 
 //=============================================================================
-//= headers_test const ========================================================
+//= labels_test const =========================================================
 //=============================================================================
 const (
-// None at present.
+	labelsLogText = "{app=billing tenant=acme}"
 )
 
 //=============================================================================
@@ -286,6 +1124,28 @@ const (
 // None at present.
 )
 
+//=============================================================================
+//= multiplex_test type =======================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= multiplex_test var ========================================================
+//=============================================================================
+var (
+	multiplexDests = []string{"/queue/many.a", "/queue/many.b", "/queue/many.c"}
+)
+
+//=============================================================================
+//= multiplex_test const ======================================================
+//=============================================================================
+const (
+	multiplexSources   = 5    // Merged sources
+	multiplexPerSource = 1000 // Messages per source
+)
+
 //=============================================================================
 //= nack_test type ============================================================
 //=============================================================================
@@ -295,6 +1155,15 @@ type (
 		headers Headers
 		errval  Error
 	}
+
+	nackMsgData struct {
+		proto string
+		resp  string
+		ch    Headers
+		mh    Headers
+		want  Headers
+		exe   error
+	}
 )
 
 //=============================================================================
@@ -315,6 +1184,24 @@ var (
 			Headers{HK_DESTINATION, "/queue/a"},
 			EREQIDNAK},
 	}
+
+	nackMsgList = []nackMsgData{
+		{SPL_10, fakeConnected10, Headers{HK_HOST, "localhost"},
+			Headers{HK_MESSAGE_ID, "m1", HK_SUBSCRIPTION, "s1", HK_ACK, "a1"},
+			nil, EBADVERNAK},
+		{SPL_11, fakeConnected11, Headers{HK_ACCEPT_VERSION, SPL_11, HK_HOST, "localhost"},
+			Headers{HK_MESSAGE_ID, "m1", HK_SUBSCRIPTION, "s1", HK_ACK, "a1"},
+			Headers{HK_MESSAGE_ID, "m1", HK_SUBSCRIPTION, "s1"}, nil},
+		{SPL_12, fakeConnected12, fake12Headers,
+			Headers{HK_MESSAGE_ID, "m1", HK_SUBSCRIPTION, "s1", HK_ACK, "a1"},
+			Headers{HK_ID, "a1"}, nil},
+		{SPL_12, fakeConnected12, fake12Headers,
+			Headers{HK_MESSAGE_ID, "m1", HK_SUBSCRIPTION, "s1"},
+			nil, EREQIDNAK},
+		{SPL_12, fakeConnected12, fake12Headers,
+			Headers{HK_MESSAGE_ID, "m1", HK_SUBSCRIPTION, "s1", HK_ACK, ""},
+			nil, EREQIDNAK},
+	}
 )
 
 //=============================================================================
@@ -324,6 +1211,114 @@ const (
 // None at present.
 )
 
+//=============================================================================
+//= ordered_test type =========================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= ordered_test var ==========================================================
+//=============================================================================
+var (
+// None at present.
+)
+
+//=============================================================================
+//= ordered_test const ========================================================
+//=============================================================================
+const (
+	orderedSendCount = 10 // Concurrent ordered senders
+)
+
+//=============================================================================
+//= receipts_test type ========================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= receipts_test var =========================================================
+//=============================================================================
+var (
+// None at present.
+)
+
+//=============================================================================
+//= receipts_test const =======================================================
+//=============================================================================
+const (
+	rcptMaxPending = 3 // Pending receipt limit
+)
+
+//=============================================================================
+//= routing_test type =========================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= routing_test var ==========================================================
+//=============================================================================
+var (
+	routingFrames = "MESSAGE\ndestination:/queue/route\nsubscription:rt1\n" +
+		"message-id:m1\n\nsub\x00" +
+		"MESSAGE\ndestination:/queue/route\nsubscription:nosuch\n" +
+		"message-id:m2\n\nlost\x00" +
+		"RECEIPT\nreceipt-id:un1\n\n\x00" +
+		"ERROR\nmessage:e1\n\n\x00" +
+		"RECEIPT\nreceipt-id:end1\n\n\x00"
+	routingSinkOrder = [][3]string{{RECEIPT, HK_RECEIPT_ID, "un1"},
+		{ERROR, HK_MESSAGE, "e1"}, {RECEIPT, HK_RECEIPT_ID, "end1"}}
+	routingErrorFrames = "ERROR\nmessage:e2\n\n\x00" +
+		"RECEIPT\nreceipt-id:end2\n\n\x00"
+)
+
+//=============================================================================
+//= routing_test const ========================================================
+//=============================================================================
+const (
+// None at present.
+)
+
+//=============================================================================
+//= selector_test type ========================================================
+//=============================================================================
+type (
+	selectorData struct {
+		s string
+		e error
+	}
+)
+
+//=============================================================================
+//= selector_test var =========================================================
+//=============================================================================
+var (
+	selectorList = []selectorData{
+		{selectorGood, nil},
+		{"a = 'it''s'", nil},
+		{"b = \"(\"", nil},
+		{"", ESELSYN},
+		{"   ", ESELSYN},
+		{"a = 'b", ESELSYN},
+		{"(a = 1", ESELSYN},
+		{"a = 1)", ESELSYN},
+		{")a = 1(", ESELSYN},
+	}
+	fakeSelectorErrorFrame = "ERROR\nreceipt-id:sel-r1\nmessage:bad selector\n\n\x00"
+)
+
+//=============================================================================
+//= selector_test const =======================================================
+//=============================================================================
+const (
+	selectorGood = "(priority > 4 OR urgent = 'yes') AND region = 'eu'"
+)
+
 //=============================================================================
 //= send_test type ============================================================
 //=============================================================================
@@ -342,7 +1337,7 @@ var (
 //= send_test const ===========================================================
 //=============================================================================
 const (
-// None at present.
+	sendRaceSenders = 8
 )
 
 // send_test END
@@ -359,16 +1354,77 @@ type (
 //= sendbytes_test var ========================================================
 //=============================================================================
 var (
-// None at present.
+	noCloneHeaders = Headers{HK_DESTINATION, "/queue/noclone",
+		"x-key", "a:b\nc"} // Needs 1.2 encoding
 )
 
 //=============================================================================
 //= sendbytes_test const ======================================================
 //=============================================================================
 const (
+	sendFutureCount = 5
+	sendAckTimeout  = 100 * time.Millisecond // No verdict wait
+	noCloneSenders  = 4                      // Concurrent SendBytesNoClone callers
+	noCloneSends    = 8                      // Sends per caller
+	noCloneEncoded  = "a\\cb\\nc"            // x-key on the wire
+)
+
+//=============================================================================
+//= stats_test type ===========================================================
+//=============================================================================
+type (
 // None at present.
 )
 
+//=============================================================================
+//= stats_test var ============================================================
+//=============================================================================
+var (
+	statsLabels = map[string]string{"tenant": "acme", "app": "billing"}
+	statsKeys   = []string{"schema", "session", "protocol", "connected",
+		"uptime_ms", "frames_read", "bytes_read", "frames_written",
+		"bytes_written", "heartbeats", "subscription_count", "subscriptions",
+		"read_sizes", "write_sizes", "labels"}
+)
+
+//=============================================================================
+//= stats_test const ==========================================================
+//=============================================================================
+const (
+	statsSends = 50 // SENDs made while MetricsJSON runs
+)
+
+//=============================================================================
+//= stream_test type ==========================================================
+//=============================================================================
+type (
+	streamData struct {
+		pos StreamPosition
+		v   string // Header value
+	}
+)
+
+//=============================================================================
+//= stream_test var ===========================================================
+//=============================================================================
+var (
+	streamList = []streamData{
+		{StreamFirst, "first"},
+		{StreamLast, "last"},
+		{StreamOffset(0), "offset=0"},
+		{StreamOffset(5000), "offset=5000"},
+		{StreamTimestamp(time.Unix(1500000000, 999)), "timestamp=1500000000"},
+	}
+)
+
+//=============================================================================
+//= stream_test const =========================================================
+//=============================================================================
+const (
+	fakeConnectedRabbit = "CONNECTED\nversion:1.2\nserver:RabbitMQ/3.8.0\n\n\x00"
+	streamHeader        = "x-stream-offset"
+)
+
 //=============================================================================
 //= sub_test type =============================================================
 //=============================================================================
@@ -404,6 +1460,12 @@ type (
 		subh  Headers
 		exe   error
 	}
+
+	validAckModeData struct {
+		mode  string
+		proto string
+		want  bool
+	}
 )
 
 //=============================================================================
@@ -524,15 +1586,70 @@ var (
 				HK_ACK, badam},
 			ESBADAM},
 	}
+
+	validAckModeList = []validAckModeData{
+		{AckModeAuto, SPL_10, true},
+		{AckModeClient, SPL_10, true},
+		{AckModeClientIndividual, SPL_10, false},
+		{AckModeAuto, SPL_11, true},
+		{AckModeClient, SPL_11, true},
+		{AckModeClientIndividual, SPL_11, true},
+		{AckModeAuto, SPL_12, true},
+		{AckModeClient, SPL_12, true},
+		{AckModeClientIndividual, SPL_12, true},
+		{"badam", SPL_12, false},
+		{AckModeAuto, "9.9", false},
+	}
 )
 
 //=============================================================================
 //= sub_test const ============================================================
 //=============================================================================
 const (
+	subChurnWorkers = 8                     // Concurrent subscribers
+	subChurnIters   = 100                   // Subscribe / unsubscribe cycles per worker
+	subChurnIds     = 4                     // Shared subscription ids, so Subscribes collide
+	subChurnGap     = 50 * time.Microsecond // Between MESSAGE frames
+)
+
+//=============================================================================
+//= subscription_test type ====================================================
+//=============================================================================
+type (
 // None at present.
 )
 
+//=============================================================================
+//= subscription_test var =====================================================
+//=============================================================================
+var (
+	fakeSubErrorFrame = "ERROR\nreceipt-id:sub-r1\nmessage:bad destination\n\n\x00"
+	// Subscription id, message number, message number
+	fakeCollectMsg = "MESSAGE\ndestination:/queue/coll\nsubscription:%s\nmessage-id:m%d\nack:a%d\n\ncoll\x00"
+	// Ack mode to ACK ids expected from CollectAck of subCollectMsgs messages
+	// Log text expected only in the subscription, and connection, logs
+	subLoggerOnly  = []string{"sub=lg1", "RDR_DELIVER", "close start lg1", "[ACK start"}
+	connLoggerOnly = []string{"close start lg2"}
+	collectAckIds  = map[string][]string{
+		AckModeAuto:             nil,
+		AckModeClient:           {"a2"},
+		AckModeClientIndividual: {"a0", "a1", "a2"},
+	}
+)
+
+//=============================================================================
+//= subscription_test const ===================================================
+//=============================================================================
+const (
+	subCloseCount  = 20                     // Concurrent Close calls
+	subReplaySize  = 2                      // Replay buffer size
+	subCredits     = 2                      // Delivery credits per Request
+	subCreditMsgs  = 5                      // Messages sent
+	subConfTmo     = 5 * time.Second        // SubscribeConfirmed timeout
+	subCollectMsgs = 3                      // Messages sent for Collect
+	subCollectTmo  = 100 * time.Millisecond // Collect timeout
+)
+
 //=============================================================================
 //= suppress_test type ========================================================
 //=============================================================================
@@ -581,6 +1698,27 @@ var (
 			true,
 		},
 	}
+	tsctConnData = []struct {
+		sct    bool
+		ct     string // Caller supplied content-type
+		wanted string
+	}{
+		{false, "", DFLT_CONTENT_TYPE},
+		{true, "", ""},
+		{true, "application/json", "application/json"},
+	}
+	tsctDefaultData = []struct {
+		dct    string // Connection default content-type
+		sct    bool
+		ct     string // Caller supplied content-type
+		wanted string
+	}{
+		{"application/json", false, "", "application/json"},
+		{"application/json", false, "text/xml", "text/xml"},
+		{"application/json", true, "", ""},
+		{"", false, "", ""},
+		{"", false, "text/xml", "text/xml"},
+	}
 )
 
 //=============================================================================
@@ -705,6 +1843,28 @@ const (
 // None at present.
 )
 
+//=============================================================================
+//= txstate_test type =========================================================
+//=============================================================================
+type (
+// None at present.
+)
+
+//=============================================================================
+//= txstate_test var ==========================================================
+//=============================================================================
+var (
+	txSendHeaders = Headers{HK_DESTINATION, "/queue/tx"} // Transaction SEND headers
+	txBodies      = []string{"tx one", "tx two"}         // Transaction SEND bodies
+)
+
+//=============================================================================
+//= txstate_test const ========================================================
+//=============================================================================
+const (
+// None at present.
+)
+
 //=============================================================================
 //= unsub_test type ===========================================================
 //=============================================================================
@@ -845,13 +2005,32 @@ type (
 		mpref string      // message prefix
 		count int         // number of messages
 	}
+	fakeBroker struct {
+		sn     net.Conn      // server side network connection
+		rdr    *bufio.Reader // server side reader
+		wlk    sync.Mutex    // server side write lock
+		frames chan Frame    // frames received from the client
+		arcpt  bool          // automatically answer receipt requests
+		done   chan struct{} // closed when the fake broker ends
+	}
+	shortConn struct {
+		net.Conn
+		lk    sync.Mutex
+		armed bool // next large write is short
+		chunk int  // bytes actually written by a short write
+	}
+	timeoutError struct{}
 )
 
 //=============================================================================
 //= utils_test var ============================================================
 //=============================================================================
 var (
-// None at present.
+	fakeConnected10 = "CONNECTED\n\n\x00"
+	fakeConnected11 = "CONNECTED\nversion:1.1\n\n\x00"
+	fakeConnected12 = "CONNECTED\nversion:1.2\n\n\x00"
+	fake12Headers   = Headers{HK_ACCEPT_VERSION, SPL_12, HK_HOST, "localhost"}
+	fakeErrorFrame  = "ERROR\nmessage:bad frame\ncontent-length:6\n\ndetail\x00"
 )
 
 //=============================================================================
@@ -900,7 +2079,12 @@ const (
 //= deadline_test type ========================================================
 //=============================================================================
 type (
-// None at present.
+	slowConn struct {
+		net.Conn
+		lk    sync.Mutex
+		delay time.Duration // Added to each write
+		dl    time.Time     // Current write deadline
+	}
 )
 
 //=============================================================================
@@ -908,13 +2092,17 @@ type (
 //=============================================================================
 var (
 	wdleInit = false // Enabled just after init
+	// A MESSAGE frame with the body cut short
+	fakeFrameIdleStall = "MESSAGE\ndestination:/queue/idle\nsubscription:idle1\nmessage-id:stall\ncontent-length:10\n\nabc"
 )
 
 //=============================================================================
 //= deadline_test const =======================================================
 //=============================================================================
 const (
-// None at present.
+	frameIdleTimeout = 100 * time.Millisecond // Per frame read timeout
+	frameIdleGap     = 40 * time.Millisecond  // Gap between frames, under the timeout
+	frameIdleCount   = 5                      // Frames sent with gaps
 )
 
 //=============================================================================
@@ -22,8 +22,5 @@ package stompngo
 func (c *Connection) transmitCommon(v string, h Headers) error {
 	ch := h.Clone()
 	f := Frame{v, ch, NULLBUFF}
-	r := make(chan error)
-	c.output <- wiredata{f, r}
-	e := <-r
-	return e
+	return c.wireSend(f, 0)
 }
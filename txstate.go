@@ -0,0 +1,247 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+/*
+	TxSnapshot is the client side state of a transaction begun, and not yet
+	committed or aborted, on a connection.  It holds the BEGIN headers and,
+	with WithTxFrames, the SEND frames sent in the transaction so far.
+
+	It marshals with encoding/json, so it can be saved for crash recovery of
+	transactional producers, and replayed with ReplayTx on a new connection.
+*/
+type TxSnapshot struct {
+	Id     string  `json:"id"`               // Transaction id
+	Begin  Headers `json:"begin"`            // BEGIN headers
+	Frames []Frame `json:"frames,omitempty"` // SEND frames, in send order
+}
+
+/*
+	Transaction aborted by reconnect callback, see OnTxAborted.
+*/
+type TxAborted func(c *Connection, s TxSnapshot)
+
+/*
+	WithTxFrames records the SEND frames of each open transaction, so that
+	TxSnapshot includes them and ReplayTx can resend them.  Frames are held
+	until the transaction is committed or aborted, so large transactions
+	use memory in proportion.  Without it only transaction ids and BEGIN
+	headers are recorded.
+*/
+func WithTxFrames() ConnectOption {
+	return func(o *connectOptions) {
+		o.txfr = true
+	}
+}
+
+/*
+	TxSnapshot returns copies of the open transactions, in BEGIN order.  It
+	remains available after the connection is lost.
+
+	Example:
+		b, e := json.Marshal(c.TxSnapshot())
+		if e != nil {
+			// Do something sane ...
+		}
+		// Save b ...
+*/
+func (c *Connection) TxSnapshot() []TxSnapshot {
+	c.txLock.Lock()
+	defer c.txLock.Unlock()
+	return copyTxSnapshots(c.txop)
+}
+
+/*
+	OnTxAborted sets a callback for transactions lost with a previous
+	connection.  When a connection is made with CloneSettings options, or by
+	Redial, from a connection that is no longer connected, any transaction
+	still open on the old connection has been discarded by the broker.  Each
+	is aborted on the new connection, and the callback invoked with the new
+	connection and the transaction state, once connected, before Connect
+	returns.
+
+	No ABORT frame is sent, since the broker does not know the transaction.
+	Instead a SEND or COMMIT for the transaction id on the new connection
+	returns ETXABRT, rather than completing part of a transaction, and an
+	ABORT does nothing.  The callback may restore the transaction with
+	ReplayTx.
+
+	The callback is copied by CloneSettings.
+
+	Example:
+		c.OnTxAborted(func(nc *stompngo.Connection, s stompngo.TxSnapshot) {
+			if e := nc.ReplayTx(s); e != nil {
+				// Do something sane ...
+			}
+		})
+*/
+func (c *Connection) OnTxAborted(f TxAborted) {
+	c.cbLock.Lock()
+	c.txah = f
+	c.cbLock.Unlock()
+}
+
+/*
+	ReplayTx begins the transaction s again on this connection, with the
+	same BEGIN headers, and resends any recorded SEND frames.  The
+	transaction is then open, for the caller to Commit or Abort as usual.
+	A transaction aborted by reconnect, see OnTxAborted, may be used again
+	once replayed.  EBADFRM is returned, and the rest of s is not sent, for
+	a frame that is not a SEND in the transaction.
+*/
+func (c *Connection) ReplayTx(s TxSnapshot) error {
+	c.log("REPLAYTX", "start", s.Id, len(s.Frames))
+	c.txLock.Lock()
+	delete(c.txab, s.Id)
+	c.txLock.Unlock()
+	if e := c.Begin(s.Begin); e != nil {
+		return e
+	}
+	for _, f := range s.Frames {
+		if f.Command != SEND || f.Headers.Value(HK_TRANSACTION) != s.Id {
+			return EBADFRM
+		}
+		rf := Frame{SEND, f.Headers.Clone(), f.Body}
+		if e := c.throttleSend(); e != nil {
+			return e
+		}
+		e := func() error {
+			defer c.orderSend()()
+			return c.wireSend(rf, 0)
+		}()
+		if e != nil {
+			return e
+		}
+		c.txFrame(rf)
+	}
+	c.log("REPLAYTX", "end", s.Id)
+	return nil
+}
+
+/*
+	Copy transaction state.
+*/
+func copyTxSnapshots(ts []*TxSnapshot) []TxSnapshot {
+	if len(ts) == 0 {
+		return nil
+	}
+	r := make([]TxSnapshot, 0, len(ts))
+	for _, t := range ts {
+		s := TxSnapshot{Id: t.Id, Begin: t.Begin.Clone()}
+		for _, f := range t.Frames {
+			s.Frames = append(s.Frames, Frame{f.Command, f.Headers.Clone(),
+				append([]byte{}, f.Body...)})
+		}
+		r = append(r, s)
+	}
+	return r
+}
+
+/*
+	Record a transaction begun.
+*/
+func (c *Connection) txBegun(h Headers) {
+	t := &TxSnapshot{Id: h.Value(HK_TRANSACTION), Begin: h.Clone()}
+	c.txLock.Lock()
+	c.txop = append(c.txop, t)
+	c.txLock.Unlock()
+}
+
+/*
+	Forget a transaction committed or aborted.
+*/
+func (c *Connection) txEnded(id string) {
+	c.txLock.Lock()
+	defer c.txLock.Unlock()
+	delete(c.txab, id)
+	for i, t := range c.txop {
+		if t.Id == id {
+			c.txop = append(c.txop[:i], c.txop[i+1:]...)
+			return
+		}
+	}
+}
+
+/*
+	Check whether a transaction was aborted by reconnect.
+*/
+func (c *Connection) txAborted(id string) bool {
+	if id == "" {
+		return false
+	}
+	c.txLock.Lock()
+	defer c.txLock.Unlock()
+	return c.txab[id]
+}
+
+/*
+	Check a SEND for a transaction aborted by reconnect.
+*/
+func (c *Connection) txCheck(h Headers) error {
+	if c.txAborted(h.Value(HK_TRANSACTION)) {
+		return ETXABRT
+	}
+	return nil
+}
+
+/*
+	Record a SEND frame sent in an open transaction, if frames are recorded.
+*/
+func (c *Connection) txFrame(f Frame) {
+	if !c.copts.txfr {
+		return
+	}
+	id := f.Headers.Value(HK_TRANSACTION)
+	if id == "" {
+		return
+	}
+	c.txLock.Lock()
+	defer c.txLock.Unlock()
+	for _, t := range c.txop {
+		if t.Id == id {
+			t.Frames = append(t.Frames, Frame{f.Command, f.Headers.Clone(),
+				append([]byte{}, f.Body...)})
+			return
+		}
+	}
+}
+
+/*
+	Abort transactions lost with a previous connection, once connected.
+*/
+func (c *Connection) txLost(ts []TxSnapshot) {
+	if len(ts) == 0 {
+		return
+	}
+	c.txLock.Lock()
+	if c.txab == nil {
+		c.txab = make(map[string]bool)
+	}
+	for _, s := range ts {
+		c.txab[s.Id] = true
+	}
+	c.txLock.Unlock()
+	c.cbLock.RLock()
+	f := c.txah
+	c.cbLock.RUnlock()
+	for _, s := range ts {
+		c.log("TX_ABORTED", s.Id)
+		if f != nil {
+			f(c, s)
+		}
+	}
+}
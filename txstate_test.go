@@ -0,0 +1,176 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+/*
+	TxState Test: a transaction open when the connection is lost is aborted
+	on Redial, reported to the callback, and can be replayed from its
+	snapshot.
+*/
+func TestTxStateReconnect(t *testing.T) {
+	l, fbc := listenFakeBroker(t, NetProtoTCP4, "127.0.0.1:0")
+	defer l.Close()
+	c1, e := Dial(l.Addr().String(), fake12Headers, WithNetwork(NetProtoTCP4),
+		WithTxFrames())
+	if e != nil {
+		t.Fatalf("TestTxStateReconnect Expected nil, got <%v>\n", e)
+	}
+	fb1 := <-fbc
+	var lost []TxSnapshot
+	c1.OnTxAborted(func(nc *Connection, s TxSnapshot) {
+		lost = append(lost, s)
+	})
+	tx, e := c1.BeginTx(Headers{})
+	if e != nil {
+		t.Fatalf("TestTxStateReconnect Expected nil, got <%v>\n", e)
+	}
+	for _, b := range txBodies {
+		if e = c1.SendBytesTx(txSendHeaders, []byte(b), tx); e != nil {
+			t.Fatalf("TestTxStateReconnect Expected nil, got <%v>\n", e)
+		}
+	}
+	tc, e := c1.BeginTx(Headers{}) // Committed, not in the snapshot
+	if e != nil {
+		t.Fatalf("TestTxStateReconnect Expected nil, got <%v>\n", e)
+	}
+	if e = c1.Commit(Headers{HK_TRANSACTION, tc}); e != nil {
+		t.Fatalf("TestTxStateReconnect Expected nil, got <%v>\n", e)
+	}
+	ss := c1.TxSnapshot()
+	if len(ss) != 1 || ss[0].Id != tx || len(ss[0].Frames) != len(txBodies) {
+		t.Fatalf("TestTxStateReconnect Expected <%s %d>, got <%+v>\n", tx,
+			len(txBodies), ss)
+	}
+	jb, e := json.Marshal(ss)
+	if e != nil {
+		t.Fatalf("TestTxStateReconnect Expected nil, got <%v>\n", e)
+	}
+	var rs []TxSnapshot
+	if e = json.Unmarshal(jb, &rs); e != nil || !reflect.DeepEqual(rs, ss) {
+		t.Fatalf("TestTxStateReconnect Expected <%+v>, got <%+v %v>\n", ss, rs, e)
+	}
+	for _, w := range []string{CONNECT, BEGIN, SEND, SEND, BEGIN, COMMIT} {
+		if f := fb1.nextFrame(t); f.Command != w {
+			t.Fatalf("TestTxStateReconnect Expected <%v>, got <%v>\n", w, f.Command)
+		}
+	}
+	// Connection lost mid transaction
+	fb1.close()
+	for i := 0; i < 200 && c1.Connected(); i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if c1.Connected() {
+		t.Fatalf("TestTxStateReconnect Expected not connected\n")
+	}
+	fbc2 := make(chan *fakeBroker, 1)
+	go func() {
+		sn, e := l.Accept()
+		if e != nil {
+			close(fbc2)
+			return
+		}
+		fbc2 <- newFakeBroker(sn, fakeConnected12)
+	}()
+	c2, e := c1.Redial()
+	if e != nil {
+		t.Fatalf("TestTxStateReconnect Expected nil, got <%v>\n", e)
+	}
+	fb2 := <-fbc2
+	if len(lost) != 1 || !reflect.DeepEqual(lost[0], ss[0]) {
+		t.Fatalf("TestTxStateReconnect Expected <%+v>, got <%+v>\n", ss, lost)
+	}
+	// Lost transaction use is refused, nothing is sent
+	if e = c2.SendBytesTx(txSendHeaders, []byte("late"), tx); e != ETXABRT {
+		t.Fatalf("TestTxStateReconnect Expected <%v>, got <%v>\n", ETXABRT, e)
+	}
+	if e = c2.Commit(Headers{HK_TRANSACTION, tx}); e != ETXABRT {
+		t.Fatalf("TestTxStateReconnect Expected <%v>, got <%v>\n", ETXABRT, e)
+	}
+	// Replay, then commit
+	if e = c2.ReplayTx(lost[0]); e != nil {
+		t.Fatalf("TestTxStateReconnect Expected nil, got <%v>\n", e)
+	}
+	if e = c2.Commit(Headers{HK_TRANSACTION, tx}); e != nil {
+		t.Fatalf("TestTxStateReconnect Expected nil, got <%v>\n", e)
+	}
+	if ss = c2.TxSnapshot(); len(ss) != 0 {
+		t.Fatalf("TestTxStateReconnect Expected none, got <%+v>\n", ss)
+	}
+	_ = fb2.nextFrame(t) // CONNECT
+	if f := fb2.nextFrame(t); f.Command != BEGIN || f.Headers.Value(HK_TRANSACTION) != tx {
+		t.Fatalf("TestTxStateReconnect Expected <%v %s>, got <%v %v>\n", BEGIN, tx,
+			f.Command, f.Headers)
+	}
+	for _, b := range txBodies {
+		if f := fb2.nextFrame(t); f.Command != SEND || string(f.Body) != b ||
+			f.Headers.Value(HK_TRANSACTION) != tx {
+			t.Fatalf("TestTxStateReconnect Expected <%v %s>, got <%v %v %s>\n", SEND, b,
+				f.Command, f.Headers, f.Body)
+		}
+	}
+	if f := fb2.nextFrame(t); f.Command != COMMIT {
+		t.Fatalf("TestTxStateReconnect Expected <%v>, got <%v>\n", COMMIT, f.Command)
+	}
+	e = c2.Disconnect(NoDiscReceipt)
+	checkDisconnectError(t, e)
+	fb2.close()
+}
+
+/*
+	TxState Test: without WithTxFrames a snapshot has no frames, and ABORT
+	of a transaction aborted by reconnect sends nothing.
+*/
+func TestTxStateNoFrames(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestTxStateNoFrames Expected nil, got <%v>\n", e)
+	}
+	tx, e := c.BeginTx(Headers{})
+	if e != nil {
+		t.Fatalf("TestTxStateNoFrames Expected nil, got <%v>\n", e)
+	}
+	if e = c.SendBytesTx(txSendHeaders, []byte(txBodies[0]), tx); e != nil {
+		t.Fatalf("TestTxStateNoFrames Expected nil, got <%v>\n", e)
+	}
+	ss := c.TxSnapshot()
+	if len(ss) != 1 || ss[0].Id != tx || ss[0].Frames != nil {
+		t.Fatalf("TestTxStateNoFrames Expected <%s no frames>, got <%+v>\n", tx, ss)
+	}
+	c.txLost(ss)
+	if e = c.Abort(Headers{HK_TRANSACTION, tx}); e != nil {
+		t.Fatalf("TestTxStateNoFrames Expected nil, got <%v>\n", e)
+	}
+	if ss = c.TxSnapshot(); len(ss) != 0 {
+		t.Fatalf("TestTxStateNoFrames Expected none, got <%+v>\n", ss)
+	}
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	for _, w := range []string{CONNECT, BEGIN, SEND, DISCONNECT} {
+		if f := fb.nextFrame(t); f.Command != w {
+			t.Fatalf("TestTxStateNoFrames Expected <%v>, got <%v>\n", w, f.Command)
+		}
+	}
+	fb.close()
+}
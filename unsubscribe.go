@@ -16,9 +16,10 @@
 
 package stompngo
 
-//import (
-//	"fmt"
-//)
+import (
+	//	"fmt"
+	"time"
+)
 
 /*
 	Unsubscribe from a STOMP subscription.
@@ -39,14 +40,86 @@ package stompngo
 func (c *Connection) Unsubscribe(h Headers) error {
 	c.log(UNSUBSCRIBE, "start", h)
 	// fmt.Printf("Unsub Headers: %v\n", h)
-	if !c.connected {
-		return ECONBAD
+	usekey, sd, e := c.checkUnsubscribe(h)
+	if e != nil {
+		return e
 	}
-	e := checkHeaders(h, c.Protocol())
+
+	e = c.transmitCommon(UNSUBSCRIBE, h) // transmitCommon Clones() the headers
 	if e != nil {
 		return e
 	}
 
+	// Only the subscription checked is removed, not a new one with the same
+	// id.  A blocked delivery to its channel is abandoned.
+	c.subsLock.Lock()
+	if ps, ok := c.subs[usekey]; ok && ps == sd {
+		c.expireAcks(ps, 0, -1) // Nothing more can be acked
+		c.quitSub(ps)
+		delete(c.subs, usekey)
+	}
+	c.subsLock.Unlock()
+	c.log(UNSUBSCRIBE, "end", h)
+	return nil
+}
+
+/*
+	UnsubscribeReceipt unsubscribes from a STOMP subscription exactly as
+	Unsubscribe does, and waits for the broker RECEIPT confirming the
+	UNSUBSCRIBE was processed.
+
+	A receipt header is added to the UNSUBSCRIBE if the client did not supply
+	one.  Messages already in flight continue to be delivered to the
+	subscription channel until the RECEIPT arrives.  The subscription channel
+	is then closed.
+
+	ERCPTTMO is returned if the RECEIPT does not arrive within the timeout.
+	In that case the subscription is left in place.
+
+	Example:
+		h := stompngo.Headers{stompngo.HK_DESTINATION, "/queue/myqueue",
+			stompngo.HK_ID, "myid"}
+		_, e := c.UnsubscribeReceipt(h, 5*time.Second)
+		if e != nil {
+			// Do something sane ...
+		}
+*/
+func (c *Connection) UnsubscribeReceipt(h Headers, t time.Duration) (MessageData, error) {
+	c.log(UNSUBSCRIBE, "receipt start", h)
+	usekey, sd, e := c.checkUnsubscribe(h)
+	if e != nil {
+		return MessageData{}, e
+	}
+	md, e := c.transmitReceipt(h, t, func(ch Headers) error {
+		return c.transmitCommon(UNSUBSCRIBE, ch)
+	})
+	if e != nil {
+		return md, e
+	}
+
+	c.subsLock.Lock()
+	if ps, ok := c.subs[usekey]; ok && ps == sd {
+		delete(c.subs, usekey)
+	}
+	c.closeSub(sd, nil)
+	c.subsLock.Unlock()
+	c.log(UNSUBSCRIBE, "receipt end", h)
+	return md, nil
+}
+
+/*
+	Check UNSUBSCRIBE specific requirements, and return the key of the
+	subscription to remove, and the subscription.
+*/
+func (c *Connection) checkUnsubscribe(h Headers) (string, *subscription, error) {
+	if !c.Connected() {
+		return "", nil, ECONBAD
+	}
+	e := c.validateHeaders(h)
+	if e != nil {
+		return "", nil, e
+	}
+
 	// Specification Requirements:
 	// 1.0) requires either a destination header or an id header
 	// 1.1) ... requires ... the id header ....
@@ -57,15 +130,15 @@ func (c *Connection) Unsubscribe(h Headers) error {
 	switch c.Protocol() {
 	case SPL_12:
 		if !oki {
-			return EUNOSID
+			return "", nil, EUNOSID
 		}
 	case SPL_11:
 		if !oki {
-			return EUNOSID
+			return "", nil, EUNOSID
 		}
 	case SPL_10:
 		if !oki && !okd {
-			return EUNODSID
+			return "", nil, EUNODSID
 		}
 	default:
 		panic("unsubscribe version not supported: " + c.Protocol())
@@ -73,39 +146,34 @@ func (c *Connection) Unsubscribe(h Headers) error {
 	//
 	shaid := Sha1(h.Value(HK_DESTINATION)) // Special for 1.0
 	c.subsLock.RLock()
-	_, p := c.subs[shid]
-	_, ps := c.subs[shaid]
+	sdi, p := c.subs[shid]
+	sdd, ps := c.subs[shaid]
 	c.subsLock.RUnlock()
 	usekey := ""
+	var sd *subscription
 
 	switch c.Protocol() {
 	case SPL_12:
 		fallthrough
 	case SPL_11:
 		if !oki {
-			return EUNOSID // id required
+			return "", nil, EUNOSID // id required
 		}
 		if !p { // subscription does not exist
-			return EBADSID // invalid subscription-id
+			return "", nil, EBADSID // invalid subscription-id
 		}
-		usekey = shid
+		usekey, sd = shid, sdi
 	case SPL_10:
-		if !p && !ps {
-			return EUNODSID
+		switch {
+		case p: // Client supplied id
+			usekey, sd = shid, sdi
+		case ps:
+			usekey, sd = shaid, sdd
+		default:
+			return "", nil, EUNODSID
 		}
-		usekey = shaid
 	default:
 		panic("unsubscribe version not supported: " + c.Protocol())
 	}
-
-	e = c.transmitCommon(UNSUBSCRIBE, h) // transmitCommon Clones() the headers
-	if e != nil {
-		return e
-	}
-
-	c.subsLock.Lock()
-	delete(c.subs, usekey)
-	c.subsLock.Unlock()
-	c.log(UNSUBSCRIBE, "end", h)
-	return nil
+	return usekey, sd, nil
 }
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync/atomic"
 )
 
 /*
@@ -65,6 +66,24 @@ func readUntilNul(c *Connection) ([]uint8, error) {
 	return b, e
 }
 
+/*
+	A network helper.  Read the body of a frame with "content-length:0",
+	which is only the trailing 'null' byte.  Anything else is a content-length
+	mismatch, and is not read as body data.
+*/
+func readEmptyBody(c *Connection) ([]uint8, error) {
+	c.setReadDeadline()
+	nb, e := c.rdr.ReadByte()
+	if c.checkReadError(e) != nil {
+		return NULLBUFF, e
+	}
+	if nb != 0 {
+		c.log("BAD CONTENT-LENGTH", 0, nb)
+		return NULLBUFF, EBADCLEN
+	}
+	return NULLBUFF, nil
+}
+
 /*
 	A network helper.  Read a full message body with a known length that is
 	> 0.  Then read the trailing 'null' byte expected for STOMP frames.
@@ -81,17 +100,53 @@ func readBody(c *Connection, l int) ([]uint8, error) {
 		return b, e
 	}
 	c.setReadDeadline()
-	_, _ = c.rdr.ReadByte()         // trailing NUL
+	nb, e := c.rdr.ReadByte()       // trailing NUL
 	if c.checkReadError(e) != nil { // Other erors
 		return b, e
 	}
+	if e == nil && nb != 0 { // Declared content-length does not match body
+		c.log("BAD CONTENT-LENGTH", l, nb)
+		return b, EBADCLEN
+	}
 	return b, e
 }
 
 /*
-	Common Header Validation.
+	SetAllowEmptyHeaderValues sets whether empty header values are allowed
+	at protocol level 1.0.  Levels 1.1 and 1.2 always allow empty values, as
+	the specifications permit them.  By default 1.0 rejects them with
+	EHDRMTV, on both sent and received frames.  Set true for a 1.0 broker
+	that sends or requires empty valued headers.  Empty header keys are
+	always rejected with EHDRMTK.
+*/
+func (c *Connection) SetAllowEmptyHeaderValues(a bool) {
+	var v int32
+	if a {
+		v = 1
+	}
+	atomic.StoreInt32(&c.aehv, v)
+}
+
+/*
+	Header validation for this connection's protocol level and empty value
+	setting.
+*/
+func (c *Connection) validateHeaders(h Headers) error {
+	return checkHeadersEmpty(h, c.Protocol(), atomic.LoadInt32(&c.aehv) == 1)
+}
+
+/*
+	Common Header Validation.  Empty keys are always an error, empty values
+	are an error at level 1.0 only.
 */
 func checkHeaders(h Headers, p string) error {
+	return checkHeadersEmpty(h, p, false)
+}
+
+/*
+	Header validation, ae true allows empty values at level 1.0.
+*/
+func checkHeadersEmpty(h Headers, p string, ae bool) error {
 	if h == nil {
 		return EHDRNIL
 	}
@@ -104,7 +159,7 @@ func checkHeaders(h Headers, p string) error {
 		if h[i] == "" {
 			return EHDRMTK
 		}
-		if p == SPL_10 && h[i+1] == "" {
+		if p == SPL_10 && !ae && h[i+1] == "" {
 			return EHDRMTV
 		}
 	}
@@ -145,3 +200,14 @@ func dumpmd(md MessageData) {
 		fmt.Println("Error: nil")
 	}
 }
+
+/*
+	Decode a received header value for internal use when raw headers are
+	being delivered.
+*/
+func (c *Connection) decodedValue(v string) string {
+	if c.copts.rawh && c.Protocol() != SPL_10 {
+		return decode(v)
+	}
+	return v
+}
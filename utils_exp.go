@@ -69,8 +69,46 @@ func Supported(v string) bool {
 }
 
 /*
-	Protocols returns a slice of client supported protocol levels.
+	IsProtocolSupported checks if a particular STOMP version is supported in
+	the current implementation.  It is the same as Supported.
+*/
+func IsProtocolSupported(v string) bool {
+	return Supported(v)
+}
+
+/*
+	Protocols returns a slice of client supported protocol levels, lowest
+	first.  The slice is a copy.
 */
 func Protocols() []string {
-	return supported
+	return SupportedProtocols()
+}
+
+/*
+	SupportedProtocols returns a slice of client supported protocol levels,
+	lowest first.  The slice is a copy, and may be modified by the caller.
+
+	Example:
+		for _, v := range stompngo.SupportedProtocols() {
+			fmt.Println(v)
+		}
+*/
+func SupportedProtocols() []string {
+	r := make([]string, len(supported))
+	copy(r, supported)
+	return r
+}
+
+/*
+	ValidAckMode checks if an ack mode is legal for SUBSCRIBE at a particular
+	STOMP protocol level.  The "client-individual" mode requires STOMP 1.1+.
+*/
+func ValidAckMode(mode, protocol string) bool {
+	switch protocol {
+	case SPL_10:
+		return validAckModes10[mode]
+	case SPL_11, SPL_12:
+		return validAckModes10[mode] || validAckModes1x[mode]
+	}
+	return false
 }
@@ -17,13 +17,18 @@
 package stompngo
 
 import (
+	"bufio"
 	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"os"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 	//
 	"github.com/gmallard/stompngo/senv"
 )
@@ -284,3 +289,341 @@ func checkDupeHeaders(ms, wh Headers) error {
 	}
 	return nil
 }
+
+/*
+   Test helper.  Open an in memory connection to a scripted fake broker.  The
+   fake broker reads the CONNECT frame, and answers with the supplied raw
+   response frame.  All subsequent client frames are made available on the
+   fake broker's frames channel.
+*/
+func openFakeConn(t *testing.T, resp string) (net.Conn, *fakeBroker) {
+	cn, sn := net.Pipe()
+	return cn, newFakeBroker(sn, resp)
+}
+
+/*
+   Test helper.  Open an in memory connection to a broker that answers the
+   CONNECT frame with the supplied raw response frame, and then discards
+   everything, e.g. for benchmarks.
+*/
+func openDiscardConn(resp string) net.Conn {
+	cn, sn := net.Pipe()
+	go func() {
+		r := bufio.NewReader(sn)
+		if _, e := r.ReadBytes(0); e != nil {
+			return
+		}
+		if _, e := io.WriteString(sn, resp); e != nil {
+			return
+		}
+		_, _ = io.Copy(ioutil.Discard, r)
+	}()
+	return cn
+}
+
+/*
+   Test helper.  Listen on a real network, and start a fake broker for the
+   first connection accepted.  The test is skipped if the network is not
+   available.
+*/
+func listenFakeBroker(t *testing.T, network, addr string) (net.Listener,
+	<-chan *fakeBroker) {
+	l, e := net.Listen(network, addr)
+	if e != nil {
+		t.Skipf("listenFakeBroker %s %s not available <%v>\n", network, addr, e)
+	}
+	fbc := make(chan *fakeBroker, 1)
+	go func() {
+		sn, e := l.Accept()
+		if e != nil {
+			close(fbc)
+			return
+		}
+		fbc <- newFakeBroker(sn, fakeConnected12)
+	}()
+	return l, fbc
+}
+
+/*
+   Test helper.  Start a fake broker on the server side of a network
+   connection.
+*/
+func newFakeBroker(sn net.Conn, resp string) *fakeBroker {
+	fb := &fakeBroker{sn: sn, rdr: bufio.NewReader(sn),
+		frames: make(chan Frame, 64), arcpt: true, done: make(chan struct{})}
+	go fb.run(resp)
+	return fb
+}
+
+/*
+   Test helper.  Fake broker main loop.
+*/
+func (fb *fakeBroker) run(resp string) {
+	defer close(fb.done)
+	f, e := fb.readFrame()
+	if e != nil {
+		return
+	}
+	fb.frames <- f
+	if resp != "" {
+		if fb.write(resp) != nil {
+			return
+		}
+	}
+	for {
+		f, e = fb.readFrame()
+		if e != nil {
+			return
+		}
+		fb.frames <- f
+		if r, ok := f.Headers.Contains(HK_RECEIPT); ok && fb.autoReceipt() {
+			if fb.write(RECEIPT+"\n"+HK_RECEIPT_ID+":"+r+"\n\n\x00") != nil {
+				return
+			}
+		}
+	}
+}
+
+/*
+   Test helper.  Fake broker automatic receipt setting.
+*/
+func (fb *fakeBroker) setAutoReceipt(b bool) {
+	fb.wlk.Lock()
+	fb.arcpt = b
+	fb.wlk.Unlock()
+}
+
+func (fb *fakeBroker) autoReceipt() bool {
+	fb.wlk.Lock()
+	defer fb.wlk.Unlock()
+	return fb.arcpt
+}
+
+/*
+   Test helper.  Fake broker raw write.
+*/
+func (fb *fakeBroker) write(s string) error {
+	fb.wlk.Lock()
+	defer fb.wlk.Unlock()
+	_, e := io.WriteString(fb.sn, s)
+	return e
+}
+
+/*
+   Test helper.  Fake broker frame read.  Heartbeats are skipped.
+*/
+func (fb *fakeBroker) readFrame() (Frame, error) {
+	f := Frame{"", Headers{}, NULLBUFF}
+	for f.Command == "" {
+		s, e := fb.rdr.ReadString('\n')
+		if e != nil {
+			return f, e
+		}
+		f.Command = strings.TrimSuffix(s, "\n")
+	}
+	for {
+		s, e := fb.rdr.ReadString('\n')
+		if e != nil {
+			return f, e
+		}
+		if s == "\n" {
+			break
+		}
+		p := strings.SplitN(strings.TrimSuffix(s, "\n"), ":", 2)
+		if len(p) != 2 {
+			return f, EUNKHDR
+		}
+		f.Headers = append(f.Headers, p[0], p[1])
+	}
+	if v, ok := f.Headers.Contains(HK_CONTENT_LENGTH); ok {
+		l, e := strconv.Atoi(v)
+		if e != nil {
+			return f, e
+		}
+		f.Body = make([]byte, l+1)
+		if _, e = io.ReadFull(fb.rdr, f.Body); e != nil {
+			return f, e
+		}
+		f.Body = f.Body[:l]
+		return f, nil
+	}
+	b, e := fb.rdr.ReadBytes(0)
+	if e != nil {
+		return f, e
+	}
+	f.Body = b[:len(b)-1]
+	return f, nil
+}
+
+/*
+   Test helper.  Get the next frame the fake broker received.
+*/
+func (fb *fakeBroker) nextFrame(t *testing.T) Frame {
+	select {
+	case f := <-fb.frames:
+		return f
+	case <-time.After(5 * time.Second):
+		debug.PrintStack()
+		t.Fatalf("fake broker: no frame received\n")
+	}
+	return Frame{}
+}
+
+/*
+   Test helper.  Shut down a fake broker.
+*/
+func (fb *fakeBroker) close() {
+	_ = fb.sn.Close()
+	<-fb.done
+}
+
+/*
+   Test helper.  A net.Conn that performs one short write, with a timeout
+   error, once armed.
+*/
+func (sc *shortConn) arm() {
+	sc.lk.Lock()
+	sc.armed = true
+	sc.lk.Unlock()
+}
+
+func (sc *shortConn) Write(b []byte) (int, error) {
+	sc.lk.Lock()
+	armed := sc.armed && len(b) > sc.chunk
+	if armed {
+		sc.armed = false
+	}
+	sc.lk.Unlock()
+	if !armed {
+		return sc.Conn.Write(b)
+	}
+	n, e := sc.Conn.Write(b[:sc.chunk])
+	if e != nil {
+		return n, e
+	}
+	return n, timeoutError{}
+}
+
+/*
+   Test helper.  A net.Conn with slow writes, which honor write deadlines.
+*/
+func (sc *slowConn) setDelay(d time.Duration) {
+	sc.lk.Lock()
+	sc.delay = d
+	sc.lk.Unlock()
+}
+
+func (sc *slowConn) SetWriteDeadline(t time.Time) error {
+	sc.lk.Lock()
+	sc.dl = t
+	sc.lk.Unlock()
+	return sc.Conn.SetWriteDeadline(t)
+}
+
+func (sc *slowConn) Write(b []byte) (int, error) {
+	sc.lk.Lock()
+	d, dl := sc.delay, sc.dl
+	sc.lk.Unlock()
+	time.Sleep(d)
+	if !dl.IsZero() && time.Now().After(dl) {
+		return 0, timeoutError{}
+	}
+	return sc.Conn.Write(b)
+}
+
+func (timeoutError) Error() string   { return "test i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+/*
+   Test helper.  Ordered send tickets issued so far.
+*/
+func (s *sendSequencer) issued() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next
+}
+
+/*
+   Test helper.  A FrameCodec speaking plain STOMP, with no header encoding
+   and no content-length.  Written frames are marked with a header, and
+   read frames are counted and marked.
+*/
+func (tc *testCodec) WriteFrame(w *bufio.Writer, f Frame) error {
+	tc.lk.Lock()
+	tc.nw++
+	tc.lk.Unlock()
+	s := f.Command + "\n" + frameCodecHeader + ":w\n"
+	for i := 0; i < len(f.Headers); i += 2 {
+		s += f.Headers[i] + ":" + f.Headers[i+1] + "\n"
+	}
+	if _, e := w.WriteString(s + "\n"); e != nil {
+		return e
+	}
+	if _, e := w.Write(f.Body); e != nil {
+		return e
+	}
+	return w.WriteByte(0)
+}
+
+func (tc *testCodec) ReadFrame(r *bufio.Reader) (Frame, error) {
+	f := Frame{"", Headers{}, NULLBUFF}
+	s, e := r.ReadString('\n')
+	if e != nil {
+		return f, e
+	}
+	f.Command = strings.TrimSuffix(s, "\n")
+	if f.Command == "" {
+		return f, nil
+	}
+	for {
+		s, e = r.ReadString('\n')
+		if e != nil {
+			return f, e
+		}
+		if s == "\n" {
+			break
+		}
+		p := strings.SplitN(strings.TrimSuffix(s, "\n"), ":", 2)
+		if len(p) != 2 {
+			return f, EUNKHDR
+		}
+		f.Headers = append(f.Headers, p[0], p[1])
+	}
+	b, e := r.ReadBytes(0)
+	if e != nil {
+		return f, e
+	}
+	f.Body = b[:len(b)-1]
+	f.Headers = append(f.Headers, frameCodecHeader, "r")
+	tc.lk.Lock()
+	tc.nr++
+	tc.lk.Unlock()
+	return f, nil
+}
+
+func (tc *testCodec) counts() (int, int) {
+	tc.lk.Lock()
+	defer tc.lk.Unlock()
+	return tc.nr, tc.nw
+}
+
+/*
+   Test helper.  Check the subscription map invariants: each entry is keyed
+   by its id, and is still open for delivery while connected.
+*/
+func (c *Connection) subsInvariant() error {
+	c.subsLock.RLock()
+	defer c.subsLock.RUnlock()
+	for k, ps := range c.subs {
+		switch {
+		case k != ps.id:
+			return fmt.Errorf("subscription key %q has id %q", k, ps.id)
+		case ps.qcd && !ps.cs:
+			return fmt.Errorf("subscription %q unsubscribed, still mapped", k)
+		case ps.cs && c.Connected():
+			return fmt.Errorf("subscription %q closed, still mapped", k)
+		}
+	}
+	return nil
+}
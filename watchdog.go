@@ -0,0 +1,75 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+/*
+	SetReadWatchdog starts a watchdog that forcibly closes the network
+	connection if nothing at all (frames or heart beats) is read from the
+	broker for the duration d.  The connection reader then fails, and all
+	MessageData channels receive the read error, just as for any other
+	network failure.
+
+	This detects half open connections, where a wedged broker leaves reads
+	hanging.  It complements, and does not replace, heart beat receive
+	checking.  With heart beats a reasonable value for d is a small multiple
+	of ReceiveTickerInterval().
+
+	A duration of zero stops any running watchdog.
+
+	Example:
+		c.SetReadWatchdog(3 * time.Duration(c.ReceiveTickerInterval()) * time.Millisecond)
+*/
+func (c *Connection) SetReadWatchdog(d time.Duration) {
+	c.wdLock.Lock()
+	defer c.wdLock.Unlock()
+	if c.wdsd != nil {
+		close(c.wdsd)
+		c.wdsd = nil
+	}
+	c.wdd = d
+	if d <= 0 {
+		return
+	}
+	c.log("Read Watchdog", d)
+	c.wdsd = make(chan struct{})
+	go c.readWatchdog(d, c.wdsd)
+}
+
+/*
+	The read watchdog.
+*/
+func (c *Connection) readWatchdog(d time.Duration, sd chan struct{}) {
+	st := c.monoNanos() // Watchdog start
+	c.checkLoop(d, sd, func(now int64) bool {
+		lr := atomic.LoadInt64(&c.lrt)
+		if lr < st {
+			lr = st
+		}
+		if now-lr > int64(d) {
+			c.log("Read Watchdog expired, closing network connection", d)
+			_ = c.netconn.Close()
+			return true
+		}
+		return false
+	})
+	c.log("Read Watchdog Ends", time.Now())
+}
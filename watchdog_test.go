@@ -0,0 +1,90 @@
+//
+// Copyright © 2017 Guy M. Allard
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package stompngo
+
+import (
+	"testing"
+	"time"
+)
+
+/*
+	Watchdog Test: a silent broker trips the read watchdog.
+*/
+func TestWatchdogSilentBroker(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestWatchdogSilentBroker Expected nil, got <%v>\n", e)
+	}
+	c.SetReadWatchdog(100 * time.Millisecond)
+	select {
+	case md := <-c.MessageData:
+		if md.Error == nil {
+			t.Fatalf("TestWatchdogSilentBroker Expected read error, got <%v>\n", md)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestWatchdogSilentBroker watchdog did not fire\n")
+	}
+	fb.close()
+}
+
+/*
+	Watchdog Test: read activity keeps the watchdog quiet.
+*/
+func TestWatchdogActiveBroker(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestWatchdogActiveBroker Expected nil, got <%v>\n", e)
+	}
+	c.SetReadWatchdog(200 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		time.Sleep(50 * time.Millisecond)
+		_ = fb.write("\n") // Heart beat
+	}
+	select {
+	case md := <-c.MessageData:
+		t.Fatalf("TestWatchdogActiveBroker Unexpected data <%v>\n", md)
+	default:
+	}
+	c.SetReadWatchdog(0)
+	e = c.Disconnect(empty_headers)
+	checkDisconnectError(t, e)
+	_ = nc.Close()
+	fb.close()
+}
+
+/*
+	Watchdog Test: a tiny duration does not panic, and trips the watchdog.
+*/
+func TestWatchdogTinyDuration(t *testing.T) {
+	nc, fb := openFakeConn(t, fakeConnected12)
+	c, e := Connect(nc, fake12Headers)
+	if e != nil {
+		t.Fatalf("TestWatchdogTinyDuration Expected nil, got <%v>\n", e)
+	}
+	c.SetReadWatchdog(time.Nanosecond)
+	select {
+	case md := <-c.MessageData:
+		if md.Error == nil {
+			t.Fatalf("TestWatchdogTinyDuration Expected read error, got <%v>\n", md)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("TestWatchdogTinyDuration watchdog did not fire\n")
+	}
+	fb.close()
+}
@@ -22,6 +22,7 @@ import (
 	"net"
 	// "bytes"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -49,11 +50,65 @@ writerLoop:
 			break writerLoop
 		}
 	} // of for
-	//
-	c.connected = false
+	// Fail anything still queued, then release any later senders.
+drainLoop:
+	for {
+		select {
+		case d := <-c.output:
+			d.errchan <- ECONBAD
+		default:
+			break drainLoop
+		}
+	}
+	close(c.wtrdc)
 	c.log("WTR_SHUTDOWN", time.Now())
 }
 
+/*
+	Queue a frame for the writer, and wait for the write result, with an
+	optional one off write deadline.  ECONBAD is returned, rather than
+	blocking, once the writer has exited.
+*/
+func (c *Connection) wireSend(f Frame, d time.Duration) error {
+	r, e := c.wireQueue(f, d)
+	if e != nil {
+		return e
+	}
+	return c.wireResult(r)
+}
+
+/*
+	Queue a frame for the writer, without waiting for the write result.  The
+	returned channel is buffered, so the writer never blocks on it.
+*/
+func (c *Connection) wireQueue(f Frame, d time.Duration) (chan error, error) {
+	r := make(chan error, 1)
+	select {
+	case c.output <- wiredata{f, r, d}:
+		return r, nil
+	case _ = <-c.wtrdc:
+		return nil, ECONBAD
+	}
+}
+
+/*
+	Wait for the write result of a queued frame.  ECONBAD is returned if the
+	writer exits without reporting a result.
+*/
+func (c *Connection) wireResult(r chan error) error {
+	select {
+	case e := <-r:
+		return e
+	case _ = <-c.wtrdc:
+		select {
+		case e := <-r:
+			return e
+		default:
+			return ECONBAD
+		}
+	}
+}
+
 /*
 	Connection logical write.
 */
@@ -62,9 +117,7 @@ func (c *Connection) wireWrite(d wiredata) {
 	// fmt.Printf("WWD01 f:[%v]\n", f)
 	switch f.Command {
 	case "\n": // HeartBeat frame
-		if c.dld.wde && c.dld.wds {
-			_ = c.netconn.SetWriteDeadline(time.Now().Add(c.dld.wdld))
-		}
+		c.setWriteDeadline()
 		_, e := c.wtr.WriteString(f.Command)
 		if e != nil {
 			if e.(net.Error).Timeout() {
@@ -76,14 +129,22 @@ func (c *Connection) wireWrite(d wiredata) {
 			return
 		}
 	default: // Other frames
-		if e := f.writeFrame(c.wtr, c); e != nil {
+		c.dld.owd = d.wdld // Any one off write deadline, this frame only
+		defer func() { c.dld.owd = 0 }()
+		if e := c.writeWireFrame(f); e != nil {
 			d.errchan <- e
 			return
 		}
-		if e := c.wtr.Flush(); e != nil {
+		c.setWriteDeadline()
+		e := c.wtr.Flush()
+		if c.writeDeadlineActive() {
+			_ = c.netconn.SetWriteDeadline(c.dld.t0)
+		}
+		if c.checkWriteError(e) != nil {
 			d.errchan <- e
 			return
 		}
+		c.updateActivity()
 	}
 	if e := c.wtr.Flush(); e != nil {
 		d.errchan <- e
@@ -92,11 +153,14 @@ func (c *Connection) wireWrite(d wiredata) {
 	//
 	if c.hbd != nil {
 		c.hbd.sdl.Lock()
-		c.hbd.ls = time.Now().UnixNano() // Latest good send
+		c.hbd.ls = c.monoNanos() // Latest good send
 		c.hbd.sdl.Unlock()
 	}
-	c.mets.tfw++                // Frame written count
-	c.mets.tbw += f.Size(false) // Bytes written count
+	atomic.AddInt64(&c.mets.tfw, 1)             // Frame written count
+	atomic.AddInt64(&c.mets.tbw, f.Size(false)) // Bytes written count
+	if f.Command != "\n" {
+		c.countFrameSize(DirectionWrite, f.Size(false))
+	}
 	//
 	d.errchan <- nil
 	return
@@ -111,10 +175,11 @@ func (f *Frame) writeFrame(w *bufio.Writer, c *Connection) error {
 	// Content type.  Always add it if the client does not suppress and does not
 	// supply it.
 	_, sctok = f.Headers.Contains(HK_SUPPRESS_CT)
-	if !sctok {
+	if !sctok && !c.suppressContentType() {
 		if _, ctok := f.Headers.Contains(HK_CONTENT_TYPE); !ctok {
-			f.Headers = append(f.Headers, HK_CONTENT_TYPE,
-				DFLT_CONTENT_TYPE)
+			if ct := c.defaultContentType(); ct != "" {
+				f.Headers = append(f.Headers, HK_CONTENT_TYPE, ct)
+			}
 		}
 	}
 
@@ -127,12 +192,19 @@ func (f *Frame) writeFrame(w *bufio.Writer, c *Connection) error {
 			f.Headers = append(f.Headers, HK_CONTENT_LENGTH, strconv.Itoa(len(f.Body)))
 		}
 	}
-	// Encode the headers if needed
+	// Encode the headers if needed.  Copied on the first change, the
+	// Headers may be shared with the caller, see SendBytesNoClone.
 	if c.Protocol() > SPL_10 && f.Command != CONNECT {
-		for i := 0; i < len(f.Headers); i += 2 {
-			f.Headers[i] = encode(f.Headers[i])
-			f.Headers[i+1] = encode(f.Headers[i+1])
+		eh, cp := f.Headers, false
+		for i := 0; i < len(eh); i++ {
+			if ev := encode(eh[i]); ev != eh[i] {
+				if !cp {
+					eh, cp = eh.Clone(), true
+				}
+				eh[i] = ev
+			}
 		}
+		f.Headers = eh
 	}
 
 	if sclok {
@@ -147,9 +219,7 @@ func (f *Frame) writeFrame(w *bufio.Writer, c *Connection) error {
 		}
 	}
 
-	if c.dld.wde && c.dld.wds {
-		_ = c.netconn.SetWriteDeadline(time.Now().Add(c.dld.wdld))
-	}
+	c.setWriteDeadline()
 
 	// Writes start
 
@@ -161,9 +231,7 @@ func (f *Frame) writeFrame(w *bufio.Writer, c *Connection) error {
 	// fmt.Println("WRCMD", f.Command)
 	// Write the frame Headers
 	for i := 0; i < len(f.Headers); i += 2 {
-		if c.dld.wde && c.dld.wds {
-			_ = c.netconn.SetWriteDeadline(time.Now().Add(c.dld.wdld))
-		}
+		c.setWriteDeadline()
 		_, e := w.WriteString(f.Headers[i] + ":" + f.Headers[i+1] + "\n")
 		if c.checkWriteError(e) != nil {
 			return e
@@ -172,9 +240,7 @@ func (f *Frame) writeFrame(w *bufio.Writer, c *Connection) error {
 	}
 
 	// Write the last Header LF
-	if c.dld.wde && c.dld.wds {
-		_ = c.netconn.SetWriteDeadline(time.Now().Add(c.dld.wdld))
-	}
+	c.setWriteDeadline()
 	e = w.WriteByte('\n')
 	if c.checkWriteError(e) != nil {
 		return e
@@ -189,20 +255,38 @@ func (f *Frame) writeFrame(w *bufio.Writer, c *Connection) error {
 			return e
 		}
 	}
-	if c.dld.wde && c.dld.wds {
-		_ = c.netconn.SetWriteDeadline(time.Now().Add(c.dld.wdld))
-	}
+	c.setWriteDeadline()
 	e = w.WriteByte(0)
 	if c.checkWriteError(e) != nil {
 		return e
 	}
 	// End of write loop - set no deadline
-	if c.dld.wde {
+	if c.dld.wde || c.dld.owd > 0 {
 		_ = c.netconn.SetWriteDeadline(c.dld.t0)
 	}
 	return nil
 }
 
+/*
+	Set the write deadline for the next network write, if any.  A one off
+	frame deadline takes precedence over the connection default.
+*/
+func (c *Connection) setWriteDeadline() {
+	switch {
+	case c.dld.owd > 0:
+		_ = c.netconn.SetWriteDeadline(time.Now().Add(c.dld.owd))
+	case c.dld.wde && c.dld.wds:
+		_ = c.netconn.SetWriteDeadline(time.Now().Add(c.dld.wdld))
+	}
+}
+
+/*
+	True if network writes currently have a deadline.
+*/
+func (c *Connection) writeDeadlineActive() bool {
+	return c.dld.owd > 0 || (c.dld.wde && c.dld.wds)
+}
+
 func (c *Connection) checkWriteError(e error) error {
 	if e == nil {
 		return e
@@ -222,32 +306,46 @@ func (c *Connection) checkWriteError(e error) error {
 
 func (c *Connection) writeBody(f *Frame) error {
 	// fmt.Printf("WDBG99 body:%v bodystring: %v\n", f.Body, string(f.Body))
+	if !c.dld.rfsw {
+		c.setWriteDeadline()
+		n, e := c.wtr.Write(f.Body)
+		if n != len(f.Body) {
+			c.log("SHORT WRITE", n, len(f.Body))
+			atomic.AddInt64(&c.swc, 1)
+		}
+		return e
+	}
+	// Short write recovery.  Flush what is already buffered, and write the
+	// body directly to the network connection.  The byte count of any
+	// partial write is then exact, and retrying from that point is safe.
+	// *Any* error from a bufio.Writer is *not* recoverable.  See code in
+	// bufio.go to understand this.
+	if e := c.wtr.Flush(); e != nil {
+		return e
+	}
 	var n = 0
 	var e error
+	t := len(f.Body)
+	b := f.Body
 	for {
-		if c.dld.wde && c.dld.wds {
-			_ = c.netconn.SetWriteDeadline(time.Now().Add(c.dld.wdld))
-		}
-		n, e = c.wtr.Write(f.Body)
-		if n == len(f.Body) {
+		c.setWriteDeadline()
+		n, e = c.netconn.Write(b)
+		if n == len(b) {
 			return e
 		}
-		c.log("SHORT WRITE", n, len(f.Body))
+		c.log("SHORT WRITE", n, len(b))
+		atomic.AddInt64(&c.swc, 1)
 		if n == 0 { // Zero bytes would mean something is seriously wrong.
 			return e
 		}
-		if !c.dld.rfsw {
-			return e
-		}
-		if c.dld.wde && c.dld.wds && c.dld.dns && isErrorTimeout(e) {
+		if c.writeDeadlineActive() && c.dld.dns && isErrorTimeout(e) {
 			c.log("invoking write deadline callback 2")
 			c.dld.dlnotify(e, true)
 		}
-		// *Any* error from a bufio.Writer is *not* recoverable.  See code in
-		// bufio.go to understand this.  We get a new writer here, to clear any
-		// error condition.
-		c.wtr = bufio.NewWriter(c.netconn) // Create new writer
-		f.Body = f.Body[n:]
+		b = b[n:]
+		if swf := c.shortWriteHandler(); swf != nil {
+			swf(t-len(b), t)
+		}
 	}
 }
 